@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func runAudit(args []string) {
+	if len(args) < 1 {
+		printAuditUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		runAuditList(args[1:])
+	case "help", "-h", "--help":
+		printAuditUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown audit subcommand: %s\n\n", args[0])
+		printAuditUsage()
+		os.Exit(1)
+	}
+}
+
+func printAuditUsage() {
+	fmt.Println(`Usage: majordomo audit <subcommand> [options]
+
+Subcommands:
+  list    List audit events, newest first
+
+Run 'majordomo audit <subcommand> --help' for more information.`)
+}
+
+func runAuditList(args []string) {
+	fs := flag.NewFlagSet("audit list", flag.ExitOnError)
+	from := fs.String("from", "", "Only events at or after this time (RFC 3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "Only events before this time (RFC 3339 or YYYY-MM-DD)")
+	actorType := fs.String("actor-type", "", "Only events by this kind of actor: user, api_key or cli")
+	actorID := fs.String("actor-id", "", "Only events by this user or API key ID")
+	action := fs.String("action", "", "Only this action, such as api_key.revoke")
+	targetType := fs.String("target-type", "", "Only events on this kind of target, such as user")
+	targetID := fs.String("target-id", "", "Only events on this target ID")
+	limit := fs.Int("limit", storage.DefaultAuditLimit, "Maximum number of events")
+	verbose := fs.Bool("v", false, "Show the before and after state of each event")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	q := &models.AuditQuery{
+		ActorType:  *actorType,
+		Action:     *action,
+		TargetType: *targetType,
+		TargetID:   *targetID,
+		Limit:      *limit,
+	}
+	q.From = parseAuditTime("--from", *from)
+	q.To = parseAuditTime("--to", *to)
+	if *actorID != "" {
+		id, err := uuid.Parse(*actorID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --actor-id: %v\n", err)
+			os.Exit(1)
+		}
+		q.ActorID = &id
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	events, err := store.ListAuditEvents(context.Background(), q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing audit events: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No audit events found.")
+		return
+	}
+
+	if *verbose {
+		for _, e := range events {
+			fmt.Printf("%s  %s:%s  %s  %s:%s  %s\n",
+				e.OccurredAt.Local().Format(time.RFC3339),
+				e.ActorType, e.ActorName, e.Action,
+				e.TargetType, e.TargetID, auditSource(e))
+			if len(e.Before) > 0 {
+				fmt.Printf("    before: %s\n", e.Before)
+			}
+			if len(e.After) > 0 {
+				fmt.Printf("    after:  %s\n", e.After)
+			}
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tACTION\tTARGET\tSOURCE")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s:%s\t%s\t%s:%s\t%s\n",
+			e.OccurredAt.Local().Format(time.RFC3339),
+			e.ActorType, e.ActorName, e.Action,
+			e.TargetType, e.TargetID, auditSource(e))
+	}
+	w.Flush()
+}
+
+func auditSource(e *models.AuditEvent) string {
+	if e.SourceIP == nil {
+		return "-"
+	}
+	return *e.SourceIP
+}
+
+func parseAuditTime(flagName, v string) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid %s %q (expected RFC 3339 or YYYY-MM-DD)\n", flagName, v)
+		os.Exit(1)
+	}
+	return t
+}
+
+// recordAudit writes an audit event for a CLI command. The actor is the
+// operating system user running the command. The change has already been
+// made, so a failure is only reported.
+func recordAudit(ctx context.Context, store storage.AuditStorage, action, targetType, targetID string, before, after interface{}) {
+	err := audit.NewRecorder(store).Write(ctx, audit.Event{
+		Actor:      audit.Actor{Type: models.AuditActorCLI, Name: cliUsername()},
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit event: %v\n", err)
+	}
+}
+
+// cliUsername returns the name of the operating system user running the CLI
+func cliUsername() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
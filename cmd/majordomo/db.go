@@ -5,30 +5,36 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	"github.com/superset-studio/majordomo-gateway/internal/config"
 	"github.com/superset-studio/majordomo-gateway/internal/storage"
 )
 
-// connectDB creates a PostgresStorage connection using the config.
+// connectDB opens the configured storage backend for CLI commands.
 // It loads .env and config file, then connects to the database.
-// For CLI commands that don't need HLL/cache, pass nil for storageConfig.
-func connectDB(configPath string, storageConfig *storage.PostgresStorageConfig) *storage.PostgresStorage {
-	// Load .env file if present
-	_ = godotenv.Load()
+func connectDB(configPath string) storage.Backend {
+	cfg := loadConfig(configPath)
 
-	cfg, err := config.Load(configPath)
+	store, err := openStorage(context.Background(), cfg, false)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	return store
+}
+
+// connectPostgres is connectDB for commands that only exist for Postgres,
+// such as partition maintenance and rollup rebuilds.
+func connectPostgres(configPath, command string) *storage.PostgresStorage {
+	cfg := loadConfig(configPath)
+	if storageDriver(cfg) != storage.DriverPostgres {
+		fmt.Fprintf(os.Stderr, "Error: '%s' requires storage.driver: postgres\n", command)
 		os.Exit(1)
 	}
 
-	store, err := storage.NewPostgresStorage(
-		context.Background(),
-		cfg.Storage.Postgres.DSN(),
-		cfg.Storage.Postgres.MaxConns,
-		storageConfig,
-	)
+	store, err := storage.NewPostgresStorage(context.Background(), cfg.Storage.Postgres.DSN(), cfg.Storage.Postgres.MaxConns, nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error connecting to database: %v\n", err)
 		os.Exit(1)
@@ -37,6 +43,76 @@ func connectDB(configPath string, storageConfig *storage.PostgresStorageConfig)
 	return store
 }
 
+// openStorage creates the storage backend selected by storage.driver. The
+// Postgres request log writer only uses the configured writer settings (and
+// spill directory) when serving; CLI commands use the defaults.
+func openStorage(ctx context.Context, cfg *config.Config, serving bool) (storage.Backend, error) {
+	switch driver := storageDriver(cfg); driver {
+	case storage.DriverPostgres:
+		var pgConfig *storage.PostgresStorageConfig
+		if serving {
+			pgConfig = &storage.PostgresStorageConfig{
+				HLLFlushInterval:   cfg.Metadata.HLLFlushInterval,
+				ActiveKeysCacheTTL: cfg.Metadata.ActiveKeysCacheTTL,
+				BufferSize:         cfg.Storage.Writer.BufferSize,
+				BatchSize:          cfg.Storage.Writer.BatchSize,
+				FlushInterval:      cfg.Storage.Writer.FlushInterval,
+				SpillDir:           cfg.Storage.Writer.SpillDir,
+				SpillMaxBytes:      cfg.Storage.Writer.SpillMaxBytes,
+				ReplayInterval:     cfg.Storage.Writer.ReplayInterval,
+			}
+		}
+		store, err := storage.NewPostgresStorage(ctx, cfg.Storage.Postgres.DSN(), cfg.Storage.Postgres.MaxConns, pgConfig)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case storage.DriverSQLite:
+		store, err := storage.NewSQLiteStorage(ctx, &storage.SQLiteStorageConfig{
+			Path:               cfg.Storage.SQLite.Path,
+			HLLFlushInterval:   cfg.Metadata.HLLFlushInterval,
+			ActiveKeysCacheTTL: cfg.Metadata.ActiveKeysCacheTTL,
+			BufferSize:         cfg.Storage.Writer.BufferSize,
+			BatchSize:          cfg.Storage.Writer.BatchSize,
+			FlushInterval:      cfg.Storage.Writer.FlushInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", storage.ErrUnknownDriver, driver)
+	}
+}
+
+// openDB opens a plain database connection for commands that only run SQL,
+// such as migrations, without starting the request log writer.
+func openDB(cfg *config.Config) *sqlx.DB {
+	var db *sqlx.DB
+	var err error
+	switch driver := storageDriver(cfg); driver {
+	case storage.DriverPostgres:
+		db, err = storage.OpenPostgres(context.Background(), cfg.Storage.Postgres.DSN(), cfg.Storage.Postgres.MaxConns)
+	case storage.DriverSQLite:
+		db, err = storage.OpenSQLite(context.Background(), cfg.Storage.SQLite.Path)
+	default:
+		err = fmt.Errorf("%w: %q", storage.ErrUnknownDriver, driver)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	return db
+}
+
+// storageDriver returns the configured storage driver, defaulting to Postgres.
+func storageDriver(cfg *config.Config) string {
+	if cfg.Storage.Driver == "" {
+		return storage.DriverPostgres
+	}
+	return cfg.Storage.Driver
+}
+
 // loadConfig loads the application configuration from the given path.
 // It loads .env file first and returns the parsed config.
 func loadConfig(configPath string) *config.Config {
@@ -56,6 +56,7 @@ func runKeysCreate(args []string) {
 	fs := flag.NewFlagSet("keys create", flag.ExitOnError)
 	name := fs.String("name", "", "Name for the API key (required)")
 	description := fs.String("description", "", "Description for the API key")
+	scopes := fs.String("scopes", models.AllScopes.String(), "Comma-separated scopes: proxy, proxy-keys:read, proxy-keys:write, usage:read")
 	configPath := fs.String("config", "", "Path to config file")
 	fs.Parse(args)
 
@@ -65,7 +66,13 @@ func runKeysCreate(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	scopeList, err := models.ParseScopes(*scopes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --scopes: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	plaintext, hash, err := auth.GenerateAPIKey()
@@ -75,22 +82,26 @@ func runKeysCreate(args []string) {
 	}
 
 	input := &models.CreateAPIKeyInput{
-		Name: *name,
+		Name:   *name,
+		Scopes: scopeList,
 	}
 	if *description != "" {
 		input.Description = description
 	}
 
-	key, err := store.CreateAPIKey(context.Background(), hash, input)
+	ctx := context.Background()
+	key, err := store.CreateAPIKey(ctx, hash, input)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating key: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(ctx, store, "api_key.create", "api_key", key.ID.String(), nil, key)
 
 	fmt.Println("API key created successfully!")
 	fmt.Println()
-	fmt.Printf("ID:   %s\n", key.ID)
-	fmt.Printf("Name: %s\n", key.Name)
+	fmt.Printf("ID:     %s\n", key.ID)
+	fmt.Printf("Name:   %s\n", key.Name)
+	fmt.Printf("Scopes: %s\n", key.Scopes)
 	fmt.Println()
 	fmt.Println("IMPORTANT: Save this key - it will not be shown again:")
 	fmt.Println()
@@ -103,7 +114,7 @@ func runKeysList(args []string) {
 	configPath := fs.String("config", "", "Path to config file")
 	fs.Parse(args)
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	keys, err := store.ListAPIKeys(context.Background())
@@ -118,14 +129,14 @@ func runKeysList(args []string) {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCREATED\tREQUESTS")
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tSCOPES\tCREATED\tREQUESTS")
 	for _, k := range keys {
 		status := "active"
 		if !k.IsActive {
 			status = "revoked"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
-			k.ID, k.Name, status,
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n",
+			k.ID, k.Name, status, k.Scopes,
 			k.CreatedAt.Format("2006-01-02"),
 			k.RequestCount)
 	}
@@ -150,7 +161,7 @@ func runKeysGet(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	key, err := store.GetAPIKeyByID(context.Background(), id)
@@ -165,6 +176,7 @@ func runKeysGet(args []string) {
 		fmt.Printf("Description:   %s\n", *key.Description)
 	}
 	fmt.Printf("Status:        %s\n", statusString(key))
+	fmt.Printf("Scopes:        %s\n", key.Scopes)
 	fmt.Printf("Created:       %s\n", key.CreatedAt.Format(time.RFC3339))
 	if key.RevokedAt != nil {
 		fmt.Printf("Revoked:       %s\n", key.RevokedAt.Format(time.RFC3339))
@@ -193,14 +205,22 @@ func runKeysRevoke(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
-	err = store.RevokeAPIKey(context.Background(), id)
+	ctx := context.Background()
+	key, err := store.GetAPIKeyByID(ctx, id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = store.RevokeAPIKey(ctx, id)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error revoking key: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(ctx, store, "api_key.revoke", "api_key", id.String(), key, nil)
 
 	fmt.Printf("API key %s has been revoked.\n", id)
 }
@@ -209,17 +229,18 @@ func runKeysUpdate(args []string) {
 	fs := flag.NewFlagSet("keys update", flag.ExitOnError)
 	name := fs.String("name", "", "New name for the API key")
 	description := fs.String("description", "", "New description")
+	scopes := fs.String("scopes", "", "New comma-separated scopes, replacing the current ones")
 	configPath := fs.String("config", "", "Path to config file")
 	fs.Parse(args)
 
 	if fs.NArg() < 1 {
 		fmt.Fprintln(os.Stderr, "Error: key ID required")
-		fmt.Fprintln(os.Stderr, "Usage: majordomo keys update <id> [--name NAME] [--description DESC]")
+		fmt.Fprintln(os.Stderr, "Usage: majordomo keys update <id> [--name NAME] [--description DESC] [--scopes SCOPES]")
 		os.Exit(1)
 	}
 
-	if *name == "" && *description == "" {
-		fmt.Fprintln(os.Stderr, "Error: at least one of --name or --description is required")
+	if *name == "" && *description == "" && *scopes == "" {
+		fmt.Fprintln(os.Stderr, "Error: at least one of --name, --description or --scopes is required")
 		os.Exit(1)
 	}
 
@@ -230,7 +251,7 @@ func runKeysUpdate(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	input := &models.UpdateAPIKeyInput{}
@@ -240,18 +261,34 @@ func runKeysUpdate(args []string) {
 	if *description != "" {
 		input.Description = description
 	}
+	if *scopes != "" {
+		input.Scopes, err = models.ParseScopes(*scopes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --scopes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	before, err := store.GetAPIKeyByID(ctx, id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	key, err := store.UpdateAPIKey(context.Background(), id, input)
+	key, err := store.UpdateAPIKey(ctx, id, input)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error updating key: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(ctx, store, "api_key.update", "api_key", key.ID.String(), before, key)
 
 	fmt.Printf("API key %s updated successfully.\n", key.ID)
 	fmt.Printf("Name: %s\n", key.Name)
 	if key.Description != nil && *key.Description != "" {
 		fmt.Printf("Description: %s\n", *key.Description)
 	}
+	fmt.Printf("Scopes: %s\n", key.Scopes)
 }
 
 func statusString(key *models.APIKey) string {
@@ -2,22 +2,35 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/superset-studio/majordomo-gateway/internal/api"
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/config"
+	"github.com/superset-studio/majordomo-gateway/internal/guardrail"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
 	"github.com/superset-studio/majordomo-gateway/internal/pricing"
+	"github.com/superset-studio/majordomo-gateway/internal/prompt"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
 	"github.com/superset-studio/majordomo-gateway/internal/proxy"
+	"github.com/superset-studio/majordomo-gateway/internal/redact"
+	"github.com/superset-studio/majordomo-gateway/internal/routing"
 	"github.com/superset-studio/majordomo-gateway/internal/secrets"
 	"github.com/superset-studio/majordomo-gateway/internal/server"
 	"github.com/superset-studio/majordomo-gateway/internal/storage"
+	"github.com/superset-studio/majordomo-gateway/internal/transform"
+	"github.com/superset-studio/majordomo-gateway/internal/upstream"
 )
 
 func main() {
@@ -35,6 +48,24 @@ func main() {
 		runProxyKeys(os.Args[2:])
 	case "users":
 		runUsers(os.Args[2:])
+	case "orgs":
+		runOrgs(os.Args[2:])
+	case "teams":
+		runTeams(os.Args[2:])
+	case "maintenance":
+		runMaintenance(os.Args[2:])
+	case "rollups":
+		runRollups(os.Args[2:])
+	case "migrate":
+		runMigrate(os.Args[2:])
+	case "secrets":
+		runSecrets(os.Args[2:])
+	case "audit":
+		runAudit(os.Args[2:])
+	case "prompts":
+		runPrompts(os.Args[2:])
+	case "replay":
+		runReplay(os.Args[2:])
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -49,9 +80,18 @@ func printUsage() {
 
 Commands:
   serve        Start the proxy server
+  migrate      Apply or roll back database migrations
   keys         Manage API keys
   proxy-keys   Manage proxy keys
   users        Manage web UI users
+  orgs         Manage organizations
+  teams        Manage teams, team members and budgets
+  maintenance  Manage partitions and apply retention policies
+  rollups      Rebuild usage rollups
+  secrets      Rotate provider key encryption
+  audit        List the audit log of administrative actions
+  prompts      Manage prompt templates
+  replay       Replay logged requests and compare the responses
 
 Run 'majordomo <command> --help' for more information.`)
 }
@@ -68,15 +108,34 @@ func runServe(args []string) {
 	cfg := loadConfig(*configPath)
 	ctx := context.Background()
 
-	store, err := storage.NewPostgresStorage(ctx, cfg.Storage.Postgres.DSN(), cfg.Storage.Postgres.MaxConns, &storage.PostgresStorageConfig{
-		HLLFlushInterval:   cfg.Metadata.HLLFlushInterval,
-		ActiveKeysCacheTTL: cfg.Metadata.ActiveKeysCacheTTL,
-	})
+	// SQLite always migrates on open; Postgres only when asked to
+	driver := storageDriver(cfg)
+	if cfg.Storage.AutoMigrate && driver == storage.DriverPostgres {
+		db := openDB(cfg)
+		migrator, err := storage.NewMigrator(db, driver)
+		if err == nil {
+			_, err = migrator.Up(ctx, 0)
+		}
+		db.Close()
+		if err != nil {
+			slog.Error("failed to apply migrations", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	store, err := openStorage(ctx, cfg, true)
 	if err != nil {
 		slog.Error("failed to connect to database", "error", err)
 		os.Exit(1)
 	}
 	defer store.Close()
+	slog.Info("storage backend ready", "driver", driver)
+
+	if current, expected, err := store.SchemaVersion(ctx); err != nil {
+		slog.Warn("failed to read schema version", "error", err)
+	} else if current < expected {
+		slog.Warn("database schema is behind, run `majordomo migrate up` or set storage.auto_migrate", "current", current, "expected", expected)
+	}
 
 	pricingSvc := pricing.NewService(
 		cfg.Pricing.RemoteURL,
@@ -88,13 +147,7 @@ func runServe(args []string) {
 
 	var s3Storage *storage.S3BodyStorage
 	if cfg.S3.Enabled {
-		s3Storage, err = storage.NewS3BodyStorage(ctx, storage.S3Config{
-			Bucket:          cfg.S3.Bucket,
-			Region:          cfg.S3.Region,
-			Endpoint:        cfg.S3.Endpoint,
-			AccessKeyID:     cfg.S3.AccessKeyID,
-			SecretAccessKey: cfg.S3.SecretAccessKey,
-		})
+		s3Storage, err = storage.NewS3BodyStorage(ctx, s3ConfigFrom(cfg))
 		if err != nil {
 			slog.Error("failed to initialize S3 storage", "error", err)
 			os.Exit(1)
@@ -103,48 +156,133 @@ func runServe(args []string) {
 		slog.Info("S3 body storage enabled", "bucket", cfg.S3.Bucket, "region", cfg.S3.Region)
 	}
 
+	if pg, ok := store.(*storage.PostgresStorage); !ok {
+		if cfg.Maintenance.Enabled {
+			slog.Warn("background maintenance requires the postgres storage driver, skipping")
+		}
+	} else if cfg.Maintenance.Enabled {
+		maintainer := storage.NewMaintainer(pg, s3Storage, maintenanceConfigFrom(cfg))
+		maintainer.Start(cfg.Maintenance.Interval)
+		defer maintainer.Stop()
+		slog.Info("background maintenance enabled", "interval", cfg.Maintenance.Interval)
+	} else if partitioned, err := pg.IsRequestLogPartitioned(ctx); err != nil {
+		slog.Warn("failed to check llm_requests partitioning", "error", err)
+	} else if !partitioned {
+		slog.Warn("llm_requests is not partitioned, partition management is disabled; see docs/data-retention.md")
+	} else {
+		// Make sure inserts land in monthly partitions even without the background job
+		if _, err := pg.EnsurePartitions(ctx, time.Now(), cfg.Maintenance.PartitionsAhead); err != nil {
+			slog.Warn("failed to create llm_requests partitions", "error", err)
+		}
+	}
+
 	resolver := auth.NewResolver(store)
 
-	// Set up proxy key support if encryption key is configured
+	// Set up proxy key support if encryption keys are configured
+	var secretStore secrets.SecretStore
 	var proxyResolver *auth.ProxyResolver
 	var apiHandler *api.Handler
-	if cfg.Secrets.EncryptionKey != "" {
-		secretStore, err := secrets.NewAESStore(cfg.Secrets.EncryptionKey)
+	if cfg.Secrets.Enabled() {
+		secretStore, err = newSecretStoreFromConfig(cfg)
 		if err != nil {
 			slog.Error("failed to initialize secret store", "error", err)
 			os.Exit(1)
 		}
 		proxyResolver = auth.NewProxyResolver(store, secretStore)
-		apiHandler = api.NewHandler(store, secretStore)
-		slog.Info("proxy key support enabled")
+		apiHandler = api.NewHandler(store, secretStore, store)
+		slog.Info("proxy key support enabled", "secrets_backend", cfg.Secrets.Backend)
+	}
+
+	configRoutes, err := modelRoutesFrom(cfg)
+	if err != nil {
+		slog.Error("invalid model route in config", "error", err)
+		os.Exit(1)
+	}
+	router := routing.NewRouter(store, store, configRoutes, cfg.Routing.RefreshInterval)
+	defer router.Close()
+
+	shadowRules, err := shadowRulesFrom(cfg)
+	if err != nil {
+		slog.Error("invalid shadow rule in config", "error", err)
+		os.Exit(1)
+	}
+
+	transforms, err := transformRulesFrom(cfg)
+	if err != nil {
+		slog.Error("invalid transform in config", "error", err)
+		os.Exit(1)
+	}
+
+	redactor, err := redactorFrom(cfg)
+	if err != nil {
+		slog.Error("invalid redaction config", "error", err)
+		os.Exit(1)
+	}
+
+	guardrails, err := guardrailsFrom(cfg)
+	if err != nil {
+		slog.Error("invalid guardrail in config", "error", err)
+		os.Exit(1)
+	}
+
+	upstreams, err := upstreamPoolsFrom(cfg)
+	if err != nil {
+		slog.Error("invalid upstreams config", "error", err)
+		os.Exit(1)
 	}
 
-	proxyHandler := proxy.NewHandler(store, s3Storage, pricingSvc, resolver, proxyResolver, cfg)
+	prompts := prompt.NewRegistry(store, cfg.Prompts.CacheTTL)
+
+	proxyHandler := proxy.NewHandler(store, s3Storage, pricingSvc, resolver, proxyResolver, proxy.NewBudgetChecker(store, store), router, routing.NewShadows(shadowRules), upstreams, transform.NewTransformer(transforms), redactor, guardrail.NewGuardrails(guardrails), prompts, store, cfg)
+
+	// Batches submitted with proxy keys are polled for their results; others
+	// are recorded when their results are downloaded through the gateway
+	if proxyResolver != nil && cfg.Batches.PollInterval > 0 {
+		batchPoller := proxy.NewBatchPoller(proxyHandler, proxyResolver)
+		batchPoller.Start(cfg.Batches.PollInterval)
+		defer batchPoller.Stop()
+		slog.Info("batch polling enabled", "interval", cfg.Batches.PollInterval)
+	}
 
 	// Set up admin web UI if JWT secret is configured
 	var adminCfg *server.AdminConfig
 	if cfg.JWT.Secret != "" {
 		jwtSvc := auth.NewJWTService(cfg.JWT.Secret, cfg.JWT.Expiry)
+		sessions := auth.NewSessionManager(store, store, jwtSvc, cfg.JWT.RefreshExpiry)
+		throttle := auth.NewLoginThrottle(auth.LoginThrottleConfig{
+			MaxFailures:      cfg.LoginThrottle.MaxFailures,
+			MaxFailuresPerIP: cfg.LoginThrottle.MaxFailuresPerIP,
+			Window:           cfg.LoginThrottle.Window,
+			Lockout:          cfg.LoginThrottle.Lockout,
+		})
+
+		adminHandler := api.NewAdminHandler(store, store, store, store, store, secretStore, sessions, throttle, store)
+		adminCfg = &server.AdminConfig{
+			AdminHandler:   adminHandler,
+			RoutesHandler:  api.NewRoutesHandler(store, store, store, store, router, store),
+			PromptsHandler: api.NewPromptsHandler(store, prompts, store),
+			Sessions:       sessions,
+			Users:          store,
+			CORSOrigins:    cfg.CORS.AllowedOrigins,
+		}
 
-		var adminSecretStore secrets.SecretStore
-		if cfg.Secrets.EncryptionKey != "" {
-			adminSecretStore, err = secrets.NewAESStore(cfg.Secrets.EncryptionKey)
+		if cfg.OIDC.Enabled() {
+			oidcProvider, err := auth.NewOIDCProvider(ctx, oidcConfigFrom(cfg), []byte(cfg.JWT.Secret))
 			if err != nil {
-				slog.Error("failed to initialize secret store for admin", "error", err)
+				slog.Error("failed to initialize OIDC login", "error", err)
 				os.Exit(1)
 			}
-		}
-
-		adminHandler := api.NewAdminHandler(store, store, store, adminSecretStore, jwtSvc)
-		adminCfg = &server.AdminConfig{
-			AdminHandler: adminHandler,
-			JWTService:   jwtSvc,
-			CORSOrigins:  cfg.CORS.AllowedOrigins,
+			adminCfg.OIDCHandler = api.NewOIDCHandler(oidcProvider, store, sessions, store, cfg.OIDC.UIRedirectURL)
+			adminCfg.DisablePasswordLogin = cfg.OIDC.DisablePasswordLogin
+			slog.Info("OIDC login enabled", "issuer", oidcProvider.Issuer(), "password_login", !cfg.OIDC.DisablePasswordLogin)
+		} else if cfg.OIDC.DisablePasswordLogin {
+			slog.Error("oidc.disable_password_login requires oidc.issuer_url")
+			os.Exit(1)
 		}
 		slog.Info("admin web UI enabled")
 	}
 
-	srv := server.New(&cfg.Server, proxyHandler, store, apiHandler, resolver, adminCfg)
+	srv := server.New(&cfg.Server, proxyHandler, store, apiHandler, api.NewUsageHandler(store), resolver, adminCfg)
 
 	errChan := make(chan error, 1)
 	go func() {
@@ -171,3 +309,265 @@ func runServe(args []string) {
 
 	slog.Info("server stopped")
 }
+
+// modelRoutesFrom converts and validates the model routes in the config file
+func modelRoutesFrom(cfg *config.Config) ([]*models.ModelRoute, error) {
+	routes := make([]*models.ModelRoute, 0, len(cfg.Routing.Routes))
+	for i, rc := range cfg.Routing.Routes {
+		route := &models.ModelRoute{
+			Name:           rc.Name,
+			TargetProvider: rc.TargetProvider,
+			TargetModel:    rc.TargetModel,
+		}
+		if rc.APIKeyID != "" {
+			id, err := uuid.Parse(rc.APIKeyID)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: invalid api_key_id: %w", i, err)
+			}
+			route.APIKeyID = &id
+		}
+		if rc.ProxyKeyID != "" {
+			id, err := uuid.Parse(rc.ProxyKeyID)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: invalid proxy_key_id: %w", i, err)
+			}
+			route.ProxyKeyID = &id
+		}
+		if rc.MetadataKey != "" || rc.MetadataValue != "" {
+			key, value := rc.MetadataKey, rc.MetadataValue
+			route.MetadataKey = &key
+			route.MetadataValue = &value
+		}
+		if err := routing.Validate(route); err != nil {
+			return nil, fmt.Errorf("route %d (%s): %w", i, rc.Name, err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// shadowRulesFrom converts and validates the shadow rules in the config file
+func shadowRulesFrom(cfg *config.Config) ([]routing.ShadowRule, error) {
+	rules := make([]routing.ShadowRule, 0, len(cfg.Routing.Shadow.Rules))
+	for i, rc := range cfg.Routing.Shadow.Rules {
+		rule := routing.ShadowRule{
+			Name:           rc.Name,
+			Model:          rc.Model,
+			TargetProvider: rc.TargetProvider,
+			TargetModel:    rc.TargetModel,
+			SampleRate:     1,
+		}
+		if rc.SampleRate != nil {
+			rule.SampleRate = *rc.SampleRate
+		}
+		if err := routing.ValidateShadowRule(&rule); err != nil {
+			return nil, fmt.Errorf("shadow rule %d (%s): %w", i, rc.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// transformRulesFrom converts and validates the transforms in the config file
+func transformRulesFrom(cfg *config.Config) ([]transform.Rule, error) {
+	rules := make([]transform.Rule, 0, len(cfg.Transforms))
+	for i, tc := range cfg.Transforms {
+		rule := transform.Rule{
+			Name:   tc.Name,
+			Phase:  transform.Phase(tc.Phase),
+			Models: tc.Models,
+			Paths:  tc.Paths,
+		}
+		if rule.Phase == "" {
+			rule.Phase = transform.PhaseRequest
+		}
+		for _, id := range tc.APIKeyIDs {
+			keyID, err := uuid.Parse(id)
+			if err != nil {
+				return nil, fmt.Errorf("transform %d (%s): invalid api_key_ids entry %q", i, tc.Name, id)
+			}
+			rule.APIKeyIDs = append(rule.APIKeyIDs, keyID)
+		}
+		for _, oc := range tc.Operations {
+			op := transform.Operation{Op: oc.Op, Path: oc.Path}
+			if oc.ValueJSON != "" {
+				if !json.Valid([]byte(oc.ValueJSON)) {
+					return nil, fmt.Errorf("transform %d (%s): invalid value_json for %s", i, tc.Name, oc.Path)
+				}
+				op.Value = json.RawMessage(oc.ValueJSON)
+			} else if oc.Value != nil {
+				value, err := json.Marshal(oc.Value)
+				if err != nil {
+					return nil, fmt.Errorf("transform %d (%s): invalid value for %s: %w", i, tc.Name, oc.Path, err)
+				}
+				op.Value = value
+			}
+			rule.Operations = append(rule.Operations, op)
+		}
+		if err := transform.ValidateRule(&rule); err != nil {
+			return nil, fmt.Errorf("transform %d (%s): %w", i, tc.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// redactorFrom creates the body redactor, or returns nil if redaction is
+// disabled
+func redactorFrom(cfg *config.Config) (*redact.Redactor, error) {
+	rc := cfg.Logging.Redaction
+	if !rc.Enabled {
+		return nil, nil
+	}
+	mode, err := redact.ParseMode(rc.Mode)
+	if err != nil {
+		return nil, err
+	}
+	patterns := make([]redact.Pattern, len(rc.CustomPatterns))
+	for i, p := range rc.CustomPatterns {
+		patterns[i] = redact.Pattern{Name: p.Name, Pattern: p.Pattern}
+	}
+	return redact.NewRedactor(mode, rc.Detectors, patterns)
+}
+
+// guardrailsFrom converts and validates the guardrails in the config file
+func guardrailsFrom(cfg *config.Config) ([]guardrail.Guardrail, error) {
+	list := make([]guardrail.Guardrail, 0, len(cfg.Guardrails))
+	for i, gc := range cfg.Guardrails {
+		g, err := guardrailFrom(gc)
+		if err != nil {
+			return nil, fmt.Errorf("guardrail %d (%s): %w", i, gc.Name, err)
+		}
+		list = append(list, g)
+	}
+	return list, nil
+}
+
+func guardrailFrom(gc config.GuardrailConfig) (guardrail.Guardrail, error) {
+	g := guardrail.Guardrail{Name: gc.Name, Action: guardrail.ActionBlock, FailClosed: gc.FailClosed}
+	if g.Name == "" {
+		return g, errors.New("name is required")
+	}
+	if gc.Action != "" {
+		action, err := guardrail.ParseAction(gc.Action)
+		if err != nil {
+			return g, err
+		}
+		g.Action = action
+	}
+	for _, id := range gc.APIKeyIDs {
+		keyID, err := uuid.Parse(id)
+		if err != nil {
+			return g, fmt.Errorf("invalid api_key_ids entry %q", id)
+		}
+		g.APIKeyIDs = append(g.APIKeyIDs, keyID)
+	}
+	for _, id := range gc.ProxyKeyIDs {
+		keyID, err := uuid.Parse(id)
+		if err != nil {
+			return g, fmt.Errorf("invalid proxy_key_ids entry %q", id)
+		}
+		g.ProxyKeyIDs = append(g.ProxyKeyIDs, keyID)
+	}
+
+	// Each type runs at the stages it makes sense for unless stage is set
+	var err error
+	var stages []guardrail.Stage
+	switch gc.Type {
+	case "denylist":
+		g.Check, err = guardrail.NewDenylist(gc.Keywords, gc.Patterns)
+		stages = []guardrail.Stage{guardrail.StageInput}
+	case "max_messages":
+		g.Check, err = guardrail.NewMaxMessages(gc.MaxMessages)
+		stages = []guardrail.Stage{guardrail.StageInput}
+	case "secrets":
+		detectors := gc.Detectors
+		if len(detectors) == 0 {
+			detectors = []string{"api_key"}
+		}
+		g.Check, err = guardrail.NewSecrets(detectors)
+		stages = []guardrail.Stage{guardrail.StageInput, guardrail.StageOutput}
+	case "json_schema":
+		g.Check, err = guardrail.NewJSONSchema(json.RawMessage(gc.Schema))
+		stages = []guardrail.Stage{guardrail.StageOutput}
+	case "webhook":
+		g.Check, err = guardrail.NewWebhook(gc.URL, gc.Timeout, gc.Headers)
+		stages = []guardrail.Stage{guardrail.StageInput}
+	default:
+		return g, fmt.Errorf("unknown type %q: must be denylist, max_messages, secrets, json_schema or webhook", gc.Type)
+	}
+	if err != nil {
+		return g, err
+	}
+
+	switch gc.Stage {
+	case "":
+	case "input":
+		stages = []guardrail.Stage{guardrail.StageInput}
+	case "output":
+		stages = []guardrail.Stage{guardrail.StageOutput}
+	case "both":
+		stages = []guardrail.Stage{guardrail.StageInput, guardrail.StageOutput}
+	default:
+		return g, fmt.Errorf("unknown stage %q: must be input, output or both", gc.Stage)
+	}
+	if (gc.Type == "max_messages" && slices.Contains(stages, guardrail.StageOutput)) ||
+		(gc.Type == "json_schema" && slices.Contains(stages, guardrail.StageInput)) {
+		return g, fmt.Errorf("%s guardrails can't run at the %s stage", gc.Type, gc.Stage)
+	}
+	g.Stages = stages
+	return g, nil
+}
+
+// upstreamPoolsFrom creates an endpoint pool for each provider with a
+// configured base URL
+func upstreamPoolsFrom(cfg *config.Config) (upstream.Pools, error) {
+	strategy, err := upstream.ParseStrategy(cfg.Upstreams.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	cb := cfg.Upstreams.CircuitBreaker
+	poolCfg := upstream.Config{
+		Strategy:            strategy,
+		Window:              cfg.Upstreams.Window,
+		ConsecutiveFailures: cb.ConsecutiveFailures,
+		ErrorRate:           cb.ErrorRate,
+		MinRequests:         cb.MinRequests,
+		OpenDuration:        cb.OpenDuration,
+	}
+
+	pools := upstream.Pools{}
+	for name, pc := range map[provider.Provider]config.ProviderConfig{
+		provider.ProviderOpenAI:    cfg.Providers.OpenAI,
+		provider.ProviderAnthropic: cfg.Providers.Anthropic,
+		provider.ProviderGemini:    cfg.Providers.Gemini,
+	} {
+		urls := pc.BaseURLs
+		if len(urls) == 0 && pc.BaseURL != "" {
+			urls = []string{pc.BaseURL}
+		}
+		if len(urls) > 0 {
+			pools[string(name)] = upstream.NewPool(urls, poolCfg)
+		}
+	}
+	return pools, nil
+}
+
+func oidcConfigFrom(cfg *config.Config) auth.OIDCConfig {
+	mapping := make(map[string]models.Role, len(cfg.OIDC.RoleMapping))
+	for value, role := range cfg.OIDC.RoleMapping {
+		mapping[value] = models.Role(role)
+	}
+	return auth.OIDCConfig{
+		IssuerURL:         cfg.OIDC.IssuerURL,
+		ClientID:          cfg.OIDC.ClientID,
+		ClientSecret:      cfg.OIDC.ClientSecret,
+		RedirectURL:       cfg.OIDC.RedirectURL,
+		Scopes:            cfg.OIDC.Scopes,
+		UsernameClaim:     cfg.OIDC.UsernameClaim,
+		RoleClaim:         cfg.OIDC.RoleClaim,
+		RoleMapping:       mapping,
+		DefaultRole:       models.Role(cfg.OIDC.DefaultRole),
+		LinkExistingUsers: cfg.OIDC.LinkExistingUsers,
+	}
+}
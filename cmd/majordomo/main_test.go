@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/config"
+)
+
+// loadTestConfig loads a config file with the given YAML, the way serve does
+func loadTestConfig(t *testing.T, yaml string) *config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "majordomo.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestTransformRulesFrom(t *testing.T) {
+	cfg := loadTestConfig(t, `
+transforms:
+  - name: metadata
+    operations:
+      - op: add
+        path: /metadata
+        value: {userId: u-1}
+      - op: add
+        path: /extra_headers
+        value_json: '{"X-Team-Id": "search", "userId": "u-1"}'
+`)
+	rules, err := transformRulesFrom(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || len(rules[0].Operations) != 2 {
+		t.Fatalf("rules = %+v", rules)
+	}
+
+	// The config loader lowercases keys in value; value_json keeps them
+	if got := string(rules[0].Operations[0].Value); got != `{"userid":"u-1"}` {
+		t.Errorf("value = %s", got)
+	}
+	if got := string(rules[0].Operations[1].Value); got != `{"X-Team-Id": "search", "userId": "u-1"}` {
+		t.Errorf("value_json = %s", got)
+	}
+}
+
+func TestTransformRulesFrom_InvalidValueJSON(t *testing.T) {
+	cfg := loadTestConfig(t, `
+transforms:
+  - name: broken
+    operations:
+      - op: add
+        path: /metadata
+        value_json: '{"userId": '
+`)
+	_, err := transformRulesFrom(cfg)
+	if err == nil || !strings.Contains(err.Error(), "transform 0 (broken)") {
+		t.Fatalf("error = %v, want one naming transform 0 (broken)", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/config"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func runMaintenance(args []string) {
+	if len(args) < 1 {
+		printMaintenanceUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "run":
+		runMaintenanceRun(args[1:])
+	case "help", "-h", "--help":
+		printMaintenanceUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown maintenance subcommand: %s\n\n", args[0])
+		printMaintenanceUsage()
+		os.Exit(1)
+	}
+}
+
+func printMaintenanceUsage() {
+	fmt.Println(`Usage: majordomo maintenance <subcommand> [options]
+
+Subcommands:
+  run       Create upcoming partitions and apply retention policies once
+
+Run 'majordomo maintenance <subcommand> --help' for more information.`)
+}
+
+func runMaintenanceRun(args []string) {
+	fs := flag.NewFlagSet("maintenance run", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	store := connectPostgres(*configPath, "maintenance run")
+	defer store.Close()
+
+	ctx := context.Background()
+
+	var s3Storage *storage.S3BodyStorage
+	if cfg.S3.Enabled {
+		var err error
+		s3Storage, err = storage.NewS3BodyStorage(ctx, s3ConfigFrom(cfg))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing S3 storage: %v\n", err)
+			os.Exit(1)
+		}
+		defer s3Storage.Close()
+	}
+
+	maintainer := storage.NewMaintainer(store, s3Storage, maintenanceConfigFrom(cfg))
+	report, err := maintainer.Run(ctx, time.Now())
+
+	fmt.Printf("Partitioned:         %t\n", report.Partitioned)
+	fmt.Printf("Partitions created:  %s\n", listOrNone(report.PartitionsCreated))
+	fmt.Printf("Partitions dropped:  %s\n", listOrNone(report.PartitionsDropped))
+	fmt.Printf("Bodies purged:       %d\n", report.BodiesPurged)
+	fmt.Printf("Rows expired:        %d\n", report.RowsExpired)
+	if s3Storage != nil {
+		fmt.Printf("S3 lifecycle:        %t\n", report.S3LifecycleApplied)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: maintenance did not complete: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func maintenanceConfigFrom(cfg *config.Config) storage.MaintenanceConfig {
+	return storage.MaintenanceConfig{
+		PartitionsAhead: cfg.Maintenance.PartitionsAhead,
+		BodyRetention:   cfg.Maintenance.Retention.BodyDays,
+		RowRetention:    cfg.Maintenance.Retention.RowDays,
+		BatchSize:       cfg.Maintenance.BatchSize,
+	}
+}
+
+func s3ConfigFrom(cfg *config.Config) storage.S3Config {
+	return storage.S3Config{
+		Bucket:          cfg.S3.Bucket,
+		Region:          cfg.S3.Region,
+		Endpoint:        cfg.S3.Endpoint,
+		AccessKeyID:     cfg.S3.AccessKeyID,
+		SecretAccessKey: cfg.S3.SecretAccessKey,
+	}
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func runMigrate(args []string) {
+	if len(args) < 1 {
+		printMigrateUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "up":
+		runMigrateUp(args[1:])
+	case "down":
+		runMigrateDown(args[1:])
+	case "status":
+		runMigrateStatus(args[1:])
+	case "help", "-h", "--help":
+		printMigrateUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate subcommand: %s\n\n", args[0])
+		printMigrateUsage()
+		os.Exit(1)
+	}
+}
+
+func printMigrateUsage() {
+	fmt.Println(`Usage: majordomo migrate <subcommand> [options]
+
+Subcommands:
+  up        Apply pending migrations
+  down      Roll back applied migrations
+  status    Show which migrations have been applied
+
+Run 'majordomo migrate <subcommand> --help' for more information.`)
+}
+
+// newMigrator loads config and returns a migrator and a function to close its connection.
+func newMigrator(configPath string) (*storage.Migrator, func()) {
+	cfg := loadConfig(configPath)
+	db := openDB(cfg)
+
+	migrator, err := storage.NewMigrator(db, storageDriver(cfg))
+	if err != nil {
+		db.Close()
+		fmt.Fprintf(os.Stderr, "Error loading migrations: %v\n", err)
+		os.Exit(1)
+	}
+
+	return migrator, func() { db.Close() }
+}
+
+func runMigrateUp(args []string) {
+	fs := flag.NewFlagSet("migrate up", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	to := fs.Int("to", 0, "Target version (default: latest)")
+	fs.Parse(args)
+
+	migrator, closeDB := newMigrator(*configPath)
+	defer closeDB()
+
+	applied, err := migrator.Up(context.Background(), *to)
+	for _, m := range applied {
+		fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date.")
+	}
+}
+
+func runMigrateDown(args []string) {
+	fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	steps := fs.Int("steps", 1, "Number of migrations to roll back")
+	fs.Parse(args)
+
+	migrator, closeDB := newMigrator(*configPath)
+	defer closeDB()
+
+	rolledBack, err := migrator.Down(context.Background(), *steps)
+	for _, m := range rolledBack {
+		fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNoMigrations) {
+			fmt.Println("No migrations have been applied.")
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runMigrateStatus(args []string) {
+	fs := flag.NewFlagSet("migrate status", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	migrator, closeDB := newMigrator(*configPath)
+	defer closeDB()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	pending := 0
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Format(time.RFC3339)
+		} else {
+			pending++
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d pending\n", pending)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/prompt"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func runPrompts(args []string) {
+	if len(args) < 1 {
+		printPromptsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "create":
+		runPromptsCreate(args[1:])
+	case "list":
+		runPromptsList(args[1:])
+	case "versions":
+		runPromptsVersions(args[1:])
+	case "show":
+		runPromptsShow(args[1:])
+	case "delete":
+		runPromptsDelete(args[1:])
+	case "help", "-h", "--help":
+		printPromptsUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown prompts subcommand: %s\n\n", args[0])
+		printPromptsUsage()
+		os.Exit(1)
+	}
+}
+
+func printPromptsUsage() {
+	fmt.Println(`Usage: majordomo prompts <subcommand> [options]
+
+Subcommands:
+  create    Add the next version of a prompt template
+  list      List the latest version of each prompt template
+  versions  List the versions of a prompt template
+  show      Show a prompt template, as name or name@version
+  delete    Delete a version of a prompt template, as name@version
+
+Run 'majordomo prompts <subcommand> --help' for more information.`)
+}
+
+func runPromptsCreate(args []string) {
+	fs := flag.NewFlagSet("prompts create", flag.ExitOnError)
+	name := fs.String("name", "", "Prompt template name (required)")
+	file := fs.String("file", "", `JSON file with the messages, e.g. [{"role": "system", "content": "..."}], or - for stdin (required)`)
+	description := fs.String("description", "", "Description of this version")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *name == "" || *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: --name and --file are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading messages: %v\n", err)
+		os.Exit(1)
+	}
+
+	p := &models.PromptTemplate{Name: *name}
+	if err := json.Unmarshal(data, &p.Messages); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: messages must be a JSON array of {\"role\", \"content\"} objects: %v\n", err)
+		os.Exit(1)
+	}
+	if *description != "" {
+		p.Description = description
+	}
+	if err := prompt.Validate(p); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.CreatePromptVersion(ctx, p); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating prompt template: %v\n", err)
+		os.Exit(1)
+	}
+	p.Variables = prompt.Variables(p.Messages)
+	recordAudit(ctx, store, "prompt.create", "prompt", fmt.Sprintf("%s@%d", p.Name, p.Version), nil, p)
+
+	fmt.Println("Prompt template created successfully!")
+	fmt.Println()
+	fmt.Printf("Reference: %s@%d\n", p.Name, p.Version)
+	fmt.Printf("Variables: %s\n", variablesString(p.Variables))
+	fmt.Println()
+}
+
+func runPromptsList(args []string) {
+	fs := flag.NewFlagSet("prompts list", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	prompts, err := store.ListPrompts(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing prompt templates: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(prompts) == 0 {
+		fmt.Println("No prompt templates found.")
+		return
+	}
+
+	printPrompts(prompts)
+}
+
+func runPromptsVersions(args []string) {
+	fs := flag.NewFlagSet("prompts versions", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Error: prompt name required")
+		fmt.Fprintln(os.Stderr, "Usage: majordomo prompts versions <name>")
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	prompts, err := store.ListPromptVersions(context.Background(), fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing prompt template versions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(prompts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", storage.ErrPromptNotFound)
+		os.Exit(1)
+	}
+
+	printPrompts(prompts)
+}
+
+func runPromptsShow(args []string) {
+	fs := flag.NewFlagSet("prompts show", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Error: prompt reference required")
+		fmt.Fprintln(os.Stderr, "Usage: majordomo prompts show <name>[@version]")
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	p := lookupPrompt(context.Background(), store, fs.Arg(0))
+
+	fmt.Printf("Reference:   %s@%d\n", p.Name, p.Version)
+	if p.Description != nil {
+		fmt.Printf("Description: %s\n", *p.Description)
+	}
+	fmt.Printf("Variables:   %s\n", variablesString(prompt.Variables(p.Messages)))
+	fmt.Printf("Created:     %s\n", p.CreatedAt.Format("2006-01-02 15:04:05"))
+	for _, m := range p.Messages {
+		fmt.Println()
+		fmt.Printf("[%s]\n%s\n", m.Role, m.Content)
+	}
+}
+
+func runPromptsDelete(args []string) {
+	fs := flag.NewFlagSet("prompts delete", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || !strings.Contains(fs.Arg(0), "@") {
+		fmt.Fprintln(os.Stderr, "Error: prompt reference with a version required")
+		fmt.Fprintln(os.Stderr, "Usage: majordomo prompts delete <name>@<version>")
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	p := lookupPrompt(ctx, store, fs.Arg(0))
+
+	if err := store.DeletePromptVersion(ctx, p.Name, p.Version); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting prompt template: %v\n", err)
+		os.Exit(1)
+	}
+	ref := fmt.Sprintf("%s@%d", p.Name, p.Version)
+	recordAudit(ctx, store, "prompt.delete", "prompt", ref, p, nil)
+
+	fmt.Printf("Prompt template %s has been deleted.\n", ref)
+}
+
+// lookupPrompt finds a prompt template by reference, or exits
+func lookupPrompt(ctx context.Context, store storage.PromptStorage, ref string) *models.PromptTemplate {
+	name, version, err := prompt.ParseReference(ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	p, err := store.GetPromptVersion(ctx, name, version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return p
+}
+
+func printPrompts(prompts []*models.PromptTemplate) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tMESSAGES\tVARIABLES\tCREATED")
+	for _, p := range prompts {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n",
+			p.Name, p.Version, len(p.Messages),
+			variablesString(prompt.Variables(p.Messages)),
+			p.CreatedAt.Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+func variablesString(variables []string) string {
+	if len(variables) == 0 {
+		return "-"
+	}
+	return strings.Join(variables, ", ")
+}
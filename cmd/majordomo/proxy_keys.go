@@ -10,9 +10,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
-	"github.com/superset-studio/majordomo-gateway/internal/config"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
-	"github.com/superset-studio/majordomo-gateway/internal/secrets"
 )
 
 func runProxyKeys(args []string) {
@@ -30,6 +28,8 @@ func runProxyKeys(args []string) {
 		runProxyKeysGet(args[1:])
 	case "revoke":
 		runProxyKeysRevoke(args[1:])
+	case "set-single-header":
+		runProxyKeysSetSingleHeader(args[1:])
 	case "set-provider":
 		runProxyKeysSetProvider(args[1:])
 	case "remove-provider":
@@ -49,13 +49,14 @@ func printProxyKeysUsage() {
 	fmt.Println(`Usage: majordomo proxy-keys <subcommand> [options]
 
 Subcommands:
-  create           Create a new proxy key
-  list             List proxy keys
-  get              Get details of a proxy key
-  revoke           Revoke a proxy key
-  set-provider     Set a provider API key mapping
-  remove-provider  Remove a provider API key mapping
-  list-providers   List provider mappings for a proxy key
+  create             Create a new proxy key
+  list               List proxy keys
+  get                Get details of a proxy key
+  revoke             Revoke a proxy key
+  set-single-header  Allow or forbid a proxy key to authenticate on its own
+  set-provider       Set a provider API key mapping
+  remove-provider    Remove a provider API key mapping
+  list-providers     List provider mappings for a proxy key
 
 Run 'majordomo proxy-keys <subcommand> --help' for more information.`)
 }
@@ -65,6 +66,7 @@ func runProxyKeysCreate(args []string) {
 	name := fs.String("name", "", "Name for the proxy key (required)")
 	description := fs.String("description", "", "Description for the proxy key")
 	majordomoKeyID := fs.String("majordomo-key-id", "", "Majordomo API key ID to associate with (required)")
+	singleHeader := fs.Bool("single-header", false, "Let the proxy key authenticate requests without X-Majordomo-Key")
 	configPath := fs.String("config", "", "Path to config file")
 	fs.Parse(args)
 
@@ -86,7 +88,7 @@ func runProxyKeysCreate(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	// Verify the Majordomo key exists
@@ -103,7 +105,8 @@ func runProxyKeysCreate(args []string) {
 	}
 
 	input := &models.CreateProxyKeyInput{
-		Name: *name,
+		Name:             *name,
+		SingleHeaderAuth: *singleHeader,
 	}
 	if *description != "" {
 		input.Description = description
@@ -114,12 +117,14 @@ func runProxyKeysCreate(args []string) {
 		fmt.Fprintf(os.Stderr, "Error creating proxy key: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(context.Background(), store, "proxy_key.create", "proxy_key", pk.ID.String(), nil, pk)
 
 	fmt.Println("Proxy key created successfully!")
 	fmt.Println()
 	fmt.Printf("ID:                %s\n", pk.ID)
 	fmt.Printf("Name:              %s\n", pk.Name)
 	fmt.Printf("Majordomo Key ID:  %s\n", pk.MajordomoAPIKeyID)
+	fmt.Printf("Single-Header:     %t\n", pk.SingleHeaderAuth)
 	fmt.Println()
 	fmt.Println("IMPORTANT: Save this key - it will not be shown again:")
 	fmt.Println()
@@ -145,7 +150,7 @@ func runProxyKeysList(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	keys, err := store.ListProxyKeys(context.Background(), mkID)
@@ -191,7 +196,7 @@ func runProxyKeysGet(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	pk, err := store.GetProxyKeyByID(context.Background(), id)
@@ -206,6 +211,7 @@ func runProxyKeysGet(args []string) {
 		fmt.Printf("Description:       %s\n", *pk.Description)
 	}
 	fmt.Printf("Majordomo Key ID:  %s\n", pk.MajordomoAPIKeyID)
+	fmt.Printf("Single-Header:     %t\n", pk.SingleHeaderAuth)
 	fmt.Printf("Status:            %s\n", proxyKeyStatusString(pk))
 	fmt.Printf("Created:           %s\n", pk.CreatedAt.Format(time.RFC3339))
 	if pk.RevokedAt != nil {
@@ -234,18 +240,67 @@ func runProxyKeysRevoke(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
+	pk, err := store.GetProxyKeyByID(context.Background(), id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: proxy key not found: %v\n", err)
+		os.Exit(1)
+	}
+
 	err = store.RevokeProxyKey(context.Background(), id)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error revoking proxy key: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(context.Background(), store, "proxy_key.revoke", "proxy_key", id.String(), pk, nil)
 
 	fmt.Printf("Proxy key %s has been revoked.\n", id)
 }
 
+func runProxyKeysSetSingleHeader(args []string) {
+	fs := flag.NewFlagSet("proxy-keys set-single-header", flag.ExitOnError)
+	enabled := fs.Bool("enabled", true, "Whether the proxy key may authenticate requests without X-Majordomo-Key")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Error: proxy key ID required")
+		fmt.Fprintln(os.Stderr, "Usage: majordomo proxy-keys set-single-header [--enabled=false] <id>")
+		os.Exit(1)
+	}
+
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid proxy key ID: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	pk, err := store.GetProxyKeyByID(context.Background(), id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: proxy key not found: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := store.SetProxyKeySingleHeaderAuth(context.Background(), id, *enabled); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating proxy key: %v\n", err)
+		os.Exit(1)
+	}
+	updated := *pk
+	updated.SingleHeaderAuth = *enabled
+	recordAudit(context.Background(), store, "proxy_key.single_header_auth_set", "proxy_key", id.String(), pk, &updated)
+
+	if *enabled {
+		fmt.Printf("Proxy key %s can now authenticate requests on its own.\n", id)
+	} else {
+		fmt.Printf("Proxy key %s now requires X-Majordomo-Key.\n", id)
+	}
+}
+
 func runProxyKeysSetProvider(args []string) {
 	fs := flag.NewFlagSet("proxy-keys set-provider", flag.ExitOnError)
 	provider := fs.String("provider", "", "Provider name (e.g., openai, anthropic, gemini) (required)")
@@ -282,7 +337,7 @@ func runProxyKeysSetProvider(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	// Verify proxy key exists
@@ -303,6 +358,7 @@ func runProxyKeysSetProvider(args []string) {
 		fmt.Fprintf(os.Stderr, "Error setting provider mapping: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(context.Background(), store, "provider_mapping.set", "proxy_key", id.String(), nil, map[string]string{"provider": *provider})
 
 	fmt.Printf("Provider mapping set: %s → %s (encrypted)\n", *provider, id)
 }
@@ -330,7 +386,7 @@ func runProxyKeysRemoveProvider(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	err = store.DeleteProviderMapping(context.Background(), id, *provider)
@@ -338,6 +394,7 @@ func runProxyKeysRemoveProvider(args []string) {
 		fmt.Fprintf(os.Stderr, "Error removing provider mapping: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(context.Background(), store, "provider_mapping.delete", "proxy_key", id.String(), map[string]string{"provider": *provider}, nil)
 
 	fmt.Printf("Provider mapping removed: %s for proxy key %s\n", *provider, id)
 }
@@ -359,7 +416,7 @@ func runProxyKeysListProviders(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	mappings, err := store.ListProviderMappings(context.Background(), id)
@@ -390,10 +447,3 @@ func proxyKeyStatusString(pk *models.ProxyKey) string {
 	}
 	return "active"
 }
-
-func newSecretStoreFromConfig(cfg *config.Config) (secrets.SecretStore, error) {
-	if cfg.Secrets.EncryptionKey == "" {
-		return nil, fmt.Errorf("secrets.encryption_key is required (set MAJORDOMO_SECRETS_ENCRYPTION_KEY)")
-	}
-	return secrets.NewAESStore(cfg.Secrets.EncryptionKey)
-}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/pricing"
+	"github.com/superset-studio/majordomo-gateway/internal/replay"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// metadataFlag collects repeated --metadata key=value flags
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	m[strings.ToLower(key)] = value
+	return nil
+}
+
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: majordomo replay [options]
+
+Re-sends logged requests whose bodies were stored, through the gateway
+(--gateway) or directly to the provider, and writes a report comparing cost,
+tokens, latency and output with the original responses.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+	from := fs.String("from", "", "Only requests at or after this time (RFC 3339 or YYYY-MM-DD, default: 24 hours ago)")
+	to := fs.String("to", "", "Only requests before this time (RFC 3339 or YYYY-MM-DD, default: now)")
+	provider := fs.String("provider", "", "Only requests to this provider")
+	model := fs.String("model", "", "Only requests to this model")
+	apiKeyID := fs.String("api-key-id", "", "Only requests made with this Majordomo API key ID")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "metadata", "Only requests with this metadata, as key=value (repeatable)")
+	limit := fs.Int("limit", storage.DefaultReplayLimit, "Maximum number of requests, oldest first")
+
+	gateway := fs.String("gateway", "", "Replay through the gateway at this URL, e.g. http://localhost:7680 (default: directly to the provider)")
+	majordomoKey := fs.String("majordomo-key", "", "Majordomo API key for --gateway")
+	apiKey := fs.String("api-key", "", "Provider API key, or a proxy key with --gateway")
+	targetProvider := fs.String("target-provider", "", "Replay to this provider instead of the logged one")
+	targetModel := fs.String("target-model", "", "Replay with this model instead of the logged one")
+	baseURL := fs.String("base-url", "", "Provider base URL, without --gateway (default: the provider's)")
+	promptRef := fs.String("prompt", "", "Render requests that used this prompt template with this version instead, as name@version (with --gateway)")
+
+	concurrency := fs.Int("concurrency", 4, "Requests replayed at a time")
+	timeout := fs.Duration("timeout", 2*time.Minute, "Timeout for each replayed request")
+	output := fs.String("output", "", "Write the report to this file (default: stdout)")
+	format := fs.String("format", "", "Report format: json or csv (default: from the --output extension, else json)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *format == "" {
+		*format = "json"
+		if strings.EqualFold(filepath.Ext(*output), ".csv") {
+			*format = "csv"
+		}
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintf(os.Stderr, "Error: --format must be json or csv\n")
+		os.Exit(1)
+	}
+
+	q := &models.ReplayQuery{
+		From:     time.Now().Add(-24 * time.Hour),
+		To:       time.Now(),
+		Provider: *provider,
+		Model:    *model,
+		Metadata: metadata,
+		Limit:    *limit,
+	}
+	if *from != "" {
+		q.From = parseAuditTime("--from", *from)
+	}
+	if *to != "" {
+		q.To = parseAuditTime("--to", *to)
+	}
+	if *apiKeyID != "" {
+		id, err := uuid.Parse(*apiKeyID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --api-key-id: %v\n", err)
+			os.Exit(1)
+		}
+		q.MajordomoAPIKeyID = &id
+	}
+
+	target := replay.Target{
+		GatewayURL:   *gateway,
+		MajordomoKey: *majordomoKey,
+		APIKey:       *apiKey,
+		Provider:     *targetProvider,
+		Model:        *targetModel,
+		BaseURL:      *baseURL,
+		Prompt:       *promptRef,
+	}
+	if target.GatewayURL != "" && target.BaseURL != "" {
+		fmt.Fprintln(os.Stderr, "Error: --base-url only applies without --gateway")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig(*configPath)
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+
+	requests, err := store.ListReplayRequests(ctx, q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing requests: %v\n", err)
+		os.Exit(1)
+	}
+	if len(requests) == 0 {
+		fmt.Fprintln(os.Stderr, "No logged requests with stored bodies match.")
+		return
+	}
+
+	var bodies replay.BodyStore
+	if cfg.S3.Enabled {
+		s3Storage, err := storage.NewS3BodyStorage(ctx, s3ConfigFrom(cfg))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing S3 storage: %v\n", err)
+			os.Exit(1)
+		}
+		defer s3Storage.Close()
+		bodies = s3Storage
+	}
+
+	pricingSvc := pricing.NewService(cfg.Pricing.RemoteURL, cfg.Pricing.FallbackFile, cfg.Pricing.AliasesFile, cfg.Pricing.RefreshInterval)
+	defer pricingSvc.Close()
+
+	replayer, err := replay.NewReplayer(target, bodies, pricingSvc, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Replaying %d requests...\n", len(requests))
+	report := replayer.Run(ctx, requests, *concurrency)
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating report: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if *format == "csv" {
+		err = report.WriteCSV(out)
+	} else {
+		err = report.WriteJSON(out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+
+	s := report.Summary
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Replayed:  %d of %d (%d failed)\n", s.Replayed, s.Requests, s.Failed)
+	fmt.Fprintf(os.Stderr, "Outputs:   %d exact, %d equal once normalized, %d different\n", s.Exact, s.Normalized, s.Different)
+	fmt.Fprintf(os.Stderr, "Errors:    %d original, %d replayed\n", s.Original.ErrorCount, s.Replay.ErrorCount)
+	fmt.Fprintf(os.Stderr, "Cost:      $%.4f original, $%.4f replayed\n", s.Original.TotalCost, s.Replay.TotalCost)
+	fmt.Fprintf(os.Stderr, "Tokens:    %d/%d original, %d/%d replayed (input/output)\n",
+		s.Original.InputTokens, s.Original.OutputTokens, s.Replay.InputTokens, s.Replay.OutputTokens)
+	fmt.Fprintf(os.Stderr, "Latency:   %.0f ms original, %.0f ms replayed (average)\n", s.Original.AvgLatencyMs, s.Replay.AvgLatencyMs)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func runRollups(args []string) {
+	if len(args) < 1 {
+		printRollupsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "rebuild":
+		runRollupsRebuild(args[1:])
+	case "help", "-h", "--help":
+		printRollupsUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown rollups subcommand: %s\n\n", args[0])
+		printRollupsUsage()
+		os.Exit(1)
+	}
+}
+
+func printRollupsUsage() {
+	fmt.Println(`Usage: majordomo rollups <subcommand> [options]
+
+Subcommands:
+  rebuild   Recompute hourly and daily usage rollups from llm_requests
+
+Run 'majordomo rollups <subcommand> --help' for more information.`)
+}
+
+func runRollupsRebuild(args []string) {
+	fs := flag.NewFlagSet("rollups rebuild", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	from := fs.String("from", "", "Start date, inclusive (YYYY-MM-DD, required)")
+	to := fs.String("to", "", "End date, exclusive (YYYY-MM-DD, default: tomorrow)")
+	fs.Parse(args)
+
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "Error: --from is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	fromTime, err := time.Parse(time.DateOnly, *from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --from: %v\n", err)
+		os.Exit(1)
+	}
+
+	toTime := time.Now().UTC().AddDate(0, 0, 1)
+	if *to != "" {
+		toTime, err = time.Parse(time.DateOnly, *to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --to: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if !fromTime.Before(toTime) {
+		fmt.Fprintln(os.Stderr, "Error: --from must be before --to")
+		os.Exit(1)
+	}
+
+	store := connectPostgres(*configPath, "rollups rebuild")
+	defer store.Close()
+
+	scanned, err := store.RebuildRollups(context.Background(), fromTime, toTime)
+	if err != nil {
+		if errors.Is(err, storage.ErrRebuildBeforeData) {
+			fmt.Fprintln(os.Stderr, "Error: the range starts before the oldest retained request; rollups for expired rows cannot be recomputed")
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Error rebuilding rollups: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Rebuilt rollups from %s to %s (%d requests)\n", fromTime.Format(time.DateOnly), toTime.Format(time.DateOnly), scanned)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/superset-studio/majordomo-gateway/internal/config"
+	"github.com/superset-studio/majordomo-gateway/internal/secrets"
+)
+
+func runSecrets(args []string) {
+	if len(args) < 1 {
+		printSecretsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "rotate":
+		runSecretsRotate(args[1:])
+	case "help", "-h", "--help":
+		printSecretsUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown secrets subcommand: %s\n\n", args[0])
+		printSecretsUsage()
+		os.Exit(1)
+	}
+}
+
+func printSecretsUsage() {
+	fmt.Println(`Usage: majordomo secrets <subcommand> [options]
+
+Subcommands:
+  rotate    Re-encrypt provider API keys with the active encryption key
+            (aes backend) or the latest Vault Transit key version
+
+Run 'majordomo secrets <subcommand> --help' for more information.`)
+}
+
+func runSecretsRotate(args []string) {
+	fs := flag.NewFlagSet("secrets rotate", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	batchSize := fs.Int("batch-size", 100, "Provider mappings re-encrypted per transaction")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	secretStore, err := newSecretStoreFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	rotator, ok := secretStore.(secrets.Rotator)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: secrets.backend %q does not support rotation\n", cfg.Secrets.Backend)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	report, err := store.ReencryptProviderMappings(context.Background(), *batchSize, rotator.Rotate)
+
+	fmt.Printf("Scanned:    %d\n", report.Scanned)
+	fmt.Printf("Rotated:    %d\n", report.Rotated)
+	fmt.Printf("Unchanged:  %d\n", report.Unchanged)
+	if report.Conflicts > 0 {
+		fmt.Printf("Conflicts:  %d (changed during rotation, run again)\n", report.Conflicts)
+	}
+	if len(report.FailedIDs) > 0 {
+		fmt.Printf("Failed:     %d\n", len(report.FailedIDs))
+		for _, id := range report.FailedIDs {
+			fmt.Printf("  %s\n", id)
+		}
+	}
+
+	if report.Rotated > 0 {
+		recordAudit(context.Background(), store, "secrets.rotate", "provider_mappings", "", nil, map[string]int{
+			"scanned":   report.Scanned,
+			"rotated":   report.Rotated,
+			"unchanged": report.Unchanged,
+			"conflicts": report.Conflicts,
+			"failed":    len(report.FailedIDs),
+		})
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: rotation did not complete: %v\n", err)
+		os.Exit(1)
+	}
+	if len(report.FailedIDs) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: some provider keys could not be decrypted; keep their old encryption key configured and set them again")
+		os.Exit(1)
+	}
+}
+
+// newSecretStoreFromConfig creates the SecretStore selected by secrets.backend.
+func newSecretStoreFromConfig(cfg *config.Config) (secrets.SecretStore, error) {
+	if !cfg.Secrets.Enabled() {
+		return nil, fmt.Errorf("secrets.encryption_key is required (set MAJORDOMO_SECRETS_ENCRYPTION_KEY)")
+	}
+
+	switch cfg.Secrets.Backend {
+	case "", "aes":
+		return newKeyringFromConfig(cfg)
+	case "vault-transit":
+		return newVaultTransitFromConfig(cfg.Secrets.Vault)
+	case "aws-kms":
+		return newAWSKMSFromConfig(cfg.Secrets.AWSKMS)
+	case "reference":
+		var vault *secrets.VaultConfig
+		if vaultCfg := vaultConfigFrom(cfg.Secrets.Vault); vaultCfg.Address != "" {
+			vault = &vaultCfg
+		}
+		ref := cfg.Secrets.Reference
+		return secrets.NewReferenceStore(vault, ref.CacheTTL, secrets.ReferencePolicy{
+			EnvPrefixes: ref.AllowedEnvPrefixes,
+			FileDirs:    ref.AllowedFileDirs,
+			VaultPaths:  ref.AllowedVaultPaths,
+		})
+	default:
+		return nil, fmt.Errorf("unknown secrets.backend %q (expected aes, vault-transit, aws-kms or reference)", cfg.Secrets.Backend)
+	}
+}
+
+// newKeyringFromConfig builds the keyring for the aes backend.
+// secrets.encryption_key is registered as the "default" key and is the
+// active key unless secrets.active_key says otherwise.
+func newKeyringFromConfig(cfg *config.Config) (*secrets.Keyring, error) {
+	keys := make(map[string]string, len(cfg.Secrets.Keys)+1)
+	for id, key := range cfg.Secrets.Keys {
+		keys[id] = key
+	}
+	if cfg.Secrets.EncryptionKey != "" {
+		if _, ok := keys[secrets.LegacyKeyID]; ok {
+			return nil, fmt.Errorf("secrets.keys.%s conflicts with secrets.encryption_key", secrets.LegacyKeyID)
+		}
+		keys[secrets.LegacyKeyID] = cfg.Secrets.EncryptionKey
+	}
+
+	activeKey := cfg.Secrets.ActiveKey
+	if activeKey == "" && cfg.Secrets.EncryptionKey != "" {
+		activeKey = secrets.LegacyKeyID
+	}
+
+	var kms secrets.KMS
+	switch cfg.Secrets.Mode {
+	case "", "direct":
+	case "envelope":
+		var err error
+		kms, err = newKMSFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown secrets.mode %q (expected direct or envelope)", cfg.Secrets.Mode)
+	}
+
+	return secrets.NewKeyring(keys, activeKey, kms)
+}
+
+// newKMSFromConfig creates the KMS that wraps data keys in envelope mode.
+func newKMSFromConfig(cfg *config.Config) (secrets.KMS, error) {
+	switch cfg.Secrets.KMS.Provider {
+	case "", "local":
+		if cfg.Secrets.KMS.KeyFile == "" {
+			return nil, fmt.Errorf("secrets.kms.key_file is required for the local KMS")
+		}
+		return secrets.NewLocalKMS(cfg.Secrets.KMS.KeyFile)
+	case "vault-transit":
+		return newVaultTransitFromConfig(cfg.Secrets.Vault)
+	case "aws-kms":
+		return newAWSKMSFromConfig(cfg.Secrets.AWSKMS)
+	default:
+		return nil, fmt.Errorf("unknown secrets.kms.provider %q", cfg.Secrets.KMS.Provider)
+	}
+}
+
+func newVaultTransitFromConfig(cfg config.VaultConfig) (*secrets.VaultTransit, error) {
+	return secrets.NewVaultTransit(vaultConfigFrom(cfg), cfg.TransitMount, cfg.TransitKey)
+}
+
+func newAWSKMSFromConfig(cfg config.AWSKMSConfig) (*secrets.AWSKMS, error) {
+	return secrets.NewAWSKMS(context.Background(), secrets.AWSKMSConfig{
+		KeyID:    cfg.KeyID,
+		Region:   cfg.Region,
+		Endpoint: cfg.Endpoint,
+	})
+}
+
+// vaultConfigFrom fills in the address and token from the standard Vault
+// environment variables when they aren't configured.
+func vaultConfigFrom(cfg config.VaultConfig) secrets.VaultConfig {
+	vault := secrets.VaultConfig{
+		Address:   cfg.Address,
+		Token:     cfg.Token,
+		Namespace: cfg.Namespace,
+	}
+	if vault.Address == "" {
+		vault.Address = os.Getenv("VAULT_ADDR")
+	}
+	if vault.Token == "" {
+		vault.Token = os.Getenv("VAULT_TOKEN")
+	}
+	return vault
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func runOrgs(args []string) {
+	if len(args) < 1 {
+		printOrgsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "create":
+		runOrgsCreate(args[1:])
+	case "list":
+		runOrgsList(args[1:])
+	case "help", "-h", "--help":
+		printOrgsUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown orgs subcommand: %s\n\n", args[0])
+		printOrgsUsage()
+		os.Exit(1)
+	}
+}
+
+func printOrgsUsage() {
+	fmt.Println(`Usage: majordomo orgs <subcommand> [options]
+
+Subcommands:
+  create    Create a new organization
+  list      List all organizations
+
+Run 'majordomo orgs <subcommand> --help' for more information.`)
+}
+
+func runOrgsCreate(args []string) {
+	fs := flag.NewFlagSet("orgs create", flag.ExitOnError)
+	name := fs.String("name", "", "Organization name (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "Error: --name is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	org, err := store.CreateOrganization(context.Background(), *name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating organization: %v\n", err)
+		os.Exit(1)
+	}
+	recordAudit(context.Background(), store, "organization.create", "organization", org.ID.String(), nil, org)
+
+	fmt.Println("Organization created successfully!")
+	fmt.Println()
+	fmt.Printf("ID:   %s\n", org.ID)
+	fmt.Printf("Name: %s\n", org.Name)
+	fmt.Println()
+}
+
+func runOrgsList(args []string) {
+	fs := flag.NewFlagSet("orgs list", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	orgs, err := store.ListOrganizations(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing organizations: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(orgs) == 0 {
+		fmt.Println("No organizations found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCREATED")
+	for _, o := range orgs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", o.ID, o.Name, o.CreatedAt.Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+func runTeams(args []string) {
+	if len(args) < 1 {
+		printTeamsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "create":
+		runTeamsCreate(args[1:])
+	case "list":
+		runTeamsList(args[1:])
+	case "members":
+		runTeamsMembers(args[1:])
+	case "add-member":
+		runTeamsAddMember(args[1:])
+	case "remove-member":
+		runTeamsRemoveMember(args[1:])
+	case "set-budget":
+		runTeamsSetBudget(args[1:])
+	case "assign-key":
+		runTeamsAssignKey(args[1:])
+	case "help", "-h", "--help":
+		printTeamsUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown teams subcommand: %s\n\n", args[0])
+		printTeamsUsage()
+		os.Exit(1)
+	}
+}
+
+func printTeamsUsage() {
+	fmt.Println(`Usage: majordomo teams <subcommand> [options]
+
+Subcommands:
+  create         Create a new team in an organization
+  list           List the teams in an organization
+  members        List a team's members
+  add-member     Add a user to a team, or change their team role
+  remove-member  Remove a user from a team
+  set-budget     Set or clear a team's monthly budget (USD)
+  assign-key     Move an API key into a team, or out of it with --team ""
+
+Run 'majordomo teams <subcommand> --help' for more information.`)
+}
+
+func runTeamsCreate(args []string) {
+	fs := flag.NewFlagSet("teams create", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required)")
+	name := fs.String("name", "", "Team name (required)")
+	budget := fs.String("budget", "", "Monthly budget in USD")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *org == "" || *name == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org and --name are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	monthlyBudget := parseBudget(*budget)
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	o := lookupOrg(ctx, store, *org)
+
+	team, err := store.CreateTeam(ctx, o.ID, *name, monthlyBudget)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating team: %v\n", err)
+		os.Exit(1)
+	}
+	recordAudit(ctx, store, "team.create", "team", team.ID.String(), nil, team)
+
+	fmt.Println("Team created successfully!")
+	fmt.Println()
+	fmt.Printf("ID:     %s\n", team.ID)
+	fmt.Printf("Name:   %s\n", team.Name)
+	fmt.Printf("Budget: %s\n", budgetString(team.MonthlyBudget))
+	fmt.Println()
+}
+
+func runTeamsList(args []string) {
+	fs := flag.NewFlagSet("teams list", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *org == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	o := lookupOrg(ctx, store, *org)
+
+	teams, err := store.ListTeams(ctx, o.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing teams: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(teams) == 0 {
+		fmt.Println("No teams found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tBUDGET\tCREATED")
+	for _, t := range teams {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			t.ID, t.Name, budgetString(t.MonthlyBudget),
+			t.CreatedAt.Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+func runTeamsMembers(args []string) {
+	fs := flag.NewFlagSet("teams members", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required)")
+	team := fs.String("team", "", "Team name (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *org == "" || *team == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org and --team are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	t := lookupTeam(ctx, store, *org, *team)
+
+	members, err := store.ListTeamMembers(ctx, t.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing members: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(members) == 0 {
+		fmt.Println("No members found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER ID\tUSERNAME\tROLE\tADDED")
+	for _, m := range members {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			m.UserID, m.Username, m.Role,
+			m.CreatedAt.Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+func runTeamsAddMember(args []string) {
+	fs := flag.NewFlagSet("teams add-member", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required)")
+	team := fs.String("team", "", "Team name (required)")
+	username := fs.String("username", "", "Username (required)")
+	role := fs.String("role", string(models.RoleMember), "Team role: admin, member, viewer or billing")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *org == "" || *team == "" || *username == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org, --team and --username are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	teamRole := models.Role(*role)
+	if !teamRole.Valid() {
+		fmt.Fprintf(os.Stderr, "Error: invalid --role %q (expected admin, member, viewer or billing)\n", *role)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	t := lookupTeam(ctx, store, *org, *team)
+	user := lookupUser(ctx, store, *username)
+
+	oldRole, err := store.GetTeamMemberRole(ctx, t.ID, user.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error looking up team role: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := store.SetTeamMember(ctx, t.ID, user.ID, teamRole); err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding member: %v\n", err)
+		os.Exit(1)
+	}
+
+	var before map[string]interface{}
+	if oldRole != "" {
+		before = map[string]interface{}{"username": user.Username, "role": oldRole}
+	}
+	after := map[string]interface{}{"username": user.Username, "role": teamRole}
+	recordAudit(ctx, store, "team.member_set", "team_member", audit.TeamMemberID(t.ID, user.ID), before, after)
+
+	fmt.Printf("User %s is now %s of team %s.\n", user.Username, teamRole, t.Name)
+}
+
+func runTeamsRemoveMember(args []string) {
+	fs := flag.NewFlagSet("teams remove-member", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required)")
+	team := fs.String("team", "", "Team name (required)")
+	username := fs.String("username", "", "Username (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *org == "" || *team == "" || *username == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org, --team and --username are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	t := lookupTeam(ctx, store, *org, *team)
+	user := lookupUser(ctx, store, *username)
+
+	if err := store.RemoveTeamMember(ctx, t.ID, user.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing member: %v\n", err)
+		os.Exit(1)
+	}
+	recordAudit(ctx, store, "team.member_remove", "team_member", audit.TeamMemberID(t.ID, user.ID), map[string]interface{}{"username": user.Username}, nil)
+
+	fmt.Printf("User %s removed from team %s.\n", user.Username, t.Name)
+}
+
+func runTeamsSetBudget(args []string) {
+	fs := flag.NewFlagSet("teams set-budget", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required)")
+	team := fs.String("team", "", "Team name (required)")
+	budget := fs.String("budget", "", "Monthly budget in USD; empty removes the budget")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *org == "" || *team == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org and --team are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	monthlyBudget := parseBudget(*budget)
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	t := lookupTeam(ctx, store, *org, *team)
+
+	if err := store.UpdateTeamBudget(ctx, t.ID, monthlyBudget); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating budget: %v\n", err)
+		os.Exit(1)
+	}
+	before := *t
+	t.MonthlyBudget = monthlyBudget
+	recordAudit(ctx, store, "team.budget_set", "team", t.ID.String(), &before, t)
+
+	fmt.Printf("Monthly budget for team %s: %s\n", t.Name, budgetString(monthlyBudget))
+}
+
+func runTeamsAssignKey(args []string) {
+	fs := flag.NewFlagSet("teams assign-key", flag.ExitOnError)
+	org := fs.String("org", "", "Organization name (required with --team)")
+	team := fs.String("team", "", "Team name; empty removes the key from its team")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Error: key ID required")
+		fmt.Fprintln(os.Stderr, "Usage: majordomo teams assign-key --org <org> --team <team> <key-id>")
+		os.Exit(1)
+	}
+
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid key ID: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *team != "" && *org == "" {
+		fmt.Fprintln(os.Stderr, "Error: --org is required with --team")
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	var t *models.Team
+	if *team != "" {
+		t = lookupTeam(ctx, store, *org, *team)
+	}
+
+	if err := store.SetAPIKeyTeam(ctx, id, t); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var after map[string]interface{}
+	if t != nil {
+		after = map[string]interface{}{"team_id": t.ID, "org_id": t.OrgID}
+	}
+	recordAudit(ctx, store, "api_key.team_set", "api_key", id.String(), nil, after)
+
+	if t != nil {
+		fmt.Printf("API key %s assigned to team %s.\n", id, t.Name)
+	} else {
+		fmt.Printf("API key %s removed from its team.\n", id)
+	}
+}
+
+func lookupOrg(ctx context.Context, store storage.Backend, name string) *models.Organization {
+	org, err := store.GetOrganizationByName(ctx, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error looking up organization %q: %v\n", name, err)
+		os.Exit(1)
+	}
+	return org
+}
+
+func lookupTeam(ctx context.Context, store storage.Backend, orgName, name string) *models.Team {
+	org := lookupOrg(ctx, store, orgName)
+	team, err := store.GetTeamByName(ctx, org.ID, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error looking up team %q: %v\n", name, err)
+		os.Exit(1)
+	}
+	return team
+}
+
+// parseBudget parses a --budget flag; an empty value means no budget.
+func parseBudget(s string) *float64 {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --budget %q\n", s)
+		os.Exit(1)
+	}
+	return &v
+}
+
+func budgetString(budget *float64) string {
+	if budget == nil {
+		return "none"
+	}
+	return fmt.Sprintf("$%.2f", *budget)
+}
@@ -7,7 +7,10 @@ import (
 	"os"
 	"text/tabwriter"
 
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func runUsers(args []string) {
@@ -21,6 +24,14 @@ func runUsers(args []string) {
 		runUsersCreate(args[1:])
 	case "list":
 		runUsersList(args[1:])
+	case "set-role":
+		runUsersSetRole(args[1:])
+	case "deactivate":
+		runUsersSetActive(args[1:], false)
+	case "activate":
+		runUsersSetActive(args[1:], true)
+	case "reset-password":
+		runUsersResetPassword(args[1:])
 	case "help", "-h", "--help":
 		printUsersUsage()
 	default:
@@ -34,8 +45,12 @@ func printUsersUsage() {
 	fmt.Println(`Usage: majordomo users <subcommand> [options]
 
 Subcommands:
-  create    Create a new user
-  list      List all users
+  create          Create a new user
+  list            List all users
+  set-role        Change a user's role (admin, member, viewer, billing)
+  deactivate      Deactivate a user so they can no longer log in
+  activate        Reactivate a deactivated user
+  reset-password  Set a new password for a user
 
 Run 'majordomo users <subcommand> --help' for more information.`)
 }
@@ -44,6 +59,7 @@ func runUsersCreate(args []string) {
 	fs := flag.NewFlagSet("users create", flag.ExitOnError)
 	username := fs.String("username", "", "Username (required)")
 	password := fs.String("password", "", "Password (required)")
+	role := fs.String("role", string(models.RoleMember), "Role: admin, member, viewer or billing")
 	configPath := fs.String("config", "", "Path to config file")
 	fs.Parse(args)
 
@@ -59,12 +75,18 @@ func runUsersCreate(args []string) {
 		os.Exit(1)
 	}
 
-	store := connectDB(*configPath, nil)
+	if !models.Role(*role).Valid() {
+		fmt.Fprintf(os.Stderr, "Error: invalid --role %q (expected admin, member, viewer or billing)\n", *role)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	input := &models.CreateUserInput{
 		Username: *username,
 		Password: *password,
+		Role:     models.Role(*role),
 	}
 
 	user, err := store.CreateUser(context.Background(), input)
@@ -72,11 +94,13 @@ func runUsersCreate(args []string) {
 		fmt.Fprintf(os.Stderr, "Error creating user: %v\n", err)
 		os.Exit(1)
 	}
+	recordAudit(context.Background(), store, "user.create", "user", user.ID.String(), nil, user)
 
 	fmt.Println("User created successfully!")
 	fmt.Println()
 	fmt.Printf("ID:       %s\n", user.ID)
 	fmt.Printf("Username: %s\n", user.Username)
+	fmt.Printf("Role:     %s\n", user.Role)
 	fmt.Println()
 }
 
@@ -85,7 +109,7 @@ func runUsersList(args []string) {
 	configPath := fs.String("config", "", "Path to config file")
 	fs.Parse(args)
 
-	store := connectDB(*configPath, nil)
+	store := connectDB(*configPath)
 	defer store.Close()
 
 	users, err := store.ListUsers(context.Background())
@@ -100,15 +124,171 @@ func runUsersList(args []string) {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tUSERNAME\tSTATUS\tCREATED")
+	fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tSTATUS\tCREATED")
 	for _, u := range users {
 		status := "active"
 		if !u.IsActive {
 			status = "inactive"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
-			u.ID, u.Username, status,
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			u.ID, u.Username, u.Role, status,
 			u.CreatedAt.Format("2006-01-02"))
 	}
 	w.Flush()
 }
+
+func runUsersSetRole(args []string) {
+	fs := flag.NewFlagSet("users set-role", flag.ExitOnError)
+	username := fs.String("username", "", "Username (required)")
+	role := fs.String("role", "", "Role: admin, member, viewer or billing (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *username == "" || *role == "" {
+		fmt.Fprintln(os.Stderr, "Error: --username and --role are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	newRole := models.Role(*role)
+	if !newRole.Valid() {
+		fmt.Fprintf(os.Stderr, "Error: invalid --role %q (expected admin, member, viewer or billing)\n", *role)
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	user := lookupUser(ctx, store, *username)
+	if newRole != models.RoleAdmin {
+		checkNotLastAdmin(ctx, store, user)
+	}
+
+	if err := store.UpdateUserRole(ctx, user.ID, newRole); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating role: %v\n", err)
+		os.Exit(1)
+	}
+	before := *user
+	user.Role = newRole
+	recordAudit(ctx, store, "user.role_change", "user", user.ID.String(), &before, user)
+
+	fmt.Printf("User %s is now %s.\n", user.Username, newRole)
+}
+
+func runUsersSetActive(args []string, active bool) {
+	name := "users deactivate"
+	if active {
+		name = "users activate"
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	username := fs.String("username", "", "Username (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *username == "" {
+		fmt.Fprintln(os.Stderr, "Error: --username is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	user := lookupUser(ctx, store, *username)
+	if !active {
+		checkNotLastAdmin(ctx, store, user)
+	}
+
+	if err := store.SetUserActive(ctx, user.ID, active); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating user: %v\n", err)
+		os.Exit(1)
+	}
+	before := *user
+	user.IsActive = active
+	action := "user.deactivate"
+	if active {
+		action = "user.activate"
+	}
+	recordAudit(ctx, store, action, "user", user.ID.String(), &before, user)
+	if !active {
+		revokeSessions(ctx, store, user)
+	}
+
+	if active {
+		fmt.Printf("User %s activated.\n", user.Username)
+	} else {
+		fmt.Printf("User %s deactivated.\n", user.Username)
+	}
+}
+
+func runUsersResetPassword(args []string) {
+	fs := flag.NewFlagSet("users reset-password", flag.ExitOnError)
+	username := fs.String("username", "", "Username (required)")
+	password := fs.String("password", "", "New password (required)")
+	configPath := fs.String("config", "", "Path to config file")
+	fs.Parse(args)
+
+	if *username == "" || *password == "" {
+		fmt.Fprintln(os.Stderr, "Error: --username and --password are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := connectDB(*configPath)
+	defer store.Close()
+
+	ctx := context.Background()
+	user := lookupUser(ctx, store, *username)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), 12)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error hashing password: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := store.UpdateUserPassword(ctx, user.ID, string(hash)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating password: %v\n", err)
+		os.Exit(1)
+	}
+	recordAudit(ctx, store, "user.password_reset", "user", user.ID.String(), nil, nil)
+	revokeSessions(ctx, store, user)
+
+	fmt.Printf("Password for %s reset.\n", user.Username)
+}
+
+// revokeSessions signs a user out of the web UI everywhere
+func revokeSessions(ctx context.Context, store storage.Backend, user *models.User) {
+	if err := store.RevokeUserSessions(ctx, user.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error revoking sessions: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func lookupUser(ctx context.Context, store storage.Backend, username string) *models.User {
+	user, err := store.GetUserByUsername(ctx, username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error looking up user: %v\n", err)
+		os.Exit(1)
+	}
+	if user == nil {
+		fmt.Fprintf(os.Stderr, "Error: user %q not found\n", username)
+		os.Exit(1)
+	}
+	return user
+}
+
+// checkNotLastAdmin exits if user is the only active admin, who can't be
+// demoted or deactivated.
+func checkNotLastAdmin(ctx context.Context, store storage.Backend, user *models.User) {
+	users, err := store.ListUsers(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing users: %v\n", err)
+		os.Exit(1)
+	}
+	if auth.IsLastActiveAdmin(users, user.ID) {
+		fmt.Fprintf(os.Stderr, "Error: %s is the last active admin; make another user admin first\n", user.Username)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// auditEvent builds an audit event for a request. The actor is the logged-in
+// user or, on the /api/v1 routes, the Majordomo API key.
+func auditEvent(r *http.Request, action, targetType, targetID string, before, after interface{}) audit.Event {
+	return audit.Event{
+		Actor:      requestActor(r),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     before,
+		After:      after,
+		SourceIP:   sourceIP(r),
+	}
+}
+
+func requestActor(r *http.Request) audit.Actor {
+	if claims := GetUserInfo(r.Context()); claims != nil {
+		id := claims.UserID
+		return audit.Actor{Type: models.AuditActorUser, ID: &id, Name: claims.Username}
+	}
+	if info := GetAPIKeyInfo(r.Context()); info != nil {
+		id := info.ID
+		actor := audit.Actor{Type: models.AuditActorAPIKey, ID: &id}
+		if info.Alias != nil {
+			actor.Name = *info.Alias
+		}
+		return actor
+	}
+	return audit.Actor{}
+}
+
+// sourceIP returns the address the request came from. Forwarding headers are
+// ignored because clients can set them to anything.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ListAuditEvents handles GET /api/v1/admin/audit-events
+func (h *AdminHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.auditLog.ListAuditEvents(r.Context(), q)
+	if err != nil {
+		slog.Error("failed to list audit events", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []*models.AuditEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// parseAuditQuery reads audit query parameters: from and to (RFC 3339 or
+// YYYY-MM-DD), actor_type, actor_id, action, target_type, target_id and limit.
+func parseAuditQuery(r *http.Request) (*models.AuditQuery, error) {
+	params := r.URL.Query()
+
+	q := &models.AuditQuery{
+		ActorType:  params.Get("actor_type"),
+		Action:     params.Get("action"),
+		TargetType: params.Get("target_type"),
+		TargetID:   params.Get("target_id"),
+	}
+	if v := params.Get("from"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return nil, errors.New("invalid from")
+		}
+		q.From = t
+	}
+	if v := params.Get("to"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return nil, errors.New("invalid to")
+		}
+		q.To = t
+	}
+	if v := params.Get("actor_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, errors.New("invalid actor_id")
+		}
+		q.ActorID = &id
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > storage.MaxAuditLimit {
+			return nil, errors.New("invalid limit")
+		}
+		q.Limit = n
+	}
+
+	return q, nil
+}
+
+// providerMappingAudit is the audited state of a provider mapping. The
+// provider key itself is never recorded.
+func providerMappingAudit(provider string) map[string]string {
+	return map[string]string{"provider": provider}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/routing"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+type experimentRequest struct {
+	Name      string                `json:"name"`
+	Model     string                `json:"model"`
+	StickyKey *string               `json:"sticky_key,omitempty"`
+	Arms      models.ExperimentArms `json:"arms"`
+	IsActive  *bool                 `json:"is_active,omitempty"`
+}
+
+type experimentResultsResponse struct {
+	Experiment *models.Experiment            `json:"experiment"`
+	From       time.Time                     `json:"from"`
+	To         time.Time                     `json:"to"`
+	Arms       []*models.ExperimentArmResult `json:"arms"`
+}
+
+// ListExperiments handles GET /api/v1/admin/experiments
+func (h *RoutesHandler) ListExperiments(w http.ResponseWriter, r *http.Request) {
+	exps, err := h.experiments.ListExperiments(r.Context())
+	if err != nil {
+		slog.Error("failed to list experiments", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exps)
+}
+
+// CreateExperiment handles POST /api/v1/admin/experiments. New experiments
+// are active unless is_active is false.
+func (h *RoutesHandler) CreateExperiment(w http.ResponseWriter, r *http.Request) {
+	exp := &models.Experiment{IsActive: true}
+	if !h.decodeExperiment(w, r, exp) {
+		return
+	}
+
+	if err := h.experiments.CreateExperiment(r.Context(), exp); err != nil {
+		slog.Error("failed to create experiment", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "experiment.create", "experiment", exp.ID.String(), nil, exp))
+	h.reload(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(exp)
+}
+
+// GetExperiment handles GET /api/v1/admin/experiments/{experimentId}
+func (h *RoutesHandler) GetExperiment(w http.ResponseWriter, r *http.Request) {
+	exp, ok := h.getExperimentParam(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exp)
+}
+
+// UpdateExperiment handles PUT /api/v1/admin/experiments/{experimentId}. The
+// request replaces the experiment's name, model, sticky key and arms; the
+// experiment stays active or stopped unless is_active is given.
+func (h *RoutesHandler) UpdateExperiment(w http.ResponseWriter, r *http.Request) {
+	before, ok := h.getExperimentParam(w, r)
+	if !ok {
+		return
+	}
+
+	exp := &models.Experiment{ID: before.ID, IsActive: before.IsActive, CreatedAt: before.CreatedAt}
+	if !h.decodeExperiment(w, r, exp) {
+		return
+	}
+
+	if err := h.experiments.UpdateExperiment(r.Context(), exp); err != nil {
+		if err == storage.ErrExperimentNotFound {
+			http.Error(w, "experiment not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to update experiment", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "experiment.update", "experiment", exp.ID.String(), before, exp))
+	h.reload(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exp)
+}
+
+// DeleteExperiment handles DELETE /api/v1/admin/experiments/{experimentId}
+func (h *RoutesHandler) DeleteExperiment(w http.ResponseWriter, r *http.Request) {
+	exp, ok := h.getExperimentParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.experiments.DeleteExperiment(r.Context(), exp.ID); err != nil {
+		if err == storage.ErrExperimentNotFound {
+			http.Error(w, "experiment not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to delete experiment", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "experiment.delete", "experiment", exp.ID.String(), exp, nil))
+	h.reload(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// GetExperimentResults handles GET /api/v1/admin/experiments/{experimentId}/results.
+// from and to (RFC 3339 or YYYY-MM-DD) default to the experiment's creation
+// and now. Every arm of the experiment is listed, with zeros if it served no
+// requests, followed by arms that have since been removed.
+func (h *RoutesHandler) GetExperimentResults(w http.ResponseWriter, r *http.Request) {
+	exp, ok := h.getExperimentParam(w, r)
+	if !ok {
+		return
+	}
+
+	from, to := exp.CreatedAt, time.Now().UTC()
+	params := r.URL.Query()
+	if v := params.Get("from"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := params.Get("to"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.experiments.ExperimentResults(r.Context(), exp.ID, from, to)
+	if err != nil {
+		slog.Error("failed to query experiment results", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	byArm := make(map[string]*models.ExperimentArmResult, len(results))
+	for _, result := range results {
+		byArm[result.Arm] = result
+	}
+	arms := make([]*models.ExperimentArmResult, 0, len(exp.Arms)+len(results))
+	for _, arm := range exp.Arms {
+		if result, ok := byArm[arm.Name]; ok {
+			arms = append(arms, result)
+			delete(byArm, arm.Name)
+		} else {
+			arms = append(arms, &models.ExperimentArmResult{Arm: arm.Name})
+		}
+	}
+	for _, result := range results {
+		if _, ok := byArm[result.Arm]; ok {
+			arms = append(arms, result)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(experimentResultsResponse{Experiment: exp, From: from, To: to, Arms: arms})
+}
+
+// decodeExperiment reads an experiment from the request body into exp,
+// validates it and checks that no other experiment is active for its model.
+// It writes an error response and returns false if any of that fails.
+func (h *RoutesHandler) decodeExperiment(w http.ResponseWriter, r *http.Request, exp *models.Experiment) bool {
+	var req experimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	exp.Name = req.Name
+	exp.Model = req.Model
+	exp.StickyKey = req.StickyKey
+	exp.Arms = req.Arms
+	if req.IsActive != nil {
+		exp.IsActive = *req.IsActive
+	}
+	if err := routing.ValidateExperiment(exp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if !exp.IsActive {
+		return true
+	}
+	exps, err := h.experiments.ListExperiments(r.Context())
+	if err != nil {
+		slog.Error("failed to list experiments", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return false
+	}
+	for _, other := range exps {
+		if other.IsActive && other.Model == exp.Model && other.ID != exp.ID {
+			http.Error(w, "model already has an active experiment", http.StatusConflict)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *RoutesHandler) getExperimentParam(w http.ResponseWriter, r *http.Request) (*models.Experiment, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "experimentId"))
+	if err != nil {
+		http.Error(w, "invalid experiment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	exp, err := h.experiments.GetExperiment(r.Context(), id)
+	if err != nil {
+		if err == storage.ErrExperimentNotFound {
+			http.Error(w, "experiment not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get experiment", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return exp, true
+}
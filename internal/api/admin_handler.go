@@ -2,11 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
 	"github.com/superset-studio/majordomo-gateway/internal/secrets"
@@ -19,24 +24,39 @@ type AdminHandler struct {
 	apiKeys   storage.APIKeyStorage
 	proxyKeys storage.ProxyKeyStorage
 	users     storage.UserStorage
+	teams     storage.TeamStorage
+	usage     storage.UsageStorage
 	secrets   secrets.SecretStore
-	jwt       *auth.JWTService
+	sessions  *auth.SessionManager
+	throttle  *auth.LoginThrottle
+	auditLog  storage.AuditStorage
+	audit     *audit.Recorder
 }
 
-// NewAdminHandler creates a new admin API handler.
+// NewAdminHandler creates a new admin API handler. Password logins are
+// limited by throttle. Changes are recorded in auditLog.
 func NewAdminHandler(
 	apiKeys storage.APIKeyStorage,
 	proxyKeys storage.ProxyKeyStorage,
 	users storage.UserStorage,
+	teams storage.TeamStorage,
+	usage storage.UsageStorage,
 	secretStore secrets.SecretStore,
-	jwtSvc *auth.JWTService,
+	sessions *auth.SessionManager,
+	throttle *auth.LoginThrottle,
+	auditLog storage.AuditStorage,
 ) *AdminHandler {
 	return &AdminHandler{
 		apiKeys:   apiKeys,
 		proxyKeys: proxyKeys,
 		users:     users,
+		teams:     teams,
+		usage:     usage,
 		secrets:   secretStore,
-		jwt:       jwtSvc,
+		sessions:  sessions,
+		throttle:  throttle,
+		auditLog:  auditLog,
+		audit:     audit.NewRecorder(auditLog),
 	}
 }
 
@@ -48,8 +68,21 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"`
+	Token            string       `json:"token"`
+	ExpiresAt        time.Time    `json:"expires_at"`
+	RefreshToken     string       `json:"refresh_token"`
+	RefreshExpiresAt time.Time    `json:"refresh_expires_at"`
+	User             *models.User `json:"user"`
+}
+
+func newLoginResponse(tokens *auth.Tokens, user *models.User) loginResponse {
+	return loginResponse{
+		Token:            tokens.AccessToken,
+		ExpiresAt:        tokens.AccessExpiresAt,
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: tokens.RefreshExpiresAt,
+		User:             user,
+	}
 }
 
 // Login handles POST /api/v1/admin/login
@@ -65,6 +98,16 @@ func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked-out logins are rejected before the password is checked, so
+	// guesses made during a lockout reveal nothing
+	ip := sourceIP(r)
+	if wait := h.throttle.Check(req.Username, ip); wait > 0 {
+		slog.Warn("login rejected during lockout", "username", req.Username, "source_ip", ip)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many failed logins; try again later", http.StatusTooManyRequests)
+		return
+	}
+
 	user, err := h.users.GetUserByUsername(r.Context(), req.Username)
 	if err != nil {
 		slog.Error("failed to get user", "error", err)
@@ -73,24 +116,88 @@ func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if user == nil || !user.IsActive {
+		h.throttle.Failure(req.Username, ip)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.throttle.Failure(req.Username, ip)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	h.throttle.Success(req.Username)
 
-	token, err := h.jwt.GenerateToken(user.ID, user.Username)
+	tokens, err := h.sessions.Start(r.Context(), user, r.UserAgent(), ip)
 	if err != nil {
-		slog.Error("failed to generate token", "error", err)
+		slog.Error("failed to start session", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(loginResponse{Token: token, User: user})
+	json.NewEncoder(w).Encode(newLoginResponse(tokens, user))
+}
+
+// --- Refresh and Logout ---
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh handles POST /api/v1/admin/refresh. It exchanges a refresh token
+// for a new access token and refresh token; the old refresh token stops
+// working.
+func (h *AdminHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, user, err := h.sessions.Refresh(r.Context(), req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidSession) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to refresh session", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newLoginResponse(tokens, user))
+}
+
+// Logout handles POST /api/v1/admin/logout. It revokes the current session,
+// or with ?all=true every session of the user.
+func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := GetUserInfo(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	if r.URL.Query().Get("all") == "true" {
+		err = h.sessions.RevokeUser(r.Context(), claims.UserID)
+	} else {
+		err = h.sessions.Revoke(r.Context(), claims.SessionID)
+	}
+	if err != nil {
+		slog.Error("failed to revoke session", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 // --- Me ---
@@ -121,7 +228,8 @@ type changePasswordRequest struct {
 	NewPassword     string `json:"new_password"`
 }
 
-// ChangePassword handles PUT /api/v1/admin/me/password
+// ChangePassword handles PUT /api/v1/admin/me/password. Every session of the
+// user is revoked and the response carries new tokens, like login.
 func (h *AdminHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	claims := GetUserInfo(r.Context())
 	if claims == nil {
@@ -164,16 +272,33 @@ func (h *AdminHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "user.password_change", "user", claims.UserID.String(), nil, nil))
+
+	// Sign out every session, including ones an attacker who knew the old
+	// password may hold, and give the caller a fresh one
+	if err := h.sessions.RevokeUser(r.Context(), claims.UserID); err != nil {
+		slog.Error("failed to revoke sessions", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	tokens, err := h.sessions.Start(r.Context(), user, r.UserAgent(), sourceIP(r))
+	if err != nil {
+		slog.Error("failed to start session", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(newLoginResponse(tokens, user))
 }
 
 // --- API Keys ---
 
 type adminCreateAPIKeyRequest struct {
-	Name        string  `json:"name"`
-	Description *string `json:"description,omitempty"`
+	Name        string        `json:"name"`
+	Description *string       `json:"description,omitempty"`
+	TeamID      *uuid.UUID    `json:"team_id,omitempty"`
+	Scopes      models.Scopes `json:"scopes,omitempty"` // Defaults to every scope
 }
 
 type adminCreateAPIKeyResponse struct {
@@ -182,6 +307,8 @@ type adminCreateAPIKeyResponse struct {
 }
 
 // ListAPIKeys handles GET /api/v1/admin/api-keys
+// Users with access to every key get all API keys, or one user's keys with
+// ?user_id=; everyone else gets their own and their teams' keys.
 func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	claims := GetUserInfo(r.Context())
 	if claims == nil {
@@ -189,7 +316,21 @@ func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	keys, err := h.apiKeys.ListAPIKeysByUserID(r.Context(), claims.UserID)
+	var keys []*models.APIKey
+	var err error
+	switch userID := r.URL.Query().Get("user_id"); {
+	case !auth.HasPermission(claims.Role, auth.PermAllKeys):
+		keys, err = h.listOwnAndTeamAPIKeys(r, claims)
+	case userID != "":
+		id, parseErr := uuid.Parse(userID)
+		if parseErr != nil {
+			http.Error(w, "invalid user_id", http.StatusBadRequest)
+			return
+		}
+		keys, err = h.apiKeys.ListAPIKeysByUserID(r.Context(), id)
+	default:
+		keys, err = h.apiKeys.ListAPIKeys(r.Context())
+	}
 	if err != nil {
 		slog.Error("failed to list API keys", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -218,6 +359,22 @@ func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
+	if req.Scopes != nil {
+		if err := req.Scopes.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Scopes = req.Scopes.Normalize()
+	}
+
+	var team *models.Team
+	if req.TeamID != nil {
+		var ok bool
+		team, ok = h.authorizeTeam(w, r, *req.TeamID, auth.PermAllKeys, auth.PermAPIKeysWrite)
+		if !ok {
+			return
+		}
+	}
 
 	plaintext, hash, err := auth.GenerateAPIKey()
 	if err != nil {
@@ -231,6 +388,8 @@ func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		Name:        req.Name,
 		Description: req.Description,
 		UserID:      &userID,
+		Team:        team,
+		Scopes:      req.Scopes,
 	}
 
 	key, err := h.apiKeys.CreateAPIKey(r.Context(), hash, input)
@@ -239,6 +398,7 @@ func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "api_key.create", "api_key", key.ID.String(), nil, key))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -253,7 +413,7 @@ func (h *AdminHandler) GetAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	key, ok := h.verifyAPIKeyOwnership(w, r, claims)
+	key, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermAPIKeysRead)
 	if !ok {
 		return
 	}
@@ -270,23 +430,32 @@ func (h *AdminHandler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims)
+	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermAPIKeysWrite)
 	if !ok {
 		return
 	}
 
 	var req struct {
-		Name        *string `json:"name,omitempty"`
-		Description *string `json:"description,omitempty"`
+		Name        *string       `json:"name,omitempty"`
+		Description *string       `json:"description,omitempty"`
+		Scopes      models.Scopes `json:"scopes,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.Scopes != nil {
+		if err := req.Scopes.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Scopes = req.Scopes.Normalize()
+	}
 
 	input := &models.UpdateAPIKeyInput{
 		Name:        req.Name,
 		Description: req.Description,
+		Scopes:      req.Scopes,
 	}
 
 	updated, err := h.apiKeys.UpdateAPIKey(r.Context(), apiKey.ID, input)
@@ -295,6 +464,7 @@ func (h *AdminHandler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "api_key.update", "api_key", apiKey.ID.String(), apiKey, updated))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updated)
@@ -308,7 +478,7 @@ func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims)
+	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermAPIKeysWrite)
 	if !ok {
 		return
 	}
@@ -318,6 +488,7 @@ func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "api_key.revoke", "api_key", apiKey.ID.String(), apiKey, nil))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
@@ -333,7 +504,7 @@ func (h *AdminHandler) ListProxyKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims)
+	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermProxyKeysRead)
 	if !ok {
 		return
 	}
@@ -357,15 +528,12 @@ func (h *AdminHandler) CreateProxyKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims)
+	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermProxyKeysWrite)
 	if !ok {
 		return
 	}
 
-	var req struct {
-		Name        string  `json:"name"`
-		Description *string `json:"description,omitempty"`
-	}
+	var req createProxyKeyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
@@ -384,8 +552,9 @@ func (h *AdminHandler) CreateProxyKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	input := &models.CreateProxyKeyInput{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:             req.Name,
+		Description:      req.Description,
+		SingleHeaderAuth: req.SingleHeaderAuth,
 	}
 
 	pk, err := h.proxyKeys.CreateProxyKey(r.Context(), hash, apiKey.ID, input)
@@ -394,6 +563,7 @@ func (h *AdminHandler) CreateProxyKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "proxy_key.create", "proxy_key", pk.ID.String(), nil, pk))
 
 	resp := struct {
 		*models.ProxyKey
@@ -413,7 +583,7 @@ func (h *AdminHandler) GetProxyKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims)
+	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims, auth.PermProxyKeysRead)
 	if !ok {
 		return
 	}
@@ -430,7 +600,7 @@ func (h *AdminHandler) RevokeProxyKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims)
+	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims, auth.PermProxyKeysWrite)
 	if !ok {
 		return
 	}
@@ -440,11 +610,50 @@ func (h *AdminHandler) RevokeProxyKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "proxy_key.revoke", "proxy_key", pk.ID.String(), pk, nil))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
 }
 
+// SetSingleHeaderAuth handles PUT /api/v1/admin/api-keys/{id}/proxy-keys/{pkId}/single-header-auth
+func (h *AdminHandler) SetSingleHeaderAuth(w http.ResponseWriter, r *http.Request) {
+	claims := GetUserInfo(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims, auth.PermProxyKeysWrite)
+	if !ok {
+		return
+	}
+
+	var req setSingleHeaderAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !pk.IsActive {
+		http.Error(w, "proxy key has been revoked", http.StatusConflict)
+		return
+	}
+
+	if err := h.proxyKeys.SetProxyKeySingleHeaderAuth(r.Context(), pk.ID, req.Enabled); err != nil {
+		slog.Error("failed to set proxy key single-header auth", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	updated := *pk
+	updated.SingleHeaderAuth = req.Enabled
+	h.audit.Record(r.Context(), auditEvent(r, "proxy_key.single_header_auth_set", "proxy_key", pk.ID.String(), pk, &updated))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&updated)
+}
+
 // --- Provider Mappings (nested under proxy keys) ---
 
 // ListProviderMappings handles GET /api/v1/admin/api-keys/{id}/proxy-keys/{pkId}/providers
@@ -455,7 +664,7 @@ func (h *AdminHandler) ListProviderMappings(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims)
+	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims, auth.PermProxyKeysRead)
 	if !ok {
 		return
 	}
@@ -491,7 +700,7 @@ func (h *AdminHandler) SetProviderMapping(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims)
+	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims, auth.PermProxyKeysWrite)
 	if !ok {
 		return
 	}
@@ -513,10 +722,8 @@ func (h *AdminHandler) SetProviderMapping(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	encrypted, err := h.secrets.Encrypt(req.APIKey)
-	if err != nil {
-		slog.Error("failed to encrypt provider key", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	encrypted, ok := encryptProviderKey(w, h.secrets, req.APIKey)
+	if !ok {
 		return
 	}
 
@@ -525,6 +732,7 @@ func (h *AdminHandler) SetProviderMapping(w http.ResponseWriter, r *http.Request
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "provider_mapping.set", "proxy_key", pk.ID.String(), nil, providerMappingAudit(providerName)))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "provider": providerName})
@@ -538,7 +746,7 @@ func (h *AdminHandler) DeleteProviderMapping(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims)
+	_, pk, ok := h.verifyProxyKeyOwnership(w, r, claims, auth.PermProxyKeysWrite)
 	if !ok {
 		return
 	}
@@ -558,16 +766,91 @@ func (h *AdminHandler) DeleteProviderMapping(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "provider_mapping.delete", "proxy_key", pk.ID.String(), providerMappingAudit(providerName), nil))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
+// --- Usage ---
+
+// GetAPIKeyUsage handles GET /api/v1/admin/api-keys/{id}/usage
+func (h *AdminHandler) GetAPIKeyUsage(w http.ResponseWriter, r *http.Request) {
+	claims := GetUserInfo(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermUsageRead)
+	if !ok {
+		return
+	}
+
+	q, err := parseUsageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.MajordomoAPIKeyID = &key.ID
+
+	writeUsage(w, r, h.usage, q)
+}
+
+// GetShadowUsage handles GET /api/v1/admin/usage/shadow. It compares shadow
+// requests with the primary requests they mirrored, per rule and model.
+// from and to (RFC 3339 or YYYY-MM-DD) default to the last 7 days and may
+// span at most 31, since the comparison is computed from the request log.
+func (h *AdminHandler) GetShadowUsage(w http.ResponseWriter, r *http.Request) {
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -7)
+	params := r.URL.Query()
+	if v := params.Get("to"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if v := params.Get("from"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxUsageRange[models.GranularityHour] {
+		http.Error(w, "time range too large", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.usage.ShadowResults(r.Context(), from, to)
+	if err != nil {
+		slog.Error("failed to query shadow usage", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []*models.ShadowResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
 // --- Ownership verification helpers ---
 
 // verifyAPIKeyOwnership parses the {id} URL param, fetches the API key, and verifies
-// it belongs to the authenticated user. Returns the key and true on success.
-func (h *AdminHandler) verifyAPIKeyOwnership(w http.ResponseWriter, r *http.Request, claims *auth.JWTClaims) (*models.APIKey, bool) {
+// the authenticated user may use perm on it: the key is theirs, it belongs to a
+// team where their team role grants perm, or their role grants access to every
+// key. Returns the key and true on success.
+func (h *AdminHandler) verifyAPIKeyOwnership(w http.ResponseWriter, r *http.Request, claims *auth.JWTClaims, perm auth.Permission) (*models.APIKey, bool) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
 		http.Error(w, "invalid API key ID", http.StatusBadRequest)
@@ -585,17 +868,33 @@ func (h *AdminHandler) verifyAPIKeyOwnership(w http.ResponseWriter, r *http.Requ
 		return nil, false
 	}
 
-	if key.UserID == nil || *key.UserID != claims.UserID {
-		http.Error(w, "API key not found", http.StatusNotFound)
-		return nil, false
+	if auth.HasPermission(claims.Role, auth.PermAllKeys) {
+		return key, true
+	}
+
+	if key.UserID != nil && *key.UserID == claims.UserID {
+		return key, true
+	}
+
+	if key.TeamID != nil {
+		role, err := h.teams.GetTeamMemberRole(r.Context(), *key.TeamID, claims.UserID)
+		if err != nil {
+			slog.Error("failed to get team role", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return nil, false
+		}
+		if role != "" && auth.HasPermission(role, perm) {
+			return key, true
+		}
 	}
 
-	return key, true
+	http.Error(w, "API key not found", http.StatusNotFound)
+	return nil, false
 }
 
 // verifyProxyKeyOwnership verifies both the API key and proxy key ownership chain.
-func (h *AdminHandler) verifyProxyKeyOwnership(w http.ResponseWriter, r *http.Request, claims *auth.JWTClaims) (*models.APIKey, *models.ProxyKey, bool) {
-	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims)
+func (h *AdminHandler) verifyProxyKeyOwnership(w http.ResponseWriter, r *http.Request, claims *auth.JWTClaims, perm auth.Permission) (*models.APIKey, *models.ProxyKey, bool) {
+	apiKey, ok := h.verifyAPIKeyOwnership(w, r, claims, perm)
 	if !ok {
 		return nil, nil, false
 	}
@@ -624,3 +923,44 @@ func (h *AdminHandler) verifyProxyKeyOwnership(w http.ResponseWriter, r *http.Re
 
 	return apiKey, pk, true
 }
+
+// listOwnAndTeamAPIKeys returns the user's own API keys and the keys of every
+// team where their team role can read API keys.
+func (h *AdminHandler) listOwnAndTeamAPIKeys(r *http.Request, claims *auth.JWTClaims) ([]*models.APIKey, error) {
+	keys, err := h.apiKeys.ListAPIKeysByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := h.teams.ListTeamsByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uuid.UUID]bool, len(keys))
+	for _, k := range keys {
+		seen[k.ID] = true
+	}
+	for _, team := range teams {
+		role, err := h.teams.GetTeamMemberRole(r.Context(), team.ID, claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !auth.HasPermission(role, auth.PermAPIKeysRead) {
+			continue
+		}
+
+		teamKeys, err := h.apiKeys.ListAPIKeysByTeamID(r.Context(), team.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range teamKeys {
+			if !seen[k.ID] {
+				seen[k.ID] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	return keys, nil
+}
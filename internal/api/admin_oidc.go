@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// oidcStateCookie holds the signed login state between the redirect to the
+// OIDC provider and the callback.
+const oidcStateCookie = "majordomo_oidc_state"
+
+// errOIDCForbidden is returned when the provider authenticated the user but
+// Majordomo won't let them in.
+var errOIDCForbidden = errors.New("forbidden")
+
+// OIDCHandler provides single sign-on for the admin API through an OIDC
+// provider. After the callback it starts a session like password login.
+type OIDCHandler struct {
+	provider      *auth.OIDCProvider
+	users         storage.UserStorage
+	sessions      *auth.SessionManager
+	audit         *audit.Recorder
+	uiRedirectURL string
+}
+
+// NewOIDCHandler creates a new OIDC login handler. When uiRedirectURL is set,
+// the callback redirects there with the tokens in the URL fragment
+// (#token=...&refresh_token=...); otherwise it responds with the same JSON as
+// password login. Users provisioned, linked or given a new role are recorded
+// in auditLog.
+func NewOIDCHandler(provider *auth.OIDCProvider, users storage.UserStorage, sessions *auth.SessionManager, auditLog storage.AuditStorage, uiRedirectURL string) *OIDCHandler {
+	return &OIDCHandler{
+		provider:      provider,
+		users:         users,
+		sessions:      sessions,
+		audit:         audit.NewRecorder(auditLog),
+		uiRedirectURL: uiRedirectURL,
+	}
+}
+
+// Login handles GET /api/v1/admin/oidc/login
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	login, err := h.provider.StartLogin()
+	if err != nil {
+		slog.Error("failed to start oidc login", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    login.State,
+		Path:     "/api/v1/admin/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, login.AuthURL, http.StatusFound)
+}
+
+// Callback handles GET /api/v1/admin/oidc/callback
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		http.Error(w, "login failed: "+errCode+" "+q.Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, "login state missing; start again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/admin/oidc", MaxAge: -1})
+
+	identity, err := h.provider.FinishLogin(r.Context(), cookie.Value, q.Get("state"), q.Get("code"))
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCLoginState) {
+			http.Error(w, "login state invalid or expired; start again", http.StatusBadRequest)
+			return
+		}
+		slog.Warn("oidc login failed", "error", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.provisionUser(r, identity)
+	if err != nil {
+		if errors.Is(err, errOIDCForbidden) {
+			slog.Warn("oidc login rejected", "username", identity.Username, "reason", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		slog.Error("failed to provision oidc user", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.sessions.Start(r.Context(), user, r.UserAgent(), sourceIP(r))
+	if err != nil {
+		slog.Error("failed to start session", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.uiRedirectURL != "" {
+		target := strings.SplitN(h.uiRedirectURL, "#", 2)[0]
+		fragment := url.Values{"token": {tokens.AccessToken}, "refresh_token": {tokens.RefreshToken}}
+		http.Redirect(w, r, target+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newLoginResponse(tokens, user))
+}
+
+// provisionUser finds or creates the user for an OIDC identity. A local user
+// with the same username and no linked identity is linked on first login only
+// when the provider allows it (see auth.OIDCProvider.CanLink); otherwise the
+// login is refused, since anyone who controls the username claim could take
+// the account over.
+// When roles come from the provider, the user's role is updated to match,
+// except that the last active admin is never demoted.
+func (h *OIDCHandler) provisionUser(r *http.Request, id *auth.OIDCIdentity) (*models.User, error) {
+	ctx := r.Context()
+	if h.provider.MapsRoles() && id.Role == "" {
+		return nil, fmt.Errorf("%w: no role is mapped for this account", errOIDCForbidden)
+	}
+
+	user, err := h.users.GetUserByOIDCSubject(ctx, id.Issuer, id.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		existing, err := h.users.GetUserByUsername(ctx, id.Username)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case existing == nil:
+			if id.Role == "" {
+				return nil, fmt.Errorf("%w: no role is mapped for this account", errOIDCForbidden)
+			}
+			user, err = h.users.CreateOIDCUser(ctx, id.Username, id.Issuer, id.Subject, id.Role)
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("provisioned oidc user", "username", user.Username, "role", user.Role)
+			h.record(r, user, "user.create", nil, user)
+			return user, nil
+		case existing.OIDCSubject != nil:
+			return nil, fmt.Errorf("%w: username %s is linked to another identity", errOIDCForbidden, id.Username)
+		case !h.provider.CanLink(id):
+			return nil, fmt.Errorf("%w: username %s belongs to a local user", errOIDCForbidden, id.Username)
+		default:
+			if err := h.users.LinkUserOIDC(ctx, existing.ID, id.Issuer, id.Subject); err != nil {
+				return nil, err
+			}
+			slog.Info("linked user to oidc identity", "username", existing.Username)
+			before := *existing
+			existing.OIDCIssuer, existing.OIDCSubject = &id.Issuer, &id.Subject
+			h.record(r, existing, "user.oidc_link", &before, existing)
+			user = existing
+		}
+	}
+
+	if !user.IsActive {
+		return nil, fmt.Errorf("%w: account is deactivated", errOIDCForbidden)
+	}
+
+	if h.provider.MapsRoles() && id.Role != user.Role {
+		if user.Role == models.RoleAdmin {
+			users, err := h.users.ListUsers(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if auth.IsLastActiveAdmin(users, user.ID) {
+				slog.Warn("not demoting last active admin from oidc role mapping", "username", user.Username, "mapped_role", id.Role)
+				return user, nil
+			}
+		}
+		if err := h.users.UpdateUserRole(ctx, user.ID, id.Role); err != nil {
+			return nil, err
+		}
+		slog.Info("updated user role from oidc", "username", user.Username, "old_role", user.Role, "role", id.Role)
+		before := *user
+		user.Role = id.Role
+		h.record(r, user, "user.role_change", &before, user)
+	}
+
+	return user, nil
+}
+
+// record writes an audit event for a change SSO login made to user. The user
+// logging in is the actor.
+func (h *OIDCHandler) record(r *http.Request, user *models.User, action string, before, after interface{}) {
+	event := auditEvent(r, action, "user", user.ID.String(), before, after)
+	id := user.ID
+	event.Actor = audit.Actor{Type: models.AuditActorUser, ID: &id, Name: user.Username}
+	h.audit.Record(r.Context(), event)
+}
+
+// PasswordLoginDisabled handles POST /api/v1/admin/login when only OIDC login
+// is allowed.
+func PasswordLoginDisabled(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "password login is disabled; log in with single sign-on", http.StatusForbidden)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// newTestOIDCProvider returns a provider backed by a server that only serves
+// discovery, which is enough to call provisionUser with ready-made identities
+func newTestOIDCProvider(t *testing.T, linkExisting bool) *auth.OIDCProvider {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+		IssuerURL:         srv.URL,
+		ClientID:          "majordomo",
+		RedirectURL:       "https://gateway.example.com/api/v1/admin/oidc/callback",
+		DefaultRole:       models.RoleViewer,
+		LinkExistingUsers: linkExisting,
+	}, []byte("state-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProvisionUser_LinksOnlyVerifiedWhenEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     bool
+		verified bool
+		wantLink bool
+	}{
+		{"unverified", true, false, false},
+		{"linking off", false, true, false},
+		{"verified and enabled", true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newTestStore(t)
+			admin := newTestUser(t, store, "admin", models.RoleAdmin)
+			p := newTestOIDCProvider(t, tt.link)
+			h := NewOIDCHandler(p, store, nil, store, "")
+
+			id := &auth.OIDCIdentity{Issuer: p.Issuer(), Subject: "attacker", Username: "admin", Role: models.RoleViewer, UsernameVerified: tt.verified}
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/oidc/callback", nil)
+			user, err := h.provisionUser(req, id)
+
+			linked, lookupErr := store.GetUserByOIDCSubject(ctx, p.Issuer(), "attacker")
+			if lookupErr != nil {
+				t.Fatal(lookupErr)
+			}
+			if !tt.wantLink {
+				if !errors.Is(err, errOIDCForbidden) {
+					t.Errorf("provisionUser error = %v, want %v", err, errOIDCForbidden)
+				}
+				if linked != nil {
+					t.Errorf("identity was linked to %s", linked.Username)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("provisionUser: %v", err)
+			}
+			if user.ID != admin.ID || linked == nil || linked.ID != admin.ID {
+				t.Errorf("identity not linked to the existing user: user = %+v, linked = %+v", user, linked)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/prompt"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// PromptsHandler serves the prompt template endpoints of the admin API
+type PromptsHandler struct {
+	prompts  storage.PromptStorage
+	registry *prompt.Registry
+	audit    *audit.Recorder
+}
+
+// NewPromptsHandler creates a new prompt template handler. Changes are
+// applied to registry straight away and recorded in auditLog.
+func NewPromptsHandler(prompts storage.PromptStorage, registry *prompt.Registry, auditLog storage.AuditStorage) *PromptsHandler {
+	return &PromptsHandler{
+		prompts:  prompts,
+		registry: registry,
+		audit:    audit.NewRecorder(auditLog),
+	}
+}
+
+type promptRequest struct {
+	Name        string                `json:"name"`
+	Description *string               `json:"description,omitempty"`
+	Messages    models.PromptMessages `json:"messages"`
+}
+
+// ListPrompts handles GET /api/v1/admin/prompts, returning the latest version
+// of each prompt template
+func (h *PromptsHandler) ListPrompts(w http.ResponseWriter, r *http.Request) {
+	prompts, err := h.prompts.ListPrompts(r.Context())
+	if err != nil {
+		slog.Error("failed to list prompt templates", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writePrompts(w, prompts)
+}
+
+// CreatePrompt handles POST /api/v1/admin/prompts. It adds the next version
+// of the named prompt template, which is version 1 for a new name.
+func (h *PromptsHandler) CreatePrompt(w http.ResponseWriter, r *http.Request) {
+	var req promptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	p := &models.PromptTemplate{Name: req.Name, Description: req.Description, Messages: req.Messages}
+	if err := prompt.Validate(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.prompts.CreatePromptVersion(r.Context(), p); err != nil {
+		slog.Error("failed to create prompt template", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	p.Variables = prompt.Variables(p.Messages)
+	h.audit.Record(r.Context(), auditEvent(r, "prompt.create", "prompt", promptID(p), nil, p))
+	h.registry.Invalidate(p.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// GetPrompt handles GET /api/v1/admin/prompts/{name}, returning the latest
+// version
+func (h *PromptsHandler) GetPrompt(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.getPrompt(w, r, chi.URLParam(r, "name"), 0)
+	if !ok {
+		return
+	}
+
+	writePrompt(w, p)
+}
+
+// ListPromptVersions handles GET /api/v1/admin/prompts/{name}/versions,
+// newest first
+func (h *PromptsHandler) ListPromptVersions(w http.ResponseWriter, r *http.Request) {
+	prompts, err := h.prompts.ListPromptVersions(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		slog.Error("failed to list prompt template versions", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if len(prompts) == 0 {
+		http.Error(w, "prompt template not found", http.StatusNotFound)
+		return
+	}
+
+	writePrompts(w, prompts)
+}
+
+// GetPromptVersion handles GET /api/v1/admin/prompts/{name}/versions/{version}
+func (h *PromptsHandler) GetPromptVersion(w http.ResponseWriter, r *http.Request) {
+	version, ok := versionParam(w, r)
+	if !ok {
+		return
+	}
+	p, ok := h.getPrompt(w, r, chi.URLParam(r, "name"), version)
+	if !ok {
+		return
+	}
+
+	writePrompt(w, p)
+}
+
+// DeletePromptVersion handles DELETE
+// /api/v1/admin/prompts/{name}/versions/{version}. Requests that reference
+// the version fail from then on.
+func (h *PromptsHandler) DeletePromptVersion(w http.ResponseWriter, r *http.Request) {
+	version, ok := versionParam(w, r)
+	if !ok {
+		return
+	}
+	p, ok := h.getPrompt(w, r, chi.URLParam(r, "name"), version)
+	if !ok {
+		return
+	}
+
+	if err := h.prompts.DeletePromptVersion(r.Context(), p.Name, p.Version); err != nil {
+		if err == storage.ErrPromptNotFound {
+			http.Error(w, "prompt template not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to delete prompt template", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "prompt.delete", "prompt", promptID(p), p, nil))
+	h.registry.Invalidate(p.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// GetPromptResults handles GET /api/v1/admin/prompts/{name}/results,
+// comparing the requests rendered from each version. The range defaults to
+// the time since the first stored version was created; from and to may be
+// RFC 3339 times or dates.
+func (h *PromptsHandler) GetPromptResults(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	versions, err := h.prompts.ListPromptVersions(r.Context(), name)
+	if err != nil {
+		slog.Error("failed to list prompt template versions", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "prompt template not found", http.StatusNotFound)
+		return
+	}
+
+	from, to := versions[len(versions)-1].CreatedAt, time.Now().UTC()
+	params := r.URL.Query()
+	if v := params.Get("from"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := params.Get("to"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.prompts.PromptResults(r.Context(), name, from, to)
+	if err != nil {
+		slog.Error("failed to query prompt template results", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []*models.PromptVersionResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":     name,
+		"from":     from,
+		"to":       to,
+		"versions": results,
+	})
+}
+
+func (h *PromptsHandler) getPrompt(w http.ResponseWriter, r *http.Request, name string, version int) (*models.PromptTemplate, bool) {
+	p, err := h.prompts.GetPromptVersion(r.Context(), name, version)
+	if err != nil {
+		if err == storage.ErrPromptNotFound {
+			http.Error(w, "prompt template not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get prompt template", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return p, true
+}
+
+// versionParam parses the {version} URL parameter, a positive number or
+// "latest" for 0
+func versionParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := chi.URLParam(r, "version")
+	if v == "latest" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+func promptID(p *models.PromptTemplate) string {
+	return fmt.Sprintf("%s@%d", p.Name, p.Version)
+}
+
+func writePrompt(w http.ResponseWriter, p *models.PromptTemplate) {
+	p.Variables = prompt.Variables(p.Messages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+func writePrompts(w http.ResponseWriter, prompts []*models.PromptTemplate) {
+	if prompts == nil {
+		prompts = []*models.PromptTemplate{}
+	}
+	for _, p := range prompts {
+		p.Variables = prompt.Variables(p.Messages)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompts)
+}
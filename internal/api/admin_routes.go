@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/routing"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// RoutesHandler serves the model route and experiment endpoints of the admin
+// API
+type RoutesHandler struct {
+	routes      storage.ModelRouteStorage
+	experiments storage.ExperimentStorage
+	apiKeys     storage.APIKeyStorage
+	proxyKeys   storage.ProxyKeyStorage
+	router      *routing.Router
+	audit       *audit.Recorder
+}
+
+// NewRoutesHandler creates a new model route and experiment handler. Changes
+// are applied to router straight away and recorded in auditLog.
+func NewRoutesHandler(
+	routes storage.ModelRouteStorage,
+	experiments storage.ExperimentStorage,
+	apiKeys storage.APIKeyStorage,
+	proxyKeys storage.ProxyKeyStorage,
+	router *routing.Router,
+	auditLog storage.AuditStorage,
+) *RoutesHandler {
+	return &RoutesHandler{
+		routes:      routes,
+		experiments: experiments,
+		apiKeys:     apiKeys,
+		proxyKeys:   proxyKeys,
+		router:      router,
+		audit:       audit.NewRecorder(auditLog),
+	}
+}
+
+type modelRouteRequest struct {
+	Name           string     `json:"name"`
+	TargetProvider string     `json:"target_provider,omitempty"`
+	TargetModel    string     `json:"target_model"`
+	APIKeyID       *uuid.UUID `json:"api_key_id,omitempty"`
+	ProxyKeyID     *uuid.UUID `json:"proxy_key_id,omitempty"`
+	MetadataKey    *string    `json:"metadata_key,omitempty"`
+	MetadataValue  *string    `json:"metadata_value,omitempty"`
+}
+
+// ListRoutes handles GET /api/v1/admin/routes
+func (h *RoutesHandler) ListRoutes(w http.ResponseWriter, r *http.Request) {
+	routes, err := h.routes.ListModelRoutes(r.Context())
+	if err != nil {
+		slog.Error("failed to list model routes", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(routes)
+}
+
+// CreateRoute handles POST /api/v1/admin/routes
+func (h *RoutesHandler) CreateRoute(w http.ResponseWriter, r *http.Request) {
+	route := &models.ModelRoute{}
+	if !h.decodeRoute(w, r, route) {
+		return
+	}
+
+	if err := h.routes.CreateModelRoute(r.Context(), route); err != nil {
+		slog.Error("failed to create model route", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "model_route.create", "model_route", route.ID.String(), nil, route))
+	h.reload(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(route)
+}
+
+// GetRoute handles GET /api/v1/admin/routes/{routeId}
+func (h *RoutesHandler) GetRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := h.getRouteParam(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(route)
+}
+
+// UpdateRoute handles PUT /api/v1/admin/routes/{routeId}. The request
+// replaces the route's name, target and conditions.
+func (h *RoutesHandler) UpdateRoute(w http.ResponseWriter, r *http.Request) {
+	before, ok := h.getRouteParam(w, r)
+	if !ok {
+		return
+	}
+
+	route := &models.ModelRoute{ID: before.ID, CreatedAt: before.CreatedAt}
+	if !h.decodeRoute(w, r, route) {
+		return
+	}
+
+	if err := h.routes.UpdateModelRoute(r.Context(), route); err != nil {
+		if err == storage.ErrModelRouteNotFound {
+			http.Error(w, "model route not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to update model route", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "model_route.update", "model_route", route.ID.String(), before, route))
+	h.reload(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(route)
+}
+
+// DeleteRoute handles DELETE /api/v1/admin/routes/{routeId}
+func (h *RoutesHandler) DeleteRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := h.getRouteParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.routes.DeleteModelRoute(r.Context(), route.ID); err != nil {
+		if err == storage.ErrModelRouteNotFound {
+			http.Error(w, "model route not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to delete model route", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "model_route.delete", "model_route", route.ID.String(), route, nil))
+	h.reload(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// decodeRoute reads a route from the request body into route, validates it
+// and checks that the keys it is conditioned on exist. It writes an error
+// response and returns false if any of that fails.
+func (h *RoutesHandler) decodeRoute(w http.ResponseWriter, r *http.Request, route *models.ModelRoute) bool {
+	var req modelRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	route.Name = req.Name
+	route.TargetProvider = req.TargetProvider
+	route.TargetModel = req.TargetModel
+	route.APIKeyID = req.APIKeyID
+	route.ProxyKeyID = req.ProxyKeyID
+	route.MetadataKey = req.MetadataKey
+	route.MetadataValue = req.MetadataValue
+	if err := routing.Validate(route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if route.APIKeyID != nil {
+		if _, err := h.apiKeys.GetAPIKeyByID(r.Context(), *route.APIKeyID); err != nil {
+			if err == storage.ErrAPIKeyNotFound {
+				http.Error(w, "api_key_id does not exist", http.StatusBadRequest)
+				return false
+			}
+			slog.Error("failed to get API key", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return false
+		}
+	}
+	if route.ProxyKeyID != nil {
+		if _, err := h.proxyKeys.GetProxyKeyByID(r.Context(), *route.ProxyKeyID); err != nil {
+			if err == storage.ErrProxyKeyNotFound {
+				http.Error(w, "proxy_key_id does not exist", http.StatusBadRequest)
+				return false
+			}
+			slog.Error("failed to get proxy key", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *RoutesHandler) getRouteParam(w http.ResponseWriter, r *http.Request) (*models.ModelRoute, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "routeId"))
+	if err != nil {
+		http.Error(w, "invalid route ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	route, err := h.routes.GetModelRoute(r.Context(), id)
+	if err != nil {
+		if err == storage.ErrModelRouteNotFound {
+			http.Error(w, "model route not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get model route", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return route, true
+}
+
+// reload applies a change to this replica's router. Other replicas pick it up
+// on their next refresh, as does this one if the reload fails.
+func (h *RoutesHandler) reload(ctx context.Context) {
+	if err := h.router.Reload(ctx); err != nil {
+		slog.Warn("failed to reload model routes", "error", err)
+	}
+}
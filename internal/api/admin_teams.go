@@ -0,0 +1,529 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// --- Organizations ---
+
+// ListOrganizations handles GET /api/v1/admin/organizations
+func (h *AdminHandler) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.teams.ListOrganizations(r.Context())
+	if err != nil {
+		slog.Error("failed to list organizations", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+// CreateOrganization handles POST /api/v1/admin/organizations
+func (h *AdminHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.teams.GetOrganizationByName(r.Context(), req.Name); err == nil {
+		http.Error(w, "organization already exists", http.StatusConflict)
+		return
+	} else if err != storage.ErrOrganizationNotFound {
+		slog.Error("failed to get organization", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	org, err := h.teams.CreateOrganization(r.Context(), req.Name)
+	if err != nil {
+		slog.Error("failed to create organization", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "organization.create", "organization", org.ID.String(), nil, org))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// ListTeams handles GET /api/v1/admin/organizations/{orgId}/teams
+func (h *AdminHandler) ListTeams(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.getOrganizationParam(w, r)
+	if !ok {
+		return
+	}
+
+	teams, err := h.teams.ListTeams(r.Context(), org.ID)
+	if err != nil {
+		slog.Error("failed to list teams", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(teams)
+}
+
+// CreateTeam handles POST /api/v1/admin/organizations/{orgId}/teams
+func (h *AdminHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.getOrganizationParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		MonthlyBudget *float64 `json:"monthly_budget,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.MonthlyBudget != nil && *req.MonthlyBudget < 0 {
+		http.Error(w, "monthly_budget must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.teams.GetTeamByName(r.Context(), org.ID, req.Name); err == nil {
+		http.Error(w, "team already exists", http.StatusConflict)
+		return
+	} else if err != storage.ErrTeamNotFound {
+		slog.Error("failed to get team", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	team, err := h.teams.CreateTeam(r.Context(), org.ID, req.Name, req.MonthlyBudget)
+	if err != nil {
+		slog.Error("failed to create team", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "team.create", "team", team.ID.String(), nil, team))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(team)
+}
+
+// GetOrganizationUsage handles GET /api/v1/admin/organizations/{orgId}/usage
+func (h *AdminHandler) GetOrganizationUsage(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.getOrganizationParam(w, r)
+	if !ok {
+		return
+	}
+
+	q, err := parseUsageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.OrgID = &org.ID
+
+	writeUsage(w, r, h.usage, q)
+}
+
+// --- Teams ---
+
+// MyTeams handles GET /api/v1/admin/me/teams
+func (h *AdminHandler) MyTeams(w http.ResponseWriter, r *http.Request) {
+	claims := GetUserInfo(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	teams, err := h.teams.ListTeamsByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		slog.Error("failed to list teams", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if teams == nil {
+		teams = []*models.Team{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(teams)
+}
+
+// GetTeam handles GET /api/v1/admin/teams/{teamId}
+func (h *AdminHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsRead, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(team)
+}
+
+// ListTeamAPIKeys handles GET /api/v1/admin/teams/{teamId}/api-keys
+func (h *AdminHandler) ListTeamAPIKeys(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermAllKeys, auth.PermAPIKeysRead)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeys.ListAPIKeysByTeamID(r.Context(), team.ID)
+	if err != nil {
+		slog.Error("failed to list API keys", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+type teamBudgetResponse struct {
+	TeamID          uuid.UUID `json:"team_id"`
+	MonthlyBudget   *float64  `json:"monthly_budget"`
+	PeriodStart     time.Time `json:"period_start"`
+	MonthToDateCost float64   `json:"month_to_date_cost"`
+}
+
+// GetTeamBudget handles GET /api/v1/admin/teams/{teamId}/budget
+func (h *AdminHandler) GetTeamBudget(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsRead, auth.PermUsageRead)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	cost, err := h.usage.TeamCostSince(r.Context(), team.ID, periodStart)
+	if err != nil {
+		slog.Error("failed to get team cost", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(teamBudgetResponse{
+		TeamID:          team.ID,
+		MonthlyBudget:   team.MonthlyBudget,
+		PeriodStart:     periodStart,
+		MonthToDateCost: cost,
+	})
+}
+
+// SetTeamBudget handles PUT /api/v1/admin/teams/{teamId}/budget
+// A null monthly_budget removes the budget. Only users whose global role can
+// manage teams may set it; a team admin can't raise their own team's budget.
+func (h *AdminHandler) SetTeamBudget(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsWrite, "")
+	if !ok {
+		return
+	}
+	if !auth.HasPermission(GetUserInfo(r.Context()).Role, auth.PermTeamsWrite) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		MonthlyBudget *float64 `json:"monthly_budget"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.MonthlyBudget != nil && *req.MonthlyBudget < 0 {
+		http.Error(w, "monthly_budget must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.teams.UpdateTeamBudget(r.Context(), team.ID, req.MonthlyBudget); err != nil {
+		slog.Error("failed to update team budget", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	before := *team
+	team.MonthlyBudget = req.MonthlyBudget
+	h.audit.Record(r.Context(), auditEvent(r, "team.budget_set", "team", team.ID.String(), &before, team))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(team)
+}
+
+// GetTeamUsage handles GET /api/v1/admin/teams/{teamId}/usage
+func (h *AdminHandler) GetTeamUsage(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsRead, auth.PermUsageRead)
+	if !ok {
+		return
+	}
+
+	q, err := parseUsageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.TeamID = &team.ID
+
+	writeUsage(w, r, h.usage, q)
+}
+
+// --- Team Members ---
+
+// ListTeamMembers handles GET /api/v1/admin/teams/{teamId}/members
+func (h *AdminHandler) ListTeamMembers(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsRead, "")
+	if !ok {
+		return
+	}
+
+	members, err := h.teams.ListTeamMembers(r.Context(), team.ID)
+	if err != nil {
+		slog.Error("failed to list team members", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if members == nil {
+		members = []*models.TeamMember{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// SetTeamMember handles PUT /api/v1/admin/teams/{teamId}/members/{userId}
+// Adds the user to the team or changes their team role. Team admins may
+// manage their own team's members.
+func (h *AdminHandler) SetTeamMember(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsWrite, auth.PermUsersWrite)
+	if !ok {
+		return
+	}
+
+	user, ok := h.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	oldRole, err := h.teams.GetTeamMemberRole(r.Context(), team.ID, user.ID)
+	if err != nil {
+		slog.Error("failed to get team role", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.teams.SetTeamMember(r.Context(), team.ID, user.ID, req.Role); err != nil {
+		slog.Error("failed to set team member", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var before map[string]interface{}
+	if oldRole != "" {
+		before = map[string]interface{}{"username": user.Username, "role": oldRole}
+	}
+	after := map[string]interface{}{"username": user.Username, "role": req.Role}
+	h.audit.Record(r.Context(), auditEvent(r, "team.member_set", "team_member", audit.TeamMemberID(team.ID, user.ID), before, after))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TeamMember{
+		TeamID:   team.ID,
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     req.Role,
+	})
+}
+
+// RemoveTeamMember handles DELETE /api/v1/admin/teams/{teamId}/members/{userId}
+func (h *AdminHandler) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.authorizeTeamParam(w, r, auth.PermTeamsWrite, auth.PermUsersWrite)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.teams.RemoveTeamMember(r.Context(), team.ID, userID); err != nil {
+		if err == storage.ErrTeamMemberNotFound {
+			http.Error(w, "team member not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to remove team member", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "team.member_remove", "team_member", audit.TeamMemberID(team.ID, userID), nil, nil))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "removed"})
+}
+
+// SetAPIKeyTeam handles PUT /api/v1/admin/api-keys/{id}/team
+// A null team_id removes the key from its team.
+func (h *AdminHandler) SetAPIKeyTeam(w http.ResponseWriter, r *http.Request) {
+	claims := GetUserInfo(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key, ok := h.verifyAPIKeyOwnership(w, r, claims, auth.PermAPIKeysWrite)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TeamID *uuid.UUID `json:"team_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Moving a key out of a team needs the same access as moving it in
+	if key.TeamID != nil {
+		if _, ok := h.authorizeTeam(w, r, *key.TeamID, auth.PermTeamsWrite, auth.PermTeamsWrite); !ok {
+			return
+		}
+	}
+
+	var team *models.Team
+	if req.TeamID != nil {
+		team, ok = h.authorizeTeam(w, r, *req.TeamID, auth.PermTeamsWrite, auth.PermTeamsWrite)
+		if !ok {
+			return
+		}
+	}
+
+	if err := h.apiKeys.SetAPIKeyTeam(r.Context(), key.ID, team); err != nil {
+		slog.Error("failed to set API key team", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	before := *key
+	key.TeamID, key.OrgID = nil, nil
+	if team != nil {
+		key.TeamID, key.OrgID = &team.ID, &team.OrgID
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "api_key.team_set", "api_key", key.ID.String(), &before, key))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// --- Team access helpers ---
+
+// getOrganizationParam parses the {orgId} URL param and fetches the organization.
+func (h *AdminHandler) getOrganizationParam(w http.ResponseWriter, r *http.Request) (*models.Organization, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "orgId"))
+	if err != nil {
+		http.Error(w, "invalid organization ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	org, err := h.teams.GetOrganization(r.Context(), id)
+	if err != nil {
+		if err == storage.ErrOrganizationNotFound {
+			http.Error(w, "organization not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get organization", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return org, true
+}
+
+// authorizeTeamParam parses the {teamId} URL param and calls authorizeTeam.
+func (h *AdminHandler) authorizeTeamParam(w http.ResponseWriter, r *http.Request, globalPerm, teamPerm auth.Permission) (*models.Team, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "teamId"))
+	if err != nil {
+		http.Error(w, "invalid team ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return h.authorizeTeam(w, r, id, globalPerm, teamPerm)
+}
+
+// authorizeTeam fetches the team and verifies the authenticated user's role
+// grants globalPerm, or that they are a member whose team role grants teamPerm.
+// An empty teamPerm admits any member.
+func (h *AdminHandler) authorizeTeam(w http.ResponseWriter, r *http.Request, teamID uuid.UUID, globalPerm, teamPerm auth.Permission) (*models.Team, bool) {
+	claims := GetUserInfo(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	team, err := h.teams.GetTeam(r.Context(), teamID)
+	if err != nil {
+		if err == storage.ErrTeamNotFound {
+			http.Error(w, "team not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get team", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if auth.HasPermission(claims.Role, globalPerm) {
+		return team, true
+	}
+
+	role, err := h.teams.GetTeamMemberRole(r.Context(), team.ID, claims.UserID)
+	if err != nil {
+		slog.Error("failed to get team role", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if role != "" && (teamPerm == "" || auth.HasPermission(role, teamPerm)) {
+		return team, true
+	}
+
+	http.Error(w, "team not found", http.StatusNotFound)
+	return nil, false
+}
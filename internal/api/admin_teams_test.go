@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+func newTestStore(t *testing.T) *storage.SQLiteStorage {
+	t.Helper()
+	store, err := storage.NewSQLiteStorage(context.Background(), &storage.SQLiteStorageConfig{
+		Path: filepath.Join(t.TempDir(), "majordomo.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newTestUser(t *testing.T, store *storage.SQLiteStorage, username string, role models.Role) *models.User {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), &models.CreateUserInput{Username: username, Password: "unused", Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// asUser returns r as sent by user with an admin session
+func asUser(r *http.Request, user *models.User) *http.Request {
+	claims := &auth.JWTClaims{UserID: user.ID, Username: user.Username, Role: user.Role}
+	return r.WithContext(context.WithValue(r.Context(), jwtUserInfoKey, claims))
+}
+
+func TestSetTeamBudget_RequiresGlobalRole(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	h := NewAdminHandler(store, store, store, store, store, nil, nil, nil, store)
+
+	org, err := store.CreateOrganization(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := 100.0
+	team, err := store.CreateTeam(ctx, org.ID, "search", &budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := newTestUser(t, store, "root", models.RoleAdmin)
+	teamAdmin := newTestUser(t, store, "lead", models.RoleMember)
+	outsider := newTestUser(t, store, "other", models.RoleMember)
+	if err := store.SetTeamMember(ctx, team.ID, teamAdmin.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Put("/teams/{teamId}/budget", h.SetTeamBudget)
+	setBudget := func(user *models.User, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/teams/"+team.ID.String()+"/budget", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, asUser(req, user))
+		return rec.Code
+	}
+
+	if code := setBudget(teamAdmin, `{"monthly_budget": 100000}`); code != http.StatusForbidden {
+		t.Errorf("team admin: status = %d, want 403", code)
+	}
+	if code := setBudget(teamAdmin, `{"monthly_budget": null}`); code != http.StatusForbidden {
+		t.Errorf("team admin removing the budget: status = %d, want 403", code)
+	}
+	if code := setBudget(outsider, `{"monthly_budget": 100000}`); code != http.StatusNotFound {
+		t.Errorf("non-member: status = %d, want 404", code)
+	}
+
+	got, err := store.GetTeam(ctx, team.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MonthlyBudget == nil || *got.MonthlyBudget != 100 {
+		t.Fatalf("budget changed to %v by a user who can't set it", got.MonthlyBudget)
+	}
+
+	if code := setBudget(admin, `{"monthly_budget": 750}`); code != http.StatusOK {
+		t.Fatalf("admin: status = %d, want 200", code)
+	}
+	got, _ = store.GetTeam(ctx, team.ID)
+	if got.MonthlyBudget == nil || *got.MonthlyBudget != 750 {
+		t.Errorf("budget = %v, want 750", got.MonthlyBudget)
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- User Management ---
+
+type createUserRequest struct {
+	Username string      `json:"username"`
+	Password string      `json:"password"`
+	Role     models.Role `json:"role"`
+}
+
+// ListUsers handles GET /api/v1/admin/users
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.users.ListUsers(r.Context())
+	if err != nil {
+		slog.Error("failed to list users", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// CreateUser handles POST /api/v1/admin/users
+func (h *AdminHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		http.Error(w, "username and password are required", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.users.GetUserByUsername(r.Context(), req.Username)
+	if err != nil {
+		slog.Error("failed to get user", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "username already exists", http.StatusConflict)
+		return
+	}
+
+	user, err := h.users.CreateUser(r.Context(), &models.CreateUserInput{
+		Username: req.Username,
+		Password: req.Password,
+		Role:     req.Role,
+	})
+	if err != nil {
+		slog.Error("failed to create user", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "user.create", "user", user.ID.String(), nil, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetUser handles GET /api/v1/admin/users/{userId}
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetUserRole handles PUT /api/v1/admin/users/{userId}/role
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !req.Role.Valid() {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role != models.RoleAdmin && !h.checkNotLastAdmin(w, r, user) {
+		return
+	}
+
+	if err := h.users.UpdateUserRole(r.Context(), user.ID, req.Role); err != nil {
+		slog.Error("failed to update user role", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	before := *user
+	user.Role = req.Role
+	h.audit.Record(r.Context(), auditEvent(r, "user.role_change", "user", user.ID.String(), &before, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeactivateUser handles POST /api/v1/admin/users/{userId}/deactivate and
+// revokes the user's sessions
+func (h *AdminHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserActive(w, r, false)
+}
+
+// ActivateUser handles POST /api/v1/admin/users/{userId}/activate
+func (h *AdminHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserActive(w, r, true)
+}
+
+func (h *AdminHandler) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	user, ok := h.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !active {
+		if claims := GetUserInfo(r.Context()); claims != nil && claims.UserID == user.ID {
+			http.Error(w, "cannot deactivate yourself", http.StatusBadRequest)
+			return
+		}
+		if !h.checkNotLastAdmin(w, r, user) {
+			return
+		}
+	}
+
+	if err := h.users.SetUserActive(r.Context(), user.ID, active); err != nil {
+		slog.Error("failed to update user", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	before := *user
+	user.IsActive = active
+	action := "user.deactivate"
+	if active {
+		action = "user.activate"
+	}
+	h.audit.Record(r.Context(), auditEvent(r, action, "user", user.ID.String(), &before, user))
+
+	if !active {
+		if err := h.sessions.RevokeUser(r.Context(), user.ID); err != nil {
+			slog.Error("failed to revoke sessions", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ResetUserPassword handles PUT /api/v1/admin/users/{userId}/password and
+// signs the user out everywhere
+func (h *AdminHandler) ResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		http.Error(w, "password is required", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
+	if err != nil {
+		slog.Error("failed to hash password", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.users.UpdateUserPassword(r.Context(), user.ID, string(hash)); err != nil {
+		slog.Error("failed to update password", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), auditEvent(r, "user.password_reset", "user", user.ID.String(), nil, nil))
+
+	if err := h.sessions.RevokeUser(r.Context(), user.ID); err != nil {
+		slog.Error("failed to revoke sessions", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// getUserParam parses the {userId} URL param and fetches the user.
+func (h *AdminHandler) getUserParam(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := h.users.GetUserByID(r.Context(), id)
+	if err != nil {
+		if err == storage.ErrUserNotFound {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get user", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// checkNotLastAdmin rejects demoting or deactivating the only active admin.
+func (h *AdminHandler) checkNotLastAdmin(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	users, err := h.users.ListUsers(r.Context())
+	if err != nil {
+		slog.Error("failed to list users", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return false
+	}
+
+	if auth.IsLastActiveAdmin(users, user.ID) {
+		http.Error(w, "cannot remove the last active admin", http.StatusConflict)
+		return false
+	}
+
+	return true
+}
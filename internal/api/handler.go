@@ -2,11 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/audit"
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
 	"github.com/superset-studio/majordomo-gateway/internal/secrets"
@@ -17,19 +19,22 @@ import (
 type Handler struct {
 	storage storage.ProxyKeyStorage
 	secrets secrets.SecretStore
+	audit   *audit.Recorder
 }
 
-// NewHandler creates a new API handler.
-func NewHandler(store storage.ProxyKeyStorage, secretStore secrets.SecretStore) *Handler {
+// NewHandler creates a new API handler. Changes are recorded in auditLog.
+func NewHandler(store storage.ProxyKeyStorage, secretStore secrets.SecretStore, auditLog storage.AuditStorage) *Handler {
 	return &Handler{
 		storage: store,
 		secrets: secretStore,
+		audit:   audit.NewRecorder(auditLog),
 	}
 }
 
 type createProxyKeyRequest struct {
-	Name        string  `json:"name"`
-	Description *string `json:"description,omitempty"`
+	Name             string  `json:"name"`
+	Description      *string `json:"description,omitempty"`
+	SingleHeaderAuth bool    `json:"single_header_auth"`
 }
 
 type createProxyKeyResponse struct {
@@ -64,8 +69,9 @@ func (h *Handler) CreateProxyKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	input := &models.CreateProxyKeyInput{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:             req.Name,
+		Description:      req.Description,
+		SingleHeaderAuth: req.SingleHeaderAuth,
 	}
 
 	pk, err := h.storage.CreateProxyKey(r.Context(), hash, info.ID, input)
@@ -75,6 +81,8 @@ func (h *Handler) CreateProxyKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.audit.Record(r.Context(), auditEvent(r, "proxy_key.create", "proxy_key", pk.ID.String(), nil, pk))
+
 	resp := createProxyKeyResponse{
 		ProxyKey: pk,
 		Key:      plaintext,
@@ -174,11 +182,72 @@ func (h *Handler) RevokeProxyKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "proxy_key.revoke", "proxy_key", id.String(), pk, nil))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
 }
 
+type setSingleHeaderAuthRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetSingleHeaderAuth handles PUT /api/v1/proxy-keys/{id}/single-header-auth
+func (h *Handler) SetSingleHeaderAuth(w http.ResponseWriter, r *http.Request) {
+	info := GetAPIKeyInfo(r.Context())
+	if info == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid proxy key ID", http.StatusBadRequest)
+		return
+	}
+
+	var req setSingleHeaderAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Verify ownership
+	pk, err := h.storage.GetProxyKeyByID(r.Context(), id)
+	if err != nil {
+		if err == storage.ErrProxyKeyNotFound {
+			http.Error(w, "proxy key not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get proxy key", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if pk.MajordomoAPIKeyID != info.ID {
+		http.Error(w, "proxy key not found", http.StatusNotFound)
+		return
+	}
+
+	if !pk.IsActive {
+		http.Error(w, "proxy key has been revoked", http.StatusConflict)
+		return
+	}
+
+	if err := h.storage.SetProxyKeySingleHeaderAuth(r.Context(), id, req.Enabled); err != nil {
+		slog.Error("failed to set proxy key single-header auth", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	updated := *pk
+	updated.SingleHeaderAuth = req.Enabled
+	h.audit.Record(r.Context(), auditEvent(r, "proxy_key.single_header_auth_set", "proxy_key", id.String(), pk, &updated))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&updated)
+}
+
 type setProviderMappingRequest struct {
 	APIKey string `json:"api_key"`
 }
@@ -231,10 +300,8 @@ func (h *Handler) SetProviderMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	encrypted, err := h.secrets.Encrypt(req.APIKey)
-	if err != nil {
-		slog.Error("failed to encrypt provider key", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	encrypted, ok := encryptProviderKey(w, h.secrets, req.APIKey)
+	if !ok {
 		return
 	}
 
@@ -243,11 +310,28 @@ func (h *Handler) SetProviderMapping(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "provider_mapping.set", "proxy_key", id.String(), nil, providerMappingAudit(providerName)))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "provider": providerName})
 }
 
+// encryptProviderKey encrypts a provider key for storage. References the
+// secret store rejects are a 400; other failures are logged and a 500.
+func encryptProviderKey(w http.ResponseWriter, store secrets.SecretStore, key string) (string, bool) {
+	encrypted, err := store.Encrypt(key)
+	switch {
+	case err == nil:
+		return encrypted, true
+	case errors.Is(err, secrets.ErrInvalidReference), errors.Is(err, secrets.ErrReferenceNotAllowed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error("failed to encrypt provider key", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+	return "", false
+}
+
 // DeleteProviderMapping handles DELETE /api/v1/proxy-keys/{id}/providers/{provider}
 func (h *Handler) DeleteProviderMapping(w http.ResponseWriter, r *http.Request) {
 	info := GetAPIKeyInfo(r.Context())
@@ -290,6 +374,7 @@ func (h *Handler) DeleteProviderMapping(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r.Context(), auditEvent(r, "provider_mapping.delete", "proxy_key", id.String(), providerMappingAudit(providerName), nil))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
@@ -2,16 +2,21 @@ package api
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
 )
 
 const jwtUserInfoKey contextKey = "jwtUserInfo"
 
-// JWTAuthMiddleware validates the Bearer token and stores JWTClaims in the request context.
-func JWTAuthMiddleware(jwtSvc *auth.JWTService) func(http.Handler) http.Handler {
+// JWTAuthMiddleware validates the Bearer token and its session and stores JWTClaims in the request context.
+// The session and user are looked up on every request so logout, deactivation and role changes take
+// effect immediately; the stored claims carry the user's current role.
+func JWTAuthMiddleware(sessions *auth.SessionManager, users storage.UserStorage) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -26,11 +31,32 @@ func JWTAuthMiddleware(jwtSvc *auth.JWTService) func(http.Handler) http.Handler
 				return
 			}
 
-			claims, err := jwtSvc.ValidateToken(parts[1])
+			claims, err := sessions.Authenticate(r.Context(), parts[1])
+			if errors.Is(err, auth.ErrInvalidSession) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
 			if err != nil {
+				slog.Error("failed to check session", "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+
+			user, err := users.GetUserByID(r.Context(), claims.UserID)
+			if err == storage.ErrUserNotFound {
 				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
+			if err != nil {
+				slog.Error("failed to get user", "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if !user.IsActive {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			claims.Role = user.Role
 
 			ctx := context.WithValue(r.Context(), jwtUserInfoKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -38,6 +64,27 @@ func JWTAuthMiddleware(jwtSvc *auth.JWTService) func(http.Handler) http.Handler
 	}
 }
 
+// RequirePermission rejects requests from users whose role lacks perm.
+// It must run after JWTAuthMiddleware.
+func RequirePermission(perm auth.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetUserInfo(r.Context())
+			if claims == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !auth.HasPermission(claims.Role, perm) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserInfo retrieves the authenticated JWTClaims from the request context.
 func GetUserInfo(ctx context.Context) *auth.JWTClaims {
 	claims, _ := ctx.Value(jwtUserInfoKey).(*auth.JWTClaims)
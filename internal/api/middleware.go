@@ -35,3 +35,24 @@ func GetAPIKeyInfo(ctx context.Context) *models.APIKeyInfo {
 	info, _ := ctx.Value(apiKeyInfoKey).(*models.APIKeyInfo)
 	return info
 }
+
+// RequireScope rejects requests made with an API key that lacks scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope models.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := GetAPIKeyInfo(r.Context())
+			if info == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !info.Scopes.Has(scope) {
+				http.Error(w, "API key lacks the "+string(scope)+" scope", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// maxUsageRange bounds a single usage query so hourly queries stay cheap.
+var maxUsageRange = map[string]time.Duration{
+	models.GranularityHour: 31 * 24 * time.Hour,
+	models.GranularityDay:  366 * 24 * time.Hour,
+}
+
+// UsageHandler provides REST API endpoints for aggregated usage.
+type UsageHandler struct {
+	storage storage.UsageStorage
+}
+
+// NewUsageHandler creates a new usage handler.
+func NewUsageHandler(store storage.UsageStorage) *UsageHandler {
+	return &UsageHandler{storage: store}
+}
+
+// GetUsage handles GET /api/v1/usage
+func (h *UsageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	info := GetAPIKeyInfo(r.Context())
+	if info == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseUsageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.MajordomoAPIKeyID = &info.ID
+
+	writeUsage(w, r, h.storage, q)
+}
+
+// parseUsageQuery reads usage query parameters:
+// granularity (hour|day, default day), from and to (RFC 3339 or YYYY-MM-DD,
+// default the last 30 days), proxy_key_id, provider, model and metadata_key.
+func parseUsageQuery(r *http.Request) (*models.UsageQuery, error) {
+	params := r.URL.Query()
+
+	q := &models.UsageQuery{
+		Granularity: params.Get("granularity"),
+		Provider:    params.Get("provider"),
+		Model:       params.Get("model"),
+		MetadataKey: params.Get("metadata_key"),
+	}
+	if q.Granularity == "" {
+		q.Granularity = models.GranularityDay
+	}
+	maxRange, ok := maxUsageRange[q.Granularity]
+	if !ok {
+		return nil, storage.ErrInvalidGranularity
+	}
+
+	now := time.Now().UTC()
+	q.To = now
+	q.From = now.AddDate(0, 0, -30)
+	if v := params.Get("to"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return nil, errors.New("invalid to")
+		}
+		q.To = t
+	}
+	if v := params.Get("from"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return nil, errors.New("invalid from")
+		}
+		q.From = t
+	}
+	if !q.From.Before(q.To) {
+		return nil, errors.New("from must be before to")
+	}
+	if q.To.Sub(q.From) > maxRange {
+		return nil, errors.New("time range too large for granularity")
+	}
+
+	if v := params.Get("proxy_key_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, errors.New("invalid proxy_key_id")
+		}
+		q.ProxyKeyID = &id
+	}
+
+	return q, nil
+}
+
+func parseUsageTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+func writeUsage(w http.ResponseWriter, r *http.Request, store storage.UsageStorage, q *models.UsageQuery) {
+	rows, err := store.QueryUsage(r.Context(), q)
+	if err != nil {
+		slog.Error("failed to query usage", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if rows == nil {
+		rows = []*models.UsageRollup{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
@@ -0,0 +1,172 @@
+// Package audit records administrative actions in the append-only audit log.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// Actor identifies who performed an action
+type Actor struct {
+	Type string // One of models.AuditActorUser, AuditActorAPIKey or AuditActorCLI
+	ID   *uuid.UUID
+	Name string
+}
+
+// Event describes one administrative action. Before and After are the
+// target's state around the change; either may be nil for creates and
+// deletes. They are stored as a diff with secrets removed.
+type Event struct {
+	Actor      Actor
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+	SourceIP   string
+}
+
+// TeamMemberID is the target ID of a team membership, so that changes to one
+// member's role can be found in the log
+func TeamMemberID(teamID, userID uuid.UUID) string {
+	return teamID.String() + "/" + userID.String()
+}
+
+// Recorder writes events to the audit log
+type Recorder struct {
+	store storage.AuditStorage
+}
+
+// NewRecorder creates a new audit recorder
+func NewRecorder(store storage.AuditStorage) *Recorder {
+	return &Recorder{store: store}
+}
+
+// Record writes an event to the audit log. The action has already happened
+// when Record is called, so failures are logged rather than returned.
+func (r *Recorder) Record(ctx context.Context, e Event) {
+	if err := r.Write(ctx, e); err != nil {
+		slog.Error("failed to write audit event", "action", e.Action, "target_type", e.TargetType, "target_id", e.TargetID, "error", err)
+	}
+}
+
+// Write writes an event to the audit log and returns any error
+func (r *Recorder) Write(ctx context.Context, e Event) error {
+	before, after, err := Diff(e.Before, e.After)
+	if err != nil {
+		return err
+	}
+
+	event := &models.AuditEvent{
+		ActorType:  e.Actor.Type,
+		ActorID:    e.Actor.ID,
+		ActorName:  e.Actor.Name,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Before:     before,
+		After:      after,
+	}
+	if e.SourceIP != "" {
+		event.SourceIP = &e.SourceIP
+	}
+
+	return r.store.WriteAuditEvent(ctx, event)
+}
+
+// Diff converts before and after to JSON objects, drops secret fields, and
+// when both are present keeps only the fields that changed. Fields tagged
+// json:"-" never appear, so key hashes and encrypted keys are excluded by the
+// models themselves; Diff also drops any field whose name looks like a
+// secret, in case a map or request struct carries one.
+func Diff(before, after interface{}) (models.AuditState, models.AuditState, error) {
+	b, err := toFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := toFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if b != nil && a != nil {
+		for k, v := range b {
+			if av, ok := a[k]; ok && reflect.DeepEqual(v, av) {
+				delete(b, k)
+				delete(a, k)
+			}
+		}
+	}
+
+	bs, err := marshalFields(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	as, err := marshalFields(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bs, as, nil
+}
+
+// toFields converts v to a map of its JSON fields without secrets. A nil v
+// gives a nil map.
+func toFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for k := range fields {
+		if isSecretField(k) {
+			delete(fields, k)
+		}
+	}
+	return fields, nil
+}
+
+func marshalFields(fields map[string]interface{}) (models.AuditState, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return models.AuditState(data), nil
+}
+
+// isSecretField reports whether a JSON field name looks like it holds a
+// credential
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "key", "api_key", "key_hash", "encrypted_key":
+		return true
+	}
+	for _, s := range []string{"password", "secret", "token", "credential"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+func decode(t *testing.T, s models.AuditState) map[string]interface{} {
+	t.Helper()
+	if s == nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(s, &m); err != nil {
+		t.Fatalf("invalid state %s: %v", s, err)
+	}
+	return m
+}
+
+func TestDiffKeepsChangedFields(t *testing.T) {
+	id := uuid.New()
+	before := &models.User{ID: id, Username: "alice", PasswordHash: "hash", Role: models.RoleMember, IsActive: true}
+	after := &models.User{ID: id, Username: "alice", PasswordHash: "hash", Role: models.RoleAdmin, IsActive: true}
+
+	b, a, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm, am := decode(t, b), decode(t, a)
+	if len(bm) != 1 || bm["role"] != "member" {
+		t.Errorf("before = %s, want only the old role", b)
+	}
+	if len(am) != 1 || am["role"] != "admin" {
+		t.Errorf("after = %s, want only the new role", a)
+	}
+}
+
+func TestDiffCreateAndDelete(t *testing.T) {
+	key := &models.APIKey{ID: uuid.New(), Name: "ci", KeyHash: "secret-hash"}
+
+	b, a, err := Diff(nil, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != nil {
+		t.Errorf("before = %s, want nil", b)
+	}
+	am := decode(t, a)
+	if am["name"] != "ci" {
+		t.Errorf("after = %s, want the whole key", a)
+	}
+	if _, ok := am["key_hash"]; ok {
+		t.Errorf("after contains the key hash: %s", a)
+	}
+
+	var missing *models.APIKey
+	b, a, err = Diff(key, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != nil || decode(t, b)["name"] != "ci" {
+		t.Errorf("delete diff = %s, %s", b, a)
+	}
+}
+
+func TestDiffDropsSecretFields(t *testing.T) {
+	after := map[string]interface{}{
+		"provider":      "openai",
+		"api_key":       "sk-live",
+		"key":           "mdm_sk_abc",
+		"new_password":  "hunter2",
+		"client_secret": "s",
+		"refresh_token": "t",
+	}
+
+	_, a, err := Diff(nil, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	am := decode(t, a)
+	if len(am) != 1 || am["provider"] != "openai" {
+		t.Errorf("after = %s, want only provider", a)
+	}
+}
+
+func TestDiffNoChange(t *testing.T) {
+	b, a, err := Diff(map[string]string{"name": "x"}, map[string]string{"name": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "{}" || string(a) != "{}" {
+		t.Errorf("diff = %s, %s, want empty objects", b, a)
+	}
+}
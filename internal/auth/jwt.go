@@ -6,12 +6,15 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
 )
 
 // JWTClaims represents the claims stored in a JWT token
 type JWTClaims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Username  string      `json:"username"`
+	Role      models.Role `json:"role"`
+	SessionID uuid.UUID   `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -29,21 +32,29 @@ func NewJWTService(secret string, expiry time.Duration) *JWTService {
 	}
 }
 
-// GenerateToken creates a new signed JWT for the given user
-func (s *JWTService) GenerateToken(userID uuid.UUID, username string) (string, error) {
+// GenerateToken creates a new signed access token for the given user and
+// session, and returns it with its expiry
+func (s *JWTService) GenerateToken(userID uuid.UUID, username string, role models.Role, sessionID uuid.UUID) (string, time.Time, error) {
 	now := time.Now()
+	expiresAt := now.Add(s.expiry)
 	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.expiry)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
 			Subject:   userID.String(),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+	signed, err := token.SignedString(s.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
 // ValidateToken parses and validates a JWT token string
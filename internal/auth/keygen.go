@@ -12,6 +12,8 @@ const (
 	KeyPrefix = "mdm_sk_"
 	// ProxyKeyPrefix is the prefix for proxy keys
 	ProxyKeyPrefix = "mdm_pk_"
+	// RefreshTokenPrefix is the prefix for admin session refresh tokens
+	RefreshTokenPrefix = "mdm_rt_"
 	// KeyByteLength is the number of random bytes to generate (256 bits)
 	KeyByteLength = 32
 )
@@ -62,3 +64,26 @@ func ValidateProxyKeyFormat(key string) bool {
 	}
 	return strings.HasPrefix(key, ProxyKeyPrefix)
 }
+
+// GenerateRefreshToken creates a new session refresh token with the mdm_rt_ prefix.
+// Returns the plaintext token (given to the client) and its SHA256 hash (store in DB).
+func GenerateRefreshToken() (plaintext string, hash string, err error) {
+	bytes := make([]byte, KeyByteLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(bytes)
+	plaintext = RefreshTokenPrefix + encoded
+	hash = HashAPIKey(plaintext)
+
+	return plaintext, hash, nil
+}
+
+// ValidateRefreshTokenFormat checks if a token has the expected mdm_rt_ prefix and minimum length.
+func ValidateRefreshTokenFormat(token string) bool {
+	if len(token) <= len(RefreshTokenPrefix) {
+		return false
+	}
+	return strings.HasPrefix(token, RefreshTokenPrefix)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginThrottleConfig limits failed password logins. A limit of 0 disables
+// that check.
+type LoginThrottleConfig struct {
+	// MaxFailures is the number of failed logins for one username within
+	// Window that locks the username out.
+	MaxFailures int
+	// MaxFailuresPerIP is the number of failed logins from one client address
+	// within Window that locks the address out.
+	MaxFailuresPerIP int
+	Window           time.Duration
+	Lockout          time.Duration
+}
+
+// LoginThrottle counts failed logins per username and per client address and
+// locks them out when a limit is reached. Counts are kept in memory, so each
+// gateway replica throttles separately.
+type LoginThrottle struct {
+	cfg LoginThrottleConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	users     map[string]*loginAttempts
+	ips       map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginThrottle creates a new login throttle
+func NewLoginThrottle(cfg LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		cfg:   cfg,
+		now:   time.Now,
+		users: make(map[string]*loginAttempts),
+		ips:   make(map[string]*loginAttempts),
+	}
+}
+
+// Check returns how long the username or address remains locked out, or 0 if
+// a login may be attempted
+func (t *LoginThrottle) Check(username, ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var wait time.Duration
+	for _, a := range []*loginAttempts{t.users[userKey(username)], t.ips[ip]} {
+		if a != nil && a.lockedUntil.After(now) {
+			wait = max(wait, a.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Failure records a failed login
+func (t *LoginThrottle) Failure(username, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+	t.fail(t.users, userKey(username), t.cfg.MaxFailures, now)
+	t.fail(t.ips, ip, t.cfg.MaxFailuresPerIP, now)
+}
+
+// Success clears the failed logins of a username. Failures from the address
+// are kept, so one valid account can't be used to reset the address limit.
+func (t *LoginThrottle) Success(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.users, userKey(username))
+}
+
+func (t *LoginThrottle) fail(attempts map[string]*loginAttempts, key string, limit int, now time.Time) {
+	if limit <= 0 || key == "" {
+		return
+	}
+
+	a := attempts[key]
+	if a == nil || now.Sub(a.windowStart) >= t.cfg.Window {
+		a = &loginAttempts{windowStart: now, lockedUntil: lockedUntil(a)}
+		attempts[key] = a
+	}
+	a.failures++
+	if a.failures >= limit {
+		a.lockedUntil = now.Add(t.cfg.Lockout)
+		a.failures = 0
+		a.windowStart = now
+	}
+}
+
+// sweep drops entries whose window has passed and that are not locked out.
+// It runs at most once per window.
+func (t *LoginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.cfg.Window {
+		return
+	}
+	t.lastSweep = now
+
+	for _, attempts := range []map[string]*loginAttempts{t.users, t.ips} {
+		for key, a := range attempts {
+			if now.Sub(a.windowStart) >= t.cfg.Window && !a.lockedUntil.After(now) {
+				delete(attempts, key)
+			}
+		}
+	}
+}
+
+func lockedUntil(a *loginAttempts) time.Time {
+	if a == nil {
+		return time.Time{}
+	}
+	return a.lockedUntil
+}
+
+func userKey(username string) string {
+	return strings.ToLower(username)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLoginThrottle(now *time.Time) *LoginThrottle {
+	t := NewLoginThrottle(LoginThrottleConfig{
+		MaxFailures:      3,
+		MaxFailuresPerIP: 5,
+		Window:           time.Minute,
+		Lockout:          10 * time.Minute,
+	})
+	t.now = func() time.Time { return *now }
+	return t
+}
+
+func TestLoginThrottleLocksUsername(t *testing.T) {
+	now := time.Now()
+	th := newTestLoginThrottle(&now)
+
+	for i := 0; i < 2; i++ {
+		th.Failure("alice", "10.0.0.1")
+	}
+	if wait := th.Check("alice", "10.0.0.2"); wait != 0 {
+		t.Fatalf("Check after 2 failures = %v, want 0", wait)
+	}
+
+	th.Failure("Alice", "10.0.0.1")
+	if wait := th.Check("alice", "10.0.0.2"); wait != 10*time.Minute {
+		t.Errorf("Check after 3 failures = %v, want 10m from any address", wait)
+	}
+	if wait := th.Check("bob", "10.0.0.1"); wait != 0 {
+		t.Errorf("Check(bob) = %v, want 0", wait)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if wait := th.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Errorf("Check after lockout = %v, want 0", wait)
+	}
+}
+
+func TestLoginThrottleWindow(t *testing.T) {
+	now := time.Now()
+	th := newTestLoginThrottle(&now)
+
+	th.Failure("alice", "10.0.0.1")
+	th.Failure("alice", "10.0.0.1")
+	now = now.Add(time.Minute)
+	th.Failure("alice", "10.0.0.1")
+	if wait := th.Check("alice", ""); wait != 0 {
+		t.Errorf("Check = %v, want failures from the previous window forgotten", wait)
+	}
+}
+
+func TestLoginThrottleLocksAddress(t *testing.T) {
+	now := time.Now()
+	th := newTestLoginThrottle(&now)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		th.Failure(name, "10.0.0.1")
+	}
+	if wait := th.Check("f", "10.0.0.1"); wait != 10*time.Minute {
+		t.Errorf("Check(locked address) = %v, want 10m", wait)
+	}
+	if wait := th.Check("f", "10.0.0.2"); wait != 0 {
+		t.Errorf("Check(other address) = %v, want 0", wait)
+	}
+}
+
+func TestLoginThrottleSuccessResetsUsername(t *testing.T) {
+	now := time.Now()
+	th := newTestLoginThrottle(&now)
+
+	th.Failure("alice", "10.0.0.1")
+	th.Failure("alice", "10.0.0.1")
+	th.Success("alice")
+	th.Failure("alice", "10.0.0.1")
+	if wait := th.Check("alice", ""); wait != 0 {
+		t.Errorf("Check = %v, want the count reset by the successful login", wait)
+	}
+}
+
+func TestLoginThrottleDisabled(t *testing.T) {
+	th := NewLoginThrottle(LoginThrottleConfig{Window: time.Minute, Lockout: time.Minute})
+	for i := 0; i < 100; i++ {
+		th.Failure("alice", "10.0.0.1")
+	}
+	if wait := th.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Errorf("Check = %v, want 0 with limits disabled", wait)
+	}
+}
@@ -0,0 +1,562 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+const (
+	oidcTimeout = 10 * time.Second
+
+	// oidcLoginTTL is how long a user has to complete login at the provider.
+	oidcLoginTTL = 10 * time.Minute
+
+	// jwksRefreshInterval rate-limits JWKS refetches for unknown key IDs.
+	jwksRefreshInterval = time.Minute
+)
+
+var (
+	ErrOIDCLoginState = errors.New("invalid or expired login state")
+	ErrOIDCIDToken    = errors.New("invalid ID token")
+)
+
+// OIDCConfig configures login through an OpenID Connect provider.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Public URL of the callback endpoint
+	Scopes       []string
+
+	// UsernameClaim names the ID token claim used as the username
+	// (default "email").
+	UsernameClaim string
+
+	// RoleClaim names the ID token claim holding group or role names, e.g.
+	// "groups". Dotted paths such as "realm_access.roles" reach nested claims.
+	// When empty, roles are not taken from the provider.
+	RoleClaim string
+
+	// RoleMapping maps RoleClaim values to roles. Values are compared
+	// case-insensitively.
+	RoleMapping map[string]models.Role
+
+	// DefaultRole applies when no RoleMapping entry matches. When empty,
+	// users with no matching entry can't log in.
+	DefaultRole models.Role
+
+	// LinkExistingUsers lets a login link to a local user with the same
+	// username, if the username is an email the provider says is verified.
+	LinkExistingUsers bool
+}
+
+// OIDCIdentity is a user authenticated by the OIDC provider.
+type OIDCIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Role     models.Role // Empty when the user has no mapped role and there is no default
+
+	// UsernameVerified is true when the username is an email the provider
+	// marked verified with email_verified.
+	UsernameVerified bool
+}
+
+// OIDCLogin is the start of an authorization-code login.
+type OIDCLogin struct {
+	AuthURL string // Where to send the user's browser
+	State   string // Opaque value to keep in a cookie until the callback
+}
+
+// OIDCProvider implements the OIDC authorization-code flow with PKCE. Login
+// state is kept client-side in a value signed with stateKey, so any gateway
+// replica can handle the callback.
+type OIDCProvider struct {
+	cfg      OIDCConfig
+	issuer   string
+	authURL  string
+	tokenURL string
+	jwksURL  string
+	stateKey []byte
+	http     *http.Client
+
+	keysMu        sync.Mutex
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider fetches the provider's discovery document and creates an
+// OIDCProvider. stateKey signs login state and should be secret.
+func NewOIDCProvider(ctx context.Context, cfg OIDCConfig, stateKey []byte) (*OIDCProvider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc issuer URL, client ID and redirect URL are required")
+	}
+	if len(stateKey) == 0 {
+		return nil, errors.New("oidc state key is required")
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "email"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.DefaultRole != "" && !cfg.DefaultRole.Valid() {
+		return nil, fmt.Errorf("invalid oidc default role %q", cfg.DefaultRole)
+	}
+	mapping := make(map[string]models.Role, len(cfg.RoleMapping))
+	for value, role := range cfg.RoleMapping {
+		if !role.Valid() {
+			return nil, fmt.Errorf("invalid role %q in oidc role mapping for %q", role, value)
+		}
+		mapping[strings.ToLower(value)] = role
+	}
+	cfg.RoleMapping = mapping
+
+	p := &OIDCProvider{
+		cfg:      cfg,
+		stateKey: stateKey,
+		http:     &http.Client{Timeout: oidcTimeout},
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	discoveryURL := strings.TrimRight(cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != strings.TrimRight(cfg.IssuerURL, "/") {
+		return nil, fmt.Errorf("oidc discovery issuer %q does not match %q", discovery.Issuer, cfg.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is missing endpoints")
+	}
+
+	p.issuer = discovery.Issuer
+	p.authURL = discovery.AuthorizationEndpoint
+	p.tokenURL = discovery.TokenEndpoint
+	p.jwksURL = discovery.JWKSURI
+	return p, nil
+}
+
+// Issuer returns the provider's issuer identifier.
+func (p *OIDCProvider) Issuer() string {
+	return p.issuer
+}
+
+// MapsRoles reports whether roles come from the provider's claims.
+func (p *OIDCProvider) MapsRoles() bool {
+	return p.cfg.RoleClaim != ""
+}
+
+// CanLink reports whether an identity may be linked to an existing local user
+// with the same username. Usernames aren't checked by anyone but the provider,
+// so this needs LinkExistingUsers and a verified email.
+func (p *OIDCProvider) CanLink(id *OIDCIdentity) bool {
+	return p.cfg.LinkExistingUsers && id.UsernameVerified
+}
+
+type oidcState struct {
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// StartLogin begins a login and returns the authorization URL and the state
+// to hand back to FinishLogin.
+func (p *OIDCProvider) StartLogin() (*OIDCLogin, error) {
+	st := oidcState{ExpiresAt: time.Now().Add(oidcLoginTTL).Unix()}
+	for _, field := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		token, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		*field = token
+	}
+
+	challenge := sha256.Sum256([]byte(st.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {st.State},
+		"nonce":                 {st.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	authURL := p.authURL
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + q.Encode()
+	} else {
+		authURL += "?" + q.Encode()
+	}
+
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return &OIDCLogin{AuthURL: authURL, State: encoded + "." + p.sign(encoded)}, nil
+}
+
+// FinishLogin completes a login: it checks the state returned by the provider
+// against the state from StartLogin, exchanges the code, and verifies the ID
+// token.
+func (p *OIDCProvider) FinishLogin(ctx context.Context, loginState, state, code string) (*OIDCIdentity, error) {
+	st, err := p.parseState(loginState)
+	if err != nil {
+		return nil, err
+	}
+	if state == "" || !hmac.Equal([]byte(state), []byte(st.State)) {
+		return nil, ErrOIDCLoginState
+	}
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+
+	idToken, err := p.exchange(ctx, code, st.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.verifyIDToken(ctx, idToken, st.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.identity(claims)
+}
+
+func (p *OIDCProvider) parseState(value string) (*oidcState, error) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(p.sign(encoded))) {
+		return nil, ErrOIDCLoginState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrOIDCLoginState
+	}
+
+	var st oidcState
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, ErrOIDCLoginState
+	}
+	if time.Now().Unix() > st.ExpiresAt {
+		return nil, ErrOIDCLoginState
+	}
+	return &st, nil
+}
+
+func (p *OIDCProvider) sign(value string) string {
+	mac := hmac.New(sha256.New, p.stateKey)
+	mac.Write([]byte("oidc-state:" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// exchange redeems an authorization code at the token endpoint and returns
+// the ID token.
+func (p *OIDCProvider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("oidc token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); !hmac.Equal([]byte(got), []byte(nonce)) {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCIDToken)
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) identity(claims jwt.MapClaims) (*OIDCIdentity, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrOIDCIDToken)
+	}
+
+	username, _ := claims[p.cfg.UsernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrOIDCIDToken, p.cfg.UsernameClaim)
+	}
+	verified := false
+	if p.cfg.UsernameClaim == "email" {
+		v, ok := claims["email_verified"].(bool)
+		if ok && !v {
+			return nil, fmt.Errorf("%w: email is not verified", ErrOIDCIDToken)
+		}
+		verified = ok
+	}
+
+	return &OIDCIdentity{
+		Issuer:           p.issuer,
+		Subject:          subject,
+		Username:         username,
+		Role:             p.mapRole(claims),
+		UsernameVerified: verified,
+	}, nil
+}
+
+// mapRole returns the most privileged role, in the order of models.Roles,
+// that a RoleClaim value maps to, or DefaultRole when none does.
+func (p *OIDCProvider) mapRole(claims jwt.MapClaims) models.Role {
+	if p.cfg.RoleClaim == "" {
+		return p.cfg.DefaultRole
+	}
+
+	matched := make(map[models.Role]bool)
+	for _, value := range claimStrings(claims, p.cfg.RoleClaim) {
+		if role, ok := p.cfg.RoleMapping[strings.ToLower(value)]; ok {
+			matched[role] = true
+		}
+	}
+	for _, role := range models.Roles {
+		if matched[role] {
+			return role
+		}
+	}
+	return p.cfg.DefaultRole
+}
+
+// claimStrings returns the string values of a claim that is a string or a
+// list of strings. path may be dotted to reach nested objects.
+func claimStrings(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// key returns the public key with the given ID, refetching the JWKS when the
+// ID is unknown so provider key rotation is picked up.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	p.keysFetchedAt = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) lookupKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURL, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc signing keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
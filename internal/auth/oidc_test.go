@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+const (
+	mockClientID     = "majordomo"
+	mockClientSecret = "client-secret"
+	mockRedirectURL  = "https://gateway.example.com/api/v1/admin/oidc/callback"
+)
+
+// mockOIDC is a minimal OIDC provider. authorize stands in for the user
+// logging in at the provider: it records the claims to put in the ID token
+// and returns an authorization code.
+type mockOIDC struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{key: key, codes: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize simulates a user logging in at the provider with the given
+// claims, and returns the code and state the provider would redirect with.
+func (m *mockOIDC) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != mockClientID || q.Get("redirect_uri") != mockRedirectURL || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	full := jwt.MapClaims{
+		"iss":   m.URL,
+		"aud":   mockClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code = q.Get("state") + "-code"
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), claims: full}
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	grant, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	m.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || r.Form.Get("client_secret") != mockClientSecret ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "id_token": signed})
+}
+
+func newTestOIDCProvider(t *testing.T, m *mockOIDC) *OIDCProvider {
+	t.Helper()
+	p, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		IssuerURL:    m.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+		RoleClaim:    "groups",
+		RoleMapping: map[string]models.Role{
+			"Gateway-Admins":  models.RoleAdmin,
+			"gateway-finance": models.RoleBilling,
+		},
+		DefaultRole: models.RoleViewer,
+	}, []byte("state-key"))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return p
+}
+
+func TestOIDCLogin(t *testing.T) {
+	m := newMockOIDC(t)
+	p := newTestOIDCProvider(t, m)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   models.Role
+	}{
+		{"mapped group", jwt.MapClaims{"groups": []interface{}{"gateway-finance", "gateway-admins"}}, models.RoleAdmin},
+		{"single string claim", jwt.MapClaims{"groups": "GATEWAY-FINANCE"}, models.RoleBilling},
+		{"no mapped group", jwt.MapClaims{"groups": []interface{}{"engineering"}}, models.RoleViewer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, err := p.StartLogin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := jwt.MapClaims{"sub": "user-1", "email": "alice@example.com", "email_verified": true}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			code, state := m.authorize(t, login.AuthURL, claims)
+
+			id, err := p.FinishLogin(context.Background(), login.State, state, code)
+			if err != nil {
+				t.Fatalf("FinishLogin: %v", err)
+			}
+			if id.Issuer != m.URL || id.Subject != "user-1" || id.Username != "alice@example.com" || id.Role != tt.want {
+				t.Errorf("identity = %+v, want role %s", id, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	m := newMockOIDC(t)
+	p := newTestOIDCProvider(t, m)
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		mangle  func(loginState, state string) (string, string)
+		wantErr error
+	}{
+		{
+			name:    "state mismatch",
+			mangle:  func(ls, s string) (string, string) { return ls, s + "x" },
+			wantErr: ErrOIDCLoginState,
+		},
+		{
+			name:    "tampered login state",
+			mangle:  func(ls, s string) (string, string) { return "e30." + ls[len(ls)-10:], s },
+			wantErr: ErrOIDCLoginState,
+		},
+		{
+			name:    "wrong audience",
+			claims:  jwt.MapClaims{"aud": "someone-else"},
+			wantErr: ErrOIDCIDToken,
+		},
+		{
+			name:    "expired",
+			claims:  jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()},
+			wantErr: ErrOIDCIDToken,
+		},
+		{
+			name:    "wrong nonce",
+			claims:  jwt.MapClaims{"nonce": "replayed"},
+			wantErr: ErrOIDCIDToken,
+		},
+		{
+			name:    "unverified email",
+			claims:  jwt.MapClaims{"email_verified": false},
+			wantErr: ErrOIDCIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, err := p.StartLogin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := jwt.MapClaims{"sub": "user-1", "email": "alice@example.com"}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			code, state := m.authorize(t, login.AuthURL, claims)
+
+			loginState := login.State
+			if tt.mangle != nil {
+				loginState, state = tt.mangle(loginState, state)
+			}
+			if _, err := p.FinishLogin(context.Background(), loginState, state, code); !errors.Is(err, tt.wantErr) {
+				t.Errorf("FinishLogin error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewOIDCProviderIssuerMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://elsewhere.example.com",
+			"authorization_endpoint": "https://elsewhere.example.com/authorize",
+			"token_endpoint":         "https://elsewhere.example.com/token",
+			"jwks_uri":               "https://elsewhere.example.com/jwks",
+		})
+	}))
+	defer srv.Close()
+
+	_, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		IssuerURL:   srv.URL,
+		ClientID:    mockClientID,
+		RedirectURL: mockRedirectURL,
+	}, []byte("state-key"))
+	if err == nil {
+		t.Fatal("expected discovery to fail when the issuer doesn't match")
+	}
+}
+
+func TestOIDCCanLink(t *testing.T) {
+	m := newMockOIDC(t)
+
+	tests := []struct {
+		name     string
+		link     bool
+		verified interface{} // email_verified claim; nil leaves it out
+		want     bool
+	}{
+		{"verified", true, true, true},
+		{"claim missing", true, nil, false},
+		{"claim not a bool", true, "true", false},
+		{"linking off", false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewOIDCProvider(context.Background(), OIDCConfig{
+				IssuerURL:         m.URL,
+				ClientID:          mockClientID,
+				ClientSecret:      mockClientSecret,
+				RedirectURL:       mockRedirectURL,
+				DefaultRole:       models.RoleViewer,
+				LinkExistingUsers: tt.link,
+			}, []byte("state-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			login, err := p.StartLogin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := jwt.MapClaims{"sub": "user-1", "email": "admin"}
+			if tt.verified != nil {
+				claims["email_verified"] = tt.verified
+			}
+			code, state := m.authorize(t, login.AuthURL, claims)
+
+			id, err := p.FinishLogin(context.Background(), login.State, state, code)
+			if err != nil {
+				t.Fatalf("FinishLogin: %v", err)
+			}
+			if got := p.CanLink(id); got != tt.want {
+				t.Errorf("CanLink = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
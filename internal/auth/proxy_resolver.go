@@ -25,11 +25,24 @@ var (
 type cachedProxyKey struct {
 	proxyKeyID        uuid.UUID
 	majordomoAPIKeyID uuid.UUID
+	singleHeaderAuth  bool
+	providers         []string
 	isActive          bool
 	revokedAt         *time.Time
 	expiresAt         time.Time
 }
 
+// ProxyKeyInfo describes a valid proxy key
+type ProxyKeyInfo struct {
+	ID                uuid.UUID
+	MajordomoAPIKeyID uuid.UUID
+	// SingleHeaderAuth allows the proxy key to authenticate requests without
+	// an X-Majordomo-Key header
+	SingleHeaderAuth bool
+	// Providers lists the providers the proxy key has a provider key for
+	Providers []string
+}
+
 // ProxyResolver validates proxy keys and resolves them to decrypted provider API keys.
 type ProxyResolver struct {
 	storage   storage.ProxyKeyStorage
@@ -60,74 +73,161 @@ func (r *ProxyResolver) ResolveProxyKey(ctx context.Context, authKey string, pro
 
 	hash := HashAPIKey(authKey)
 
+	pkc, err := r.lookup(ctx, hash)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if pkc.majordomoAPIKeyID != majordomoKeyID {
+		return "", nil, ErrProxyKeyWrongOwner
+	}
+
+	id := pkc.proxyKeyID
+
 	// Check provider key cache
 	provCacheKey := hash + ":" + provider
 	r.cacheMu.RLock()
-	if cached, ok := r.provCache[provCacheKey]; ok {
-		if pkc, ok := r.cache[hash]; ok && time.Now().Before(pkc.expiresAt) {
-			id := pkc.proxyKeyID
-			r.cacheMu.RUnlock()
-			return cached, &id, nil
+	cached, ok := r.provCache[provCacheKey]
+	r.cacheMu.RUnlock()
+	if ok {
+		return cached, &id, nil
+	}
+
+	// Look up provider mapping
+	mapping, err := r.storage.GetProviderMapping(ctx, id, provider)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look up provider mapping: %w", err)
+	}
+	if mapping == nil {
+		return "", nil, fmt.Errorf("%w for %s", ErrNoProviderMapping, provider)
+	}
+
+	// Decrypt provider API key
+	decrypted, err := r.secrets.Decrypt(mapping.EncryptedKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decrypt provider key: %w", err)
+	}
+
+	// Cache the result
+	r.cacheMu.Lock()
+	r.provCache[provCacheKey] = decrypted
+	r.cacheMu.Unlock()
+
+	// Update last_used_at asynchronously
+	go func() {
+		if err := r.storage.UpdateProxyKeyLastUsed(context.Background(), id); err != nil {
+			slog.Warn("failed to update proxy key last_used_at", "error", err, "proxy_key_id", id)
 		}
+	}()
+
+	return decrypted, &id, nil
+}
+
+// LookupProxyKey validates a proxy key and returns its ID and owning Majordomo
+// key. Returns (nil, nil) if the key is not a proxy key (no mdm_pk_ prefix).
+func (r *ProxyResolver) LookupProxyKey(ctx context.Context, authKey string) (*ProxyKeyInfo, error) {
+	if !strings.HasPrefix(authKey, ProxyKeyPrefix) {
+		return nil, nil
 	}
-	r.cacheMu.RUnlock()
 
-	// DB lookup
-	proxyKey, err := r.storage.GetProxyKeyByHash(ctx, hash)
+	pkc, err := r.lookup(ctx, HashAPIKey(authKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProxyKeyInfo{
+		ID:                pkc.proxyKeyID,
+		MajordomoAPIKeyID: pkc.majordomoAPIKeyID,
+		SingleHeaderAuth:  pkc.singleHeaderAuth,
+		Providers:         pkc.providers,
+	}, nil
+}
+
+// ProviderKeyByID returns the decrypted provider API key that an active proxy
+// key maps to for the given provider. It is for work the gateway does on a
+// client's behalf after the request, when only the proxy key's ID is known,
+// and is not cached.
+func (r *ProxyResolver) ProviderKeyByID(ctx context.Context, proxyKeyID uuid.UUID, provider string) (string, error) {
+	proxyKey, err := r.storage.GetProxyKeyByID(ctx, proxyKeyID)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to look up proxy key: %w", err)
+		return "", fmt.Errorf("failed to look up proxy key: %w", err)
 	}
 	if proxyKey == nil {
-		return "", nil, ErrProxyKeyNotFound
+		return "", ErrProxyKeyNotFound
 	}
-
 	if !proxyKey.IsActive {
 		if proxyKey.RevokedAt != nil {
-			return "", nil, ErrProxyKeyRevoked
+			return "", ErrProxyKeyRevoked
 		}
-		return "", nil, ErrProxyKeyInactive
+		return "", ErrProxyKeyInactive
 	}
 
-	if proxyKey.MajordomoAPIKeyID != majordomoKeyID {
-		return "", nil, ErrProxyKeyWrongOwner
-	}
-
-	// Look up provider mapping
-	mapping, err := r.storage.GetProviderMapping(ctx, proxyKey.ID, provider)
+	mapping, err := r.storage.GetProviderMapping(ctx, proxyKeyID, provider)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to look up provider mapping: %w", err)
+		return "", fmt.Errorf("failed to look up provider mapping: %w", err)
 	}
 	if mapping == nil {
-		return "", nil, fmt.Errorf("%w for %s", ErrNoProviderMapping, provider)
+		return "", fmt.Errorf("%w for %s", ErrNoProviderMapping, provider)
 	}
 
-	// Decrypt provider API key
 	decrypted, err := r.secrets.Decrypt(mapping.EncryptedKey)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to decrypt provider key: %w", err)
+		return "", fmt.Errorf("failed to decrypt provider key: %w", err)
 	}
+	return decrypted, nil
+}
 
-	// Cache the results
-	r.cacheMu.Lock()
-	r.cache[hash] = &cachedProxyKey{
+// lookup returns the cached or stored proxy key with the given hash, checking
+// that it is active. Reloading an expired entry also drops its cached provider
+// keys, so mapping changes are picked up.
+func (r *ProxyResolver) lookup(ctx context.Context, hash string) (*cachedProxyKey, error) {
+	r.cacheMu.RLock()
+	pkc, ok := r.cache[hash]
+	r.cacheMu.RUnlock()
+	if ok && time.Now().Before(pkc.expiresAt) {
+		return pkc, nil
+	}
+
+	proxyKey, err := r.storage.GetProxyKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up proxy key: %w", err)
+	}
+	if proxyKey == nil {
+		return nil, ErrProxyKeyNotFound
+	}
+
+	if !proxyKey.IsActive {
+		if proxyKey.RevokedAt != nil {
+			return nil, ErrProxyKeyRevoked
+		}
+		return nil, ErrProxyKeyInactive
+	}
+
+	mappings, err := r.storage.ListProviderMappings(ctx, proxyKey.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provider mappings: %w", err)
+	}
+	providers := make([]string, len(mappings))
+	for i, mapping := range mappings {
+		providers[i] = mapping.Provider
+	}
+
+	pkc = &cachedProxyKey{
 		proxyKeyID:        proxyKey.ID,
 		majordomoAPIKeyID: proxyKey.MajordomoAPIKeyID,
+		singleHeaderAuth:  proxyKey.SingleHeaderAuth,
+		providers:         providers,
 		isActive:          proxyKey.IsActive,
 		revokedAt:         proxyKey.RevokedAt,
 		expiresAt:         time.Now().Add(r.cacheTTL),
 	}
-	r.provCache[provCacheKey] = decrypted
-	r.cacheMu.Unlock()
 
-	// Update last_used_at asynchronously
-	go func() {
-		if err := r.storage.UpdateProxyKeyLastUsed(context.Background(), proxyKey.ID); err != nil {
-			slog.Warn("failed to update proxy key last_used_at", "error", err, "proxy_key_id", proxyKey.ID)
-		}
-	}()
+	r.InvalidateCache(hash)
+	r.cacheMu.Lock()
+	r.cache[hash] = pkc
+	r.cacheMu.Unlock()
 
-	id := proxyKey.ID
-	return decrypted, &id, nil
+	return pkc, nil
 }
 
 // InvalidateCache removes a specific proxy key from the cache.
@@ -31,6 +31,7 @@ func (m *mockProxyKeyStorage) CreateProxyKey(_ context.Context, keyHash string,
 		Name:              input.Name,
 		Description:       input.Description,
 		MajordomoAPIKeyID: majordomoKeyID,
+		SingleHeaderAuth:  input.SingleHeaderAuth,
 		IsActive:          true,
 		CreatedAt:         time.Now(),
 	}
@@ -77,6 +78,16 @@ func (m *mockProxyKeyStorage) RevokeProxyKey(_ context.Context, id uuid.UUID) er
 	return errors.New("proxy key not found")
 }
 
+func (m *mockProxyKeyStorage) SetProxyKeySingleHeaderAuth(_ context.Context, id uuid.UUID, enabled bool) error {
+	for _, pk := range m.proxyKeys {
+		if pk.ID == id && pk.IsActive {
+			pk.SingleHeaderAuth = enabled
+			return nil
+		}
+	}
+	return errors.New("proxy key not found")
+}
+
 func (m *mockProxyKeyStorage) UpdateProxyKeyLastUsed(_ context.Context, id uuid.UUID) error {
 	m.lastUsedCalls = append(m.lastUsedCalls, id)
 	return nil
@@ -306,3 +317,96 @@ func TestResolveProxyKey_InvalidateCache(t *testing.T) {
 		t.Fatalf("expected ErrProxyKeyNotFound after cache invalidation, got %v", err)
 	}
 }
+
+func TestResolveProxyKey_WrongOwnerCached(t *testing.T) {
+	resolver, _, majordomoKeyID, _ := setupTest()
+	ctx := context.Background()
+
+	// Populate the cache as the owner
+	if _, _, err := resolver.ResolveProxyKey(ctx, "mdm_pk_testkey123", "openai", majordomoKeyID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _, err := resolver.ResolveProxyKey(ctx, "mdm_pk_testkey123", "openai", uuid.New())
+	if !errors.Is(err, ErrProxyKeyWrongOwner) {
+		t.Fatalf("expected ErrProxyKeyWrongOwner from cached key, got %v", err)
+	}
+}
+
+func TestLookupProxyKey(t *testing.T) {
+	resolver, store, majordomoKeyID, pk := setupTest()
+	ctx := context.Background()
+
+	info, err := resolver.LookupProxyKey(ctx, "sk-regular-api-key")
+	if err != nil || info != nil {
+		t.Fatalf("expected (nil, nil) for a non-proxy key, got (%v, %v)", info, err)
+	}
+
+	info, err = resolver.LookupProxyKey(ctx, "mdm_pk_testkey123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.ID != pk.ID || info.MajordomoAPIKeyID != majordomoKeyID || info.SingleHeaderAuth {
+		t.Fatalf("unexpected proxy key info: %+v", info)
+	}
+	if len(info.Providers) != 1 || info.Providers[0] != "openai" {
+		t.Fatalf("expected providers [openai], got %v", info.Providers)
+	}
+
+	// A key created with single-header auth reports it
+	created, err := store.CreateProxyKey(ctx, HashAPIKey("mdm_pk_single"), majordomoKeyID, &models.CreateProxyKeyInput{Name: "single", SingleHeaderAuth: true})
+	if err != nil {
+		t.Fatalf("CreateProxyKey: %v", err)
+	}
+	info, err = resolver.LookupProxyKey(ctx, "mdm_pk_single")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.ID != created.ID || !info.SingleHeaderAuth {
+		t.Fatalf("expected single-header auth for %s, got %+v", created.ID, info)
+	}
+
+	if _, err := resolver.LookupProxyKey(ctx, "mdm_pk_nonexistent"); !errors.Is(err, ErrProxyKeyNotFound) {
+		t.Fatalf("expected ErrProxyKeyNotFound, got %v", err)
+	}
+}
+
+func TestResolveProxyKey_MappingChangeAfterExpiry(t *testing.T) {
+	resolver, store, majordomoKeyID, pk := setupTest()
+	ctx := context.Background()
+
+	if _, _, err := resolver.ResolveProxyKey(ctx, "mdm_pk_testkey123", "openai", majordomoKeyID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Change the mapping and expire the cached proxy key
+	store.providerMappings[pk.ID.String()+":openai"].EncryptedKey = "enc:sk-rotated-openai-key"
+	resolver.cache[pk.KeyHash].expiresAt = time.Now().Add(-time.Second)
+
+	providerKey, _, err := resolver.ResolveProxyKey(ctx, "mdm_pk_testkey123", "openai", majordomoKeyID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if providerKey != "sk-rotated-openai-key" {
+		t.Fatalf("expected the rotated provider key after expiry, got %q", providerKey)
+	}
+}
+
+func TestProviderKeyByID(t *testing.T) {
+	resolver, store, _, pk := setupTest()
+	ctx := context.Background()
+
+	providerKey, err := resolver.ProviderKeyByID(ctx, pk.ID, "openai")
+	if err != nil || providerKey != "sk-real-openai-key" {
+		t.Fatalf("ProviderKeyByID = %q, %v", providerKey, err)
+	}
+
+	if _, err := resolver.ProviderKeyByID(ctx, pk.ID, "anthropic"); !errors.Is(err, ErrNoProviderMapping) {
+		t.Errorf("expected ErrNoProviderMapping, got %v", err)
+	}
+
+	store.RevokeProxyKey(ctx, pk.ID)
+	if _, err := resolver.ProviderKeyByID(ctx, pk.ID, "openai"); !errors.Is(err, ErrProxyKeyRevoked) {
+		t.Errorf("expected ErrProxyKeyRevoked, got %v", err)
+	}
+}
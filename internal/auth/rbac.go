@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// Permission is an action a user may be allowed to take in the admin API
+type Permission string
+
+const (
+	PermAPIKeysRead    Permission = "api_keys:read"
+	PermAPIKeysWrite   Permission = "api_keys:write"
+	PermProxyKeysRead  Permission = "proxy_keys:read" // Includes provider mappings
+	PermProxyKeysWrite Permission = "proxy_keys:write"
+	PermUsageRead      Permission = "usage:read"
+	PermUsersRead      Permission = "users:read"
+	PermUsersWrite     Permission = "users:write"
+	PermTeamsRead      Permission = "teams:read" // Every organization and team
+	PermTeamsWrite     Permission = "teams:write"
+	PermAuditRead      Permission = "audit:read"
+	PermRoutesRead     Permission = "routes:read" // Model routes and experiments
+	PermRoutesWrite    Permission = "routes:write"
+	PermPromptsRead    Permission = "prompts:read" // Prompt templates
+	PermPromptsWrite   Permission = "prompts:write"
+
+	// PermAllKeys extends the key and usage permissions a role has from the
+	// user's own API keys to every user's API keys.
+	PermAllKeys Permission = "keys:all"
+)
+
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleAdmin: {
+		PermAPIKeysRead, PermAPIKeysWrite,
+		PermProxyKeysRead, PermProxyKeysWrite,
+		PermUsageRead,
+		PermUsersRead, PermUsersWrite,
+		PermTeamsRead, PermTeamsWrite,
+		PermAuditRead,
+		PermRoutesRead, PermRoutesWrite,
+		PermPromptsRead, PermPromptsWrite,
+		PermAllKeys,
+	},
+	models.RoleMember: {
+		PermAPIKeysRead, PermAPIKeysWrite,
+		PermProxyKeysRead, PermProxyKeysWrite,
+		PermUsageRead,
+		PermPromptsRead,
+	},
+	models.RoleViewer: {
+		PermAPIKeysRead,
+		PermProxyKeysRead,
+		PermUsageRead,
+		PermUsersRead,
+		PermTeamsRead,
+		PermAuditRead,
+		PermRoutesRead,
+		PermPromptsRead,
+		PermAllKeys,
+	},
+	models.RoleBilling: {
+		PermAPIKeysRead,
+		PermUsageRead,
+		PermTeamsRead,
+		PermAllKeys,
+	},
+}
+
+// HasPermission reports whether role grants perm. Unknown roles have no
+// permissions. The same table applies to team roles, where it limits what a
+// member may do with the team's keys and membership.
+func HasPermission(role models.Role, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by role
+func Permissions(role models.Role) []Permission {
+	return append([]Permission(nil), rolePermissions[role]...)
+}
+
+// IsLastActiveAdmin reports whether the user with the given ID is the only
+// active admin in users. Demoting or deactivating that user would leave
+// nobody able to manage users from the admin API.
+func IsLastActiveAdmin(users []*models.User, id uuid.UUID) bool {
+	found := false
+	for _, u := range users {
+		if !u.IsActive || u.Role != models.RoleAdmin {
+			continue
+		}
+		if u.ID != id {
+			return false
+		}
+		found = true
+	}
+	return found
+}
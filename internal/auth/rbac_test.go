@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role models.Role
+		perm Permission
+		want bool
+	}{
+		{models.RoleAdmin, PermUsersWrite, true},
+		{models.RoleAdmin, PermAllKeys, true},
+		{models.RoleMember, PermAPIKeysWrite, true},
+		{models.RoleMember, PermProxyKeysWrite, true},
+		{models.RoleMember, PermAllKeys, false},
+		{models.RoleMember, PermUsersRead, false},
+		{models.RoleViewer, PermProxyKeysRead, true},
+		{models.RoleViewer, PermUsersRead, true},
+		{models.RoleViewer, PermAllKeys, true},
+		{models.RoleViewer, PermAPIKeysWrite, false},
+		{models.RoleViewer, PermUsersWrite, false},
+		{models.RoleBilling, PermUsageRead, true},
+		{models.RoleBilling, PermAPIKeysRead, true},
+		{models.RoleBilling, PermProxyKeysRead, false},
+		{models.RoleBilling, PermUsersRead, false},
+		{models.RoleBilling, PermTeamsRead, true},
+		{models.RoleMember, PermTeamsRead, false},
+		{models.RoleViewer, PermTeamsWrite, false},
+		{models.RoleViewer, PermAuditRead, true},
+		{models.RoleMember, PermAuditRead, false},
+		{models.RoleBilling, PermAuditRead, false},
+		{models.RoleAdmin, PermRoutesWrite, true},
+		{models.RoleViewer, PermRoutesRead, true},
+		{models.RoleViewer, PermRoutesWrite, false},
+		{models.RoleMember, PermRoutesRead, false},
+		{models.RoleMember, PermPromptsRead, true},
+		{models.RoleMember, PermPromptsWrite, false},
+		{models.RoleViewer, PermPromptsRead, true},
+		{models.RoleBilling, PermPromptsRead, false},
+		{models.Role("root"), PermAPIKeysRead, false},
+		{models.Role(""), PermUsageRead, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasPermission(tt.role, tt.perm); got != tt.want {
+			t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.role, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestEveryRoleHasPermissions(t *testing.T) {
+	for _, role := range models.Roles {
+		if len(Permissions(role)) == 0 {
+			t.Errorf("role %q has no permissions", role)
+		}
+	}
+}
+
+func TestIsLastActiveAdmin(t *testing.T) {
+	admin := &models.User{ID: uuid.New(), Role: models.RoleAdmin, IsActive: true}
+	member := &models.User{ID: uuid.New(), Role: models.RoleMember, IsActive: true}
+	inactiveAdmin := &models.User{ID: uuid.New(), Role: models.RoleAdmin, IsActive: false}
+	otherAdmin := &models.User{ID: uuid.New(), Role: models.RoleAdmin, IsActive: true}
+
+	users := []*models.User{admin, member, inactiveAdmin}
+	if !IsLastActiveAdmin(users, admin.ID) {
+		t.Error("expected the only active admin to be the last one")
+	}
+	if IsLastActiveAdmin(users, member.ID) {
+		t.Error("a member is never the last active admin")
+	}
+	if IsLastActiveAdmin(append(users, otherAdmin), admin.ID) {
+		t.Error("expected another active admin to remain")
+	}
+}
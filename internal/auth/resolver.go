@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
 	"github.com/superset-studio/majordomo-gateway/internal/storage"
 )
@@ -61,13 +62,42 @@ func (r *Resolver) ResolveAPIKey(ctx context.Context, apiKey string) (*models.AP
 		return nil, err
 	}
 
+	return r.accept(key, hash)
+}
+
+// ResolveAPIKeyByID resolves a Majordomo API key from its ID. It is used when
+// a proxy key authenticates a request on behalf of the key that owns it.
+func (r *Resolver) ResolveAPIKeyByID(ctx context.Context, id uuid.UUID) (*models.APIKeyInfo, error) {
+	cacheKey := "id:" + id.String()
+
+	if cached := r.getFromCache(cacheKey); cached != nil {
+		if !cached.isValid {
+			return nil, ErrAPIKeyInactive
+		}
+		return cached.info, nil
+	}
+
+	key, err := r.storage.GetAPIKeyByID(ctx, id)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		key, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.accept(key, cacheKey)
+}
+
+// accept checks that a looked-up key may be used and caches the result under
+// cacheKey
+func (r *Resolver) accept(key *models.APIKey, cacheKey string) (*models.APIKeyInfo, error) {
 	if key == nil {
-		r.cacheInvalid(hash)
+		r.cacheInvalid(cacheKey)
 		return nil, ErrInvalidAPIKey
 	}
 
 	if !key.IsActive {
-		r.cacheInvalid(hash)
+		r.cacheInvalid(cacheKey)
 		if key.RevokedAt != nil {
 			return nil, ErrAPIKeyRevoked
 		}
@@ -76,12 +106,15 @@ func (r *Resolver) ResolveAPIKey(ctx context.Context, apiKey string) (*models.AP
 
 	info := &models.APIKeyInfo{
 		ID:     key.ID,
-		Hash:   hash,
+		Hash:   key.KeyHash,
 		Alias:  &key.Name,
 		UserID: key.UserID,
+		TeamID: key.TeamID,
+		OrgID:  key.OrgID,
+		Scopes: key.Scopes,
 	}
 
-	r.cacheValid(hash, info)
+	r.cacheValid(cacheKey, info)
 
 	// Update last_used_at asynchronously
 	go func() {
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+var (
+	ErrInvalidSession     = errors.New("invalid or expired session")
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Tokens are the credentials issued when a session starts or is refreshed
+type Tokens struct {
+	SessionID        uuid.UUID
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// SessionManager issues short-lived access tokens backed by server-side
+// sessions. Each session has a refresh token that is replaced every time it
+// is used; presenting a replaced token revokes the session, since it means
+// the token was copied.
+type SessionManager struct {
+	sessions      storage.SessionStorage
+	users         storage.UserStorage
+	jwt           *JWTService
+	refreshExpiry time.Duration
+}
+
+// NewSessionManager creates a new session manager. Sessions expire after
+// refreshExpiry without a refresh.
+func NewSessionManager(sessions storage.SessionStorage, users storage.UserStorage, jwtSvc *JWTService, refreshExpiry time.Duration) *SessionManager {
+	return &SessionManager{
+		sessions:      sessions,
+		users:         users,
+		jwt:           jwtSvc,
+		refreshExpiry: refreshExpiry,
+	}
+}
+
+// Start creates a session for a user who has just logged in
+func (m *SessionManager) Start(ctx context.Context, user *models.User, userAgent, sourceIP string) (*Tokens, error) {
+	refreshToken, refreshHash, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: refreshHash,
+		ExpiresAt:        time.Now().Add(m.refreshExpiry),
+	}
+	if userAgent != "" {
+		session.UserAgent = &userAgent
+	}
+	if sourceIP != "" {
+		session.SourceIP = &sourceIP
+	}
+	if err := m.sessions.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return m.issue(user, session.ID, refreshToken, session.ExpiresAt)
+}
+
+// Refresh exchanges a refresh token for new tokens and returns them with the
+// session's user. It returns ErrInvalidSession if the token is unknown, the
+// session has expired or been revoked, or the user is inactive, and
+// ErrRefreshTokenReused if the token has already been exchanged.
+func (m *SessionManager) Refresh(ctx context.Context, refreshToken string) (*Tokens, *models.User, error) {
+	hash := HashAPIKey(refreshToken)
+	session, err := m.sessions.GetSessionByTokenHash(ctx, hash)
+	if errors.Is(err, storage.ErrSessionNotFound) {
+		return nil, nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if session.RefreshTokenHash != hash {
+		if session.RevokedAt == nil {
+			slog.Warn("refresh token reused, revoking session", "session_id", session.ID, "user_id", session.UserID)
+			if err := m.sessions.RevokeSession(ctx, session.ID); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return nil, nil, ErrInvalidSession
+	}
+
+	user, err := m.users.GetUserByID(ctx, session.UserID)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return nil, nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrInvalidSession
+	}
+
+	newToken, newHash, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	expiresAt := time.Now().Add(m.refreshExpiry)
+	err = m.sessions.RotateSessionToken(ctx, session.ID, hash, newHash, expiresAt)
+	if errors.Is(err, storage.ErrSessionNotFound) {
+		// Another request rotated or revoked the session first
+		return nil, nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := m.issue(user, session.ID, newToken, expiresAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// Authenticate validates an access token and checks that its session is
+// still active. It returns ErrInvalidSession if either check fails.
+func (m *SessionManager) Authenticate(ctx context.Context, accessToken string) (*JWTClaims, error) {
+	claims, err := m.jwt.ValidateToken(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+	if claims.SessionID == uuid.Nil {
+		return nil, ErrInvalidSession
+	}
+
+	session, err := m.sessions.GetSession(ctx, claims.SessionID)
+	if errors.Is(err, storage.ErrSessionNotFound) {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != claims.UserID || session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return nil, ErrInvalidSession
+	}
+
+	return claims, nil
+}
+
+// Revoke ends a session. Its access tokens stop working immediately.
+func (m *SessionManager) Revoke(ctx context.Context, sessionID uuid.UUID) error {
+	return m.sessions.RevokeSession(ctx, sessionID)
+}
+
+// RevokeUser ends every session of a user
+func (m *SessionManager) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	return m.sessions.RevokeUserSessions(ctx, userID)
+}
+
+func (m *SessionManager) issue(user *models.User, sessionID uuid.UUID, refreshToken string, refreshExpiresAt time.Time) (*Tokens, error) {
+	accessToken, accessExpiresAt, err := m.jwt.GenerateToken(user.ID, user.Username, user.Role, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		SessionID:        sessionID,
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// mockSessionStorage implements storage.SessionStorage for testing
+type mockSessionStorage struct {
+	sessions map[uuid.UUID]*models.Session
+}
+
+func (m *mockSessionStorage) CreateSession(_ context.Context, session *models.Session) error {
+	session.ID = uuid.New()
+	copied := *session
+	m.sessions[session.ID] = &copied
+	return nil
+}
+
+func (m *mockSessionStorage) GetSession(_ context.Context, id uuid.UUID) (*models.Session, error) {
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, storage.ErrSessionNotFound
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (m *mockSessionStorage) GetSessionByTokenHash(_ context.Context, tokenHash string) (*models.Session, error) {
+	for _, s := range m.sessions {
+		if s.RefreshTokenHash == tokenHash || (s.PreviousTokenHash != nil && *s.PreviousTokenHash == tokenHash) {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, storage.ErrSessionNotFound
+}
+
+func (m *mockSessionStorage) RotateSessionToken(_ context.Context, id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error {
+	s, ok := m.sessions[id]
+	if !ok || s.RefreshTokenHash != oldHash || s.RevokedAt != nil {
+		return storage.ErrSessionNotFound
+	}
+	s.PreviousTokenHash = &oldHash
+	s.RefreshTokenHash = newHash
+	s.ExpiresAt = expiresAt
+	return nil
+}
+
+func (m *mockSessionStorage) RevokeSession(_ context.Context, id uuid.UUID) error {
+	if s, ok := m.sessions[id]; ok && s.RevokedAt == nil {
+		now := time.Now()
+		s.RevokedAt = &now
+	}
+	return nil
+}
+
+func (m *mockSessionStorage) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			m.RevokeSession(ctx, s.ID)
+		}
+	}
+	return nil
+}
+
+// mockUserStorage implements the GetUserByID method of storage.UserStorage
+type mockUserStorage struct {
+	storage.UserStorage
+	users map[uuid.UUID]*models.User
+}
+
+func (m *mockUserStorage) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	u, ok := m.users[id]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func newTestSessionManager() (*SessionManager, *models.User, *mockUserStorage) {
+	user := &models.User{ID: uuid.New(), Username: "alice", Role: models.RoleAdmin, IsActive: true}
+	users := &mockUserStorage{users: map[uuid.UUID]*models.User{user.ID: user}}
+	sessions := &mockSessionStorage{sessions: make(map[uuid.UUID]*models.Session)}
+	m := NewSessionManager(sessions, users, NewJWTService("test-secret", time.Minute), time.Hour)
+	return m, user, users
+}
+
+func TestSessionManagerStartAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	m, user, _ := newTestSessionManager()
+
+	tokens, err := m.Start(ctx, user, "curl", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !ValidateRefreshTokenFormat(tokens.RefreshToken) {
+		t.Errorf("refresh token %q has the wrong format", tokens.RefreshToken)
+	}
+
+	claims, err := m.Authenticate(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if claims.UserID != user.ID || claims.SessionID != tokens.SessionID {
+		t.Errorf("claims = %+v, want user %s session %s", claims, user.ID, tokens.SessionID)
+	}
+
+	if err := m.Revoke(ctx, tokens.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(ctx, tokens.AccessToken); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Authenticate(revoked) = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestSessionManagerRejectsTokenWithoutSession(t *testing.T) {
+	m, user, _ := newTestSessionManager()
+
+	token, _, err := m.jwt.GenerateToken(user.ID, user.Username, user.Role, uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Authenticate(no sid) = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestSessionManagerRefreshRotates(t *testing.T) {
+	ctx := context.Background()
+	m, user, _ := newTestSessionManager()
+
+	first, err := m.Start(ctx, user, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, got, err := m.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got.ID != user.ID || second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Errorf("Refresh = %+v for %s, want a new refresh token for the same session", second, got.Username)
+	}
+	if _, err := m.Authenticate(ctx, second.AccessToken); err != nil {
+		t.Errorf("Authenticate(refreshed) = %v", err)
+	}
+
+	// Reusing the replaced token revokes the session
+	if _, _, err := m.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh(reused) = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := m.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Refresh(after reuse) = %v, want ErrInvalidSession", err)
+	}
+	if _, err := m.Authenticate(ctx, second.AccessToken); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Authenticate(after reuse) = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestSessionManagerRefreshRejects(t *testing.T) {
+	ctx := context.Background()
+	m, user, users := newTestSessionManager()
+
+	if _, _, err := m.Refresh(ctx, "mdm_rt_unknown"); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Refresh(unknown) = %v, want ErrInvalidSession", err)
+	}
+
+	tokens, err := m.Start(ctx, user, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.users[user.ID] = &models.User{ID: user.ID, Username: user.Username, Role: user.Role, IsActive: false}
+	if _, _, err := m.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Refresh(inactive user) = %v, want ErrInvalidSession", err)
+	}
+
+	users.users[user.ID] = user
+	if err := m.RevokeUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Refresh(revoked) = %v, want ErrInvalidSession", err)
+	}
+}
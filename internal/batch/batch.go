@@ -0,0 +1,355 @@
+// Package batch recognizes calls to the OpenAI and Anthropic batch APIs and
+// parses the batches and results they return, so the requests in a batch can
+// be logged with their usage once the results are available.
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+// Op is the kind of batch API call
+type Op int
+
+const (
+	OpNone     Op = iota
+	OpCreate      // Submits a batch; the response is the batch
+	OpRetrieve    // Retrieves or cancels a batch; the response is the batch
+	OpList        // Lists batches
+	OpResults     // Downloads results; the response is JSONL, one line per request
+)
+
+// Call is a batch API call. ID is the batch ID, except for OpenAI results,
+// which are downloaded by file ID.
+type Call struct {
+	Op Op
+	ID string
+}
+
+// anthropicEndpoint is the path the requests in Anthropic batches are sent to
+const anthropicEndpoint = "/v1/messages"
+
+// Classify returns the batch API call a request makes, or OpNone if it isn't
+// one. Only OpenAI and Anthropic batches are recognized.
+func Classify(p provider.Provider, method, path string) Call {
+	path = strings.TrimSuffix(path, "/")
+	var prefix string
+	switch p {
+	case provider.ProviderOpenAI:
+		// Output and error files are the only files downloaded for batches
+		if id, ok := strings.CutPrefix(path, "/v1/files/"); ok && method == http.MethodGet {
+			if id, ok := strings.CutSuffix(id, "/content"); ok && id != "" && !strings.Contains(id, "/") {
+				return Call{Op: OpResults, ID: id}
+			}
+			return Call{}
+		}
+		prefix = "/v1/batches"
+	case provider.ProviderAnthropic:
+		prefix = "/v1/messages/batches"
+	default:
+		return Call{}
+	}
+
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok {
+		return Call{}
+	}
+	if rest == "" {
+		switch method {
+		case http.MethodPost:
+			return Call{Op: OpCreate}
+		case http.MethodGet:
+			return Call{Op: OpList}
+		}
+		return Call{}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(rest, "/"), "/")
+	if !strings.HasPrefix(rest, "/") || parts[0] == "" || len(parts) > 2 {
+		return Call{}
+	}
+	id := parts[0]
+	switch {
+	case len(parts) == 1 && method == http.MethodGet:
+		return Call{Op: OpRetrieve, ID: id}
+	case len(parts) == 2 && parts[1] == "cancel" && method == http.MethodPost:
+		return Call{Op: OpRetrieve, ID: id}
+	case len(parts) == 2 && parts[1] == "results" && method == http.MethodGet && p == provider.ProviderAnthropic:
+		return Call{Op: OpResults, ID: id}
+	}
+	return Call{}
+}
+
+// Info is the state of a batch, as the provider reports it
+type Info struct {
+	ID           string
+	Status       string
+	Ended        bool   // No requests are still being processed
+	Endpoint     string // Path the batch's requests are sent to, e.g. /v1/chat/completions
+	RequestCount int
+	OutputFileID string // OpenAI only
+	ErrorFileID  string // OpenAI only
+	EndedAt      *time.Time
+}
+
+type openAIBatch struct {
+	ID            string `json:"id"`
+	Object        string `json:"object"`
+	Endpoint      string `json:"endpoint"`
+	Status        string `json:"status"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	RequestCounts struct {
+		Total int `json:"total"`
+	} `json:"request_counts"`
+	CompletedAt *int64 `json:"completed_at"`
+	FailedAt    *int64 `json:"failed_at"`
+	ExpiredAt   *int64 `json:"expired_at"`
+	CancelledAt *int64 `json:"cancelled_at"`
+}
+
+type anthropicBatch struct {
+	ID               string `json:"id"`
+	Type             string `json:"type"`
+	ProcessingStatus string `json:"processing_status"`
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+	EndedAt *time.Time `json:"ended_at"`
+}
+
+func (b *openAIBatch) info() (*Info, error) {
+	if b.Object != "batch" || b.ID == "" {
+		return nil, fmt.Errorf("not an OpenAI batch object")
+	}
+	info := &Info{
+		ID:           b.ID,
+		Status:       b.Status,
+		Endpoint:     b.Endpoint,
+		RequestCount: b.RequestCounts.Total,
+		OutputFileID: b.OutputFileID,
+		ErrorFileID:  b.ErrorFileID,
+	}
+	switch b.Status {
+	case "completed", "failed", "expired", "cancelled":
+		info.Ended = true
+	}
+	for _, at := range []*int64{b.CompletedAt, b.FailedAt, b.ExpiredAt, b.CancelledAt} {
+		if at != nil {
+			t := time.Unix(*at, 0).UTC()
+			info.EndedAt = &t
+			break
+		}
+	}
+	return info, nil
+}
+
+func (b *anthropicBatch) info() (*Info, error) {
+	if b.Type != "message_batch" || b.ID == "" {
+		return nil, fmt.Errorf("not an Anthropic message batch")
+	}
+	c := b.RequestCounts
+	return &Info{
+		ID:           b.ID,
+		Status:       b.ProcessingStatus,
+		Ended:        b.ProcessingStatus == "ended",
+		Endpoint:     anthropicEndpoint,
+		RequestCount: c.Processing + c.Succeeded + c.Errored + c.Canceled + c.Expired,
+		EndedAt:      b.EndedAt,
+	}, nil
+}
+
+// ParseBatch parses a batch returned by creating, retrieving or canceling it
+func ParseBatch(p provider.Provider, body []byte) (*Info, error) {
+	switch p {
+	case provider.ProviderOpenAI:
+		var b openAIBatch
+		if err := json.Unmarshal(body, &b); err != nil {
+			return nil, err
+		}
+		return b.info()
+	case provider.ProviderAnthropic:
+		var b anthropicBatch
+		if err := json.Unmarshal(body, &b); err != nil {
+			return nil, err
+		}
+		return b.info()
+	}
+	return nil, fmt.Errorf("%s has no batch API", p)
+}
+
+// ParseList parses a page of batches returned by listing them
+func ParseList(p provider.Provider, body []byte) ([]*Info, error) {
+	var page struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, err
+	}
+	infos := make([]*Info, 0, len(page.Data))
+	for _, data := range page.Data {
+		info, err := ParseBatch(p, data)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Result is the outcome of one request in a batch
+type Result struct {
+	CustomID   string
+	StatusCode int
+	Usage      *models.UsageMetrics // Model is "unknown" if the response doesn't name it
+	Error      string
+}
+
+type openAIResultLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicResultLine struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string          `json:"type"`
+		Message json.RawMessage `json:"message"`
+		Error   *anthropicError `json:"error"`
+	} `json:"result"`
+}
+
+// anthropicError is either an error or an error response wrapping one
+type anthropicError struct {
+	Type    string          `json:"type"`
+	Message string          `json:"message"`
+	Error   *anthropicError `json:"error"`
+}
+
+// ParseResults parses downloaded results, one JSON object per line: an
+// OpenAI output or error file, or Anthropic batch results. Anthropic requests
+// that were canceled or expired before they ran are left out.
+func ParseResults(p provider.Provider, body []byte) ([]*Result, error) {
+	if p != provider.ProviderOpenAI && p != provider.ProviderAnthropic {
+		return nil, fmt.Errorf("%s has no batch API", p)
+	}
+
+	var results []*Result
+	for i, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var result *Result
+		var err error
+		if p == provider.ProviderOpenAI {
+			result, err = parseOpenAIResult(line)
+		} else {
+			result, err = parseAnthropicResult(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func parseOpenAIResult(line []byte) (*Result, error) {
+	var l openAIResultLine
+	if err := json.Unmarshal(line, &l); err != nil {
+		return nil, err
+	}
+	result := &Result{
+		CustomID:   l.CustomID,
+		StatusCode: http.StatusInternalServerError,
+		Usage:      &models.UsageMetrics{Provider: string(provider.ProviderOpenAI)},
+	}
+	if l.Response != nil {
+		result.StatusCode = l.Response.StatusCode
+		if result.StatusCode < 400 {
+			metrics, err := (&provider.OpenAIParser{}).ParseResponse(l.Response.Body)
+			if err != nil {
+				return nil, err
+			}
+			result.Usage = metrics
+		} else {
+			var body struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			json.Unmarshal(l.Response.Body, &body)
+			result.Error = body.Error.Message
+		}
+	}
+	if l.Error != nil {
+		result.Error = l.Error.Message
+		if result.StatusCode < 400 {
+			result.StatusCode = http.StatusInternalServerError
+		}
+	}
+	if result.Usage.Model == "" {
+		result.Usage.Model = "unknown"
+	}
+	return result, nil
+}
+
+func parseAnthropicResult(line []byte) (*Result, error) {
+	var l anthropicResultLine
+	if err := json.Unmarshal(line, &l); err != nil {
+		return nil, err
+	}
+	result := &Result{
+		CustomID: l.CustomID,
+		Usage:    &models.UsageMetrics{Provider: string(provider.ProviderAnthropic)},
+	}
+	switch l.Result.Type {
+	case "succeeded":
+		metrics, err := (&provider.AnthropicParser{}).ParseResponse(l.Result.Message)
+		if err != nil {
+			return nil, err
+		}
+		result.StatusCode = http.StatusOK
+		result.Usage = metrics
+	case "errored":
+		result.StatusCode = http.StatusInternalServerError
+		if e := l.Result.Error; e != nil {
+			if e.Error != nil {
+				e = e.Error
+			}
+			result.Error = e.Message
+			if e.Type == "invalid_request_error" {
+				result.StatusCode = http.StatusBadRequest
+			}
+		}
+	case "canceled", "expired":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown result type %q", l.Result.Type)
+	}
+	if result.Usage.Model == "" {
+		result.Usage.Model = "unknown"
+	}
+	return result, nil
+}
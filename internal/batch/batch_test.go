@@ -0,0 +1,180 @@
+package batch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+func TestClassify(t *testing.T) {
+	openai := provider.ProviderOpenAI
+	anthropic := provider.ProviderAnthropic
+
+	tests := []struct {
+		name     string
+		provider provider.Provider
+		method   string
+		path     string
+		want     Call
+	}{
+		{"openai create", openai, http.MethodPost, "/v1/batches", Call{Op: OpCreate}},
+		{"openai list", openai, http.MethodGet, "/v1/batches/", Call{Op: OpList}},
+		{"openai retrieve", openai, http.MethodGet, "/v1/batches/batch_1", Call{Op: OpRetrieve, ID: "batch_1"}},
+		{"openai cancel", openai, http.MethodPost, "/v1/batches/batch_1/cancel", Call{Op: OpRetrieve, ID: "batch_1"}},
+		{"openai file content", openai, http.MethodGet, "/v1/files/file-1/content", Call{Op: OpResults, ID: "file-1"}},
+		{"openai file upload", openai, http.MethodPost, "/v1/files", Call{}},
+		{"openai file metadata", openai, http.MethodGet, "/v1/files/file-1", Call{}},
+		{"openai delete batch", openai, http.MethodDelete, "/v1/batches/batch_1", Call{}},
+		{"openai results path", openai, http.MethodGet, "/v1/batches/batch_1/results", Call{}},
+		{"openai chat", openai, http.MethodPost, "/v1/chat/completions", Call{}},
+		{"anthropic create", anthropic, http.MethodPost, "/v1/messages/batches", Call{Op: OpCreate}},
+		{"anthropic list", anthropic, http.MethodGet, "/v1/messages/batches", Call{Op: OpList}},
+		{"anthropic retrieve", anthropic, http.MethodGet, "/v1/messages/batches/msgbatch_1", Call{Op: OpRetrieve, ID: "msgbatch_1"}},
+		{"anthropic cancel", anthropic, http.MethodPost, "/v1/messages/batches/msgbatch_1/cancel", Call{Op: OpRetrieve, ID: "msgbatch_1"}},
+		{"anthropic results", anthropic, http.MethodGet, "/v1/messages/batches/msgbatch_1/results", Call{Op: OpResults, ID: "msgbatch_1"}},
+		{"anthropic messages", anthropic, http.MethodPost, "/v1/messages", Call{}},
+		{"anthropic files", anthropic, http.MethodGet, "/v1/files/file-1/content", Call{}},
+		{"gemini", provider.ProviderGemini, http.MethodPost, "/v1/batches", Call{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.provider, tt.method, tt.path); got != tt.want {
+				t.Errorf("Classify(%s %s) = %+v, want %+v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBatchOpenAI(t *testing.T) {
+	running := `{"id":"batch_1","object":"batch","endpoint":"/v1/chat/completions","status":"in_progress",
+		"output_file_id":null,"error_file_id":null,"request_counts":{"total":3,"completed":1,"failed":0}}`
+	info, err := ParseBatch(provider.ProviderOpenAI, []byte(running))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "batch_1" || info.Status != "in_progress" || info.Ended || info.EndedAt != nil {
+		t.Errorf("running batch = %+v", info)
+	}
+	if info.Endpoint != "/v1/chat/completions" || info.RequestCount != 3 || info.OutputFileID != "" {
+		t.Errorf("running batch = %+v", info)
+	}
+
+	done := `{"id":"batch_1","object":"batch","endpoint":"/v1/chat/completions","status":"completed",
+		"output_file_id":"file-out","error_file_id":"file-err","request_counts":{"total":3},
+		"completed_at":1718000000}`
+	info, err = ParseBatch(provider.ProviderOpenAI, []byte(done))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Ended || info.OutputFileID != "file-out" || info.ErrorFileID != "file-err" {
+		t.Errorf("completed batch = %+v", info)
+	}
+	if info.EndedAt == nil || info.EndedAt.Unix() != 1718000000 {
+		t.Errorf("EndedAt = %v", info.EndedAt)
+	}
+
+	if _, err := ParseBatch(provider.ProviderOpenAI, []byte(`{"id":"file-1","object":"file"}`)); err == nil {
+		t.Error("expected an error for a file object")
+	}
+}
+
+func TestParseBatchAnthropic(t *testing.T) {
+	body := `{"id":"msgbatch_1","type":"message_batch","processing_status":"ended",
+		"request_counts":{"processing":0,"succeeded":2,"errored":1,"canceled":0,"expired":1},
+		"ended_at":"2024-06-10T12:00:00Z"}`
+	info, err := ParseBatch(provider.ProviderAnthropic, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "msgbatch_1" || !info.Ended || info.RequestCount != 4 || info.Endpoint != "/v1/messages" {
+		t.Errorf("batch = %+v", info)
+	}
+	if info.EndedAt == nil || info.EndedAt.Format("2006-01-02") != "2024-06-10" {
+		t.Errorf("EndedAt = %v", info.EndedAt)
+	}
+
+	if _, err := ParseBatch(provider.ProviderAnthropic, []byte(`{"id":"msg_1","type":"message"}`)); err == nil {
+		t.Error("expected an error for a message")
+	}
+	if _, err := ParseBatch(provider.ProviderGemini, []byte(`{}`)); err == nil {
+		t.Error("expected an error for a provider without batches")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	body := `{"object":"list","data":[
+		{"id":"batch_1","object":"batch","status":"completed","output_file_id":"file-1"},
+		{"id":"batch_2","object":"batch","status":"validating"}
+	],"has_more":false}`
+	infos, err := ParseList(provider.ProviderOpenAI, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].OutputFileID != "file-1" || !infos[0].Ended || infos[1].Ended {
+		t.Errorf("infos = %+v", infos)
+	}
+}
+
+func TestParseResultsOpenAI(t *testing.T) {
+	body := `{"id":"r1","custom_id":"a","response":{"status_code":200,"body":{"model":"gpt-4o-mini-2024-07-18","usage":{"prompt_tokens":10,"completion_tokens":5,"prompt_tokens_details":{"cached_tokens":2}}}},"error":null}
+{"id":"r2","custom_id":"b","response":{"status_code":400,"body":{"error":{"message":"bad model"}}},"error":null}
+{"id":"r3","custom_id":"c","response":null,"error":{"code":"batch_expired","message":"expired"}}
+`
+	results, err := ParseResults(provider.ProviderOpenAI, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	ok := results[0]
+	if ok.CustomID != "a" || ok.StatusCode != 200 || ok.Error != "" {
+		t.Errorf("result a = %+v", ok)
+	}
+	if ok.Usage.Model != "gpt-4o-mini-2024-07-18" || ok.Usage.InputTokens != 10 || ok.Usage.OutputTokens != 5 || ok.Usage.CachedTokens != 2 {
+		t.Errorf("usage a = %+v", ok.Usage)
+	}
+
+	if r := results[1]; r.StatusCode != 400 || r.Error != "bad model" || r.Usage.Model != "unknown" || r.Usage.InputTokens != 0 {
+		t.Errorf("result b = %+v", r)
+	}
+	if r := results[2]; r.StatusCode != 500 || r.Error != "expired" {
+		t.Errorf("result c = %+v", r)
+	}
+}
+
+func TestParseResultsAnthropic(t *testing.T) {
+	body := `{"custom_id":"a","result":{"type":"succeeded","message":{"id":"msg_1","type":"message","model":"claude-3-5-haiku-20241022","usage":{"input_tokens":12,"output_tokens":7,"cache_read_input_tokens":3}}}}
+{"custom_id":"b","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: required"}}}}
+{"custom_id":"c","result":{"type":"errored","error":{"type":"api_error","message":"internal"}}}
+{"custom_id":"d","result":{"type":"canceled"}}
+{"custom_id":"e","result":{"type":"expired"}}`
+	results, err := ParseResults(provider.ProviderAnthropic, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	ok := results[0]
+	if ok.CustomID != "a" || ok.StatusCode != 200 || ok.Usage.Model != "claude-3-5-haiku-20241022" {
+		t.Errorf("result a = %+v", ok)
+	}
+	if ok.Usage.InputTokens == 0 || ok.Usage.OutputTokens != 7 || ok.Usage.CachedTokens != 3 {
+		t.Errorf("usage a = %+v", ok.Usage)
+	}
+
+	if r := results[1]; r.StatusCode != 400 || r.Error != "max_tokens: required" {
+		t.Errorf("result b = %+v", r)
+	}
+	if r := results[2]; r.StatusCode != 500 || r.Error != "internal" {
+		t.Errorf("result c = %+v", r)
+	}
+
+	if _, err := ParseResults(provider.ProviderAnthropic, []byte(`{"custom_id":"a","result":{"type":"exploded"}}`)); err == nil {
+		t.Error("expected an error for an unknown result type")
+	}
+}
@@ -14,16 +14,60 @@ type Config struct {
 	Logging   LoggingConfig   `mapstructure:"logging"`
 	Pricing   PricingConfig   `mapstructure:"pricing"`
 	Providers ProvidersConfig `mapstructure:"providers"`
+	Upstreams UpstreamsConfig `mapstructure:"upstreams"`
+	Routing   RoutingConfig   `mapstructure:"routing"`
+	Prompts   PromptsConfig   `mapstructure:"prompts"`
+	Batches   BatchesConfig   `mapstructure:"batches"`
 	S3        S3Config        `mapstructure:"s3"`
 	Metadata  MetadataConfig  `mapstructure:"metadata"`
 	Secrets   SecretsConfig   `mapstructure:"secrets"`
 	JWT       JWTConfig       `mapstructure:"jwt"`
+	OIDC      OIDCConfig      `mapstructure:"oidc"`
 	CORS      CORSConfig      `mapstructure:"cors"`
+
+	LoginThrottle LoginThrottleConfig `mapstructure:"login_throttle"`
+
+	Maintenance MaintenanceConfig `mapstructure:"maintenance"`
+
+	Transforms []TransformConfig `mapstructure:"transforms"`
+	Guardrails []GuardrailConfig `mapstructure:"guardrails"`
 }
 
 type JWTConfig struct {
-	Secret string        `mapstructure:"secret"`
-	Expiry time.Duration `mapstructure:"expiry"`
+	Secret        string        `mapstructure:"secret"`
+	Expiry        time.Duration `mapstructure:"expiry"`         // Access token lifetime
+	RefreshExpiry time.Duration `mapstructure:"refresh_expiry"` // Session lifetime without a refresh
+}
+
+// LoginThrottleConfig limits failed password logins to the admin API. A
+// limit of 0 disables it.
+type LoginThrottleConfig struct {
+	MaxFailures      int           `mapstructure:"max_failures"`        // Per username
+	MaxFailuresPerIP int           `mapstructure:"max_failures_per_ip"` // Per client address
+	Window           time.Duration `mapstructure:"window"`
+	Lockout          time.Duration `mapstructure:"lockout"`
+}
+
+// OIDCConfig configures single sign-on for the admin API. It requires
+// jwt.secret, since users still get a Majordomo token after logging in.
+type OIDCConfig struct {
+	IssuerURL            string            `mapstructure:"issuer_url"`
+	ClientID             string            `mapstructure:"client_id"`
+	ClientSecret         string            `mapstructure:"client_secret"`
+	RedirectURL          string            `mapstructure:"redirect_url"` // Public URL of /api/v1/admin/oidc/callback
+	Scopes               []string          `mapstructure:"scopes"`
+	UsernameClaim        string            `mapstructure:"username_claim"`
+	RoleClaim            string            `mapstructure:"role_claim"`   // e.g. "groups"; empty leaves roles to Majordomo
+	RoleMapping          map[string]string `mapstructure:"role_mapping"` // Role claim value -> role
+	DefaultRole          string            `mapstructure:"default_role"` // Empty rejects users no mapping matches
+	UIRedirectURL        string            `mapstructure:"ui_redirect_url"`
+	DisablePasswordLogin bool              `mapstructure:"disable_password_login"`
+	LinkExistingUsers    bool              `mapstructure:"link_existing_users"` // Link local users by verified email
+}
+
+// Enabled reports whether OIDC login is configured.
+func (o *OIDCConfig) Enabled() bool {
+	return o.IssuerURL != ""
 }
 
 type CORSConfig struct {
@@ -31,7 +75,68 @@ type CORSConfig struct {
 }
 
 type SecretsConfig struct {
-	EncryptionKey string `mapstructure:"encryption_key"` // AES-256 key, hex-encoded (64 chars)
+	Backend       string            `mapstructure:"backend"`        // "aes", "vault-transit", "aws-kms" or "reference"
+	EncryptionKey string            `mapstructure:"encryption_key"` // AES-256 key, hex-encoded (64 chars); key ID "default"
+	Keys          map[string]string `mapstructure:"keys"`           // Additional AES-256 keys by key ID
+	ActiveKey     string            `mapstructure:"active_key"`     // Key ID used to encrypt new secrets
+	Mode          string            `mapstructure:"mode"`           // "direct" or "envelope" (aes backend only)
+	KMS           KMSConfig         `mapstructure:"kms"`            // Wraps data keys in envelope mode
+	Vault         VaultConfig       `mapstructure:"vault"`
+	AWSKMS        AWSKMSConfig      `mapstructure:"aws_kms"`
+	Reference     ReferenceConfig   `mapstructure:"reference"`
+}
+
+// Enabled reports whether provider secrets can be stored, which is required
+// for proxy keys.
+func (s *SecretsConfig) Enabled() bool {
+	if s.Backend != "" && s.Backend != "aes" {
+		return true
+	}
+	return s.EncryptionKey != "" || len(s.Keys) > 0 || s.Mode == "envelope"
+}
+
+type KMSConfig struct {
+	Provider string `mapstructure:"provider"` // "local", "vault-transit" or "aws-kms"
+	KeyFile  string `mapstructure:"key_file"` // Key file for the local provider
+}
+
+// VaultConfig configures HashiCorp Vault for the vault-transit backend and
+// KMS, and for vault:// secret references.
+type VaultConfig struct {
+	Address      string `mapstructure:"address"`   // Falls back to VAULT_ADDR
+	Token        string `mapstructure:"token"`     // Falls back to VAULT_TOKEN
+	Namespace    string `mapstructure:"namespace"` // Vault Enterprise namespace
+	TransitMount string `mapstructure:"transit_mount"`
+	TransitKey   string `mapstructure:"transit_key"`
+}
+
+type AWSKMSConfig struct {
+	KeyID    string `mapstructure:"key_id"` // Key ID, ARN or alias
+	Region   string `mapstructure:"region"`
+	Endpoint string `mapstructure:"endpoint"` // Custom endpoint, e.g. for LocalStack
+}
+
+type ReferenceConfig struct {
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+
+	// What references may point to; references to anything else are rejected
+	AllowedEnvPrefixes []string `mapstructure:"allowed_env_prefixes"` // e.g. MAJORDOMO_PROVIDER_
+	AllowedFileDirs    []string `mapstructure:"allowed_file_dirs"`    // e.g. /run/secrets/providers
+	AllowedVaultPaths  []string `mapstructure:"allowed_vault_paths"`  // <mount>/<path> prefixes, e.g. kv/providers
+}
+
+// MaintenanceConfig controls llm_requests partition management and retention.
+type MaintenanceConfig struct {
+	Enabled         bool            `mapstructure:"enabled"` // Run periodically inside `serve`
+	Interval        time.Duration   `mapstructure:"interval"`
+	PartitionsAhead int             `mapstructure:"partitions_ahead"`
+	BatchSize       int             `mapstructure:"batch_size"`
+	Retention       RetentionConfig `mapstructure:"retention"`
+}
+
+type RetentionConfig struct {
+	BodyDays int `mapstructure:"body_days"` // 0 keeps request/response bodies forever
+	RowDays  int `mapstructure:"row_days"`  // 0 keeps request rows forever
 }
 
 type MetadataConfig struct {
@@ -47,8 +152,21 @@ type ServerConfig struct {
 }
 
 type StorageConfig struct {
-	Driver   string         `mapstructure:"driver"`
-	Postgres PostgresConfig `mapstructure:"postgres"`
+	Driver      string         `mapstructure:"driver"` // "postgres" or "sqlite"
+	Postgres    PostgresConfig `mapstructure:"postgres"`
+	SQLite      SQLiteConfig   `mapstructure:"sqlite"`
+	Writer      WriterConfig   `mapstructure:"writer"`
+	AutoMigrate bool           `mapstructure:"auto_migrate"` // Apply pending migrations on `serve` startup
+}
+
+// WriterConfig controls how request logs are batched and made durable.
+type WriterConfig struct {
+	BufferSize     int           `mapstructure:"buffer_size"`
+	BatchSize      int           `mapstructure:"batch_size"`
+	FlushInterval  time.Duration `mapstructure:"flush_interval"`
+	SpillDir       string        `mapstructure:"spill_dir"`       // Empty disables spill-to-disk
+	SpillMaxBytes  int64         `mapstructure:"spill_max_bytes"` // 0 means unbounded
+	ReplayInterval time.Duration `mapstructure:"replay_interval"`
 }
 
 type PostgresConfig struct {
@@ -66,11 +184,31 @@ func (p *PostgresConfig) DSN() string {
 		p.User, p.Password, p.Host, p.Port, p.Database, p.SSLMode)
 }
 
+type SQLiteConfig struct {
+	Path string `mapstructure:"path"`
+}
+
 type LoggingConfig struct {
 	StoreRequestBody  bool   `mapstructure:"store_request_body"`
 	StoreResponseBody bool   `mapstructure:"store_response_body"`
 	MaxBodySize       int    `mapstructure:"max_body_size"`
 	BodyStorage       string `mapstructure:"body_storage"` // "none", "postgres", "s3"
+
+	Redaction RedactionConfig `mapstructure:"redaction"`
+}
+
+// RedactionConfig replaces personal data and secrets in bodies before they
+// are stored, and optionally before requests are sent upstream
+type RedactionConfig struct {
+	Enabled        bool                     `mapstructure:"enabled"`
+	Mode           string                   `mapstructure:"mode"`      // "logs" or "upstream"
+	Detectors      []string                 `mapstructure:"detectors"` // Built-in detectors to run
+	CustomPatterns []RedactionPatternConfig `mapstructure:"custom_patterns"`
+}
+
+type RedactionPatternConfig struct {
+	Name    string `mapstructure:"name"`    // Used in the placeholder, e.g. [REDACTED:employee_id]
+	Pattern string `mapstructure:"pattern"` // RE2 regular expression
 }
 
 type S3Config struct {
@@ -87,6 +225,13 @@ type PricingConfig struct {
 	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
 	FallbackFile    string        `mapstructure:"fallback_file"`
 	AliasesFile     string        `mapstructure:"aliases_file"`
+	BatchDiscount   float64       `mapstructure:"batch_discount"` // Fraction taken off list prices for requests in provider batches
+}
+
+// BatchesConfig controls how the gateway follows provider batches submitted
+// through it
+type BatchesConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"` // How often batches submitted with proxy keys are checked; 0 disables polling
 }
 
 type ProvidersConfig struct {
@@ -97,8 +242,104 @@ type ProvidersConfig struct {
 	Bedrock   BedrockConfig  `mapstructure:"bedrock"`
 }
 
+type PromptsConfig struct {
+	CacheTTL time.Duration `mapstructure:"cache_ttl"` // How long the proxy keeps prompt templates before reading them again
+}
+
+type RoutingConfig struct {
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // How often routes created through the admin API are reloaded
+	Routes          []RouteConfig `mapstructure:"routes"`
+	Shadow          ShadowConfig  `mapstructure:"shadow"`
+}
+
+type ShadowConfig struct {
+	MaxConcurrent int                `mapstructure:"max_concurrent"` // Shadow requests in flight at once; further ones are dropped
+	Rules         []ShadowRuleConfig `mapstructure:"rules"`
+}
+
+// ShadowRuleConfig mirrors a sample of the requests for a model to a
+// candidate model
+type ShadowRuleConfig struct {
+	Name           string   `mapstructure:"name"`
+	Model          string   `mapstructure:"model"`
+	TargetProvider string   `mapstructure:"target_provider"`
+	TargetModel    string   `mapstructure:"target_model"`
+	SampleRate     *float64 `mapstructure:"sample_rate"` // Defaults to 1, every matching request
+}
+
+// RouteConfig is a model route defined in the config file. Empty conditions
+// are not checked.
+type RouteConfig struct {
+	Name           string `mapstructure:"name"`
+	TargetProvider string `mapstructure:"target_provider"`
+	TargetModel    string `mapstructure:"target_model"`
+	APIKeyID       string `mapstructure:"api_key_id"`
+	ProxyKeyID     string `mapstructure:"proxy_key_id"`
+	MetadataKey    string `mapstructure:"metadata_key"`
+	MetadataValue  string `mapstructure:"metadata_value"`
+}
+
 type ProviderConfig struct {
-	BaseURL string `mapstructure:"base_url"`
+	BaseURL  string   `mapstructure:"base_url"`
+	BaseURLs []string `mapstructure:"base_urls"` // Several endpoints, such as regions or replicas; used instead of base_url when set
+}
+
+// UpstreamsConfig controls how requests are spread over a provider's
+// endpoints and when an unhealthy endpoint is taken out of rotation
+type UpstreamsConfig struct {
+	Strategy       string               `mapstructure:"strategy"` // "latency", "round_robin" or "failover"
+	Window         int                  `mapstructure:"window"`   // Recent requests per endpoint that health is computed over
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig opens an endpoint's breaker when it fails too often. A
+// threshold of 0 disables that check.
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int           `mapstructure:"consecutive_failures"` // Failures in a row that open the breaker
+	ErrorRate           float64       `mapstructure:"error_rate"`           // Failed fraction of the window that opens the breaker
+	MinRequests         int           `mapstructure:"min_requests"`         // Requests in the window before error_rate applies
+	OpenDuration        time.Duration `mapstructure:"open_duration"`        // How long a breaker stays open before a trial request
+}
+
+// TransformConfig rewrites the JSON bodies of matching requests or responses.
+// Empty scope lists match everything.
+type TransformConfig struct {
+	Name       string                     `mapstructure:"name"`
+	Phase      string                     `mapstructure:"phase"`       // "request" (default) or "response"
+	APIKeyIDs  []string                   `mapstructure:"api_key_ids"` // Majordomo API key IDs
+	Models     []string                   `mapstructure:"models"`
+	Paths      []string                   `mapstructure:"paths"` // A trailing * matches any suffix
+	Operations []TransformOperationConfig `mapstructure:"operations"`
+}
+
+type TransformOperationConfig struct {
+	Op    string `mapstructure:"op"`   // "add", "replace", "remove" or "default"
+	Path  string `mapstructure:"path"` // JSON Pointer, e.g. /messages/0
+	Value any    `mapstructure:"value"`
+	// ValueJSON is the value as a JSON string, used instead of value. The
+	// config loader lowercases keys in value; value_json keeps them as written.
+	ValueJSON string `mapstructure:"value_json"`
+}
+
+// GuardrailConfig checks requests before they are sent to the provider, or
+// responses before they are returned. Empty key lists match every request.
+type GuardrailConfig struct {
+	Name        string   `mapstructure:"name"`
+	Type        string   `mapstructure:"type"`   // "denylist", "max_messages", "secrets", "json_schema" or "webhook"
+	Stage       string   `mapstructure:"stage"`  // "input", "output" or "both"; defaults depend on type
+	Action      string   `mapstructure:"action"` // "block" (default), "flag" or "log"
+	APIKeyIDs   []string `mapstructure:"api_key_ids"`
+	ProxyKeyIDs []string `mapstructure:"proxy_key_ids"`
+	FailClosed  bool     `mapstructure:"fail_closed"` // Treat a check that errors as triggered
+
+	Keywords    []string          `mapstructure:"keywords"`     // denylist: case-insensitive substrings
+	Patterns    []string          `mapstructure:"patterns"`     // denylist: RE2 regular expressions
+	MaxMessages int               `mapstructure:"max_messages"` // max_messages
+	Detectors   []string          `mapstructure:"detectors"`    // secrets: redaction detectors, default api_key
+	Schema      string            `mapstructure:"schema"`       // json_schema: the schema as a JSON string
+	URL         string            `mapstructure:"url"`          // webhook
+	Timeout     time.Duration     `mapstructure:"timeout"`      // webhook, default 5s
+	Headers     map[string]string `mapstructure:"headers"`      // webhook
 }
 
 type BedrockConfig struct {
@@ -151,9 +392,21 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("storage.postgres.database", "majordomo")
 	v.SetDefault("storage.postgres.sslmode", "disable")
 	v.SetDefault("storage.postgres.max_conns", 20)
+	v.SetDefault("storage.sqlite.path", "majordomo.db")
+	v.SetDefault("storage.auto_migrate", false)
+
+	v.SetDefault("storage.writer.buffer_size", 1000)
+	v.SetDefault("storage.writer.batch_size", 100)
+	v.SetDefault("storage.writer.flush_interval", time.Second)
+	v.SetDefault("storage.writer.spill_dir", "")
+	v.SetDefault("storage.writer.spill_max_bytes", 256*1024*1024)
+	v.SetDefault("storage.writer.replay_interval", 30*time.Second)
 
 	v.SetDefault("logging.store_request_body", false)
 	v.SetDefault("logging.store_response_body", false)
+	v.SetDefault("logging.redaction.enabled", false)
+	v.SetDefault("logging.redaction.mode", "logs")
+	v.SetDefault("logging.redaction.detectors", []string{"api_key", "email", "credit_card", "ssn", "phone"})
 	v.SetDefault("logging.max_body_size", 65536)
 	v.SetDefault("logging.body_storage", "none") // "none", "postgres", "s3"
 
@@ -168,19 +421,72 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("pricing.refresh_interval", time.Hour)
 	v.SetDefault("pricing.fallback_file", "./pricing.json")
 	v.SetDefault("pricing.aliases_file", "./model_aliases.json")
+	v.SetDefault("pricing.batch_discount", 0.5)
 
 	v.SetDefault("providers.openai.base_url", "https://api.openai.com")
 	v.SetDefault("providers.anthropic.base_url", "https://api.anthropic.com")
 	v.SetDefault("providers.gemini.base_url", "https://generativelanguage.googleapis.com")
 	v.SetDefault("providers.bedrock.region", "us-east-1")
 
+	v.SetDefault("upstreams.strategy", "latency")
+	v.SetDefault("upstreams.window", 100)
+	v.SetDefault("upstreams.circuit_breaker.consecutive_failures", 5)
+	v.SetDefault("upstreams.circuit_breaker.error_rate", 0.5)
+	v.SetDefault("upstreams.circuit_breaker.min_requests", 20)
+	v.SetDefault("upstreams.circuit_breaker.open_duration", 30*time.Second)
+
+	v.SetDefault("routing.refresh_interval", 30*time.Second)
+	v.SetDefault("routing.shadow.max_concurrent", 16)
+
+	v.SetDefault("prompts.cache_ttl", 30*time.Second)
+
+	v.SetDefault("batches.poll_interval", 5*time.Minute)
+
 	v.SetDefault("metadata.hll_flush_interval", 60*time.Second)
 	v.SetDefault("metadata.active_keys_cache_ttl", 5*time.Minute)
 
+	v.SetDefault("secrets.backend", "aes")
 	v.SetDefault("secrets.encryption_key", "")
+	v.SetDefault("secrets.active_key", "")
+	v.SetDefault("secrets.mode", "direct")
+	v.SetDefault("secrets.kms.provider", "local")
+	v.SetDefault("secrets.kms.key_file", "")
+	v.SetDefault("secrets.vault.address", "")
+	v.SetDefault("secrets.vault.token", "")
+	v.SetDefault("secrets.vault.namespace", "")
+	v.SetDefault("secrets.vault.transit_mount", "transit")
+	v.SetDefault("secrets.vault.transit_key", "majordomo")
+	v.SetDefault("secrets.aws_kms.key_id", "")
+	v.SetDefault("secrets.aws_kms.region", "")
+	v.SetDefault("secrets.aws_kms.endpoint", "")
+	v.SetDefault("secrets.reference.cache_ttl", 5*time.Minute)
 
 	v.SetDefault("jwt.secret", "")
-	v.SetDefault("jwt.expiry", 24*time.Hour)
+	v.SetDefault("jwt.expiry", 15*time.Minute)
+	v.SetDefault("jwt.refresh_expiry", 30*24*time.Hour)
+
+	v.SetDefault("login_throttle.max_failures", 5)
+	v.SetDefault("login_throttle.max_failures_per_ip", 20)
+	v.SetDefault("login_throttle.window", 15*time.Minute)
+	v.SetDefault("login_throttle.lockout", 15*time.Minute)
+
+	v.SetDefault("oidc.issuer_url", "")
+	v.SetDefault("oidc.client_id", "")
+	v.SetDefault("oidc.client_secret", "")
+	v.SetDefault("oidc.redirect_url", "")
+	v.SetDefault("oidc.scopes", []string{"openid", "email", "profile"})
+	v.SetDefault("oidc.username_claim", "email")
+	v.SetDefault("oidc.role_claim", "")
+	v.SetDefault("oidc.default_role", "member")
+	v.SetDefault("oidc.ui_redirect_url", "")
+	v.SetDefault("oidc.disable_password_login", false)
 
 	v.SetDefault("cors.allowed_origins", []string{})
+
+	v.SetDefault("maintenance.enabled", false)
+	v.SetDefault("maintenance.interval", time.Hour)
+	v.SetDefault("maintenance.partitions_ahead", 3)
+	v.SetDefault("maintenance.batch_size", 10000)
+	v.SetDefault("maintenance.retention.body_days", 0)
+	v.SetDefault("maintenance.retention.row_days", 0)
 }
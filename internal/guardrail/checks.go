@@ -0,0 +1,233 @@
+package guardrail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/redact"
+)
+
+// Denylist triggers on text containing any of its keywords, compared
+// case-insensitively, or matching any of its patterns
+type Denylist struct {
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// NewDenylist creates a Denylist. Patterns are RE2 regular expressions.
+func NewDenylist(keywords, patterns []string) (*Denylist, error) {
+	if len(keywords) == 0 && len(patterns) == 0 {
+		return nil, errors.New("keywords or patterns are required")
+	}
+	d := &Denylist{}
+	for _, k := range keywords {
+		d.keywords = append(d.keywords, strings.ToLower(k))
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	return d, nil
+}
+
+func (d *Denylist) Check(_ context.Context, in *Input) (bool, string, error) {
+	for _, text := range in.Text {
+		lower := strings.ToLower(text)
+		for _, k := range d.keywords {
+			if strings.Contains(lower, k) {
+				return true, fmt.Sprintf("contains %q", k), nil
+			}
+		}
+		for _, re := range d.patterns {
+			if re.MatchString(text) {
+				return true, fmt.Sprintf("matches %q", re.String()), nil
+			}
+		}
+	}
+	return false, "", nil
+}
+
+// MaxMessages triggers on requests with more than max messages
+type MaxMessages struct {
+	max int
+}
+
+// NewMaxMessages creates a MaxMessages check
+func NewMaxMessages(max int) (*MaxMessages, error) {
+	if max <= 0 {
+		return nil, errors.New("max_messages must be greater than 0")
+	}
+	return &MaxMessages{max: max}, nil
+}
+
+func (m *MaxMessages) Check(_ context.Context, in *Input) (bool, string, error) {
+	// messages for OpenAI and Anthropic, contents for Gemini and input for
+	// the Responses API
+	var req struct {
+		Messages []json.RawMessage `json:"messages"`
+		Contents []json.RawMessage `json:"contents"`
+		Input    json.RawMessage   `json:"input"`
+	}
+	if err := json.Unmarshal(in.Body, &req); err != nil {
+		return false, "", nil
+	}
+	n := max(len(req.Messages), len(req.Contents))
+	var input []json.RawMessage
+	if json.Unmarshal(req.Input, &input) == nil {
+		n = max(n, len(input))
+	}
+	if n > m.max {
+		return true, fmt.Sprintf("%d messages, more than %d", n, m.max), nil
+	}
+	return false, "", nil
+}
+
+// Secrets triggers on text containing API keys or other values found by the
+// redaction detectors
+type Secrets struct {
+	redactor *redact.Redactor
+}
+
+// NewSecrets creates a Secrets check using the named redaction detectors
+func NewSecrets(detectors []string) (*Secrets, error) {
+	r, err := redact.NewRedactor(redact.ModeLogs, detectors, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Secrets{redactor: r}, nil
+}
+
+func (s *Secrets) Check(_ context.Context, in *Input) (bool, string, error) {
+	for _, text := range in.Text {
+		if redacted, n := s.redactor.RedactString(text); n > 0 {
+			return true, "found " + firstPlaceholder(redacted), nil
+		}
+	}
+	return false, "", nil
+}
+
+// firstPlaceholder returns the detector name in the first [REDACTED:name]
+// placeholder of s
+func firstPlaceholder(s string) string {
+	_, rest, _ := strings.Cut(s, "[REDACTED:")
+	name, _, _ := strings.Cut(rest, "]")
+	return name
+}
+
+// JSONSchema triggers on responses whose text isn't JSON matching a schema
+type JSONSchema struct {
+	schema *Schema
+}
+
+// NewJSONSchema creates a JSONSchema check
+func NewJSONSchema(schema json.RawMessage) (*JSONSchema, error) {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchema{schema: s}, nil
+}
+
+func (j *JSONSchema) Check(_ context.Context, in *Input) (bool, string, error) {
+	text := strings.Join(in.Text, "")
+	var doc any
+	if err := json.Unmarshal([]byte(text), &doc); err != nil {
+		return true, "response is not JSON", nil
+	}
+	if err := j.schema.Validate(doc); err != nil {
+		return true, err.Error(), nil
+	}
+	return false, "", nil
+}
+
+// Webhook asks an external service to check a body. The service gets a
+// webhookRequest and answers with a webhookResponse.
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+type webhookRequest struct {
+	Guardrail  string          `json:"guardrail"`
+	Stage      Stage           `json:"stage"`
+	APIKeyID   uuid.UUID       `json:"api_key_id"`
+	ProxyKeyID *uuid.UUID      `json:"proxy_key_id,omitempty"`
+	Model      string          `json:"model,omitempty"`
+	Path       string          `json:"path"`
+	Text       []string        `json:"text"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+type webhookResponse struct {
+	Triggered bool   `json:"triggered"`
+	Reason    string `json:"reason"`
+}
+
+// NewWebhook creates a Webhook check. headers are sent with every call, for
+// example to authenticate the gateway.
+func NewWebhook(url string, timeout time.Duration, headers map[string]string) (*Webhook, error) {
+	if url == "" {
+		return nil, errors.New("url is required")
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Webhook{url: url, headers: headers, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (w *Webhook) Check(ctx context.Context, in *Input) (bool, string, error) {
+	req := webhookRequest{
+		Guardrail:  in.Guardrail,
+		Stage:      in.Stage,
+		APIKeyID:   in.Scope.APIKeyID,
+		ProxyKeyID: in.Scope.ProxyKeyID,
+		Model:      in.Scope.Model,
+		Path:       in.Scope.Path,
+		Text:       in.Text,
+	}
+	if json.Valid(in.Body) {
+		req.Body = in.Body
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return false, "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return false, "", fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+
+	var result webhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, "", fmt.Errorf("invalid webhook response: %w", err)
+	}
+	return result.Triggered, result.Reason, nil
+}
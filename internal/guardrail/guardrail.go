@@ -0,0 +1,171 @@
+// Package guardrail runs content checks on requests before they are sent to a
+// provider and on responses before they are returned to the client.
+package guardrail
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// Stage is the point in the proxy pipeline a guardrail runs at
+type Stage string
+
+const (
+	// StageInput checks the request before it is sent to the provider
+	StageInput Stage = "input"
+	// StageOutput checks a successful response before it is returned
+	StageOutput Stage = "output"
+)
+
+// Action is what happens when a guardrail's check triggers
+type Action string
+
+const (
+	// ActionBlock rejects the request, or withholds the response
+	ActionBlock Action = "block"
+	// ActionFlag lets the request through, marking the log and the response
+	ActionFlag Action = "flag"
+	// ActionLog only records the result
+	ActionLog Action = "log"
+)
+
+// ParseAction returns the action named s
+func ParseAction(s string) (Action, error) {
+	switch Action(s) {
+	case ActionBlock, ActionFlag, ActionLog:
+		return Action(s), nil
+	}
+	return "", fmt.Errorf("unknown guardrail action %q: must be block, flag or log", s)
+}
+
+// severity orders actions from least to most severe
+var severity = map[Action]int{ActionLog: 1, ActionFlag: 2, ActionBlock: 3}
+
+// Scope describes the request being checked
+type Scope struct {
+	APIKeyID   uuid.UUID
+	ProxyKeyID *uuid.UUID
+	Model      string
+	Path       string
+}
+
+// Input is what a check sees
+type Input struct {
+	Guardrail string
+	Stage     Stage
+	Scope     Scope
+	Body      []byte
+	// Text holds the prompt or completion text found in Body
+	Text []string
+}
+
+// Check decides whether a body should trigger its guardrail
+type Check interface {
+	Check(ctx context.Context, in *Input) (triggered bool, reason string, err error)
+}
+
+// Guardrail applies a check to the requests of the keys it is scoped to.
+// Empty key lists match every request.
+type Guardrail struct {
+	Name        string
+	Stages      []Stage
+	Action      Action
+	APIKeyIDs   []uuid.UUID
+	ProxyKeyIDs []uuid.UUID
+	Check       Check
+	// FailClosed treats a check that errors as triggered; otherwise the
+	// error is recorded and the request goes through
+	FailClosed bool
+}
+
+func (g *Guardrail) applies(stage Stage, scope Scope) bool {
+	if !slices.Contains(g.Stages, stage) {
+		return false
+	}
+	if len(g.APIKeyIDs) > 0 && !slices.Contains(g.APIKeyIDs, scope.APIKeyID) {
+		return false
+	}
+	if len(g.ProxyKeyIDs) > 0 && (scope.ProxyKeyID == nil || !slices.Contains(g.ProxyKeyIDs, *scope.ProxyKeyID)) {
+		return false
+	}
+	return true
+}
+
+// Guardrails runs guardrails in the order they are configured
+type Guardrails struct {
+	list []Guardrail
+}
+
+// NewGuardrails creates a Guardrails from validated guardrails
+func NewGuardrails(list []Guardrail) *Guardrails {
+	return &Guardrails{list: list}
+}
+
+// Outcome is the result of running the guardrails for one stage
+type Outcome struct {
+	Results []models.GuardrailResult
+	// Blocked is the guardrail that blocked the request, if any. Guardrails
+	// after it aren't run.
+	Blocked *models.GuardrailResult
+	// Flagged holds the names of the triggered guardrails with the flag action
+	Flagged []string
+}
+
+// Run checks body against the guardrails that apply to stage and scope
+func (g *Guardrails) Run(ctx context.Context, stage Stage, scope Scope, body []byte) Outcome {
+	var out Outcome
+	if g == nil {
+		return out
+	}
+
+	var text []string
+	for i := range g.list {
+		gr := &g.list[i]
+		if !gr.applies(stage, scope) {
+			continue
+		}
+		if text == nil {
+			text = ExtractText(body)
+		}
+
+		result := models.GuardrailResult{Name: gr.Name, Stage: string(stage), Action: string(gr.Action)}
+		triggered, reason, err := gr.Check.Check(ctx, &Input{Guardrail: gr.Name, Stage: stage, Scope: scope, Body: body, Text: text})
+		if err != nil {
+			result.Error = err.Error()
+			triggered = gr.FailClosed
+		}
+		result.Triggered = triggered
+		if triggered {
+			result.Reason = reason
+		}
+		out.Results = append(out.Results, result)
+
+		if !triggered {
+			continue
+		}
+		switch gr.Action {
+		case ActionBlock:
+			out.Blocked = &out.Results[len(out.Results)-1]
+			return out
+		case ActionFlag:
+			out.Flagged = append(out.Flagged, gr.Name)
+		}
+	}
+	return out
+}
+
+// Severest returns the most severe action among the triggered results, or
+// the empty string if none triggered
+func Severest(results []models.GuardrailResult) string {
+	var action Action
+	for _, r := range results {
+		if r.Triggered && severity[Action(r.Action)] > severity[action] {
+			action = Action(r.Action)
+		}
+	}
+	return string(action)
+}
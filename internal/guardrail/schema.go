@@ -0,0 +1,232 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema supporting the keywords used to describe
+// structured model output: type, properties, required,
+// additionalProperties, items, enum, const, minimum, maximum, minLength,
+// maxLength, pattern, minItems and maxItems. Other keywords are ignored.
+type Schema struct {
+	Types                []string           `json:"-"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *Schema            `json:"-"`
+	NoAdditional         bool               `json:"-"`
+	Items                *Schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	Const                *any               `json:"-"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseSchema parses a JSON Schema document
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &s, nil
+}
+
+// UnmarshalJSON handles the keywords whose JSON form varies: type may be a
+// string or a list, additionalProperties a boolean or a schema, and const
+// may be null
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		plain
+		Type                 json.RawMessage `json:"type"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+		Const                json.RawMessage `json:"const"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Schema(raw.plain)
+
+	if len(raw.Type) > 0 {
+		var one string
+		if json.Unmarshal(raw.Type, &one) == nil {
+			s.Types = []string{one}
+		} else if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+			return fmt.Errorf("type must be a string or a list of strings")
+		}
+		for _, t := range s.Types {
+			if !slices.Contains([]string{"object", "array", "string", "number", "integer", "boolean", "null"}, t) {
+				return fmt.Errorf("unknown type %q", t)
+			}
+		}
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		var allowed bool
+		if json.Unmarshal(raw.AdditionalProperties, &allowed) == nil {
+			s.NoAdditional = !allowed
+		} else {
+			s.AdditionalProperties = &Schema{}
+			if err := json.Unmarshal(raw.AdditionalProperties, s.AdditionalProperties); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(raw.Const) > 0 {
+		var v any
+		if err := json.Unmarshal(raw.Const, &v); err != nil {
+			return err
+		}
+		s.Const = &v
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	return nil
+}
+
+// Validate returns an error describing the first way v doesn't match the
+// schema. v is a value decoded by encoding/json.
+func (s *Schema) Validate(v any) error {
+	return s.validate(v, "$")
+}
+
+func (s *Schema) validate(v any, path string) error {
+	if len(s.Types) > 0 && !slices.ContainsFunc(s.Types, func(t string) bool { return hasType(v, t) }) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Types, " or "), typeOf(v))
+	}
+	if s.Enum != nil && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		return fmt.Errorf("%s: not one of the allowed values", path)
+	}
+	if s.Const != nil && !reflect.DeepEqual(*s.Const, v) {
+		return fmt.Errorf("%s: does not equal the constant", path)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "." + name
+			if prop, ok := s.Properties[name]; ok {
+				if err := prop.validate(v[name], child); err != nil {
+					return err
+				}
+			} else if s.NoAdditional {
+				return fmt.Errorf("%s: property not allowed", child)
+			} else if s.AdditionalProperties != nil {
+				if err := s.AdditionalProperties.validate(v[name], child); err != nil {
+					return err
+				}
+			}
+		}
+
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: fewer than %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s: more than %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d characters", path, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%s: does not match %q", path, s.Pattern)
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: less than %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: greater than %v", path, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
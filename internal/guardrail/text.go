@@ -0,0 +1,82 @@
+package guardrail
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// textKeys are the JSON members that hold prompt or completion text in the
+// request and response formats of the supported providers
+var textKeys = map[string]bool{
+	"content":      true, // OpenAI and Anthropic messages, OpenAI choices and deltas
+	"text":         true, // Content parts, Gemini parts, completions
+	"prompt":       true,
+	"input":        true, // Responses API and embeddings
+	"system":       true, // Anthropic system prompt
+	"instructions": true, // Responses API system prompt
+	"arguments":    true, // Tool call arguments
+}
+
+// ExtractText returns the prompt or completion text in a JSON body, in
+// order. The text of a server-sent event stream of JSON events is joined
+// into one, since each event holds a fragment of the completion. A body that
+// is neither is returned as a single text.
+func ExtractText(body []byte) []string {
+	var text []string
+	if json.Valid(body) {
+		var doc any
+		if json.Unmarshal(body, &doc) == nil {
+			collect(doc, "", &text)
+		}
+		return text
+	}
+
+	stream := false
+	var fragments []string
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		data, ok := bytes.CutPrefix(line, []byte("data: "))
+		if !ok {
+			continue
+		}
+		stream = true
+		var event any
+		if json.Unmarshal(data, &event) == nil {
+			collect(event, "", &fragments)
+		}
+	}
+	if len(fragments) > 0 {
+		text = append(text, strings.Join(fragments, ""))
+	}
+	if !stream && len(body) > 0 {
+		text = append(text, string(body))
+	}
+	return text
+}
+
+// collect appends the strings under text keys in v. key is the member v
+// was found under, so that arrays of strings under a text key are collected.
+func collect(v any, key string, text *[]string) {
+	switch v := v.(type) {
+	case string:
+		if textKeys[key] && v != "" {
+			*text = append(*text, v)
+		}
+	case map[string]any:
+		// Object members are visited in a stable order so that text from
+		// several members comes out the same way every time
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			collect(v[k], k, text)
+		}
+	case []any:
+		for _, item := range v {
+			collect(item, key, text)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,14 +15,60 @@ type User struct {
 	ID           uuid.UUID `json:"id" db:"id"`
 	Username     string    `json:"username" db:"username"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         Role      `json:"role" db:"role"`
 	IsActive     bool      `json:"is_active" db:"is_active"`
+	OIDCIssuer   *string   `json:"oidc_issuer,omitempty" db:"oidc_issuer"`
+	OIDCSubject  *string   `json:"oidc_subject,omitempty" db:"oidc_subject"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
+// Role determines what a user may do in the admin API
+type Role string
+
+const (
+	// RoleAdmin can manage every user and every key
+	RoleAdmin Role = "admin"
+	// RoleMember manages their own keys
+	RoleMember Role = "member"
+	// RoleViewer has read-only access to every user and key
+	RoleViewer Role = "viewer"
+	// RoleBilling can see every API key and its usage
+	RoleBilling Role = "billing"
+)
+
+// Roles lists every valid role
+var Roles = []Role{RoleAdmin, RoleMember, RoleViewer, RoleBilling}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	for _, role := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateUserInput contains fields for creating a new user
 type CreateUserInput struct {
 	Username string
 	Password string
+	Role     Role // Defaults to RoleMember
+}
+
+// Session is an admin login. Its refresh token is rotated on every use; the
+// hash of the token it replaced is kept to detect reuse.
+type Session struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	UserID            uuid.UUID  `json:"user_id" db:"user_id"`
+	RefreshTokenHash  string     `json:"-" db:"refresh_token_hash"`
+	PreviousTokenHash *string    `json:"-" db:"previous_token_hash"`
+	UserAgent         *string    `json:"user_agent,omitempty" db:"user_agent"`
+	SourceIP          *string    `json:"source_ip,omitempty" db:"source_ip"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt        time.Time  `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt         time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
 }
 
 // APIKey represents a Majordomo API key stored in the database
@@ -28,7 +78,10 @@ type APIKey struct {
 	Name         string     `json:"name" db:"name"`
 	Description  *string    `json:"description,omitempty" db:"description"`
 	UserID       *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	TeamID       *uuid.UUID `json:"team_id,omitempty" db:"team_id"`
+	OrgID        *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"`
 	IsActive     bool       `json:"is_active" db:"is_active"`
+	Scopes       Scopes     `json:"scopes" db:"scopes"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
 	LastUsedAt   *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
@@ -40,12 +93,157 @@ type CreateAPIKeyInput struct {
 	Name        string
 	Description *string
 	UserID      *uuid.UUID
+	Team        *Team  // Owning team (optional)
+	Scopes      Scopes // Defaults to AllScopes
+}
+
+// Scope is something a Majordomo API key may be used for
+type Scope string
+
+const (
+	// ScopeProxy sends requests to providers through the gateway
+	ScopeProxy Scope = "proxy"
+	// ScopeProxyKeysRead lists proxy keys and their provider mappings
+	ScopeProxyKeysRead Scope = "proxy-keys:read"
+	// ScopeProxyKeysWrite creates and revokes proxy keys and sets their
+	// provider mappings
+	ScopeProxyKeysWrite Scope = "proxy-keys:write"
+	// ScopeUsageRead reads the key's usage from /api/v1/usage
+	ScopeUsageRead Scope = "usage:read"
+)
+
+// AllScopes lists every valid scope
+var AllScopes = Scopes{ScopeProxy, ScopeProxyKeysRead, ScopeProxyKeysWrite, ScopeUsageRead}
+
+// Valid reports whether s is a known scope
+func (s Scope) Valid() bool {
+	for _, scope := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes is the set of scopes granted to an API key. It is stored as a
+// comma-separated list.
+type Scopes []Scope
+
+// ParseScopes parses a comma-separated list of scopes
+func ParseScopes(list string) (Scopes, error) {
+	var scopes Scopes
+	for _, part := range strings.Split(list, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			scopes = append(scopes, Scope(part))
+		}
+	}
+	if err := scopes.Validate(); err != nil {
+		return nil, err
+	}
+	return scopes.Normalize(), nil
+}
+
+// Validate checks that the set is not empty and has only known scopes
+func (s Scopes) Validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range s {
+		if !scope.Valid() {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// Normalize returns the scopes in the order of AllScopes without duplicates
+func (s Scopes) Normalize() Scopes {
+	var out Scopes
+	for _, scope := range AllScopes {
+		if s.Has(scope) {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
+
+// Has reports whether scope is in the set
+func (s Scopes) Has(scope Scope) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the scopes as a comma-separated list
+func (s Scopes) String() string {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Scan implements sql.Scanner
+func (s *Scopes) Scan(src interface{}) error {
+	var list string
+	switch v := src.(type) {
+	case nil:
+	case []byte:
+		list = string(v)
+	case string:
+		list = v
+	default:
+		return fmt.Errorf("unsupported scopes type %T", src)
+	}
+
+	*s = Scopes{}
+	for _, part := range strings.Split(list, ",") {
+		if part != "" {
+			*s = append(*s, Scope(part))
+		}
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (s Scopes) Value() (driver.Value, error) {
+	return s.String(), nil
+}
+
+// Organization groups teams
+type Organization struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Team owns API keys (and through them, proxy keys) and an optional monthly budget
+type Team struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	OrgID         uuid.UUID `json:"organization_id" db:"organization_id"`
+	Name          string    `json:"name" db:"name"`
+	MonthlyBudget *float64  `json:"monthly_budget,omitempty" db:"monthly_budget"` // USD per calendar month (UTC)
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// TeamMember is a user's membership in a team. Role limits what the user
+// may do with the team's keys.
+type TeamMember struct {
+	TeamID    uuid.UUID `json:"team_id" db:"team_id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	Role      Role      `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 // UpdateAPIKeyInput contains fields for updating an API key
 type UpdateAPIKeyInput struct {
 	Name        *string
 	Description *string
+	Scopes      Scopes // Replaces the key's scopes when not nil
 }
 
 // APIKeyInfo contains resolved API key information for request processing
@@ -54,6 +252,9 @@ type APIKeyInfo struct {
 	Hash   string     // SHA256 hash of the key
 	Alias  *string    // Optional alias (key name)
 	UserID *uuid.UUID // Owning user (if key belongs to a user)
+	TeamID *uuid.UUID // Owning team (if key belongs to a team)
+	OrgID  *uuid.UUID // Organization of the owning team
+	Scopes Scopes     // What the key may be used for
 }
 
 type UsageMetrics struct {
@@ -80,6 +281,7 @@ type ProxyKey struct {
 	Name              string     `json:"name" db:"name"`
 	Description       *string    `json:"description,omitempty" db:"description"`
 	MajordomoAPIKeyID uuid.UUID  `json:"majordomo_api_key_id" db:"majordomo_api_key_id"`
+	SingleHeaderAuth  bool       `json:"single_header_auth" db:"single_header_auth"`
 	IsActive          bool       `json:"is_active" db:"is_active"`
 	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
 	RevokedAt         *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
@@ -89,8 +291,9 @@ type ProxyKey struct {
 
 // CreateProxyKeyInput contains fields for creating a new proxy key
 type CreateProxyKeyInput struct {
-	Name        string
-	Description *string
+	Name             string
+	Description      *string
+	SingleHeaderAuth bool
 }
 
 // ProviderMapping maps a proxy key to an encrypted provider API key for a specific provider
@@ -103,6 +306,303 @@ type ProviderMapping struct {
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// ModelRoute sends requests for a virtual model name to a provider model.
+// The conditions are optional; a route only applies to requests that match
+// all of the conditions it sets.
+type ModelRoute struct {
+	ID uuid.UUID `json:"id" db:"id"`
+	// Name is the model name clients request, such as "fast"
+	Name string `json:"name" db:"name"`
+	// TargetProvider is the provider to send the request to. Empty keeps the
+	// provider detected from the request.
+	TargetProvider string `json:"target_provider,omitempty" db:"target_provider"`
+	TargetModel    string `json:"target_model" db:"target_model"`
+
+	APIKeyID      *uuid.UUID `json:"api_key_id,omitempty" db:"api_key_id"`
+	ProxyKeyID    *uuid.UUID `json:"proxy_key_id,omitempty" db:"proxy_key_id"`
+	MetadataKey   *string    `json:"metadata_key,omitempty" db:"metadata_key"`
+	MetadataValue *string    `json:"metadata_value,omitempty" db:"metadata_value"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Conditions returns the number of conditions the route sets
+func (r *ModelRoute) Conditions() int {
+	n := 0
+	if r.APIKeyID != nil {
+		n++
+	}
+	if r.ProxyKeyID != nil {
+		n++
+	}
+	if r.MetadataKey != nil {
+		n++
+	}
+	return n
+}
+
+// Experiment splits the traffic for a model name between arms. Requests with
+// the same value of the sticky metadata key always get the same arm; other
+// requests are assigned at random.
+type Experiment struct {
+	ID   uuid.UUID `json:"id" db:"id"`
+	Name string    `json:"name" db:"name"`
+	// Model is the model name whose traffic is split
+	Model     string         `json:"model" db:"model"`
+	StickyKey *string        `json:"sticky_key,omitempty" db:"sticky_key"`
+	Arms      ExperimentArms `json:"arms" db:"arms"`
+	IsActive  bool           `json:"is_active" db:"is_active"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// ExperimentArm is one variant of an experiment
+type ExperimentArm struct {
+	Name           string `json:"name"`
+	TargetProvider string `json:"target_provider,omitempty"`
+	TargetModel    string `json:"target_model"`
+	Weight         int    `json:"weight"` // Percentage of the experiment's traffic
+}
+
+// ExperimentArms is stored as a JSON array in a JSONB or TEXT column
+type ExperimentArms []ExperimentArm
+
+// Scan implements sql.Scanner
+func (a *ExperimentArms) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return fmt.Errorf("unsupported experiment arms type %T", src)
+	}
+}
+
+// Value implements driver.Valuer, binding the arms as text so they fit both
+// JSONB and TEXT columns
+func (a ExperimentArms) Value() (driver.Value, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// PromptTemplate is one version of a named prompt: messages with
+// {{variable}} placeholders that the gateway renders into requests that
+// reference it. Versions are never changed; editing a prompt creates the
+// next version.
+type PromptTemplate struct {
+	ID          uuid.UUID      `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Version     int            `json:"version" db:"version"`
+	Description *string        `json:"description,omitempty" db:"description"`
+	Messages    PromptMessages `json:"messages" db:"messages"`
+	// Variables lists the placeholders in Messages. It is filled in when a
+	// template is returned, not stored.
+	Variables []string  `json:"variables" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PromptMessage is a message of a prompt template
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PromptMessages is stored as a JSON array in a JSONB or TEXT column
+type PromptMessages []PromptMessage
+
+// Scan implements sql.Scanner
+func (m *PromptMessages) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("unsupported prompt messages type %T", src)
+	}
+}
+
+// Value implements driver.Valuer, binding the messages as text so they fit
+// both JSONB and TEXT columns
+func (m PromptMessages) Value() (driver.Value, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// PromptVersionResult compares the requests rendered from one version of a
+// prompt template
+type PromptVersionResult struct {
+	Version           int     `json:"version" db:"prompt_version"`
+	RequestCount      int64   `json:"request_count" db:"request_count"`
+	ErrorCount        int64   `json:"error_count" db:"error_count"`
+	ErrorRate         float64 `json:"error_rate" db:"-"`
+	InputTokens       int64   `json:"input_tokens" db:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens" db:"output_tokens"`
+	TotalCost         float64 `json:"total_cost" db:"total_cost"`
+	CostPerRequest    float64 `json:"cost_per_request" db:"-"`
+	AvgResponseTimeMs float64 `json:"avg_response_time_ms" db:"avg_response_time_ms"`
+	MaxResponseTimeMs int64   `json:"max_response_time_ms" db:"max_response_time_ms"`
+}
+
+// ReplayOfMetadataKey is the metadata key that requests replayed through the
+// gateway carry, set to the ID of the request they replay
+const ReplayOfMetadataKey = "replay-of"
+
+// ReplayQuery selects logged requests to replay. Only requests whose body was
+// stored are selected, and never shadow requests or replays.
+type ReplayQuery struct {
+	From              time.Time
+	To                time.Time
+	MajordomoAPIKeyID *uuid.UUID
+	Provider          string
+	Model             string
+	Metadata          map[string]string // Every key must have the given value
+	Limit             int
+}
+
+// LoggedRequest is a logged request with what replaying it needs. The bodies
+// are nil when they were stored in S3 under BodyS3Key.
+type LoggedRequest struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	Provider       string    `json:"provider" db:"provider"`
+	Model          string    `json:"model" db:"model"`
+	RequestPath    string    `json:"request_path" db:"request_path"`
+	RequestMethod  string    `json:"request_method" db:"request_method"`
+	PromptName     *string   `json:"prompt_name,omitempty" db:"prompt_name"`
+	PromptVersion  *int      `json:"prompt_version,omitempty" db:"prompt_version"`
+	RequestedAt    time.Time `json:"requested_at" db:"requested_at"`
+	ResponseTimeMs int64     `json:"response_time_ms" db:"response_time_ms"`
+	InputTokens    int       `json:"input_tokens" db:"input_tokens"`
+	OutputTokens   int       `json:"output_tokens" db:"output_tokens"`
+	TotalCost      float64   `json:"total_cost" db:"total_cost"`
+	StatusCode     int       `json:"status_code" db:"status_code"`
+
+	Metadata           map[string]string `json:"metadata,omitempty" db:"-"`
+	RequestBody        *string           `json:"request_body,omitempty" db:"request_body"`
+	ResponseBody       *string           `json:"response_body,omitempty" db:"response_body"`
+	ClientRequestBody  *string           `json:"client_request_body,omitempty" db:"client_request_body"`
+	ClientResponseBody *string           `json:"client_response_body,omitempty" db:"client_response_body"`
+	BodyS3Key          *string           `json:"body_s3_key,omitempty" db:"body_s3_key"`
+}
+
+// Batch results are downloaded in parts: an OpenAI batch has an output file
+// and an error file, an Anthropic batch only has results
+const (
+	BatchPartResults = "results"
+	BatchPartErrors  = "errors"
+)
+
+// Batch is a provider batch job submitted through the gateway, tracked
+// against the key that submitted it. The requests in it are logged once
+// their results are downloaded, through the gateway or by polling.
+type Batch struct {
+	ID                  string     `json:"id" db:"id"` // The provider's batch ID
+	Provider            string     `json:"provider" db:"provider"`
+	MajordomoAPIKeyID   uuid.UUID  `json:"majordomo_api_key_id" db:"majordomo_api_key_id"`
+	UserID              *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	TeamID              *uuid.UUID `json:"team_id,omitempty" db:"team_id"`
+	OrgID               *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"`
+	ProxyKeyID          *uuid.UUID `json:"proxy_key_id,omitempty" db:"proxy_key_id"`
+	ProviderAPIKeyHash  *string    `json:"provider_api_key_hash,omitempty" db:"provider_api_key_hash"`
+	ProviderAPIKeyAlias *string    `json:"provider_api_key_alias,omitempty" db:"provider_api_key_alias"`
+	RequestID           uuid.UUID  `json:"request_id" db:"request_id"` // The logged request that submitted it
+
+	Endpoint     string  `json:"endpoint" db:"endpoint"` // Path the batch's requests are sent to
+	Status       string  `json:"status" db:"status"`     // As the provider reports it
+	RequestCount int     `json:"request_count" db:"request_count"`
+	OutputFileID *string `json:"output_file_id,omitempty" db:"output_file_id"` // OpenAI only
+	ErrorFileID  *string `json:"error_file_id,omitempty" db:"error_file_id"`   // OpenAI only
+
+	Metadata map[string]string `json:"metadata,omitempty" db:"-"` // Logged with each of its requests
+
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
+	EndedAt           *time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	ResultsRecordedAt *time.Time `json:"results_recorded_at,omitempty" db:"results_recorded_at"`
+	ErrorsRecordedAt  *time.Time `json:"errors_recorded_at,omitempty" db:"errors_recorded_at"`
+}
+
+// GuardrailResult is the outcome of one guardrail check on a request or its
+// response
+type GuardrailResult struct {
+	Name      string `json:"name"`
+	Stage     string `json:"stage"`  // "input" or "output"
+	Action    string `json:"action"` // "block", "flag" or "log"
+	Triggered bool   `json:"triggered"`
+	Reason    string `json:"reason,omitempty"`
+	Error     string `json:"error,omitempty"` // Set if the check itself failed
+}
+
+// GuardrailResults is stored as a JSON array in a JSONB or TEXT column, or
+// NULL when no guardrail ran
+type GuardrailResults []GuardrailResult
+
+// Scan implements sql.Scanner
+func (g *GuardrailResults) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*g = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, g)
+	case string:
+		return json.Unmarshal([]byte(v), g)
+	default:
+		return fmt.Errorf("unsupported guardrail results type %T", src)
+	}
+}
+
+// Value implements driver.Valuer, binding the results as text so they fit
+// both JSONB and TEXT columns
+func (g GuardrailResults) Value() (driver.Value, error) {
+	if len(g) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// ExperimentArmResult compares the requests one experiment arm served
+type ExperimentArmResult struct {
+	Arm               string  `json:"arm" db:"experiment_arm"`
+	RequestCount      int64   `json:"request_count" db:"request_count"`
+	ErrorCount        int64   `json:"error_count" db:"error_count"`
+	ErrorRate         float64 `json:"error_rate" db:"-"`
+	InputTokens       int64   `json:"input_tokens" db:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens" db:"output_tokens"`
+	TotalCost         float64 `json:"total_cost" db:"total_cost"`
+	CostPerRequest    float64 `json:"cost_per_request" db:"-"`
+	AvgResponseTimeMs float64 `json:"avg_response_time_ms" db:"avg_response_time_ms"`
+	MaxResponseTimeMs int64   `json:"max_response_time_ms" db:"max_response_time_ms"`
+}
+
+// ShadowResult compares the shadow requests one rule sent to a model with
+// the primary requests they mirrored
+type ShadowResult struct {
+	Rule                     string  `json:"rule" db:"shadow_rule"`
+	Model                    string  `json:"model" db:"model"`
+	RequestCount             int64   `json:"request_count" db:"request_count"`
+	ErrorCount               int64   `json:"error_count" db:"error_count"`
+	InputTokens              int64   `json:"input_tokens" db:"input_tokens"`
+	OutputTokens             int64   `json:"output_tokens" db:"output_tokens"`
+	TotalCost                float64 `json:"total_cost" db:"total_cost"`
+	AvgResponseTimeMs        float64 `json:"avg_response_time_ms" db:"avg_response_time_ms"`
+	PrimaryErrorCount        int64   `json:"primary_error_count" db:"primary_error_count"`
+	PrimaryTotalCost         float64 `json:"primary_total_cost" db:"primary_total_cost"`
+	PrimaryAvgResponseTimeMs float64 `json:"primary_avg_response_time_ms" db:"primary_avg_response_time_ms"`
+}
+
 type RequestLog struct {
 	ID uuid.UUID `json:"id" db:"id"`
 
@@ -112,10 +612,14 @@ type RequestLog struct {
 	// User who owns the API key
 	UserID *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
 
+	// Team and organization that own the API key
+	TeamID *uuid.UUID `json:"team_id,omitempty" db:"team_id"`
+	OrgID  *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"`
+
 	// Proxy key (if request used a proxy key)
 	ProxyKeyID *uuid.UUID `json:"proxy_key_id,omitempty" db:"proxy_key_id"`
 
-	// Provider API key (hashed Authorization header)
+	// Provider API key (hash of the key the client sent)
 	ProviderAPIKeyHash  *string `json:"provider_api_key_hash,omitempty" db:"provider_api_key_hash"`
 	ProviderAPIKeyAlias *string `json:"provider_api_key_alias,omitempty" db:"provider_api_key_alias"`
 
@@ -124,6 +628,40 @@ type RequestLog struct {
 	RequestPath   string `json:"request_path" db:"request_path"`
 	RequestMethod string `json:"request_method" db:"request_method"`
 
+	// Model the client asked for, when a routing rule replaced it with Model
+	RequestedModel *string `json:"requested_model,omitempty" db:"requested_model"`
+
+	// Experiment and arm that chose the model, if any
+	ExperimentID  *uuid.UUID `json:"experiment_id,omitempty" db:"experiment_id"`
+	ExperimentArm *string    `json:"experiment_arm,omitempty" db:"experiment_arm"`
+
+	// Set on shadow requests: the primary request they mirror and the rule
+	// that mirrored it. Shadow requests are left out of usage rollups.
+	ShadowOf   *uuid.UUID `json:"shadow_of,omitempty" db:"shadow_of"`
+	ShadowRule *string    `json:"shadow_rule,omitempty" db:"shadow_rule"`
+
+	// Comma-separated names of the transforms that changed the request or
+	// response
+	Transforms *string `json:"transforms,omitempty" db:"transforms"`
+
+	// Number of values, such as emails and card numbers, redacted from the
+	// request before it was sent upstream and from the stored bodies
+	Redactions int `json:"redactions" db:"redactions"`
+
+	// Results of the guardrails that ran, and the most severe action among
+	// those that triggered
+	Guardrails      GuardrailResults `json:"guardrails,omitempty" db:"guardrails"`
+	GuardrailAction *string          `json:"guardrail_action,omitempty" db:"guardrail_action"`
+
+	// The prompt template the request's messages were rendered from
+	PromptName    *string `json:"prompt_name,omitempty" db:"prompt_name"`
+	PromptVersion *int    `json:"prompt_version,omitempty" db:"prompt_version"`
+
+	// The provider batch the request submitted, retrieved or ran in. Requests
+	// that ran in a batch also carry the custom ID the client gave them.
+	BatchID       *string `json:"batch_id,omitempty" db:"batch_id"`
+	BatchCustomID *string `json:"batch_custom_id,omitempty" db:"batch_custom_id"`
+
 	RequestedAt    time.Time `json:"requested_at" db:"requested_at"`
 	RespondedAt    time.Time `json:"responded_at" db:"responded_at"`
 	ResponseTimeMs int64     `json:"response_time_ms" db:"response_time_ms"`
@@ -147,5 +685,127 @@ type RequestLog struct {
 	BodyS3Key       *string           `json:"body_s3_key,omitempty" db:"body_s3_key"`
 	ModelAliasFound bool              `json:"model_alias_found" db:"model_alias_found"`
 
+	// The request as the client sent it and the response as the client
+	// received it, when transforms changed them. RequestBody and ResponseBody
+	// are what was exchanged with the provider.
+	ClientRequestBody  *string `json:"client_request_body,omitempty" db:"client_request_body"`
+	ClientResponseBody *string `json:"client_response_body,omitempty" db:"client_response_body"`
+
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
+
+// Rollup granularities
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// UsageQuery selects usage rollups for a time range and optional filters.
+// When MetadataKey is set, results are broken down by that key's values.
+type UsageQuery struct {
+	Granularity       string
+	From              time.Time
+	To                time.Time
+	MajordomoAPIKeyID *uuid.UUID
+	ProxyKeyID        *uuid.UUID
+	UserID            *uuid.UUID
+	TeamID            *uuid.UUID
+	OrgID             *uuid.UUID
+	Provider          string
+	Model             string
+	MetadataKey       string
+}
+
+// UsageRollup is one bucket of aggregated usage
+type UsageRollup struct {
+	Bucket              time.Time `json:"bucket" db:"bucket"`
+	Provider            string    `json:"provider" db:"provider"`
+	Model               string    `json:"model" db:"model"`
+	MetadataValue       string    `json:"metadata_value,omitempty" db:"metadata_value"`
+	RequestCount        int64     `json:"request_count" db:"request_count"`
+	ErrorCount          int64     `json:"error_count" db:"error_count"`
+	InputTokens         int64     `json:"input_tokens" db:"input_tokens"`
+	OutputTokens        int64     `json:"output_tokens" db:"output_tokens"`
+	CachedTokens        int64     `json:"cached_tokens" db:"cached_tokens"`
+	CacheCreationTokens int64     `json:"cache_creation_tokens" db:"cache_creation_tokens"`
+	InputCost           float64   `json:"input_cost" db:"input_cost"`
+	OutputCost          float64   `json:"output_cost" db:"output_cost"`
+	TotalCost           float64   `json:"total_cost" db:"total_cost"`
+	ResponseTimeMsSum   int64     `json:"response_time_ms_sum" db:"response_time_ms_sum"`
+}
+
+// Audit actor types
+const (
+	AuditActorUser   = "user"    // Admin API user, authenticated with a JWT
+	AuditActorAPIKey = "api_key" // Majordomo API key on /api/v1
+	AuditActorCLI    = "cli"     // majordomo command run against the database
+)
+
+// AuditEvent records one administrative action. Before and After hold the
+// target's changed fields as JSON objects and never contain secrets.
+type AuditEvent struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	OccurredAt time.Time  `json:"occurred_at" db:"occurred_at"`
+	ActorType  string     `json:"actor_type" db:"actor_type"`
+	ActorID    *uuid.UUID `json:"actor_id,omitempty" db:"actor_id"`
+	ActorName  string     `json:"actor_name" db:"actor_name"`
+	Action     string     `json:"action" db:"action"`
+	TargetType string     `json:"target_type" db:"target_type"`
+	TargetID   string     `json:"target_id" db:"target_id"`
+	Before     AuditState `json:"before,omitempty" db:"before_state"`
+	After      AuditState `json:"after,omitempty" db:"after_state"`
+	SourceIP   *string    `json:"source_ip,omitempty" db:"source_ip"`
+}
+
+// AuditState is a JSON object stored in a JSONB or TEXT column
+type AuditState json.RawMessage
+
+// MarshalJSON embeds the state as JSON rather than base64
+func (s AuditState) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+// UnmarshalJSON keeps a copy of the raw JSON
+func (s *AuditState) UnmarshalJSON(data []byte) error {
+	*s = append((*s)[:0], data...)
+	return nil
+}
+
+// Scan implements sql.Scanner
+func (s *AuditState) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+	case []byte:
+		*s = append(AuditState(nil), v...)
+	case string:
+		*s = AuditState(v)
+	default:
+		return fmt.Errorf("unsupported audit state type %T", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer, binding the state as text so it fits both
+// JSONB and TEXT columns
+func (s AuditState) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+// AuditQuery filters audit events. Events are returned newest first.
+type AuditQuery struct {
+	From       time.Time
+	To         time.Time
+	ActorType  string
+	ActorID    *uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	Limit      int
+}
@@ -220,6 +220,18 @@ func (s *Service) Calculate(metrics *models.UsageMetrics) models.Cost {
 	}
 }
 
+// CalculateBatch returns the cost of a request that ran in a provider batch,
+// which is billed at a discount from list prices. discount is the fraction
+// taken off, e.g. 0.5 for half price.
+func (s *Service) CalculateBatch(metrics *models.UsageMetrics, discount float64) models.Cost {
+	cost := s.Calculate(metrics)
+	rate := 1 - discount
+	cost.InputCost *= rate
+	cost.OutputCost *= rate
+	cost.TotalCost *= rate
+	return cost
+}
+
 func (s *Service) Close() {
 	close(s.done)
 }
@@ -0,0 +1,229 @@
+// Package prompt renders versioned prompt templates into requests that
+// reference them with the X-Majordomo-Prompt header.
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+const (
+	// Header names the prompt template a request is rendered from, as
+	// name@version or just name for the latest version
+	Header = "X-Majordomo-Prompt"
+
+	// VariablesField is the request body member holding the values of the
+	// template's variables. It is removed before the request is forwarded.
+	VariablesField = "prompt_variables"
+)
+
+// Format is the request format messages are rendered into
+type Format int
+
+const (
+	// FormatMessages prepends the template's messages to the messages array,
+	// as in OpenAI chat completions
+	FormatMessages Format = iota
+	// FormatAnthropic moves system messages into the top-level system
+	// prompt, as the Anthropic Messages API requires
+	FormatAnthropic
+)
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+	roles = []string{"system", "developer", "user", "assistant"}
+)
+
+// ParseReference splits a reference of the form name@version into the name
+// and version. A reference without a version, or with @latest, returns
+// version 0.
+func ParseReference(ref string) (string, int, error) {
+	name, version, found := strings.Cut(strings.TrimSpace(ref), "@")
+	if !namePattern.MatchString(name) {
+		return "", 0, fmt.Errorf("invalid prompt reference %q", ref)
+	}
+	if !found || version == "latest" {
+		return name, 0, nil
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("invalid prompt version %q", version)
+	}
+	return name, n, nil
+}
+
+// Validate checks a prompt template's name and messages
+func Validate(p *models.PromptTemplate) error {
+	if !namePattern.MatchString(p.Name) || len(p.Name) > 100 {
+		return errors.New("name must be 1 to 100 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+	if len(p.Messages) == 0 {
+		return errors.New("messages is required")
+	}
+	for i, m := range p.Messages {
+		if !slices.Contains(roles, m.Role) {
+			return fmt.Errorf("messages[%d]: role must be system, developer, user or assistant", i)
+		}
+		if m.Content == "" {
+			return fmt.Errorf("messages[%d]: content is required", i)
+		}
+	}
+	return nil
+}
+
+// Variables returns the names of the {{variable}} placeholders in messages,
+// in the order they first appear
+func Variables(messages models.PromptMessages) []string {
+	names := []string{}
+	for _, m := range messages {
+		for _, match := range placeholder.FindAllStringSubmatch(m.Content, -1) {
+			if !slices.Contains(names, match[1]) {
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// Render replaces the placeholders in messages with the values in vars.
+// String values are inserted as they are and other values as JSON. Variables
+// without a value are an error; values without a placeholder are ignored.
+func Render(messages models.PromptMessages, vars map[string]any) (models.PromptMessages, error) {
+	var missing []string
+	for _, name := range Variables(messages) {
+		if _, ok := vars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing prompt variables: %s", strings.Join(missing, ", "))
+	}
+
+	rendered := make(models.PromptMessages, len(messages))
+	for i, m := range messages {
+		content := placeholder.ReplaceAllStringFunc(m.Content, func(s string) string {
+			return valueString(vars[placeholder.FindStringSubmatch(s)[1]])
+		})
+		rendered[i] = models.PromptMessage{Role: m.Role, Content: content}
+	}
+	return rendered, nil
+}
+
+func valueString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Apply renders the template with the variables in body's prompt_variables
+// member and adds the messages to body in format. The template's messages
+// come before any messages the request carries.
+func Apply(body []byte, p *models.PromptTemplate, format Format) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+
+	var vars map[string]any
+	if raw, ok := doc[VariablesField]; ok {
+		if err := json.Unmarshal(raw, &vars); err != nil {
+			return nil, fmt.Errorf("%s must be an object", VariablesField)
+		}
+		delete(doc, VariablesField)
+	}
+
+	messages, err := Render(p.Messages, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatAnthropic {
+		var system []string
+		var rest models.PromptMessages
+		for _, m := range messages {
+			if m.Role == "system" || m.Role == "developer" {
+				system = append(system, m.Content)
+			} else {
+				rest = append(rest, m)
+			}
+		}
+		if len(system) > 0 {
+			if doc["system"], err = prependSystem(doc["system"], strings.Join(system, "\n\n")); err != nil {
+				return nil, err
+			}
+		}
+		messages = rest
+	}
+
+	if doc["messages"], err = prependMessages(doc["messages"], messages); err != nil {
+		return nil, err
+	}
+	return marshal(doc)
+}
+
+// prependMessages returns the messages array raw with messages before the
+// existing ones
+func prependMessages(raw json.RawMessage, messages models.PromptMessages) (json.RawMessage, error) {
+	var existing []json.RawMessage
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, errors.New("messages must be an array")
+		}
+	}
+	all := make([]any, 0, len(messages)+len(existing))
+	for _, m := range messages {
+		all = append(all, m)
+	}
+	for _, m := range existing {
+		all = append(all, m)
+	}
+	return marshal(all)
+}
+
+// prependSystem adds text before an Anthropic system prompt, which may be a
+// string or an array of content blocks
+func prependSystem(raw json.RawMessage, text string) (json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return marshal(text)
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return marshal(text + "\n\n" + s)
+	}
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, errors.New("system must be a string or an array of content blocks")
+	}
+	return marshal(append([]any{map[string]string{"type": "text", "text": text}}, toAny(blocks)...))
+}
+
+func toAny(raw []json.RawMessage) []any {
+	out := make([]any, len(raw))
+	for i, r := range raw {
+		out[i] = r
+	}
+	return out
+}
+
+// marshal encodes v without escaping <, > and &, which prompts often contain
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
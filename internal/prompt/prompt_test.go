@@ -0,0 +1,136 @@
+package prompt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var triage = &models.PromptTemplate{
+	Name:    "support-triage",
+	Version: 3,
+	Messages: models.PromptMessages{
+		{Role: "system", Content: "You triage tickets for {{product}}. Reply in {{ language }}."},
+		{Role: "user", Content: "Ticket: {{ticket}}"},
+	},
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		version int
+		wantErr bool
+	}{
+		{"support-triage@3", "support-triage", 3, false},
+		{"support-triage", "support-triage", 0, false},
+		{"support-triage@latest", "support-triage", 0, false},
+		{" v2.summary_short@12 ", "v2.summary_short", 12, false},
+		{"support-triage@0", "", 0, true},
+		{"support-triage@three", "", 0, true},
+		{"@3", "", 0, true},
+		{"has space@1", "", 0, true},
+	}
+	for _, tt := range tests {
+		name, version, err := ParseReference(tt.ref)
+		if (err != nil) != tt.wantErr || name != tt.name || version != tt.version {
+			t.Errorf("ParseReference(%q) = %q, %d, %v; want %q, %d, error %v", tt.ref, name, version, err, tt.name, tt.version, tt.wantErr)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	got := Variables(triage.Messages)
+	want := []string{"product", "language", "ticket"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	got, err := Render(triage.Messages, map[string]any{
+		"product":  "Acme <Cloud>",
+		"language": "French",
+		"ticket":   map[string]any{"id": 7},
+		"unused":   "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.PromptMessages{
+		{Role: "system", Content: "You triage tickets for Acme <Cloud>. Reply in French."},
+		{Role: "user", Content: `Ticket: {"id":7}`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Render() = %v, want %v", got, want)
+	}
+
+	if _, err := Render(triage.Messages, map[string]any{"product": "Acme"}); err == nil || err.Error() != "missing prompt variables: language, ticket" {
+		t.Errorf("Render() with missing variables: err = %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		format Format
+		want   string
+	}{
+		{
+			"messages",
+			`{"model":"gpt-4o","prompt_variables":{"product":"Acme","language":"English","ticket":"refund"},"messages":[{"role":"user","content":"More detail"}]}`,
+			FormatMessages,
+			`{"messages":[{"role":"system","content":"You triage tickets for Acme. Reply in English."},{"role":"user","content":"Ticket: refund"},{"role":"user","content":"More detail"}],"model":"gpt-4o"}`,
+		},
+		{
+			"anthropic without system",
+			`{"model":"claude-sonnet-4-5","max_tokens":100,"prompt_variables":{"product":"Acme","language":"English","ticket":"refund"}}`,
+			FormatAnthropic,
+			`{"max_tokens":100,"messages":[{"role":"user","content":"Ticket: refund"}],"model":"claude-sonnet-4-5","system":"You triage tickets for Acme. Reply in English."}`,
+		},
+		{
+			"anthropic with system blocks",
+			`{"system":[{"type":"text","text":"Be brief."}],"prompt_variables":{"product":"Acme","language":"English","ticket":"refund"}}`,
+			FormatAnthropic,
+			`{"messages":[{"role":"user","content":"Ticket: refund"}],"system":[{"text":"You triage tickets for Acme. Reply in English.","type":"text"},{"type":"text","text":"Be brief."}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.body), triage, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Apply([]byte(`{"prompt_variables":"x"}`), triage, FormatMessages); err == nil {
+		t.Error("Apply() with non-object variables: want error")
+	}
+	if _, err := Apply([]byte(`[1]`), triage, FormatMessages); err == nil {
+		t.Error("Apply() with non-object body: want error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(triage); err != nil {
+		t.Errorf("Validate(triage) = %v", err)
+	}
+	bad := []*models.PromptTemplate{
+		{Name: "", Messages: triage.Messages},
+		{Name: "a@b", Messages: triage.Messages},
+		{Name: "empty"},
+		{Name: "role", Messages: models.PromptMessages{{Role: "tool", Content: "x"}}},
+		{Name: "content", Messages: models.PromptMessages{{Role: "user"}}},
+	}
+	for _, p := range bad {
+		if err := Validate(p); err == nil {
+			t.Errorf("Validate(%+v): want error", p)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package prompt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// Registry looks up prompt templates for the proxy, caching them so that
+// requests don't each read the database. Changes made through the admin API
+// invalidate this replica's cache; other replicas see them once their cached
+// copies expire.
+type Registry struct {
+	store storage.PromptStorage
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	cache map[cacheKey]cached
+}
+
+type cacheKey struct {
+	name    string
+	version int
+}
+
+type cached struct {
+	prompt  *models.PromptTemplate
+	expires time.Time
+}
+
+// NewRegistry creates a registry that keeps templates for ttl
+func NewRegistry(store storage.PromptStorage, ttl time.Duration) *Registry {
+	return &Registry{store: store, ttl: ttl, cache: make(map[cacheKey]cached)}
+}
+
+// Get returns a version of the named template, or the latest version if
+// version is 0. It returns storage.ErrPromptNotFound if there is none.
+func (r *Registry) Get(ctx context.Context, name string, version int) (*models.PromptTemplate, error) {
+	key := cacheKey{name, version}
+	now := time.Now()
+
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.prompt, nil
+	}
+
+	p, err := r.store.GetPromptVersion(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = cached{prompt: p, expires: now.Add(r.ttl)}
+	r.mu.Unlock()
+	return p, nil
+}
+
+// Invalidate drops the cached versions of the named template
+func (r *Registry) Invalidate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.cache {
+		if key.name == name {
+			delete(r.cache, key)
+		}
+	}
+}
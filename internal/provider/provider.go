@@ -106,3 +106,10 @@ func extractModelFromRequest(body []byte) string {
 	}
 	return req.Model
 }
+
+// ForName returns the provider with the given name, as set by the
+// X-Majordomo-Provider header. Provider is ProviderUnknown if the name is not
+// a known provider.
+func ForName(name string) ProviderInfo {
+	return resolveExplicitProvider(name)
+}
@@ -0,0 +1,396 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/batch"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+// batchCall returns the batch API call a request made, or OpNone when it
+// made none or batches aren't tracked
+func (h *Handler) batchCall(providerInfo provider.ProviderInfo, req *http.Request) batch.Call {
+	if h.batches == nil {
+		return batch.Call{}
+	}
+	return batch.Classify(providerInfo.Provider, req.Method, req.URL.Path)
+}
+
+// trackBatch records what a successful batch API call says about a batch: a
+// new batch is tracked against the key that submitted it, a batch's status
+// is updated, and downloaded results are logged. It returns the ID of the
+// batch the call was about, or nil if there is none.
+func (h *Handler) trackBatch(ctx context.Context, call batch.Call, log *models.RequestLog, body []byte) *string {
+	p := provider.Provider(log.Provider)
+
+	switch call.Op {
+	case batch.OpCreate:
+		info, err := batch.ParseBatch(p, body)
+		if err != nil {
+			slog.Warn("failed to parse submitted batch", "error", err, "request_id", log.ID)
+			return nil
+		}
+		b := &models.Batch{
+			ID:                  info.ID,
+			Provider:            log.Provider,
+			MajordomoAPIKeyID:   *log.MajordomoAPIKeyID,
+			UserID:              log.UserID,
+			TeamID:              log.TeamID,
+			OrgID:               log.OrgID,
+			ProxyKeyID:          log.ProxyKeyID,
+			ProviderAPIKeyHash:  log.ProviderAPIKeyHash,
+			ProviderAPIKeyAlias: log.ProviderAPIKeyAlias,
+			RequestID:           log.ID,
+			Endpoint:            info.Endpoint,
+			Metadata:            log.RawMetadata,
+		}
+		applyBatchInfo(b, info)
+		if err := h.batches.CreateBatch(ctx, b); err != nil {
+			slog.Error("failed to track batch", "error", err, "batch_id", b.ID, "request_id", log.ID)
+		}
+		return &info.ID
+
+	case batch.OpRetrieve:
+		info, err := batch.ParseBatch(p, body)
+		if err != nil {
+			slog.Warn("failed to parse batch", "error", err, "request_id", log.ID)
+			return nil
+		}
+		h.updateBatch(ctx, p, info)
+		return &info.ID
+
+	case batch.OpList:
+		infos, err := batch.ParseList(p, body)
+		if err != nil {
+			slog.Warn("failed to parse batch list", "error", err, "request_id", log.ID)
+			return nil
+		}
+		for _, info := range infos {
+			h.updateBatch(ctx, p, info)
+		}
+
+	case batch.OpResults:
+		b, part, err := h.batchForResults(ctx, p, call.ID)
+		if err != nil {
+			slog.Warn("failed to look up batch", "error", err, "request_id", log.ID)
+			return nil
+		}
+		if b == nil {
+			return nil
+		}
+		h.recordBatchResults(ctx, b, part, body)
+		return &b.ID
+	}
+	return nil
+}
+
+// batchForResults returns the tracked batch that results downloaded by id
+// belong to, and which part of its results they are
+func (h *Handler) batchForResults(ctx context.Context, p provider.Provider, id string) (*models.Batch, string, error) {
+	if p == provider.ProviderAnthropic {
+		b, err := h.batches.GetBatch(ctx, string(p), id)
+		return b, models.BatchPartResults, err
+	}
+
+	// OpenAI results are files, known once the batch is retrieved after it
+	// ends
+	b, err := h.batches.GetBatchByFileID(ctx, string(p), id)
+	if err != nil || b == nil {
+		return nil, "", err
+	}
+	if b.ErrorFileID != nil && *b.ErrorFileID == id {
+		return b, models.BatchPartErrors, nil
+	}
+	return b, models.BatchPartResults, nil
+}
+
+func (h *Handler) updateBatch(ctx context.Context, p provider.Provider, info *batch.Info) {
+	b := &models.Batch{ID: info.ID, Provider: string(p)}
+	applyBatchInfo(b, info)
+	if err := h.batches.UpdateBatch(ctx, b); err != nil {
+		slog.Warn("failed to update batch", "error", err, "batch_id", info.ID)
+	}
+}
+
+// applyBatchInfo copies the state the provider reported to b
+func applyBatchInfo(b *models.Batch, info *batch.Info) {
+	b.Status = info.Status
+	b.RequestCount = info.RequestCount
+	if info.OutputFileID != "" {
+		b.OutputFileID = &info.OutputFileID
+	}
+	if info.ErrorFileID != "" {
+		b.ErrorFileID = &info.ErrorFileID
+	}
+	b.EndedAt = info.EndedAt
+	if info.Ended && b.EndedAt == nil {
+		now := time.Now()
+		b.EndedAt = &now
+	}
+}
+
+// recordBatchResults logs each request in a part of a batch's results, with
+// batch pricing, against the key that submitted the batch. A part is logged
+// once, however many times it is downloaded: it is marked recorded only after
+// its logs are written, and each log's ID is derived from the request's
+// custom ID, so writing a part again after a failure stores nothing twice.
+// A part that couldn't be written is logged the next time it is downloaded
+// or polled.
+func (h *Handler) recordBatchResults(ctx context.Context, b *models.Batch, part string, body []byte) {
+	recordedAt := b.ResultsRecordedAt
+	if part == models.BatchPartErrors {
+		recordedAt = b.ErrorsRecordedAt
+	}
+	if recordedAt != nil {
+		slog.Debug("batch results already recorded", "batch_id", b.ID, "part", part)
+		return
+	}
+
+	results, err := batch.ParseResults(provider.Provider(b.Provider), body)
+	if err != nil {
+		slog.Warn("failed to parse batch results", "error", err, "batch_id", b.ID, "part", part)
+		return
+	}
+
+	// The provider doesn't say when each request ran, only when the batch did
+	respondedAt := time.Now()
+	if b.EndedAt != nil {
+		respondedAt = *b.EndedAt
+	}
+
+	logs := make([]*models.RequestLog, len(results))
+	var totalCost float64
+	for i, result := range results {
+		cost := h.pricing.CalculateBatch(result.Usage, h.config.Pricing.BatchDiscount)
+		totalCost += cost.TotalCost
+
+		log := &models.RequestLog{
+			ID:                  batchLogID(b, part, result.CustomID),
+			MajordomoAPIKeyID:   &b.MajordomoAPIKeyID,
+			UserID:              b.UserID,
+			TeamID:              b.TeamID,
+			OrgID:               b.OrgID,
+			ProxyKeyID:          b.ProxyKeyID,
+			ProviderAPIKeyHash:  b.ProviderAPIKeyHash,
+			ProviderAPIKeyAlias: b.ProviderAPIKeyAlias,
+
+			Provider:      b.Provider,
+			Model:         result.Usage.Model,
+			RequestPath:   b.Endpoint,
+			RequestMethod: http.MethodPost,
+			BatchID:       &b.ID,
+			BatchCustomID: &result.CustomID,
+
+			RequestedAt: b.CreatedAt,
+			RespondedAt: respondedAt,
+
+			InputTokens:         result.Usage.InputTokens,
+			OutputTokens:        result.Usage.OutputTokens,
+			CachedTokens:        result.Usage.CachedTokens,
+			CacheCreationTokens: result.Usage.CacheCreationTokens,
+
+			InputCost:  cost.InputCost,
+			OutputCost: cost.OutputCost,
+			TotalCost:  cost.TotalCost,
+
+			StatusCode:      result.StatusCode,
+			RawMetadata:     b.Metadata,
+			ModelAliasFound: cost.ModelAliasFound,
+		}
+		if result.Error != "" {
+			redacted, _ := h.redact([]byte(result.Error))
+			msg := string(redacted)
+			if len(msg) > 500 {
+				msg = msg[:500]
+			}
+			log.ErrorMessage = &msg
+		}
+		logs[i] = log
+	}
+
+	if err := h.storage.WriteRequestLogs(ctx, logs); err != nil {
+		slog.Error("failed to log batch results, will retry", "error", err, "batch_id", b.ID, "part", part, "count", len(logs))
+		return
+	}
+	marked, err := h.batches.MarkBatchResultsRecorded(ctx, b.Provider, b.ID, part)
+	if err != nil {
+		slog.Warn("failed to mark batch results recorded", "error", err, "batch_id", b.ID, "part", part)
+		return
+	}
+	if !marked {
+		// Another gateway or download recorded the part at the same time;
+		// the logs it wrote have the same IDs, so each was stored once
+		slog.Debug("batch results already recorded", "batch_id", b.ID, "part", part)
+		return
+	}
+	slog.Info("recorded batch results", "batch_id", b.ID, "provider", b.Provider, "part", part, "requests", len(logs), "total_cost", totalCost)
+}
+
+// batchLogNamespace is the UUID namespace of the IDs of logged batch requests
+var batchLogNamespace = uuid.MustParse("6f1d3c1e-2b7a-5c39-9e64-8a0f4d2b7c51")
+
+// batchLogID is the ID of the log of the request with customID in a part of
+// a batch's results. It is the same every time the part is recorded.
+func batchLogID(b *models.Batch, part, customID string) uuid.UUID {
+	return uuid.NewSHA1(batchLogNamespace, []byte(b.Provider+"/"+b.ID+"/"+part+"/"+customID))
+}
+
+// batchPollAge is how long after submission a batch is polled. Providers
+// keep results for about a month.
+const batchPollAge = 30 * 24 * time.Hour
+
+// batchPollLimit bounds the batches checked in one poll
+const batchPollLimit = 100
+
+// BatchPoller follows the batches submitted with proxy keys, whose provider
+// keys the gateway holds, and logs their results once they end, for clients
+// that don't download the results through the gateway
+type BatchPoller struct {
+	handler *Handler
+	keys    *auth.ProxyResolver
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewBatchPoller creates a BatchPoller for the batches tracked by h
+func NewBatchPoller(h *Handler, keys *auth.ProxyResolver) *BatchPoller {
+	return &BatchPoller{
+		handler: h,
+		keys:    keys,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start polls now and then every interval until Stop is called
+func (p *BatchPoller) Start(interval time.Duration) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			p.Poll(context.Background())
+
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops polling and waits for a poll in progress to finish
+func (p *BatchPoller) Stop() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+// Poll checks each pending batch once: a running batch's status is updated,
+// and an ended batch's results are downloaded and logged
+func (p *BatchPoller) Poll(ctx context.Context) {
+	batches, err := p.handler.batches.ListPendingBatches(ctx, time.Now().Add(-batchPollAge), batchPollLimit)
+	if err != nil {
+		slog.Warn("failed to list pending batches", "error", err)
+		return
+	}
+	for _, b := range batches {
+		if err := p.poll(ctx, b); err != nil {
+			slog.Warn("failed to poll batch", "error", err, "batch_id", b.ID, "provider", b.Provider)
+		}
+	}
+}
+
+func (p *BatchPoller) poll(ctx context.Context, b *models.Batch) error {
+	prov := provider.Provider(b.Provider)
+	key, err := p.keys.ProviderKeyByID(ctx, *b.ProxyKeyID, b.Provider)
+	if err != nil {
+		return err
+	}
+
+	if b.EndedAt == nil {
+		path := "/v1/batches/" + b.ID
+		if prov == provider.ProviderAnthropic {
+			path = "/v1/messages/batches/" + b.ID
+		}
+		body, err := p.get(ctx, prov, key, path)
+		if err != nil {
+			return err
+		}
+		info, err := batch.ParseBatch(prov, body)
+		if err != nil {
+			return err
+		}
+		applyBatchInfo(b, info)
+		if err := p.handler.batches.UpdateBatch(ctx, b); err != nil {
+			return err
+		}
+		if b.EndedAt == nil {
+			return nil
+		}
+	}
+
+	if prov == provider.ProviderAnthropic {
+		if b.ResultsRecordedAt == nil {
+			return p.record(ctx, b, models.BatchPartResults, key, "/v1/messages/batches/"+b.ID+"/results")
+		}
+		return nil
+	}
+
+	if b.ResultsRecordedAt == nil {
+		if b.OutputFileID == nil {
+			// Every request failed, or none ran; there is nothing to log
+			if _, err := p.handler.batches.MarkBatchResultsRecorded(ctx, b.Provider, b.ID, models.BatchPartResults); err != nil {
+				return err
+			}
+		} else if err := p.record(ctx, b, models.BatchPartResults, key, "/v1/files/"+*b.OutputFileID+"/content"); err != nil {
+			return err
+		}
+	}
+	if b.ErrorFileID != nil && b.ErrorsRecordedAt == nil {
+		return p.record(ctx, b, models.BatchPartErrors, key, "/v1/files/"+*b.ErrorFileID+"/content")
+	}
+	return nil
+}
+
+// record downloads a part of a batch's results and logs it
+func (p *BatchPoller) record(ctx context.Context, b *models.Batch, part, key, path string) error {
+	body, err := p.get(ctx, provider.Provider(b.Provider), key, path)
+	if err != nil {
+		return err
+	}
+	p.handler.recordBatchResults(ctx, b, part, body)
+	return nil
+}
+
+// get sends a GET request to the provider with the provider key, through the
+// provider's configured upstreams
+func (p *BatchPoller) get(ctx context.Context, prov provider.Provider, key, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	(&clientCredential{Source: credentialSources(prov)[0]}).replace(req, key)
+	if prov == provider.ProviderAnthropic {
+		req.Header.Set("Anthropic-Version", "2023-06-01")
+	}
+
+	resp, err := p.handler.forward(ctx, provider.ForName(string(prov)), req, nil, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("GET %s returned %d", path, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/config"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/pricing"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// failingLogs is request log storage whose batch writes fail after writing
+// the first written logs
+type failingLogs struct {
+	storage.Storage
+	written int
+}
+
+func (s failingLogs) WriteRequestLogs(ctx context.Context, logs []*models.RequestLog) error {
+	if err := s.Storage.WriteRequestLogs(ctx, logs[:min(s.written, len(logs))]); err != nil {
+		return err
+	}
+	return errors.New("database unavailable")
+}
+
+// markCounter is batch storage that counts the parts marked recorded
+type markCounter struct {
+	storage.BatchStorage
+	marked int
+}
+
+func (s *markCounter) MarkBatchResultsRecorded(ctx context.Context, provider, id, part string) (bool, error) {
+	s.marked++
+	return s.BatchStorage.MarkBatchResultsRecorded(ctx, provider, id, part)
+}
+
+func TestRecordBatchResults(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewSQLiteStorage(ctx, &storage.SQLiteStorageConfig{Path: filepath.Join(t.TempDir(), "majordomo.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	prices := pricing.NewService("", "", "", time.Hour)
+	defer prices.Close()
+
+	key, err := store.CreateAPIKey(ctx, "hash-1", &models.CreateAPIKeyInput{Name: "batch jobs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := key.ID
+	endedAt := time.Now().Add(-time.Minute)
+	b := &models.Batch{
+		ID: "msgbatch_1", Provider: "anthropic", MajordomoAPIKeyID: keyID, RequestID: uuid.New(),
+		Endpoint: "/v1/messages", Status: "ended", RequestCount: 2, EndedAt: &endedAt,
+	}
+	if err := store.CreateBatch(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"custom_id":"a","result":{"type":"succeeded","message":{"model":"claude-3-5-haiku-20241022","usage":{"input_tokens":12,"output_tokens":7}}}}
+{"custom_id":"b","result":{"type":"succeeded","message":{"model":"claude-3-5-haiku-20241022","usage":{"input_tokens":3,"output_tokens":1}}}}`)
+
+	requests := func() int64 {
+		t.Helper()
+		rollups, err := store.QueryUsage(ctx, &models.UsageQuery{
+			Granularity: "day", From: time.Now().Add(-48 * time.Hour), To: time.Now().Add(24 * time.Hour), MajordomoAPIKeyID: &keyID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		for _, r := range rollups {
+			n += r.RequestCount
+		}
+		return n
+	}
+	recorded := func() bool {
+		t.Helper()
+		got, err := store.GetBatch(ctx, "anthropic", "msgbatch_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.ResultsRecordedAt != nil
+	}
+
+	// A failed write leaves the results to be recorded later
+	batches := &markCounter{BatchStorage: store}
+	h := &Handler{storage: failingLogs{Storage: store}, batches: batches, pricing: prices, config: &config.Config{}}
+	h.recordBatchResults(ctx, b, models.BatchPartResults, body)
+	if batches.marked != 0 || recorded() {
+		t.Fatal("results marked recorded although their logs weren't written")
+	}
+
+	// So does a write that fails partway through
+	h.storage = failingLogs{Storage: store, written: 1}
+	h.recordBatchResults(ctx, b, models.BatchPartResults, body)
+	if batches.marked != 0 || recorded() {
+		t.Fatal("results marked recorded although only some of their logs were written")
+	}
+	if n := requests(); n != 1 {
+		t.Fatalf("logged %d requests before the failure, want 1", n)
+	}
+
+	// Writing the part again stores the rest without counting the first twice
+	h.storage = store
+	h.recordBatchResults(ctx, b, models.BatchPartResults, body)
+	if batches.marked != 1 || !recorded() {
+		t.Fatal("results not marked recorded")
+	}
+	if n := requests(); n != 2 {
+		t.Fatalf("logged %d requests, want 2", n)
+	}
+
+	// Recording the part again, as a second gateway that downloaded it at
+	// the same time would, writes logs with the same IDs, which are dropped
+	h.recordBatchResults(ctx, b, models.BatchPartResults, body)
+	if n := requests(); n != 2 {
+		t.Errorf("logged %d requests after recording twice, want 2", n)
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+var ErrBudgetExceeded = errors.New("team monthly budget exceeded")
+
+type cachedBudget struct {
+	budget    *float64
+	spent     float64
+	expiresAt time.Time
+}
+
+// BudgetChecker rejects requests from teams that have spent their monthly
+// budget. Spend comes from the daily usage rollups and is cached per team,
+// so a team can overshoot by whatever it spends within one cache TTL.
+type BudgetChecker struct {
+	teams    storage.TeamStorage
+	usage    storage.UsageStorage
+	cache    map[uuid.UUID]*cachedBudget
+	cacheMu  sync.Mutex
+	cacheTTL time.Duration
+}
+
+// NewBudgetChecker creates a new BudgetChecker.
+func NewBudgetChecker(teams storage.TeamStorage, usage storage.UsageStorage) *BudgetChecker {
+	return &BudgetChecker{
+		teams:    teams,
+		usage:    usage,
+		cache:    make(map[uuid.UUID]*cachedBudget),
+		cacheTTL: time.Minute,
+	}
+}
+
+// Check returns ErrBudgetExceeded if the team has a budget and its spend for
+// the current UTC calendar month has reached it. Lookup failures are logged
+// and the request is allowed.
+func (b *BudgetChecker) Check(ctx context.Context, teamID uuid.UUID) error {
+	b.cacheMu.Lock()
+	cached, ok := b.cache[teamID]
+	b.cacheMu.Unlock()
+
+	if !ok || time.Now().After(cached.expiresAt) {
+		var err error
+		cached, err = b.load(ctx, teamID)
+		if err != nil {
+			slog.Warn("failed to check team budget", "error", err, "team_id", teamID)
+			return nil
+		}
+		b.cacheMu.Lock()
+		b.cache[teamID] = cached
+		b.cacheMu.Unlock()
+	}
+
+	if cached.budget != nil && cached.spent >= *cached.budget {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+func (b *BudgetChecker) load(ctx context.Context, teamID uuid.UUID) (*cachedBudget, error) {
+	team, err := b.teams.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cachedBudget{budget: team.MonthlyBudget, expiresAt: time.Now().Add(b.cacheTTL)}
+	if team.MonthlyBudget == nil {
+		return entry, nil
+	}
+
+	entry.spent, err = b.usage.TeamCostSince(ctx, teamID, monthStart(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// monthStart returns the start of the UTC calendar month containing t.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
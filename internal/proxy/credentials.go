@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+// credentialSource is where a client put its provider API key
+type credentialSource int
+
+const (
+	// sourceAuthorization is Authorization: Bearer <key>, used by OpenAI clients
+	sourceAuthorization credentialSource = iota
+	// sourceAPIKey is x-api-key, used by Anthropic clients
+	sourceAPIKey
+	// sourceGoogAPIKey is x-goog-api-key, used by Gemini clients
+	sourceGoogAPIKey
+	// sourceQueryKey is the key query parameter, used by Gemini clients
+	sourceQueryKey
+)
+
+// credentialSources lists where a provider's SDKs send the API key, in the
+// order they are checked
+func credentialSources(p provider.Provider) []credentialSource {
+	switch p {
+	case provider.ProviderAnthropic:
+		return []credentialSource{sourceAPIKey, sourceAuthorization}
+	case provider.ProviderGemini:
+		return []credentialSource{sourceGoogAPIKey, sourceQueryKey, sourceAuthorization}
+	default:
+		return []credentialSource{sourceAuthorization}
+	}
+}
+
+// get returns the key the client sent in this place, or ""
+func (s credentialSource) get(r *http.Request) string {
+	switch s {
+	case sourceAuthorization:
+		return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	case sourceAPIKey:
+		return r.Header.Get("X-Api-Key")
+	case sourceGoogAPIKey:
+		return r.Header.Get("X-Goog-Api-Key")
+	case sourceQueryKey:
+		return r.URL.Query().Get("key")
+	}
+	return ""
+}
+
+// clientCredential is an API key sent by the client and where it was found
+type clientCredential struct {
+	Source credentialSource
+	Key    string
+}
+
+// findCredential returns the API key the client sent for provider p, or nil
+// if it sent none
+func findCredential(r *http.Request, p provider.Provider) *clientCredential {
+	for _, source := range credentialSources(p) {
+		if key := source.get(r); key != "" {
+			return &clientCredential{Source: source, Key: key}
+		}
+	}
+	return nil
+}
+
+// isProxyKey reports whether the credential is a proxy key (mdm_pk_ prefix)
+func (c *clientCredential) isProxyKey() bool {
+	return strings.HasPrefix(c.Key, auth.ProxyKeyPrefix)
+}
+
+// replace swaps the credential for key in the upstream request. A key sent
+// in the query string is removed from it and sent as x-goog-api-key instead,
+// so the provider key never appears in a URL.
+func (c *clientCredential) replace(r *http.Request, key string) {
+	switch c.Source {
+	case sourceAuthorization:
+		r.Header.Set("Authorization", "Bearer "+key)
+	case sourceAPIKey:
+		r.Header.Set("X-Api-Key", key)
+	case sourceGoogAPIKey:
+		r.Header.Set("X-Goog-Api-Key", key)
+	case sourceQueryKey:
+		q := r.URL.Query()
+		q.Del("key")
+		r.URL.RawQuery = q.Encode()
+		r.Header.Set("X-Goog-Api-Key", key)
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+func TestReplaceQueryKey(t *testing.T) {
+	const (
+		proxyKey    = "mdm_pk_0123456789abcdef"
+		providerKey = "AIza-provider-key"
+		path        = "/v1beta/models/gemini-2.0-flash:streamGenerateContent"
+	)
+
+	tests := []struct {
+		name      string
+		query     string
+		header    string // x-goog-api-key sent by the client
+		wantQuery url.Values
+	}{
+		{"key only", "key=" + proxyKey, "", url.Values{}},
+		{"key with other params", "alt=sse&key=" + proxyKey + "&pageSize=10", "", url.Values{"alt": {"sse"}, "pageSize": {"10"}}},
+		{"no key", "alt=sse", proxyKey, url.Values{"alt": {"sse"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+			defer srv.Close()
+
+			r := httptest.NewRequest(http.MethodPost, path+"?"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("X-Goog-Api-Key", tt.header)
+			}
+			cred := findCredential(r, provider.ProviderGemini)
+			if cred == nil || cred.Key != proxyKey {
+				t.Fatalf("findCredential = %+v, want the proxy key", cred)
+			}
+			cred.replace(r, providerKey)
+
+			if _, err := NewUpstreamClient().Forward(context.Background(), srv.URL, r, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			forwarded := got.URL.RequestURI()
+			if strings.Contains(forwarded, proxyKey) || strings.Contains(forwarded, providerKey) {
+				t.Errorf("forwarded URL %s contains a key", forwarded)
+			}
+			if got.URL.Path != path {
+				t.Errorf("path = %s, want %s", got.URL.Path, path)
+			}
+			if q := got.URL.Query(); q.Encode() != tt.wantQuery.Encode() {
+				t.Errorf("query = %v, want %v", q, tt.wantQuery)
+			}
+			if key := got.Header.Get("X-Goog-Api-Key"); key != providerKey {
+				t.Errorf("x-goog-api-key = %q, want the provider key", key)
+			}
+		})
+	}
+}
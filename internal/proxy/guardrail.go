@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/guardrail"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// flaggedHeader lists the flag guardrails that triggered on a request
+const flaggedHeader = "X-Majordomo-Guardrails-Flagged"
+
+// runGuardrails checks body against the guardrails for stage, adding the
+// results to checks and the names of flag guardrails that triggered to
+// flagged
+func (h *Handler) runGuardrails(r *http.Request, stage guardrail.Stage, scope guardrail.Scope, body []byte, checks *models.GuardrailResults, flagged *[]string, requestID uuid.UUID) *models.GuardrailResult {
+	if h.guardrails == nil {
+		return nil
+	}
+	out := h.guardrails.Run(r.Context(), stage, scope, body)
+	for _, result := range out.Results {
+		if result.Error != "" {
+			slog.Warn("guardrail check failed", "guardrail", result.Name, "stage", result.Stage, "error", result.Error, "request_id", requestID)
+		}
+	}
+	*checks = append(*checks, out.Results...)
+	*flagged = append(*flagged, out.Flagged...)
+	return out.Blocked
+}
+
+// guardrailResponse is the response returned in place of a request or
+// response a guardrail blocked. The body follows the OpenAI error format,
+// which the providers' SDKs all surface to the caller. It only names the
+// guardrail: the reason can quote the denylist term or pattern that matched,
+// so it is kept for the request log.
+func guardrailResponse(blocked *models.GuardrailResult) *UpstreamResponse {
+	message := "request blocked by guardrail " + blocked.Name
+	if blocked.Stage == string(guardrail.StageOutput) {
+		message = "response blocked by guardrail " + blocked.Name
+	}
+
+	var body struct {
+		Error struct {
+			Message   string `json:"message"`
+			Type      string `json:"type"`
+			Guardrail string `json:"guardrail"`
+		} `json:"error"`
+	}
+	body.Error.Message = message
+	body.Error.Type = "guardrail_blocked"
+	body.Error.Guardrail = blocked.Name
+	data, _ := json.Marshal(body)
+
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	return &UpstreamResponse{StatusCode: http.StatusBadRequest, Headers: headers, Body: data}
+}
+
+// setFlaggedHeader tells the client which flag guardrails triggered
+func setFlaggedHeader(w http.ResponseWriter, flagged []string) {
+	if len(flagged) > 0 {
+		w.Header().Set(flaggedHeader, strings.Join(flagged, ","))
+	}
+}
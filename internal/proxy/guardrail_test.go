@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+func TestGuardrailResponseHidesReason(t *testing.T) {
+	blocked := &models.GuardrailResult{Name: "competitors", Stage: "input", Action: "block", Triggered: true, Reason: `contains "project falcon"`}
+	resp := guardrailResponse(blocked)
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+	if strings.Contains(string(resp.Body), "falcon") {
+		t.Errorf("response %s reveals the matched term", resp.Body)
+	}
+
+	var body struct {
+		Error struct {
+			Message   string `json:"message"`
+			Type      string `json:"type"`
+			Guardrail string `json:"guardrail"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Message != "request blocked by guardrail competitors" || body.Error.Type != "guardrail_blocked" || body.Error.Guardrail != "competitors" {
+		t.Errorf("error = %+v", body.Error)
+	}
+	if blocked.Reason != `contains "project falcon"` {
+		t.Errorf("reason for the request log = %q", blocked.Reason)
+	}
+}
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -10,13 +11,22 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
+	"github.com/superset-studio/majordomo-gateway/internal/batch"
 	"github.com/superset-studio/majordomo-gateway/internal/config"
+	"github.com/superset-studio/majordomo-gateway/internal/guardrail"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
 	"github.com/superset-studio/majordomo-gateway/internal/pricing"
+	"github.com/superset-studio/majordomo-gateway/internal/prompt"
 	"github.com/superset-studio/majordomo-gateway/internal/provider"
+	"github.com/superset-studio/majordomo-gateway/internal/redact"
+	"github.com/superset-studio/majordomo-gateway/internal/routing"
 	"github.com/superset-studio/majordomo-gateway/internal/storage"
+	"github.com/superset-studio/majordomo-gateway/internal/transform"
+	"github.com/superset-studio/majordomo-gateway/internal/upstream"
 )
 
+var errSingleHeaderAuthDisabled = errors.New("proxy key does not allow single-header auth")
+
 type Handler struct {
 	upstream      *UpstreamClient
 	storage       storage.Storage
@@ -24,8 +34,17 @@ type Handler struct {
 	pricing       *pricing.Service
 	resolver      *auth.Resolver
 	proxyResolver *auth.ProxyResolver
+	budgets       *BudgetChecker
+	router        *routing.Router
+	shadows       *routing.Shadows
+	shadowSlots   chan struct{}
+	upstreams     upstream.Pools
+	transforms    *transform.Transformer
+	redactor      *redact.Redactor
+	guardrails    *guardrail.Guardrails
+	prompts       *prompt.Registry
+	batches       storage.BatchStorage
 	config        *config.Config
-	providers     map[provider.Provider]string
 }
 
 // ProviderKeyInfo contains hashed provider API key information
@@ -40,14 +59,17 @@ func NewHandler(
 	pricingSvc *pricing.Service,
 	resolver *auth.Resolver,
 	proxyResolver *auth.ProxyResolver,
+	budgets *BudgetChecker,
+	router *routing.Router,
+	shadows *routing.Shadows,
+	upstreams upstream.Pools,
+	transforms *transform.Transformer,
+	redactor *redact.Redactor,
+	guardrails *guardrail.Guardrails,
+	prompts *prompt.Registry,
+	batches storage.BatchStorage,
 	cfg *config.Config,
 ) *Handler {
-	providers := map[provider.Provider]string{
-		provider.ProviderOpenAI:    cfg.Providers.OpenAI.BaseURL,
-		provider.ProviderAnthropic: cfg.Providers.Anthropic.BaseURL,
-		provider.ProviderGemini:    cfg.Providers.Gemini.BaseURL,
-	}
-
 	return &Handler{
 		upstream:      NewUpstreamClient(),
 		storage:       storage,
@@ -55,8 +77,17 @@ func NewHandler(
 		pricing:       pricingSvc,
 		resolver:      resolver,
 		proxyResolver: proxyResolver,
+		budgets:       budgets,
+		router:        router,
+		shadows:       shadows,
+		shadowSlots:   make(chan struct{}, max(cfg.Routing.Shadow.MaxConcurrent, 1)),
+		upstreams:     upstreams,
+		transforms:    transforms,
+		redactor:      redactor,
+		guardrails:    guardrails,
+		prompts:       prompts,
+		batches:       batches,
 		config:        cfg,
-		providers:     providers,
 	}
 }
 
@@ -65,17 +96,47 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestedAt := time.Now()
 	requestID := uuid.New()
 
-	// Validate Majordomo API key
+	headers := extractHeaders(r.Header)
+	providerInfo := provider.Detect(r.URL.Path, headers)
+
+	// The provider API key, or a proxy key standing in for it, is wherever
+	// the provider's SDKs put it
+	cred := findCredential(r, providerInfo.Provider)
+	var proxyCred *clientCredential
+	if cred != nil && cred.isProxyKey() {
+		proxyCred = cred
+	}
+
+	// Validate Majordomo API key. Without X-Majordomo-Key, a proxy key with
+	// single-header auth stands in for the Majordomo key that owns it.
 	apiKey := r.Header.Get("X-Majordomo-Key")
-	apiKeyInfo, err := h.resolver.ResolveAPIKey(ctx, apiKey)
+	var apiKeyInfo *models.APIKeyInfo
+	var err error
+	if apiKey == "" && proxyCred != nil && h.proxyResolver != nil {
+		apiKeyInfo, err = h.resolveProxyKeyOwner(ctx, proxyCred.Key)
+	} else {
+		apiKeyInfo, err = h.resolver.ResolveAPIKey(ctx, apiKey)
+	}
 	if err != nil {
 		slog.Debug("API key validation failed", "error", err)
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !apiKeyInfo.Scopes.Has(models.ScopeProxy) {
+		http.Error(w, "API key lacks the proxy scope", http.StatusForbidden)
+		return
+	}
+
+	// Enforce the owning team's monthly budget
+	if h.budgets != nil && apiKeyInfo.TeamID != nil {
+		if err := h.budgets.Check(ctx, *apiKeyInfo.TeamID); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
 
 	// Extract provider API key info (for tracking, not validation)
-	providerKeyInfo := extractProviderKeyInfo(r)
+	providerKeyInfo := extractProviderKeyInfo(r, cred)
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -83,29 +144,202 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	headers := extractHeaders(r.Header)
-	providerInfo := provider.Detect(r.URL.Path, headers)
+	// Render the prompt template the request references. Everything after
+	// this, from routing to guardrails, sees the rendered request.
+	var changes transformed
+	if ref := r.Header.Get(prompt.Header); ref != "" && h.prompts != nil {
+		rendered, tmpl, ok := h.renderPrompt(ctx, w, ref, providerInfo, body, requestID)
+		if !ok {
+			return
+		}
+		changes.prompt = tmpl
+		changes.clientRequest = body
+		body = rendered
+	}
+
+	// Replace a virtual model name with the model its route targets. This
+	// may change the provider, so it happens before proxy key resolution.
+	var requestedModel *string
+	var target *routing.Target
+	var match routing.Match
+	if h.router != nil || h.shadows != nil {
+		match = h.routeMatch(ctx, providerInfo, apiKeyInfo, proxyCred, headers)
+	}
+	if h.router != nil {
+		if model := routing.RequestedModel(body); model != "" && h.router.HasRoutes(model) {
+			target = h.router.Resolve(model, match)
+			if target != nil {
+				rewritten, err := routing.RewriteModel(body, target.Model)
+				if err != nil {
+					http.Error(w, "invalid request body", http.StatusBadRequest)
+					return
+				}
+				body = rewritten
+				requestedModel = &model
+				if target.Provider != "" {
+					providerInfo = provider.ForName(target.Provider)
+				}
+			}
+		}
+	}
+
+	// Apply request transforms. Shadow requests mirror the transformed
+	// request.
+	scope := transform.Scope{APIKeyID: apiKeyInfo.ID, Model: routing.RequestedModel(body), Path: r.URL.Path}
+	scope.RequestedModel = scope.Model
+	if requestedModel != nil {
+		scope.RequestedModel = *requestedModel
+	}
+	body = h.transformRequest(scope, body, &changes, requestID)
 
-	// Check if Authorization header contains a proxy key
+	// In upstream mode, personal data and secrets never leave the gateway
+	if h.redactor != nil && h.redactor.Mode() == redact.ModeUpstream {
+		body, changes.redactions = h.redactor.Redact(body)
+	}
+
+	// Pick the shadow rules to mirror this request to. The request is copied
+	// now, before it is changed for the primary upstream.
+	var shadows []routing.ShadowRule
+	var shadowReq *http.Request
+	var shadowModel string
+	if h.shadows != nil {
+		if model := routing.RequestedModel(body); model != "" {
+			shadowModel = model
+			if requestedModel != nil {
+				shadowModel = *requestedModel
+			}
+			match.Provider = providerInfo.Provider
+			shadows = h.shadows.Pick(shadowModel, model, match)
+		}
+		if len(shadows) > 0 {
+			shadowReq = r.Clone(context.WithoutCancel(ctx))
+		}
+	}
+
+	// Replace a proxy key with the provider key it maps to
 	var proxyKeyID *uuid.UUID
-	if h.proxyResolver != nil {
-		authHeader := r.Header.Get("Authorization")
-		authKey := strings.TrimPrefix(authHeader, "Bearer ")
-		providerKey, pkID, proxyErr := h.proxyResolver.ResolveProxyKey(ctx, authKey, string(providerInfo.Provider), apiKeyInfo.ID)
+	if h.proxyResolver != nil && proxyCred != nil {
+		providerKey, pkID, proxyErr := h.proxyResolver.ResolveProxyKey(ctx, proxyCred.Key, string(providerInfo.Provider), apiKeyInfo.ID)
 		if proxyErr != nil {
 			slog.Debug("proxy key validation failed", "error", proxyErr)
 			http.Error(w, proxyErr.Error(), http.StatusUnauthorized)
 			return
 		}
-		if providerKey != "" {
-			r.Header.Set("Authorization", "Bearer "+providerKey)
-			proxyKeyID = pkID
+		proxyCred.replace(r, providerKey)
+		proxyKeyID = pkID
+	}
+
+	// Check the request against the input guardrails. A blocked request is
+	// never sent upstream or mirrored.
+	var checks models.GuardrailResults
+	var flagged []string
+	checkScope := guardrail.Scope{APIKeyID: apiKeyInfo.ID, ProxyKeyID: proxyKeyID, Model: routing.RequestedModel(body), Path: r.URL.Path}
+	if blocked := h.runGuardrails(r, guardrail.StageInput, checkScope, body, &checks, &flagged, requestID); blocked != nil {
+		resp := guardrailResponse(blocked)
+		copyResponseHeaders(resp.Headers, w.Header())
+		setFlaggedHeader(w, flagged)
+		w.WriteHeader(resp.StatusCode)
+		w.Write(resp.Body)
+		go h.logRequest(ctx, requestID, apiKeyInfo, providerKeyInfo, proxyKeyID, providerInfo, requestedModel, target, nil, changes.orNil(), checks, r, body, resp, requestedAt, time.Now(), headers)
+		return
+	}
+
+	resp, err := h.forward(ctx, providerInfo, r, body, requestID)
+	if err != nil {
+		slog.Error("upstream request failed", "error", err, "request_id", requestID)
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+		return
+	}
+
+	respondedAt := time.Now()
+
+	// Check a successful response against the output guardrails. A blocked
+	// response is replaced for the client but logged as the provider sent
+	// it, so its usage is still counted.
+	clientResp := resp
+	if resp.StatusCode < 400 {
+		if blocked := h.runGuardrails(r, guardrail.StageOutput, checkScope, resp.Body, &checks, &flagged, requestID); blocked != nil {
+			clientResp = guardrailResponse(blocked)
+			changes.clientResponse = clientResp.Body
+		}
+	}
+
+	// Copy response headers, filtering out hop-by-hop and Content-Encoding
+	copyResponseHeaders(clientResp.Headers, w.Header())
+	setFlaggedHeader(w, flagged)
+
+	// Check if we should compress the response for the client
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	contentType := clientResp.Headers.Get("Content-Type")
+	responseBody := clientResp.Body
+	if clientResp == resp {
+		responseBody = h.transformResponse(scope, contentType, resp.Body, &changes, requestID)
+	}
+
+	if ShouldCompress(acceptEncoding, contentType, len(responseBody)) {
+		compressed, err := GzipCompress(responseBody)
+		if err != nil {
+			slog.Warn("failed to compress response, sending uncompressed", "error", err, "request_id", requestID)
+		} else {
+			responseBody = compressed
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Vary", "Accept-Encoding")
 		}
 	}
 
-	baseURL := h.providers[providerInfo.Provider]
-	if baseURL == "" {
-		baseURL = providerInfo.BaseURL
+	w.WriteHeader(clientResp.StatusCode)
+	w.Write(responseBody)
+
+	go h.logRequest(ctx, requestID, apiKeyInfo, providerKeyInfo, proxyKeyID, providerInfo, requestedModel, target, nil, changes.orNil(), checks, r, body, resp, requestedAt, respondedAt, headers)
+
+	for _, rule := range shadows {
+		h.startShadow(&shadowRequest{
+			rule:            rule,
+			primaryID:       requestID,
+			req:             shadowReq.Clone(shadowReq.Context()),
+			body:            body,
+			providerInfo:    providerInfo,
+			apiKeyInfo:      apiKeyInfo,
+			providerKeyInfo: providerKeyInfo,
+			proxyCred:       proxyCred,
+			requestedModel:  shadowModel,
+			headers:         headers,
+		})
+	}
+}
+
+// UpstreamStatus returns the health of each provider's endpoints
+func (h *Handler) UpstreamStatus() map[string][]upstream.EndpointStatus {
+	return h.upstreams.Status()
+}
+
+// sharedPools maps the providers served by another provider's endpoints to
+// that provider and the path their base URL adds to its endpoints
+var sharedPools = map[provider.Provider]struct {
+	provider provider.Provider
+	prefix   string
+}{
+	provider.ProviderAnthropicOpenAI: {provider.ProviderAnthropic, ""},
+	provider.ProviderGeminiOpenAI:    {provider.ProviderGemini, "/v1beta/openai"},
+}
+
+// forward sends a request to providerInfo's upstream, translating the
+// request and response when the provider needs it. r's path and headers are
+// changed to those sent upstream. Providers with configured base URLs get the
+// endpoint their pool picks, and the outcome counts towards its health.
+// Anthropic's and Gemini's OpenAI-compatible APIs use the pool of the
+// provider behind them.
+func (h *Handler) forward(ctx context.Context, providerInfo provider.ProviderInfo, r *http.Request, body []byte, requestID uuid.UUID) (*UpstreamResponse, error) {
+	baseURL := providerInfo.BaseURL
+	poolName, prefix := providerInfo.Provider, ""
+	if shared, ok := sharedPools[poolName]; ok {
+		poolName, prefix = shared.provider, shared.prefix
+	}
+	pool := h.upstreams[string(poolName)]
+	var endpoint *upstream.Endpoint
+	if pool != nil {
+		endpoint = pool.Pick()
+		baseURL = endpoint.URL + prefix
 	}
 
 	// Translate request if needed (e.g., OpenAI format → Anthropic format)
@@ -128,11 +362,17 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	start := time.Now()
 	resp, err := h.upstream.Forward(ctx, baseURL, r, upstreamBody)
+	if endpoint != nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		pool.Done(endpoint, time.Since(start), statusCode, err)
+	}
 	if err != nil {
-		slog.Error("upstream request failed", "error", err, "request_id", requestID)
-		http.Error(w, "upstream request failed", http.StatusBadGateway)
-		return
+		return nil, err
 	}
 
 	// Translate response back if needed (e.g., Anthropic format → OpenAI format)
@@ -145,31 +385,38 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	respondedAt := time.Now()
-
-	// Copy response headers, filtering out hop-by-hop and Content-Encoding
-	copyResponseHeaders(resp.Headers, w.Header())
-
-	// Check if we should compress the response for the client
-	acceptEncoding := r.Header.Get("Accept-Encoding")
-	contentType := resp.Headers.Get("Content-Type")
-	responseBody := resp.Body
+	return resp, nil
+}
 
-	if ShouldCompress(acceptEncoding, contentType, len(resp.Body)) {
-		compressed, err := GzipCompress(resp.Body)
-		if err != nil {
-			slog.Warn("failed to compress response, sending uncompressed", "error", err, "request_id", requestID)
-		} else {
-			responseBody = compressed
-			w.Header().Set("Content-Encoding", "gzip")
-			w.Header().Set("Vary", "Accept-Encoding")
+// routeMatch describes the request for model routing and shadow rules. A
+// proxy key that fails to resolve is left out; proxy key resolution rejects
+// the request later.
+func (h *Handler) routeMatch(ctx context.Context, providerInfo provider.ProviderInfo, apiKeyInfo *models.APIKeyInfo, proxyCred *clientCredential, headers map[string]string) routing.Match {
+	match := routing.Match{
+		Provider: providerInfo.Provider,
+		APIKeyID: apiKeyInfo.ID,
+		Metadata: extractCustomMetadata(headers),
+	}
+	if h.proxyResolver != nil && proxyCred != nil {
+		if pk, err := h.proxyResolver.LookupProxyKey(ctx, proxyCred.Key); err == nil && pk != nil {
+			match.ProxyKeyID = &pk.ID
+			match.Providers = pk.Providers
 		}
 	}
+	return match
+}
 
-	w.WriteHeader(resp.StatusCode)
-	w.Write(responseBody)
-
-	go h.logRequest(ctx, requestID, apiKeyInfo, providerKeyInfo, proxyKeyID, providerInfo, r, body, resp, requestedAt, respondedAt, headers)
+// resolveProxyKeyOwner authenticates a request that carries a proxy key but
+// no X-Majordomo-Key, as the Majordomo API key that owns the proxy key
+func (h *Handler) resolveProxyKeyOwner(ctx context.Context, proxyKey string) (*models.APIKeyInfo, error) {
+	pk, err := h.proxyResolver.LookupProxyKey(ctx, proxyKey)
+	if err != nil {
+		return nil, err
+	}
+	if !pk.SingleHeaderAuth {
+		return nil, errSingleHeaderAuthDisabled
+	}
+	return h.resolver.ResolveAPIKeyByID(ctx, pk.MajordomoAPIKeyID)
 }
 
 func (h *Handler) logRequest(
@@ -179,6 +426,11 @@ func (h *Handler) logRequest(
 	providerKeyInfo *ProviderKeyInfo,
 	proxyKeyID *uuid.UUID,
 	providerInfo provider.ProviderInfo,
+	requestedModel *string,
+	target *routing.Target,
+	shadow *shadowRequest,
+	changes *transformed,
+	checks models.GuardrailResults,
 	req *http.Request,
 	reqBody []byte,
 	resp *UpstreamResponse,
@@ -186,9 +438,19 @@ func (h *Handler) logRequest(
 	customHeaders map[string]string,
 ) {
 	parser := provider.GetParser(providerInfo.Provider)
-	metrics, err := parser.ParseResponse(resp.Body)
-	if err != nil {
-		slog.Warn("failed to parse response", "error", err, "request_id", requestID)
+
+	// Batch API calls use no tokens themselves; the requests in a batch are
+	// logged when its results are
+	call := h.batchCall(providerInfo, req)
+	var metrics *models.UsageMetrics
+	var err error
+	if call.Op == batch.OpNone {
+		metrics, err = parser.ParseResponse(resp.Body)
+	}
+	if call.Op != batch.OpNone || err != nil {
+		if err != nil {
+			slog.Warn("failed to parse response", "error", err, "request_id", requestID)
+		}
 		metrics = &models.UsageMetrics{
 			Provider: string(providerInfo.Provider),
 			Model:    parser.ExtractModel(reqBody),
@@ -206,7 +468,8 @@ func (h *Handler) logRequest(
 
 	var errMsg *string
 	if resp.StatusCode >= 400 {
-		msg := string(resp.Body)
+		body, _ := h.redact(resp.Body)
+		msg := string(body)
 		if len(msg) > 500 {
 			msg = msg[:500]
 		}
@@ -222,6 +485,10 @@ func (h *Handler) logRequest(
 		// User who owns the API key
 		UserID: apiKeyInfo.UserID,
 
+		// Team and organization that own the API key
+		TeamID: apiKeyInfo.TeamID,
+		OrgID:  apiKeyInfo.OrgID,
+
 		// Proxy key (if request used one)
 		ProxyKeyID: proxyKeyID,
 
@@ -229,10 +496,11 @@ func (h *Handler) logRequest(
 		ProviderAPIKeyHash:  providerKeyInfo.Hash,
 		ProviderAPIKeyAlias: providerKeyInfo.Alias,
 
-		Provider:      metrics.Provider,
-		Model:         metrics.Model,
-		RequestPath:   req.URL.Path,
-		RequestMethod: req.Method,
+		Provider:       metrics.Provider,
+		Model:          metrics.Model,
+		RequestedModel: requestedModel,
+		RequestPath:    req.URL.Path,
+		RequestMethod:  req.Method,
 
 		RequestedAt:    requestedAt,
 		RespondedAt:    respondedAt,
@@ -254,13 +522,46 @@ func (h *Handler) logRequest(
 		ModelAliasFound: cost.ModelAliasFound,
 	}
 
+	if target != nil && target.Experiment != nil {
+		log.ExperimentID = &target.Experiment.ID
+		log.ExperimentArm = &target.Arm
+	}
+	if shadow != nil {
+		log.ShadowOf = &shadow.primaryID
+		log.ShadowRule = &shadow.rule.Name
+	}
+	if changes != nil {
+		if len(changes.rules) > 0 {
+			rules := strings.Join(changes.rules, ",")
+			log.Transforms = &rules
+		}
+		log.Redactions = changes.redactions
+		if changes.prompt != nil {
+			log.PromptName = &changes.prompt.Name
+			log.PromptVersion = &changes.prompt.Version
+		}
+	}
+	if len(checks) > 0 {
+		log.Guardrails = checks
+		if action := guardrail.Severest(checks); action != "" {
+			log.GuardrailAction = &action
+		}
+	}
+	if call.Op != batch.OpNone && resp.StatusCode < 400 {
+		log.BatchID = h.trackBatch(context.WithoutCancel(ctx), call, log, resp.Body)
+	}
+
 	switch h.config.Logging.BodyStorage {
 	case "s3":
 		if h.s3Storage != nil {
 			s3Key := h.s3Storage.GenerateKey(apiKeyInfo.ID.String(), requestID, requestedAt)
 			log.BodyS3Key = &s3Key
 
-			h.s3Storage.Upload(&storage.BodyUpload{
+			reqBody, reqRedactions := h.redact(reqBody)
+			respBody, respRedactions := h.redact(resp.Body)
+			log.Redactions += reqRedactions + respRedactions
+
+			upload := &storage.BodyUpload{
 				Key:             s3Key,
 				RequestID:       requestID,
 				Timestamp:       requestedAt,
@@ -270,31 +571,57 @@ func (h *Handler) logRequest(
 				RequestBody:     reqBody,
 				ResponseStatus:  resp.StatusCode,
 				ResponseHeaders: storage.ExtractResponseHeaders(resp.Headers),
-				ResponseBody:    resp.Body,
-			})
+				ResponseBody:    respBody,
+			}
+			if changes != nil {
+				upload.ClientRequestBody, _ = h.redact(changes.clientRequest)
+				upload.ClientResponseBody, _ = h.redact(changes.clientResponse)
+			}
+			h.s3Storage.Upload(upload)
 		}
 	case "postgres":
 		if h.config.Logging.StoreRequestBody {
-			body := truncateBody(string(reqBody), h.config.Logging.MaxBodySize)
+			redacted, n := h.redact(reqBody)
+			log.Redactions += n
+			body := truncateBody(string(redacted), h.config.Logging.MaxBodySize)
 			log.RequestBody = &body
+			if changes != nil && changes.clientRequest != nil {
+				redacted, _ := h.redact(changes.clientRequest)
+				body := truncateBody(string(redacted), h.config.Logging.MaxBodySize)
+				log.ClientRequestBody = &body
+			}
 		}
 		if h.config.Logging.StoreResponseBody {
-			body := truncateBody(string(resp.Body), h.config.Logging.MaxBodySize)
+			redacted, n := h.redact(resp.Body)
+			log.Redactions += n
+			body := truncateBody(string(redacted), h.config.Logging.MaxBodySize)
 			log.ResponseBody = &body
+			if changes != nil && changes.clientResponse != nil {
+				redacted, _ := h.redact(changes.clientResponse)
+				body := truncateBody(string(redacted), h.config.Logging.MaxBodySize)
+				log.ClientResponseBody = &body
+			}
 		}
 	}
 
 	h.storage.WriteRequestLog(ctx, log)
 }
 
-// extractProviderKeyInfo extracts and hashes the provider API key from the Authorization header
-func extractProviderKeyInfo(r *http.Request) *ProviderKeyInfo {
+// redact replaces personal data and secrets in a body that is about to be
+// stored and returns the number of values replaced
+func (h *Handler) redact(body []byte) ([]byte, int) {
+	if h.redactor == nil {
+		return body, 0
+	}
+	return h.redactor.Redact(body)
+}
+
+// extractProviderKeyInfo hashes the API key the client sent to the provider
+func extractProviderKeyInfo(r *http.Request, cred *clientCredential) *ProviderKeyInfo {
 	info := &ProviderKeyInfo{}
 
-	// Hash the Authorization header if present
-	authHeader := r.Header.Get("Authorization")
-	if authHeader != "" {
-		hash := auth.HashAPIKey(authHeader)
+	if cred != nil {
+		hash := auth.HashAPIKey(cred.Key)
 		info.Hash = &hash
 	}
 
@@ -321,7 +648,7 @@ func extractCustomMetadata(headers map[string]string) map[string]string {
 	metadata := make(map[string]string)
 	for key, value := range headers {
 		// Exclude reserved headers
-		if key != "x-majordomo-key" && key != "x-majordomo-provider" && key != "x-majordomo-provider-alias" {
+		if key != "x-majordomo-key" && key != "x-majordomo-provider" && key != "x-majordomo-provider-alias" && key != "x-majordomo-prompt" {
 			cleanKey := strings.TrimPrefix(key, "x-majordomo-")
 			metadata[cleanKey] = value
 		}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+	"github.com/superset-studio/majordomo-gateway/internal/upstream"
+)
+
+func TestForwardUsesUpstreamProviderPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider provider.Provider
+		pool     provider.Provider
+		path     string
+		wantPath string
+	}{
+		{"openai", provider.ProviderOpenAI, provider.ProviderOpenAI, "/v1/chat/completions", "/v1/chat/completions"},
+		{"anthropic-openai", provider.ProviderAnthropicOpenAI, provider.ProviderAnthropic, "/v1/chat/completions", "/v1/messages"},
+		{"gemini-openai", provider.ProviderGeminiOpenAI, provider.ProviderGemini, "/chat/completions", "/v1beta/openai/chat/completions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.WriteHeader(http.StatusBadRequest)
+			}))
+			defer srv.Close()
+
+			pool := upstream.NewPool([]string{srv.URL}, upstream.Config{Window: 10})
+			h := &Handler{upstream: NewUpstreamClient(), upstreams: upstream.Pools{string(tt.pool): pool}}
+
+			body := []byte(`{"model":"m","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`)
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if _, err := h.forward(context.Background(), provider.ForName(string(tt.provider)), r, body, uuid.New()); err != nil {
+				t.Fatal(err)
+			}
+
+			if gotPath != tt.wantPath {
+				t.Errorf("upstream path = %q, want %q", gotPath, tt.wantPath)
+			}
+			if status := pool.Status(); status[0].Requests != 1 {
+				t.Errorf("%s pool recorded %d requests, want 1", tt.pool, status[0].Requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/prompt"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// renderPrompt renders the prompt template named by ref into body. It
+// returns the rendered body and the template, or writes an error response
+// and returns false.
+func (h *Handler) renderPrompt(ctx context.Context, w http.ResponseWriter, ref string, providerInfo provider.ProviderInfo, body []byte, requestID uuid.UUID) ([]byte, *models.PromptTemplate, bool) {
+	format := prompt.FormatMessages
+	switch providerInfo.Provider {
+	case provider.ProviderAnthropic:
+		format = prompt.FormatAnthropic
+	case provider.ProviderGemini, provider.ProviderBedrock:
+		http.Error(w, "prompt templates are not supported for "+string(providerInfo.Provider)+" requests", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	name, version, err := prompt.ParseReference(ref)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	tmpl, err := h.prompts.Get(ctx, name, version)
+	if err != nil {
+		if errors.Is(err, storage.ErrPromptNotFound) {
+			http.Error(w, "prompt template not found: "+ref, http.StatusBadRequest)
+			return nil, nil, false
+		}
+		slog.Error("failed to get prompt template", "error", err, "prompt", ref, "request_id", requestID)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	rendered, err := prompt.Apply(body, tmpl, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return rendered, tmpl, true
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+	"github.com/superset-studio/majordomo-gateway/internal/routing"
+)
+
+// shadowRequest is a copy of a primary request, to be mirrored to the target
+// of a shadow rule
+type shadowRequest struct {
+	rule      routing.ShadowRule
+	primaryID uuid.UUID
+
+	// req and body are the request as it was after routing and request
+	// transforms, before the proxy
+	// key was replaced or the request translated for the primary upstream
+	req          *http.Request
+	body         []byte
+	providerInfo provider.ProviderInfo
+
+	apiKeyInfo      *models.APIKeyInfo
+	providerKeyInfo *ProviderKeyInfo
+	proxyCred       *clientCredential
+	requestedModel  string // Model the client asked for
+	headers         map[string]string
+}
+
+// startShadow sends a shadow request in the background. Callers never wait
+// for shadow requests: when routing.shadow.max_concurrent are already in
+// flight, the request is dropped.
+func (h *Handler) startShadow(s *shadowRequest) {
+	select {
+	case h.shadowSlots <- struct{}{}:
+	default:
+		slog.Warn("too many shadow requests in flight, dropping one", "rule", s.rule.Name, "primary_request_id", s.primaryID)
+		return
+	}
+
+	go func() {
+		defer func() { <-h.shadowSlots }()
+		h.sendShadow(s)
+	}()
+}
+
+// sendShadow sends s to its rule's target and logs the response as a shadow
+// of the primary request
+func (h *Handler) sendShadow(s *shadowRequest) {
+	ctx := s.req.Context()
+	requestID := uuid.New()
+	requestedAt := time.Now()
+
+	body, err := routing.RewriteModel(s.body, s.rule.TargetModel)
+	if err != nil {
+		slog.Warn("failed to rewrite shadow request", "error", err, "rule", s.rule.Name, "primary_request_id", s.primaryID)
+		return
+	}
+
+	providerInfo := s.providerInfo
+	if s.rule.TargetProvider != "" {
+		providerInfo = provider.ForName(s.rule.TargetProvider)
+	}
+
+	// A proxy key is resolved against the shadow target's provider, which
+	// may differ from the primary's
+	var proxyKeyID *uuid.UUID
+	if h.proxyResolver != nil && s.proxyCred != nil {
+		providerKey, pkID, err := h.proxyResolver.ResolveProxyKey(ctx, s.proxyCred.Key, string(providerInfo.Provider), s.apiKeyInfo.ID)
+		if err != nil {
+			slog.Warn("skipping shadow request, proxy key did not resolve", "error", err, "rule", s.rule.Name, "primary_request_id", s.primaryID)
+			return
+		}
+		s.proxyCred.replace(s.req, providerKey)
+		proxyKeyID = pkID
+	}
+
+	resp, err := h.forward(ctx, providerInfo, s.req, body, requestID)
+	if err != nil {
+		slog.Warn("shadow request failed", "error", err, "rule", s.rule.Name, "request_id", requestID, "primary_request_id", s.primaryID)
+		return
+	}
+
+	h.logRequest(ctx, requestID, s.apiKeyInfo, s.providerKeyInfo, proxyKeyID, providerInfo, &s.requestedModel, nil, s, nil, nil, s.req, body, resp, requestedAt, time.Now(), s.headers)
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/transform"
+)
+
+// transformed records how the gateway changed a request, for logging
+type transformed struct {
+	rules []string
+
+	// The prompt template the request was rendered from
+	prompt *models.PromptTemplate
+
+	// Values redacted from the request before it was sent upstream
+	redactions int
+
+	// The request as the client sent it and the response as the client
+	// received it, set only when a prompt template, transforms or a
+	// guardrail changed them
+	clientRequest  []byte
+	clientResponse []byte
+}
+
+// orNil returns t if the gateway changed the request or response, for
+// logRequest
+func (t *transformed) orNil() *transformed {
+	if len(t.rules) > 0 || t.redactions > 0 || t.prompt != nil || t.clientResponse != nil {
+		return t
+	}
+	return nil
+}
+
+// transformRequest applies the request transforms matching scope to body
+// and records what changed in t
+func (h *Handler) transformRequest(scope transform.Scope, body []byte, t *transformed, requestID uuid.UUID) []byte {
+	if h.transforms == nil {
+		return body
+	}
+	result := h.transforms.Request(scope, body)
+	logTransformFailures(result, requestID)
+	if len(result.Applied) > 0 {
+		t.rules = append(t.rules, result.Applied...)
+		if t.clientRequest == nil {
+			t.clientRequest = body
+		}
+	}
+	return result.Body
+}
+
+// transformResponse applies the response transforms matching scope to a
+// response body. Only JSON responses are transformed; streamed responses
+// are returned as the provider sent them.
+func (h *Handler) transformResponse(scope transform.Scope, contentType string, body []byte, t *transformed, requestID uuid.UUID) []byte {
+	if h.transforms == nil || !h.transforms.HasResponseRules() || !strings.Contains(contentType, "json") {
+		return body
+	}
+	result := h.transforms.Response(scope, body)
+	logTransformFailures(result, requestID)
+	if len(result.Applied) > 0 {
+		t.rules = append(t.rules, result.Applied...)
+		t.clientResponse = result.Body
+	}
+	return result.Body
+}
+
+// logTransformFailures warns about rules that matched but couldn't be
+// applied. The body is passed on without them rather than failing the
+// request.
+func logTransformFailures(result transform.Result, requestID uuid.UUID) {
+	for _, f := range result.Failures {
+		slog.Warn("transform failed, skipping it", "transform", f.Rule, "error", f.Err, "request_id", requestID)
+	}
+}
@@ -0,0 +1,265 @@
+// Package redact finds personal data and secrets in request and response
+// bodies and replaces them with placeholders.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mode decides which copies of a request are redacted
+type Mode string
+
+const (
+	// ModeLogs redacts bodies before they are stored; the provider gets the
+	// request as sent
+	ModeLogs Mode = "logs"
+	// ModeUpstream also redacts the request before it is sent to the provider
+	ModeUpstream Mode = "upstream"
+)
+
+// ParseMode returns the mode named s
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeLogs, ModeUpstream:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("unknown redaction mode %q: must be logs or upstream", s)
+}
+
+// detector finds one kind of sensitive value. valid, if set, rejects matches
+// that fit the pattern but fail a checksum or range check.
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+// builtins are the detectors that can be enabled by name, in the order they
+// run. Secrets run first so that digits inside them aren't taken for phone
+// or card numbers.
+var builtins = []detector{
+	{
+		name:    "api_key",
+		pattern: regexp.MustCompile(`\b(?:sk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}|mdm_(?:sk|pk|rt)_[A-Za-z0-9_-]{16,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abposr]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})`),
+	},
+	{
+		name:    "email",
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	{
+		name:    "credit_card",
+		pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid:   luhn,
+	},
+	{
+		name:    "ssn",
+		pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		valid:   validSSN,
+	},
+	{
+		// North American numbers written with separators, and international
+		// numbers with a leading +. Bare runs of digits are left alone, as
+		// they are more often IDs and timestamps than phone numbers.
+		name:    "phone",
+		pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\) ?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b|\+[1-9]\d{0,2}(?:[ .-]?\d{2,5}){2,4}\b`),
+	},
+}
+
+// Detectors returns the names of the built-in detectors
+func Detectors() []string {
+	names := make([]string, len(builtins))
+	for i, d := range builtins {
+		names[i] = d.name
+	}
+	return names
+}
+
+// Pattern is a custom detector
+type Pattern struct {
+	Name    string
+	Pattern string // RE2 regular expression
+}
+
+// Redactor replaces sensitive values in bodies. It is safe for concurrent
+// use.
+type Redactor struct {
+	mode      Mode
+	detectors []detector
+}
+
+// NewRedactor creates a Redactor using the named built-in detectors followed
+// by the custom patterns
+func NewRedactor(mode Mode, detectors []string, patterns []Pattern) (*Redactor, error) {
+	r := &Redactor{mode: mode}
+	for _, name := range detectors {
+		i := indexOf(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown detector %q: must be one of %s", name, strings.Join(Detectors(), ", "))
+		}
+		r.detectors = append(r.detectors, builtins[i])
+	}
+	for _, p := range patterns {
+		if p.Name == "" {
+			return nil, fmt.Errorf("custom pattern %q: name is required", p.Pattern)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("custom pattern %s: %w", p.Name, err)
+		}
+		r.detectors = append(r.detectors, detector{name: p.Name, pattern: re})
+	}
+	return r, nil
+}
+
+func indexOf(name string) int {
+	for i, d := range builtins {
+		if d.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Mode returns the redactor's mode
+func (r *Redactor) Mode() Mode {
+	return r.mode
+}
+
+// Redact returns body with sensitive values replaced by [REDACTED:<name>]
+// and the number of values replaced. JSON bodies and server-sent event
+// streams of JSON only have their string values redacted; other bodies are
+// redacted as text. A body with nothing to redact is returned as is.
+func (r *Redactor) Redact(body []byte) ([]byte, int) {
+	if len(body) == 0 || len(r.detectors) == 0 {
+		return body, 0
+	}
+	if json.Valid(body) {
+		return r.redactJSON(body)
+	}
+
+	lines := bytes.Split(body, []byte("\n"))
+	total := 0
+	for i, line := range lines {
+		if data, ok := bytes.CutPrefix(line, []byte("data: ")); ok && json.Valid(data) {
+			redacted, n := r.redactJSON(data)
+			if n > 0 {
+				lines[i] = append([]byte("data: "), redacted...)
+				total += n
+			}
+			continue
+		}
+		redacted, n := r.RedactString(string(line))
+		if n > 0 {
+			lines[i] = []byte(redacted)
+			total += n
+		}
+	}
+	if total == 0 {
+		return body, 0
+	}
+	return bytes.Join(lines, []byte("\n")), total
+}
+
+// RedactString returns s with sensitive values replaced and the number of
+// values replaced
+func (r *Redactor) RedactString(s string) (string, int) {
+	count := 0
+	for _, d := range r.detectors {
+		s = d.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			count++
+			return "[REDACTED:" + d.name + "]"
+		})
+	}
+	return s, count
+}
+
+func (r *Redactor) redactJSON(data []byte) ([]byte, int) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return data, 0
+	}
+
+	doc, count := r.redactValue(doc)
+	if count == 0 {
+		return data, 0
+	}
+
+	// Leave <, > and & in prompts as they were sent
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return data, 0
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), count
+}
+
+// redactValue redacts the string values in v. Object keys are left alone.
+func (r *Redactor) redactValue(v any) (any, int) {
+	switch v := v.(type) {
+	case string:
+		return r.RedactString(v)
+	case map[string]any:
+		total := 0
+		for k, item := range v {
+			redacted, n := r.redactValue(item)
+			if n > 0 {
+				v[k] = redacted
+				total += n
+			}
+		}
+		return v, total
+	case []any:
+		total := 0
+		for i, item := range v {
+			redacted, n := r.redactValue(item)
+			if n > 0 {
+				v[i] = redacted
+				total += n
+			}
+		}
+		return v, total
+	}
+	return v, 0
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum used by card
+// numbers
+func luhn(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validSSN rejects numbers the Social Security Administration never issues
+func validSSN(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
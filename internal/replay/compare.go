@@ -0,0 +1,101 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/superset-studio/majordomo-gateway/internal/guardrail"
+)
+
+// How a replayed output compares with the original
+const (
+	MatchExact      = "exact"
+	MatchNormalized = "normalized" // Equal once normalized
+	MatchDifferent  = "different"
+)
+
+// maxDiffLines bounds the outputs Diff compares line by line
+const maxDiffLines = 2000
+
+// OutputText returns the completion text of a response body: the message
+// content, text parts and tool call arguments, in order
+func OutputText(body []byte) string {
+	return strings.Join(guardrail.ExtractText(body), "\n")
+}
+
+// Normalize returns s in a form that ignores differences that rarely
+// matter. JSON is re-encoded with sorted keys and no whitespace; other text
+// is lowercased, with runs of whitespace collapsed to one space.
+func Normalize(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var v any
+		if json.Unmarshal([]byte(trimmed), &v) == nil {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if enc.Encode(v) == nil {
+				return strings.TrimSuffix(buf.String(), "\n")
+			}
+		}
+	}
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Compare reports whether two outputs are the same, the same once
+// normalized, or different
+func Compare(original, replayed string) string {
+	switch {
+	case original == replayed:
+		return MatchExact
+	case Normalize(original) == Normalize(replayed):
+		return MatchNormalized
+	default:
+		return MatchDifferent
+	}
+}
+
+// Diff returns a line diff from original to replayed. Removed lines start
+// with "- ", added lines with "+ " and unchanged lines with two spaces.
+func Diff(original, replayed string) string {
+	a := strings.Split(original, "\n")
+	b := strings.Split(replayed, "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return "outputs are too long to diff"
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
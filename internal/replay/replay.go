@@ -0,0 +1,436 @@
+// Package replay re-sends logged requests through the gateway or directly to
+// a provider, and compares the new responses with the logged ones.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/prompt"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// ReplayOfHeader is sent with requests replayed through the gateway, so that
+// they are logged with the replay-of metadata key set to the original
+// request's ID
+const ReplayOfHeader = "X-Majordomo-" + models.ReplayOfMetadataKey
+
+// Target is where logged requests are replayed
+type Target struct {
+	// GatewayURL sends requests through the gateway at this URL. Without it,
+	// requests are sent directly to the provider.
+	GatewayURL   string `json:"gateway_url,omitempty"`
+	MajordomoKey string `json:"-"`
+	// APIKey is the provider API key, or a proxy key through the gateway
+	APIKey string `json:"-"`
+
+	// Provider and Model replace the logged provider and model when set
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+
+	// BaseURL replaces the provider's base URL when sending directly
+	BaseURL string `json:"base_url,omitempty"`
+
+	// Prompt is a prompt template reference, name@version. Requests that
+	// were rendered from a version of that template are rendered from this
+	// one instead. Only the gateway renders templates.
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// BodyStore reads request and response bodies stored in S3
+type BodyStore interface {
+	Download(ctx context.Context, key string) (*storage.S3BodyContent, error)
+}
+
+// Pricer calculates the cost of a response's token usage
+type Pricer interface {
+	Calculate(metrics *models.UsageMetrics) models.Cost
+}
+
+// Replayer sends logged requests to a target
+type Replayer struct {
+	target     Target
+	bodies     BodyStore
+	pricer     Pricer
+	client     *http.Client
+	promptName string
+}
+
+// NewReplayer creates a replayer for target. bodies may be nil when bodies
+// are only stored in the database.
+func NewReplayer(target Target, bodies BodyStore, pricer Pricer, timeout time.Duration) (*Replayer, error) {
+	r := &Replayer{
+		target: target,
+		bodies: bodies,
+		pricer: pricer,
+		client: &http.Client{Timeout: timeout},
+	}
+
+	if target.Provider != "" {
+		p := provider.ForName(target.Provider).Provider
+		if p == provider.ProviderUnknown || p == provider.ProviderBedrock {
+			return nil, fmt.Errorf("cannot replay to provider %q", target.Provider)
+		}
+	}
+	if target.Prompt != "" {
+		if target.GatewayURL == "" {
+			return nil, errors.New("a prompt template can only be replayed through the gateway")
+		}
+		name, version, err := prompt.ParseReference(target.Prompt)
+		if err != nil {
+			return nil, err
+		}
+		if version == 0 {
+			r.target.Prompt = name
+		}
+		r.promptName = name
+	}
+	return r, nil
+}
+
+// Run replays requests, up to concurrency at a time, and reports the result
+// of each in order
+func (r *Replayer) Run(ctx context.Context, requests []*models.LoggedRequest, concurrency int) *Report {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]*Result, len(requests))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			results[i] = r.replay(ctx, req)
+		}()
+	}
+	wg.Wait()
+
+	return newReport(r.target, results)
+}
+
+// bodies are a logged request's stored bodies
+type bodies struct {
+	request, clientRequest, response, clientResponse []byte
+}
+
+func (r *Replayer) replay(ctx context.Context, req *models.LoggedRequest) *Result {
+	result := &Result{
+		RequestID:   req.ID,
+		RequestedAt: req.RequestedAt,
+		Provider:    req.Provider,
+		Original: Outcome{
+			Model:        req.Model,
+			StatusCode:   req.StatusCode,
+			InputTokens:  req.InputTokens,
+			OutputTokens: req.OutputTokens,
+			TotalCost:    req.TotalCost,
+			LatencyMs:    req.ResponseTimeMs,
+		},
+	}
+
+	stored, err := r.load(ctx, req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Through the gateway, the request is sent as the client sent it and
+	// compared with what the client received
+	gateway := r.target.GatewayURL != ""
+	body, original := stored.request, stored.response
+	if gateway {
+		if stored.clientRequest != nil {
+			body = stored.clientRequest
+		}
+		if stored.clientResponse != nil {
+			original = stored.clientResponse
+		}
+	}
+	if req.StatusCode < 400 {
+		result.Original.Output = OutputText(original)
+	}
+
+	httpReq, providerInfo, err := r.newRequest(ctx, req, body, gateway && stored.clientRequest != nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	replayed, err := r.send(httpReq, providerInfo, gateway)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Replay = replayed
+
+	if original != nil && result.Original.StatusCode < 400 && replayed.StatusCode < 400 {
+		result.Match = Compare(result.Original.Output, replayed.Output)
+		if result.Match == MatchDifferent {
+			result.Diff = Diff(result.Original.Output, replayed.Output)
+		}
+	}
+	return result
+}
+
+// load returns a logged request's bodies from the database or S3
+func (r *Replayer) load(ctx context.Context, req *models.LoggedRequest) (*bodies, error) {
+	if req.RequestBody != nil {
+		return &bodies{
+			request:        bytesOf(req.RequestBody),
+			clientRequest:  bytesOf(req.ClientRequestBody),
+			response:       bytesOf(req.ResponseBody),
+			clientResponse: bytesOf(req.ClientResponseBody),
+		}, nil
+	}
+	if req.BodyS3Key == nil {
+		return nil, errors.New("request body was not stored")
+	}
+	if r.bodies == nil {
+		return nil, errors.New("request body is stored in S3, which is not configured")
+	}
+
+	content, err := r.bodies.Download(ctx, *req.BodyS3Key)
+	if err != nil {
+		return nil, err
+	}
+	return &bodies{
+		request:        rawBytes(content.Request.Body),
+		clientRequest:  rawBytes(content.Request.ClientBody),
+		response:       rawBytes(content.Response.Body),
+		clientResponse: rawBytes(content.Response.ClientBody),
+	}, nil
+}
+
+// newRequest builds the request replaying req with body. clientBody is set
+// when body is what the client sent, before any prompt template was
+// rendered into it.
+func (r *Replayer) newRequest(ctx context.Context, req *models.LoggedRequest, body []byte, clientBody bool) (*http.Request, provider.ProviderInfo, error) {
+	logged := provider.Provider(req.Provider)
+	providerInfo := provider.ForName(req.Provider)
+	if r.target.Provider != "" {
+		providerInfo = provider.ForName(r.target.Provider)
+	}
+	if providerInfo.Provider == provider.ProviderUnknown || providerInfo.Provider == provider.ProviderBedrock {
+		return nil, providerInfo, fmt.Errorf("cannot replay %s requests", req.Provider)
+	}
+	if format(logged) != format(providerInfo.Provider) {
+		return nil, providerInfo, fmt.Errorf("cannot replay %s requests to %s", req.Provider, providerInfo.Provider)
+	}
+
+	if len(body) == 0 {
+		return nil, providerInfo, errors.New("request body was not stored")
+	}
+	if !json.Valid(body) {
+		return nil, providerInfo, errors.New("stored request body is not valid JSON, it may have been truncated")
+	}
+
+	path := req.RequestPath
+	if logged == provider.ProviderAnthropicOpenAI {
+		// The logged path is the translated one
+		path = "/v1/chat/completions"
+	}
+	path = strings.Replace(path, ":streamGenerateContent", ":generateContent", 1)
+	if r.target.Model != "" && providerInfo.Provider == provider.ProviderGemini {
+		return nil, providerInfo, errors.New("the model of a Gemini request is part of its path and cannot be replaced")
+	}
+
+	body, err := prepareBody(body, r.target.Model)
+	if err != nil {
+		return nil, providerInfo, err
+	}
+
+	var url string
+	if r.target.GatewayURL != "" {
+		url = strings.TrimSuffix(r.target.GatewayURL, "/") + path
+	} else {
+		baseURL := providerInfo.BaseURL
+		if r.target.BaseURL != "" {
+			baseURL = strings.TrimSuffix(r.target.BaseURL, "/")
+		}
+		if baseURL == "" {
+			return nil, providerInfo, fmt.Errorf("no base URL for provider %s", providerInfo.Provider)
+		}
+		if provider.IsTranslationRequired(providerInfo.Provider) {
+			if body, path, err = provider.TranslateOpenAIToAnthropic(body); err != nil {
+				return nil, providerInfo, fmt.Errorf("failed to translate request: %w", err)
+			}
+		}
+		url = baseURL + path
+	}
+
+	method := req.RequestMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, providerInfo, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	if r.target.GatewayURL != "" {
+		for key, value := range req.Metadata {
+			httpReq.Header.Set("X-Majordomo-"+key, value)
+		}
+		if r.target.MajordomoKey != "" {
+			httpReq.Header.Set("X-Majordomo-Key", r.target.MajordomoKey)
+		}
+		httpReq.Header.Set("X-Majordomo-Provider", string(providerInfo.Provider))
+		httpReq.Header.Set(ReplayOfHeader, req.ID.String())
+		if req.PromptName != nil && clientBody {
+			ref := *req.PromptName
+			if *req.PromptName == r.promptName {
+				ref = r.target.Prompt
+			} else if req.PromptVersion != nil {
+				ref = fmt.Sprintf("%s@%d", ref, *req.PromptVersion)
+			}
+			httpReq.Header.Set(prompt.Header, ref)
+		}
+		setAuth(httpReq.Header, providerInfo.Provider, r.target.APIKey, false)
+	} else {
+		setAuth(httpReq.Header, providerInfo.Provider, r.target.APIKey, true)
+	}
+
+	return httpReq, providerInfo, nil
+}
+
+// send sends a replayed request and measures its response
+func (r *Replayer) send(httpReq *http.Request, providerInfo provider.ProviderInfo, gateway bool) (*Outcome, error) {
+	var sent []byte
+	if body, err := httpReq.GetBody(); err == nil {
+		sent, _ = io.ReadAll(body)
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	if !gateway && provider.IsTranslationRequired(providerInfo.Provider) && resp.StatusCode < 400 {
+		if translated, err := provider.TranslateAnthropicToOpenAI(body, ""); err == nil {
+			body = translated
+		}
+	}
+
+	outcome := &Outcome{
+		StatusCode: resp.StatusCode,
+		LatencyMs:  latency.Milliseconds(),
+	}
+
+	parser := provider.GetParser(providerInfo.Provider)
+	metrics := &models.UsageMetrics{Provider: string(providerInfo.Provider)}
+	if resp.StatusCode < 400 {
+		if parsed, err := parser.ParseResponse(body); err == nil {
+			metrics = parsed
+		}
+		outcome.Output = OutputText(body)
+	}
+	if metrics.Model == "" {
+		metrics.Model = parser.ExtractModel(sent)
+	}
+	metrics.ResponseTime = latency
+
+	outcome.Model = metrics.Model
+	outcome.InputTokens = metrics.InputTokens
+	outcome.OutputTokens = metrics.OutputTokens
+	if r.pricer != nil && resp.StatusCode < 400 {
+		outcome.TotalCost = r.pricer.Calculate(metrics).TotalCost
+	}
+	return outcome, nil
+}
+
+// prepareBody turns off streaming, so that the whole response can be
+// measured and compared, and replaces the model when model is set
+func prepareBody(body []byte, model string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+
+	delete(doc, "stream")
+	delete(doc, "stream_options")
+	if model != "" {
+		doc["model"], _ = json.Marshal(model)
+	}
+
+	// Leave <, > and & in prompts as they were sent
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// setAuth sets the API key where the provider's SDKs send it. Sent directly,
+// an anthropic-openai request has been translated for the Anthropic API.
+func setAuth(h http.Header, p provider.Provider, key string, direct bool) {
+	if key == "" {
+		return
+	}
+	switch {
+	case p == provider.ProviderAnthropic, p == provider.ProviderAnthropicOpenAI && direct:
+		h.Set("X-Api-Key", key)
+		h.Set("Anthropic-Version", "2023-06-01")
+	case p == provider.ProviderGemini:
+		h.Set("X-Goog-Api-Key", key)
+	case p == provider.ProviderAzure && direct:
+		h.Set("Api-Key", key)
+	default:
+		h.Set("Authorization", "Bearer "+key)
+	}
+}
+
+// format groups providers by the request format they accept
+func format(p provider.Provider) string {
+	switch p {
+	case provider.ProviderAnthropic:
+		return "anthropic"
+	case provider.ProviderGemini:
+		return "gemini"
+	default:
+		return "openai"
+	}
+}
+
+func bytesOf(s *string) []byte {
+	if s == nil {
+		return nil
+	}
+	return []byte(*s)
+}
+
+// rawBytes returns a body stored in S3. Bodies that were not JSON are stored
+// as JSON strings.
+func rawBytes(raw json.RawMessage) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return raw
+}
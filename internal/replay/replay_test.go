@@ -0,0 +1,237 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+type fixedPricer float64
+
+func (p fixedPricer) Calculate(m *models.UsageMetrics) models.Cost {
+	return models.Cost{TotalCost: float64(p) * float64(m.InputTokens+m.OutputTokens)}
+}
+
+type fakeBodies map[string]*storage.S3BodyContent
+
+func (f fakeBodies) Download(_ context.Context, key string) (*storage.S3BodyContent, error) {
+	content, ok := f[key]
+	if !ok {
+		return nil, errors.New("failed to download " + key)
+	}
+	return content, nil
+}
+
+func strPtr(s string) *string { return &s }
+
+func chatResponse(model, content string) string {
+	return `{"model":"` + model + `","choices":[{"message":{"role":"assistant","content":"` + content + `"}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		original, replayed, want string
+	}{
+		{"Paris.", "Paris.", MatchExact},
+		{"The answer is  Paris.\n", "the answer is Paris.", MatchNormalized},
+		{`{"city": "Paris", "country": "France"}`, `{"country":"France","city":"Paris"}`, MatchNormalized},
+		{"Paris.", "London.", MatchDifferent},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.original, tt.replayed); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %q, want %q", tt.original, tt.replayed, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\nc", "a\nx\nc\nd")
+	want := "  a\n- b\n+ x\n  c\n+ d\n"
+	if got != want {
+		t.Errorf("Diff() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReplayThroughGateway(t *testing.T) {
+	var got *http.Request
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Write([]byte(chatResponse("gpt-4o-mini", "Refund issued.")))
+	}))
+	defer srv.Close()
+
+	id := uuid.New()
+	req := &models.LoggedRequest{
+		ID:                id,
+		Provider:          "openai",
+		Model:             "gpt-4o",
+		RequestPath:       "/v1/chat/completions",
+		RequestMethod:     "POST",
+		PromptName:        strPtr("support-triage"),
+		PromptVersion:     func() *int { v := 2; return &v }(),
+		ResponseTimeMs:    900,
+		InputTokens:       10,
+		OutputTokens:      6,
+		TotalCost:         0.3,
+		StatusCode:        200,
+		Metadata:          map[string]string{"feature": "triage"},
+		RequestBody:       strPtr(`{"model":"gpt-4o","messages":[{"role":"system","content":"rendered"}]}`),
+		ClientRequestBody: strPtr(`{"model":"gpt-4o","stream":true,"prompt_variables":{"ticket":"refund"}}`),
+		ResponseBody:      strPtr(chatResponse("gpt-4o", "Refund  issued.")),
+	}
+
+	r, err := NewReplayer(Target{
+		GatewayURL:   srv.URL,
+		MajordomoKey: "mdm_sk_test",
+		APIKey:       "sk-test",
+		Model:        "gpt-4o-mini",
+		Prompt:       "support-triage@3",
+	}, nil, fixedPricer(0.01), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := r.Run(context.Background(), []*models.LoggedRequest{req}, 2)
+
+	if got.URL.Path != "/v1/chat/completions" {
+		t.Errorf("path = %q", got.URL.Path)
+	}
+	for header, want := range map[string]string{
+		"X-Majordomo-Key":      "mdm_sk_test",
+		"X-Majordomo-Provider": "openai",
+		"X-Majordomo-Prompt":   "support-triage@3",
+		"X-Majordomo-Feature":  "triage",
+		ReplayOfHeader:         id.String(),
+		"Authorization":        "Bearer sk-test",
+	} {
+		if v := got.Header.Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+	if gotBody["model"] != "gpt-4o-mini" || gotBody["stream"] != nil || gotBody["prompt_variables"] == nil {
+		t.Errorf("body = %v, want the client body without streaming and with the new model", gotBody)
+	}
+
+	res := report.Results[0]
+	if res.Error != "" || res.Replay == nil {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.Replay.Model != "gpt-4o-mini" || res.Replay.InputTokens != 10 || res.Replay.OutputTokens != 5 || res.Replay.TotalCost != 0.15 || res.Replay.Output != "Refund issued." {
+		t.Errorf("replay = %+v", res.Replay)
+	}
+	if res.Match != MatchNormalized || res.Diff != "" {
+		t.Errorf("match = %q, diff = %q, want normalized", res.Match, res.Diff)
+	}
+	if s := report.Summary; s.Replayed != 1 || s.Normalized != 1 || s.Original.TotalCost != 0.3 || s.Replay.OutputTokens != 5 || s.Original.AvgLatencyMs != 900 {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestReplayDirect(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Hello there"}],"usage":{"input_tokens":8,"output_tokens":3}}`))
+	}))
+	defer srv.Close()
+
+	requestBody := `{"model":"claude-sonnet-4-5","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`
+	requests := []*models.LoggedRequest{
+		{
+			ID:          uuid.New(),
+			Provider:    "anthropic",
+			Model:       "claude-sonnet-4-5",
+			RequestPath: "/v1/messages",
+			StatusCode:  200,
+			BodyS3Key:   strPtr("key/1.json.gz"),
+		},
+		{ID: uuid.New(), Provider: "gemini", RequestPath: "/v1beta/models/gemini-2.0-flash:generateContent", StatusCode: 200, RequestBody: strPtr(`{}`)},
+		{ID: uuid.New(), Provider: "anthropic", RequestPath: "/v1/messages", StatusCode: 200, RequestBody: strPtr(`{"model":"claude-sonnet-4-5","messages":[`)},
+		{ID: uuid.New(), Provider: "anthropic", RequestPath: "/v1/messages", StatusCode: 200, BodyS3Key: strPtr("key/missing.json.gz")},
+	}
+	bodies := fakeBodies{
+		"key/1.json.gz": {
+			Request:  storage.S3RequestContent{Body: json.RawMessage(requestBody)},
+			Response: storage.S3ResponseContent{Body: json.RawMessage(`{"content":[{"type":"text","text":"Hi!"}]}`)},
+		},
+	}
+
+	r, err := NewReplayer(Target{APIKey: "sk-ant-test", Provider: "anthropic", BaseURL: srv.URL}, bodies, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := r.Run(context.Background(), requests, 1)
+
+	if got.URL.Path != "/v1/messages" || got.Header.Get("X-Api-Key") != "sk-ant-test" || got.Header.Get("Anthropic-Version") == "" {
+		t.Errorf("request = %s %v", got.URL.Path, got.Header)
+	}
+	if want := `{"max_tokens":100,"messages":[{"role":"user","content":"hi"}],"model":"claude-sonnet-4-5"}`; string(gotBody) != want {
+		t.Errorf("body = %s, want the stored request body", gotBody)
+	}
+
+	res := report.Results[0]
+	if res.Replay == nil || res.Replay.InputTokens != 8 || res.Match != MatchDifferent || res.Diff != "- Hi!\n+ Hello there\n" {
+		t.Errorf("result = %+v, replay %+v", res, res.Replay)
+	}
+	for i, want := range []string{
+		"cannot replay gemini requests to anthropic",
+		"stored request body is not valid JSON",
+		"failed to download key/missing.json.gz",
+	} {
+		if res := report.Results[i+1]; !strings.Contains(res.Error, want) || res.Replay != nil {
+			t.Errorf("result %d error = %q, want %q", i+1, res.Error, want)
+		}
+	}
+	if s := report.Summary; s.Requests != 4 || s.Replayed != 1 || s.Failed != 3 || s.Different != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestNewReplayer(t *testing.T) {
+	if _, err := NewReplayer(Target{Prompt: "support-triage@3"}, nil, nil, time.Second); err == nil {
+		t.Error("prompt without the gateway: want error")
+	}
+	if _, err := NewReplayer(Target{Provider: "nope"}, nil, nil, time.Second); err == nil {
+		t.Error("unknown provider: want error")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	report := newReport(Target{}, []*Result{
+		{RequestID: uuid.New(), Provider: "openai", Original: Outcome{Model: "gpt-4o", StatusCode: 200, TotalCost: 0.25}, Replay: &Outcome{Model: "gpt-4o-mini", StatusCode: 200, TotalCost: 0.05}, Match: MatchExact},
+		{RequestID: uuid.New(), Provider: "openai", Original: Outcome{Model: "gpt-4o", StatusCode: 200}, Error: "request body was not stored"},
+	})
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || len(rows[0]) != len(csvHeader) {
+		t.Fatalf("rows = %v", rows)
+	}
+	if rows[1][11] != "0.25" || rows[1][12] != "0.05" || rows[1][15] != MatchExact {
+		t.Errorf("row = %v", rows[1])
+	}
+	if rows[2][4] != "" || rows[2][6] != "" || rows[2][16] != "request body was not stored" {
+		t.Errorf("failed row = %v", rows[2])
+	}
+}
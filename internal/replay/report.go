@@ -0,0 +1,174 @@
+package replay
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcome is how a request was answered, originally or when replayed
+type Outcome struct {
+	Model        string  `json:"model"`
+	StatusCode   int     `json:"status_code"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	TotalCost    float64 `json:"total_cost"`
+	LatencyMs    int64   `json:"latency_ms"`
+	Output       string  `json:"output,omitempty"`
+}
+
+// Result compares a replayed request with the original. Replay is nil and
+// Error set when the request could not be replayed. Match is empty when
+// either response was an error or the original response was not stored.
+type Result struct {
+	RequestID   uuid.UUID `json:"request_id"`
+	RequestedAt time.Time `json:"requested_at"`
+	Provider    string    `json:"provider"`
+	Original    Outcome   `json:"original"`
+	Replay      *Outcome  `json:"replay,omitempty"`
+	Match       string    `json:"match,omitempty"`
+	Diff        string    `json:"diff,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Totals adds up the outcomes of the replayed requests, originally or when
+// replayed
+type Totals struct {
+	ErrorCount   int     `json:"error_count"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	TotalCost    float64 `json:"total_cost"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// Summary adds up a replay. Original and Replay only cover the requests
+// that were replayed, so that they compare like for like.
+type Summary struct {
+	Requests   int    `json:"requests"`
+	Replayed   int    `json:"replayed"`
+	Failed     int    `json:"failed"`
+	Exact      int    `json:"exact_matches"`
+	Normalized int    `json:"normalized_matches"`
+	Different  int    `json:"different"`
+	Original   Totals `json:"original"`
+	Replay     Totals `json:"replay"`
+}
+
+// Report is the outcome of a replay
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Target      Target    `json:"target"`
+	Summary     Summary   `json:"summary"`
+	Results     []*Result `json:"results"`
+}
+
+func newReport(target Target, results []*Result) *Report {
+	report := &Report{
+		GeneratedAt: time.Now().UTC(),
+		Target:      target,
+		Results:     results,
+	}
+
+	s := &report.Summary
+	s.Requests = len(results)
+	var originalLatency, replayLatency int64
+	for _, r := range results {
+		if r.Replay == nil {
+			s.Failed++
+			continue
+		}
+		s.Replayed++
+		switch r.Match {
+		case MatchExact:
+			s.Exact++
+		case MatchNormalized:
+			s.Normalized++
+		case MatchDifferent:
+			s.Different++
+		}
+		s.Original.add(&r.Original)
+		s.Replay.add(r.Replay)
+		originalLatency += r.Original.LatencyMs
+		replayLatency += r.Replay.LatencyMs
+	}
+	if s.Replayed > 0 {
+		s.Original.AvgLatencyMs = float64(originalLatency) / float64(s.Replayed)
+		s.Replay.AvgLatencyMs = float64(replayLatency) / float64(s.Replayed)
+	}
+	return report
+}
+
+func (t *Totals) add(o *Outcome) {
+	if o.StatusCode >= 400 {
+		t.ErrorCount++
+	}
+	t.InputTokens += int64(o.InputTokens)
+	t.OutputTokens += int64(o.OutputTokens)
+	t.TotalCost += o.TotalCost
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// csvHeader lists the columns WriteCSV writes
+var csvHeader = []string{
+	"request_id", "requested_at", "provider",
+	"original_model", "replay_model",
+	"original_status", "replay_status",
+	"original_input_tokens", "replay_input_tokens",
+	"original_output_tokens", "replay_output_tokens",
+	"original_cost", "replay_cost",
+	"original_latency_ms", "replay_latency_ms",
+	"match", "error", "original_output", "replay_output",
+}
+
+// WriteCSV writes one row per request. The summary and diffs are only in the
+// JSON report.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, res := range r.Results {
+		replay := res.Replay
+		if replay == nil {
+			replay = &Outcome{}
+		}
+		row := []string{
+			res.RequestID.String(), res.RequestedAt.UTC().Format(time.RFC3339), res.Provider,
+			res.Original.Model, replay.Model,
+			strconv.Itoa(res.Original.StatusCode), strconv.Itoa(replay.StatusCode),
+			strconv.Itoa(res.Original.InputTokens), strconv.Itoa(replay.InputTokens),
+			strconv.Itoa(res.Original.OutputTokens), strconv.Itoa(replay.OutputTokens),
+			formatCost(res.Original.TotalCost), formatCost(replay.TotalCost),
+			strconv.FormatInt(res.Original.LatencyMs, 10), strconv.FormatInt(replay.LatencyMs, 10),
+			res.Match, res.Error, res.Original.Output, replay.Output,
+		}
+		if res.Replay == nil {
+			// Leave the replay columns empty rather than zero
+			for _, i := range []int{4, 6, 8, 10, 12, 14} {
+				row[i] = ""
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', -1, 64)
+}
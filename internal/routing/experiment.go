@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// pickArm chooses the arm of exp for a request. Requests with the same value
+// of the sticky key always get the same arm, as long as the arms and weights
+// don't change; requests without one get a random arm.
+func pickArm(exp *models.Experiment, m Match) *models.ExperimentArm {
+	var n uint64
+	if value := stickyValue(exp, m); value != "" {
+		h := fnv.New64a()
+		h.Write(exp.ID[:])
+		h.Write([]byte(value))
+		n = h.Sum64()
+	} else {
+		n = rand.Uint64()
+	}
+
+	bucket := int(n % 100)
+	for i := range exp.Arms {
+		bucket -= exp.Arms[i].Weight
+		if bucket < 0 {
+			return &exp.Arms[i]
+		}
+	}
+	return &exp.Arms[len(exp.Arms)-1]
+}
+
+func stickyValue(exp *models.Experiment, m Match) string {
+	if exp.StickyKey == nil {
+		return ""
+	}
+	return m.Metadata[*exp.StickyKey]
+}
+
+// ValidateExperiment checks that an experiment can be stored. It needs at
+// least two arms with distinct names, and their weights must add up to 100.
+func ValidateExperiment(exp *models.Experiment) error {
+	if exp.Name == "" {
+		return errors.New("name is required")
+	}
+	if exp.Model == "" {
+		return errors.New("model is required")
+	}
+	if exp.StickyKey != nil && *exp.StickyKey == "" {
+		return errors.New("sticky_key must not be empty")
+	}
+	if len(exp.Arms) < 2 {
+		return errors.New("at least two arms are required")
+	}
+
+	names := make(map[string]bool, len(exp.Arms))
+	total := 0
+	for _, arm := range exp.Arms {
+		if arm.Name == "" {
+			return errors.New("every arm needs a name")
+		}
+		if names[arm.Name] {
+			return fmt.Errorf("arm name %q is used twice", arm.Name)
+		}
+		names[arm.Name] = true
+
+		if arm.TargetModel == "" {
+			return fmt.Errorf("arm %q: target_model is required", arm.Name)
+		}
+		if err := validateProvider(arm.TargetProvider); err != nil {
+			return fmt.Errorf("arm %q: %w", arm.Name, err)
+		}
+		if arm.Weight < 0 {
+			return fmt.Errorf("arm %q: weight must not be negative", arm.Name)
+		}
+		total += arm.Weight
+	}
+	if total != 100 {
+		return fmt.Errorf("arm weights add up to %d, want 100", total)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package routing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+func TestResolveExperiment(t *testing.T) {
+	store := &mockRouteStore{
+		routes: []*models.ModelRoute{
+			{ID: uuid.New(), Name: "default", TargetModel: "gpt-4o"},
+			{ID: uuid.New(), Name: "fast", TargetModel: "gpt-4o-mini"},
+		},
+		experiments: []*models.Experiment{
+			{
+				ID:        uuid.New(),
+				Name:      "rollout",
+				Model:     "default",
+				StickyKey: ptr("X-Majordomo-User-Id"),
+				Arms: models.ExperimentArms{
+					{Name: "control", TargetModel: "gpt-4o", Weight: 70},
+					{Name: "candidate", TargetProvider: "anthropic-openai", TargetModel: "claude-sonnet-4-5", Weight: 30},
+				},
+				IsActive: true,
+			},
+			{
+				ID:    uuid.New(),
+				Name:  "stopped",
+				Model: "fast",
+				Arms: models.ExperimentArms{
+					{Name: "a", TargetModel: "gpt-4.1-nano", Weight: 50},
+					{Name: "b", TargetModel: "gpt-4.1-mini", Weight: 50},
+				},
+			},
+		},
+	}
+	r := NewRouter(store, store, nil, time.Hour)
+	defer r.Close()
+
+	// The same user always gets the same arm, and the split is roughly the
+	// configured one
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		m := Match{Provider: provider.ProviderOpenAI, Providers: []string{"anthropic-openai"}, Metadata: map[string]string{"user-id": fmt.Sprintf("user-%d", i)}}
+		target := r.Resolve("default", m)
+		if target == nil || target.Experiment == nil {
+			t.Fatalf("Resolve = %+v, want an experiment arm", target)
+		}
+		if again := r.Resolve("default", m); again.Arm != target.Arm {
+			t.Fatalf("user-%d got arms %q and %q", i, target.Arm, again.Arm)
+		}
+		counts[target.Arm]++
+	}
+	if counts["candidate"] < 500 || counts["candidate"] > 700 {
+		t.Errorf("candidate got %d of 2000 requests, want about 600", counts["candidate"])
+	}
+
+	// Requests the picked arm can't serve fall back to routes
+	for i := 0; i < 50; i++ {
+		m := Match{Provider: provider.ProviderAnthropic, Metadata: map[string]string{"user-id": fmt.Sprintf("user-%d", i)}}
+		target := r.Resolve("default", m)
+		if target == nil {
+			t.Fatal("Resolve returned nil for an Anthropic request")
+		}
+		if target.Experiment != nil && target.Arm != "control" {
+			t.Errorf("Anthropic request got arm %q", target.Arm)
+		}
+	}
+
+	// Without a proxy key mapped to the candidate's provider, requests never
+	// get the candidate arm
+	for i := 0; i < 50; i++ {
+		m := Match{Provider: provider.ProviderOpenAI, Metadata: map[string]string{"user-id": fmt.Sprintf("user-%d", i)}}
+		if target := r.Resolve("default", m); target == nil || target.Arm == "candidate" {
+			t.Fatalf("Resolve without a proxy key = %+v, want the control arm or the route", target)
+		}
+	}
+
+	// Stopped experiments don't apply
+	if target := r.Resolve("fast", Match{Provider: provider.ProviderOpenAI}); target == nil || target.Experiment != nil || target.Model != "gpt-4o-mini" {
+		t.Errorf("Resolve(fast) = %+v, want the route", target)
+	}
+}
+
+func TestValidateExperiment(t *testing.T) {
+	arms := func(weights ...int) models.ExperimentArms {
+		var a models.ExperimentArms
+		for i, w := range weights {
+			a = append(a, models.ExperimentArm{Name: fmt.Sprintf("arm-%d", i), TargetModel: "gpt-4o", Weight: w})
+		}
+		return a
+	}
+
+	tests := []struct {
+		name    string
+		exp     models.Experiment
+		wantErr bool
+	}{
+		{"valid", models.Experiment{Name: "e", Model: "default", Arms: arms(50, 50)}, false},
+		{"zero weight arm", models.Experiment{Name: "e", Model: "default", Arms: arms(100, 0)}, false},
+		{"missing model", models.Experiment{Name: "e", Arms: arms(50, 50)}, true},
+		{"one arm", models.Experiment{Name: "e", Model: "default", Arms: arms(100)}, true},
+		{"weights not 100", models.Experiment{Name: "e", Model: "default", Arms: arms(50, 40)}, true},
+		{"negative weight", models.Experiment{Name: "e", Model: "default", Arms: arms(110, -10)}, true},
+		{"duplicate arm names", models.Experiment{Name: "e", Model: "default", Arms: models.ExperimentArms{
+			{Name: "a", TargetModel: "gpt-4o", Weight: 50}, {Name: "a", TargetModel: "gpt-4.1", Weight: 50},
+		}}, true},
+		{"unsupported provider", models.Experiment{Name: "e", Model: "default", Arms: models.ExperimentArms{
+			{Name: "a", TargetModel: "gpt-4o", Weight: 50}, {Name: "b", TargetProvider: "bedrock", TargetModel: "x", Weight: 50},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateExperiment(&tt.exp); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateExperiment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+)
+
+// requestFormats maps the providers a route can target to the request format
+// they accept. A route only moves a request to another provider when both
+// accept the same format.
+var requestFormats = map[provider.Provider]string{
+	provider.ProviderOpenAI:          "openai",
+	provider.ProviderAnthropicOpenAI: "openai",
+	provider.ProviderAnthropic:       "anthropic",
+}
+
+// Match describes the request being routed
+type Match struct {
+	// Provider is the provider detected from the request
+	Provider   provider.Provider
+	APIKeyID   uuid.UUID
+	ProxyKeyID *uuid.UUID
+	// Providers lists the providers the request's proxy key has a provider
+	// key for. A request is only moved to another provider in this list, so
+	// a provider key the client sent itself never goes to another provider.
+	Providers []string
+	// Metadata holds the X-Majordomo-* metadata headers, keyed by lowercase
+	// name without the prefix
+	Metadata map[string]string
+}
+
+// Target is where a routed request is sent
+type Target struct {
+	// Provider is empty to keep the provider detected from the request
+	Provider string
+	Model    string
+
+	// Experiment and Arm are set when an experiment chose the target
+	Experiment *models.Experiment
+	Arm        string
+}
+
+// Router resolves virtual model names to provider models. Routes and
+// experiments created through the admin API are reloaded from storage every
+// refresh interval; routes from the config file are fixed.
+type Router struct {
+	store           storage.ModelRouteStorage
+	experimentStore storage.ExperimentStorage
+	static          []*models.ModelRoute
+	refreshInterval time.Duration
+
+	mu          sync.RWMutex
+	routes      map[string][]*models.ModelRoute // by name, stored routes before config routes
+	experiments map[string]*models.Experiment   // active experiments by model
+
+	done chan struct{}
+}
+
+// NewRouter creates a router with the given config routes, loads the stored
+// routes and experiments and starts refreshing them
+func NewRouter(store storage.ModelRouteStorage, experimentStore storage.ExperimentStorage, static []*models.ModelRoute, refreshInterval time.Duration) *Router {
+	for _, route := range static {
+		normalize(route)
+	}
+
+	r := &Router{
+		store:           store,
+		experimentStore: experimentStore,
+		static:          static,
+		refreshInterval: refreshInterval,
+		routes:          make(map[string][]*models.ModelRoute),
+		experiments:     make(map[string]*models.Experiment),
+		done:            make(chan struct{}),
+	}
+
+	if err := r.Reload(context.Background()); err != nil {
+		slog.Error("failed to load model routes", "error", err)
+		r.index(nil, nil)
+	}
+	go r.refreshLoop()
+
+	return r
+}
+
+// Reload reloads the stored routes and experiments. On error the current
+// ones are kept.
+func (r *Router) Reload(ctx context.Context) error {
+	stored, err := r.store.ListModelRoutes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, route := range stored {
+		normalize(route)
+	}
+
+	experiments, err := r.experimentStore.ListExperiments(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.index(stored, experiments)
+	return nil
+}
+
+func (r *Router) index(stored []*models.ModelRoute, experiments []*models.Experiment) {
+	routes := make(map[string][]*models.ModelRoute)
+	for _, route := range stored {
+		routes[route.Name] = append(routes[route.Name], route)
+	}
+	for _, route := range r.static {
+		routes[route.Name] = append(routes[route.Name], route)
+	}
+
+	active := make(map[string]*models.Experiment)
+	for _, exp := range experiments {
+		if exp.IsActive {
+			normalizeExperiment(exp)
+			active[exp.Model] = exp
+		}
+	}
+
+	r.mu.Lock()
+	r.routes = routes
+	r.experiments = active
+	r.mu.Unlock()
+}
+
+func (r *Router) refreshLoop() {
+	ticker := time.NewTicker(r.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := r.Reload(ctx); err != nil {
+				slog.Warn("failed to refresh model routes", "error", err)
+			}
+			cancel()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Close stops refreshing the stored routes
+func (r *Router) Close() {
+	close(r.done)
+}
+
+// HasRoutes reports whether any route or active experiment is named model
+func (r *Router) HasRoutes(model string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.routes[model]) > 0 || r.experiments[model] != nil
+}
+
+// Resolve returns where to send a request for model, or nil to leave it
+// alone. An active experiment for model takes precedence over routes, unless
+// the arm it picks can't take the request (see compatible).
+//
+// A route applies when the request matches every condition it sets and its
+// target provider can take the request. When several apply, the one
+// with the most conditions wins; ties go to stored routes, then the oldest.
+func (r *Router) Resolve(model string, m Match) *Target {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if exp := r.experiments[model]; exp != nil {
+		arm := pickArm(exp, m)
+		if compatible(arm.TargetProvider, m) {
+			return &Target{Provider: arm.TargetProvider, Model: arm.TargetModel, Experiment: exp, Arm: arm.Name}
+		}
+	}
+
+	var best *models.ModelRoute
+	for _, route := range r.routes[model] {
+		if !applies(route, m) {
+			continue
+		}
+		if best == nil || route.Conditions() > best.Conditions() {
+			best = route
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return &Target{Provider: best.TargetProvider, Model: best.TargetModel}
+}
+
+func applies(route *models.ModelRoute, m Match) bool {
+	if route.APIKeyID != nil && *route.APIKeyID != m.APIKeyID {
+		return false
+	}
+	if route.ProxyKeyID != nil && (m.ProxyKeyID == nil || *route.ProxyKeyID != *m.ProxyKeyID) {
+		return false
+	}
+	if route.MetadataKey != nil {
+		value, ok := m.Metadata[*route.MetadataKey]
+		if !ok || value != *route.MetadataValue {
+			return false
+		}
+	}
+	return compatible(route.TargetProvider, m)
+}
+
+// compatible reports whether the request m describes can be sent to target.
+// An empty target keeps the detected provider. Another provider must accept
+// the same format and be one the request's proxy key has a provider key for.
+func compatible(target string, m Match) bool {
+	if target == "" {
+		return true
+	}
+	format, ok := requestFormats[m.Provider]
+	if !ok || format != requestFormats[provider.Provider(target)] {
+		return false
+	}
+	return provider.Provider(target) == m.Provider || slices.Contains(m.Providers, target)
+}
+
+// normalize lowercases the metadata key and target provider of a route
+func normalize(route *models.ModelRoute) {
+	if route.MetadataKey != nil {
+		key := metadataKey(*route.MetadataKey)
+		route.MetadataKey = &key
+	}
+	route.TargetProvider = strings.ToLower(route.TargetProvider)
+}
+
+func normalizeExperiment(exp *models.Experiment) {
+	if exp.StickyKey != nil {
+		key := metadataKey(*exp.StickyKey)
+		exp.StickyKey = &key
+	}
+	for i := range exp.Arms {
+		exp.Arms[i].TargetProvider = strings.ToLower(exp.Arms[i].TargetProvider)
+	}
+}
+
+// metadataKey lowercases a metadata header name and strips its X-Majordomo-
+// prefix, to match the keys in Match.Metadata
+func metadataKey(name string) string {
+	return strings.TrimPrefix(strings.ToLower(name), "x-majordomo-")
+}
+
+// Validate checks that a route can be stored or loaded
+func Validate(route *models.ModelRoute) error {
+	if route.Name == "" {
+		return errors.New("name is required")
+	}
+	if route.TargetModel == "" {
+		return errors.New("target_model is required")
+	}
+	if err := validateProvider(route.TargetProvider); err != nil {
+		return err
+	}
+	if (route.MetadataKey == nil) != (route.MetadataValue == nil) {
+		return errors.New("metadata_key and metadata_value must be set together")
+	}
+	if route.MetadataKey != nil && *route.MetadataKey == "" {
+		return errors.New("metadata_key must not be empty")
+	}
+	return nil
+}
+
+func validateProvider(target string) error {
+	if target == "" {
+		return nil
+	}
+	if _, ok := requestFormats[provider.Provider(strings.ToLower(target))]; !ok {
+		return fmt.Errorf("unsupported target_provider %q: must be openai, anthropic or anthropic-openai", target)
+	}
+	return nil
+}
+
+// RequestedModel returns the model field of a JSON request body, or "" if it
+// has none
+func RequestedModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// RewriteModel returns body with its model field set to model
+func RewriteModel(body []byte, model string) ([]byte, error) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	req["model"] = encoded
+
+	// Leave <, > and & in prompts as they were sent
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(req); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,197 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+type mockRouteStore struct {
+	routes      []*models.ModelRoute
+	experiments []*models.Experiment
+}
+
+func (m *mockRouteStore) CreateModelRoute(ctx context.Context, route *models.ModelRoute) error {
+	m.routes = append(m.routes, route)
+	return nil
+}
+
+func (m *mockRouteStore) GetModelRoute(ctx context.Context, id uuid.UUID) (*models.ModelRoute, error) {
+	return nil, nil
+}
+
+func (m *mockRouteStore) ListModelRoutes(ctx context.Context) ([]*models.ModelRoute, error) {
+	// Return copies, as the database would
+	routes := make([]*models.ModelRoute, len(m.routes))
+	for i, route := range m.routes {
+		r := *route
+		routes[i] = &r
+	}
+	return routes, nil
+}
+
+func (m *mockRouteStore) UpdateModelRoute(ctx context.Context, route *models.ModelRoute) error {
+	return nil
+}
+
+func (m *mockRouteStore) DeleteModelRoute(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockRouteStore) CreateExperiment(ctx context.Context, exp *models.Experiment) error {
+	m.experiments = append(m.experiments, exp)
+	return nil
+}
+
+func (m *mockRouteStore) GetExperiment(ctx context.Context, id uuid.UUID) (*models.Experiment, error) {
+	return nil, nil
+}
+
+func (m *mockRouteStore) ListExperiments(ctx context.Context) ([]*models.Experiment, error) {
+	exps := make([]*models.Experiment, len(m.experiments))
+	for i, exp := range m.experiments {
+		e := *exp
+		e.Arms = append(models.ExperimentArms(nil), exp.Arms...)
+		exps[i] = &e
+	}
+	return exps, nil
+}
+
+func (m *mockRouteStore) UpdateExperiment(ctx context.Context, exp *models.Experiment) error {
+	return nil
+}
+
+func (m *mockRouteStore) DeleteExperiment(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockRouteStore) ExperimentResults(ctx context.Context, id uuid.UUID, from, to time.Time) ([]*models.ExperimentArmResult, error) {
+	return nil, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestResolve(t *testing.T) {
+	keyID := uuid.New()
+	proxyKeyID := uuid.New()
+
+	store := &mockRouteStore{routes: []*models.ModelRoute{
+		{ID: uuid.New(), Name: "fast", TargetModel: "stored-default"},
+		{ID: uuid.New(), Name: "fast", TargetModel: "for-key", APIKeyID: &keyID},
+		{ID: uuid.New(), Name: "fast", TargetModel: "for-key-in-eu", APIKeyID: &keyID, MetadataKey: ptr("X-Majordomo-Region"), MetadataValue: ptr("eu")},
+		{ID: uuid.New(), Name: "fast", TargetModel: "for-proxy-key", ProxyKeyID: &proxyKeyID},
+		{ID: uuid.New(), Name: "smart", TargetProvider: "anthropic-openai", TargetModel: "claude-sonnet-4-5"},
+	}}
+	static := []*models.ModelRoute{
+		{Name: "fast", TargetModel: "config-default"},
+		{Name: "cheap", TargetModel: "gpt-4o-mini"},
+	}
+	r := NewRouter(store, store, static, time.Hour)
+	defer r.Close()
+
+	openai := provider.ProviderOpenAI
+	tests := []struct {
+		name  string
+		model string
+		match Match
+		want  string
+	}{
+		{"stored route before config route", "fast", Match{Provider: openai, APIKeyID: uuid.New()}, "stored-default"},
+		{"config route", "cheap", Match{Provider: openai}, "gpt-4o-mini"},
+		{"API key condition", "fast", Match{Provider: openai, APIKeyID: keyID}, "for-key"},
+		{"most conditions wins", "fast", Match{Provider: openai, APIKeyID: keyID, Metadata: map[string]string{"region": "eu"}}, "for-key-in-eu"},
+		{"metadata value must match", "fast", Match{Provider: openai, APIKeyID: keyID, Metadata: map[string]string{"region": "us"}}, "for-key"},
+		{"proxy key condition", "fast", Match{Provider: openai, ProxyKeyID: &proxyKeyID}, "for-proxy-key"},
+		{"compatible provider", "smart", Match{Provider: openai, ProxyKeyID: &proxyKeyID, Providers: []string{"openai", "anthropic-openai"}}, "claude-sonnet-4-5"},
+		{"raw provider key", "smart", Match{Provider: openai}, ""},
+		{"proxy key without a target mapping", "smart", Match{Provider: openai, ProxyKeyID: &proxyKeyID, Providers: []string{"openai"}}, ""},
+		{"incompatible provider", "smart", Match{Provider: provider.ProviderAnthropic, Providers: []string{"anthropic-openai"}}, ""},
+		{"no route", "gpt-4o", Match{Provider: openai}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if target := r.Resolve(tt.model, tt.match); target != nil {
+				got = target.Model
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	store := &mockRouteStore{}
+	r := NewRouter(store, store, nil, time.Hour)
+	defer r.Close()
+
+	if r.HasRoutes("fast") {
+		t.Fatal("HasRoutes before any route was created")
+	}
+
+	store.CreateModelRoute(context.Background(), &models.ModelRoute{ID: uuid.New(), Name: "fast", TargetModel: "gpt-4o-mini"})
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if !r.HasRoutes("fast") {
+		t.Error("HasRoutes after reload = false, want true")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   models.ModelRoute
+		wantErr bool
+	}{
+		{"valid", models.ModelRoute{Name: "fast", TargetModel: "gpt-4o-mini"}, false},
+		{"valid with provider", models.ModelRoute{Name: "fast", TargetProvider: "Anthropic", TargetModel: "claude-3-5-haiku-latest"}, false},
+		{"missing name", models.ModelRoute{TargetModel: "gpt-4o-mini"}, true},
+		{"missing target model", models.ModelRoute{Name: "fast"}, true},
+		{"unsupported provider", models.ModelRoute{Name: "fast", TargetProvider: "gemini", TargetModel: "gemini-2.0-flash"}, true},
+		{"metadata key without value", models.ModelRoute{Name: "fast", TargetModel: "gpt-4o-mini", MetadataKey: ptr("region")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(&tt.route); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRewriteModel(t *testing.T) {
+	body := []byte(`{"model":"fast","messages":[{"role":"user","content":"a < b && c"}],"stream":false}`)
+
+	if got := RequestedModel(body); got != "fast" {
+		t.Fatalf("RequestedModel = %q, want fast", got)
+	}
+
+	rewritten, err := RewriteModel(body, "gpt-4o-mini")
+	if err != nil {
+		t.Fatalf("RewriteModel: %v", err)
+	}
+	var req struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(rewritten, &req); err != nil {
+		t.Fatalf("rewritten body is not JSON: %v", err)
+	}
+	if req.Model != "gpt-4o-mini" || len(req.Messages) != 1 || req.Messages[0].Content != "a < b && c" {
+		t.Errorf("rewritten body = %s", rewritten)
+	}
+	if RequestedModel([]byte("not json")) != "" {
+		t.Error("RequestedModel of a non-JSON body should be empty")
+	}
+}
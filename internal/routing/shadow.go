@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strings"
+)
+
+// ShadowRule mirrors a sample of the requests for a model to another model.
+// Shadow requests are sent after the primary response and their responses
+// are only logged, never returned to the caller.
+type ShadowRule struct {
+	Name           string
+	Model          string // Model name the rule applies to, before or after routing
+	TargetProvider string // Empty sends the shadow request to the primary's provider
+	TargetModel    string
+	SampleRate     float64 // Fraction of matching requests to mirror, in (0, 1]
+}
+
+// Shadows picks the shadow rules a request is mirrored to
+type Shadows struct {
+	rules []ShadowRule
+}
+
+// NewShadows creates a Shadows from validated rules
+func NewShadows(rules []ShadowRule) *Shadows {
+	s := &Shadows{rules: make([]ShadowRule, len(rules))}
+	for i, rule := range rules {
+		rule.TargetProvider = strings.ToLower(rule.TargetProvider)
+		s.rules[i] = rule
+	}
+	return s
+}
+
+// Pick returns the rules that apply to a request for requested, served by
+// served after routing, sampled by each rule's rate. m.Provider is the
+// provider serving the request. Rules whose target provider can't take the
+// request (see compatible) are skipped.
+func (s *Shadows) Pick(requested, served string, m Match) []ShadowRule {
+	var picked []ShadowRule
+	for _, rule := range s.rules {
+		if rule.Model != requested && rule.Model != served {
+			continue
+		}
+		if !compatible(rule.TargetProvider, m) {
+			continue
+		}
+		if rule.SampleRate < 1 && rand.Float64() >= rule.SampleRate {
+			continue
+		}
+		picked = append(picked, rule)
+	}
+	return picked
+}
+
+// ValidateShadowRule checks that a shadow rule can be used
+func ValidateShadowRule(rule *ShadowRule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	if rule.Model == "" {
+		return errors.New("model is required")
+	}
+	if rule.TargetModel == "" {
+		return errors.New("target_model is required")
+	}
+	if err := validateProvider(rule.TargetProvider); err != nil {
+		return err
+	}
+	if rule.SampleRate <= 0 || rule.SampleRate > 1 {
+		return errors.New("sample_rate must be greater than 0 and at most 1")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/superset-studio/majordomo-gateway/internal/provider"
+)
+
+func TestPickShadows(t *testing.T) {
+	s := NewShadows([]ShadowRule{
+		{Name: "all", Model: "gpt-4o", TargetModel: "gpt-4.1", SampleRate: 1},
+		{Name: "to-claude", Model: "fast", TargetProvider: "Anthropic-OpenAI", TargetModel: "claude-3-5-haiku-latest", SampleRate: 1},
+		{Name: "sampled", Model: "gpt-4o-mini", TargetModel: "gpt-4.1-nano", SampleRate: 0.25},
+	})
+
+	openai := Match{Provider: provider.ProviderOpenAI, Providers: []string{"openai", "anthropic-openai"}}
+
+	names := func(rules []ShadowRule) []string {
+		var out []string
+		for _, rule := range rules {
+			out = append(out, rule.Name)
+		}
+		return out
+	}
+
+	if got := names(s.Pick("gpt-4o", "gpt-4o", openai)); len(got) != 1 || got[0] != "all" {
+		t.Errorf("Pick(gpt-4o) = %v, want [all]", got)
+	}
+	// A rule applies to the model the client asked for and the one routing chose
+	if got := names(s.Pick("fast", "gpt-4o", openai)); len(got) != 2 {
+		t.Errorf("Pick(fast -> gpt-4o) = %v, want [all to-claude]", got)
+	}
+	// Anthropic-format requests can't be sent to an OpenAI-format target
+	if got := s.Pick("fast", "fast", Match{Provider: provider.ProviderAnthropic, Providers: []string{"anthropic-openai"}}); len(got) != 0 {
+		t.Errorf("Pick(fast) from anthropic = %v, want none", names(got))
+	}
+	// A provider key the client sent itself never goes to another provider
+	if got := names(s.Pick("fast", "gpt-4o", Match{Provider: provider.ProviderOpenAI})); len(got) != 1 || got[0] != "all" {
+		t.Errorf("Pick(fast -> gpt-4o) without a proxy key = %v, want [all]", got)
+	}
+	if got := s.Pick("gpt-4.1", "gpt-4.1", openai); len(got) != 0 {
+		t.Errorf("Pick(gpt-4.1) = %v, want none", names(got))
+	}
+
+	picked := 0
+	for i := 0; i < 4000; i++ {
+		picked += len(s.Pick("gpt-4o-mini", "gpt-4o-mini", openai))
+	}
+	if picked < 800 || picked > 1200 {
+		t.Errorf("sampled rule picked %d of 4000 times, want about 1000", picked)
+	}
+}
+
+func TestValidateShadowRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ShadowRule
+		wantErr bool
+	}{
+		{"valid", ShadowRule{Name: "s", Model: "gpt-4o", TargetModel: "gpt-4.1", SampleRate: 0.1}, false},
+		{"valid with provider", ShadowRule{Name: "s", Model: "gpt-4o", TargetProvider: "anthropic-openai", TargetModel: "claude-sonnet-4-5", SampleRate: 1}, false},
+		{"missing name", ShadowRule{Model: "gpt-4o", TargetModel: "gpt-4.1", SampleRate: 1}, true},
+		{"missing model", ShadowRule{Name: "s", TargetModel: "gpt-4.1", SampleRate: 1}, true},
+		{"missing target model", ShadowRule{Name: "s", Model: "gpt-4o", SampleRate: 1}, true},
+		{"unsupported provider", ShadowRule{Name: "s", Model: "gpt-4o", TargetProvider: "gemini", TargetModel: "gemini-2.0-flash", SampleRate: 1}, true},
+		{"zero sample rate", ShadowRule{Name: "s", Model: "gpt-4o", TargetModel: "gpt-4.1"}, true},
+		{"sample rate above 1", ShadowRule{Name: "s", Model: "gpt-4o", TargetModel: "gpt-4.1", SampleRate: 1.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateShadowRule(&tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateShadowRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -18,6 +18,15 @@ type AESStore struct {
 
 // NewAESStore creates a new AESStore from a hex-encoded or base64-encoded 32-byte key.
 func NewAESStore(key string) (*AESStore, error) {
+	keyBytes, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AESStore{key: keyBytes}, nil
+}
+
+// parseKey decodes a hex-encoded or base64-encoded 32-byte key.
+func parseKey(key string) ([]byte, error) {
 	if key == "" {
 		return nil, errors.New("encryption key is required")
 	}
@@ -36,28 +45,16 @@ func NewAESStore(key string) (*AESStore, error) {
 		}
 	}
 
-	return &AESStore{key: keyBytes}, nil
+	return keyBytes, nil
 }
 
 // Encrypt encrypts plaintext using AES-256-GCM and returns base64(nonce + ciphertext).
 func (s *AESStore) Encrypt(plaintext string) (string, error) {
-	block, err := aes.NewCipher(s.key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
+	sealed, err := seal(s.key, []byte(plaintext))
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("failed to generate nonce: %w", err)
+		return "", err
 	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return base64.StdEncoding.EncodeToString(sealed), nil
 }
 
 // Decrypt decrypts a base64(nonce + ciphertext) string using AES-256-GCM.
@@ -67,26 +64,58 @@ func (s *AESStore) Decrypt(ciphertext string) (string, error) {
 		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
 	}
 
-	block, err := aes.NewCipher(s.key)
+	plaintext, err := open(s.key, data)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
 	}
+	return string(plaintext), nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// seal encrypts plaintext with AES-256-GCM and returns nonce + ciphertext.
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts nonce + ciphertext produced by seal.
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return "", errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 
 	nonce, encrypted := data[:nonceSize], data[nonceSize:]
 	plaintext, err := gcm.Open(nil, nonce, encrypted, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
 
-	return string(plaintext), nil
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
 }
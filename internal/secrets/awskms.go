@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// awsKMSPrefix marks ciphertexts written by AWSKMS.
+const awsKMSPrefix = "awskms:"
+
+// kmsAPI is the subset of the AWS KMS client used by AWSKMS.
+type kmsAPI interface {
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// AWSKMSConfig holds configuration for AWSKMS.
+type AWSKMSConfig struct {
+	KeyID    string // Key ID, ARN or alias ("alias/majordomo")
+	Region   string
+	Endpoint string // Custom endpoint, e.g. for LocalStack
+}
+
+// AWSKMS encrypts secrets with an AWS KMS key. Credentials come from the
+// default AWS credential chain. It can be used directly as a SecretStore or
+// as the KMS in envelope mode.
+type AWSKMS struct {
+	client kmsAPI
+	keyID  string
+}
+
+// NewAWSKMS creates an AWSKMS client for the configured key.
+func NewAWSKMS(ctx context.Context, cfg AWSKMSConfig) (*AWSKMS, error) {
+	if cfg.KeyID == "" {
+		return nil, errors.New("aws kms key ID is required")
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	var kmsOpts []func(*kms.Options)
+	if cfg.Endpoint != "" {
+		kmsOpts = append(kmsOpts, func(o *kms.Options) {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		})
+	}
+
+	return &AWSKMS{client: kms.NewFromConfig(awsCfg, kmsOpts...), keyID: cfg.KeyID}, nil
+}
+
+// Encrypt encrypts plaintext with the KMS key and returns "awskms:<base64 blob>".
+func (k *AWSKMS) Encrypt(plaintext string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+
+	blob, err := k.WrapKey(ctx, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return awsKMSPrefix + base64.StdEncoding.EncodeToString(blob), nil
+}
+
+// Decrypt decrypts a ciphertext written by Encrypt.
+func (k *AWSKMS) Decrypt(ciphertext string) (string, error) {
+	encoded, ok := strings.CutPrefix(ciphertext, awsKMSPrefix)
+	if !ok {
+		return "", errors.New("not an aws kms ciphertext")
+	}
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+
+	plaintext, err := k.UnwrapKey(ctx, blob)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// WrapKey encrypts a data key for envelope mode.
+func (k *AWSKMS) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	out, err := k.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(k.keyID),
+		Plaintext: dataKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aws kms encrypt failed: %w", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey. The ciphertext blob
+// identifies the key, so blobs from a previous key still decrypt as long as
+// the gateway may use that key.
+func (k *AWSKMS) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	out, err := k.client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("aws kms decrypt failed: %w", err)
+	}
+	return out.Plaintext, nil
+}
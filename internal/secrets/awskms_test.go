@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// fakeKMS mimics AWS KMS by prefixing plaintexts with the key ID.
+type fakeKMS struct {
+	keyID string
+}
+
+func (f *fakeKMS) Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	if aws.ToString(params.KeyId) != f.keyID {
+		return nil, errors.New("NotFoundException")
+	}
+	blob := append([]byte(f.keyID+"|"), params.Plaintext...)
+	return &kms.EncryptOutput{CiphertextBlob: blob, KeyId: params.KeyId}, nil
+}
+
+func (f *fakeKMS) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	keyID, plaintext, ok := bytes.Cut(params.CiphertextBlob, []byte("|"))
+	if !ok || string(keyID) != f.keyID {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+	return &kms.DecryptOutput{Plaintext: plaintext, KeyId: aws.String(string(keyID))}, nil
+}
+
+func TestAWSKMS_EncryptDecrypt(t *testing.T) {
+	store := &AWSKMS{client: &fakeKMS{keyID: "alias/majordomo"}, keyID: "alias/majordomo"}
+
+	encrypted, err := store.Encrypt("sk-aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "awskms:") {
+		t.Fatalf("ciphertext = %q", encrypted)
+	}
+	if got, err := store.Decrypt(encrypted); err != nil || got != "sk-aws" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+	if _, err := store.Decrypt("vault:v1:abc"); err == nil {
+		t.Error("expected error for a non-kms ciphertext")
+	}
+
+	other := &AWSKMS{client: &fakeKMS{keyID: "alias/other"}, keyID: "alias/other"}
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Error("expected error decrypting with a different key")
+	}
+}
+
+func TestAWSKMS_AsEnvelopeKMS(t *testing.T) {
+	k, err := NewKeyring(nil, "", &AWSKMS{client: &fakeKMS{keyID: "alias/majordomo"}, keyID: "alias/majordomo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := k.Encrypt("sk-envelope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Decrypt(encrypted); err != nil || got != "sk-envelope" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+}
+
+func TestNewAWSKMS_RequiresKeyID(t *testing.T) {
+	if _, err := NewAWSKMS(context.Background(), AWSKMSConfig{Region: "us-east-1"}); err == nil {
+		t.Error("expected error without a key ID")
+	}
+}
@@ -0,0 +1,192 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// LegacyKeyID is the key ID of secrets.encryption_key. Ciphertexts written
+// before key IDs existed have no prefix and are decrypted with this key.
+const LegacyKeyID = "default"
+
+// envelopePrefix marks ciphertexts whose data key is wrapped by a KMS.
+const envelopePrefix = "envelope"
+
+var keyIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ErrUnknownKey is returned when a ciphertext references a key that isn't configured.
+var ErrUnknownKey = errors.New("ciphertext was encrypted with an unknown key")
+
+// Keyring is a SecretStore holding several AES-256 keys. New secrets are
+// encrypted with the active key and prefixed with its ID ("<key-id>:..."),
+// so older keys can stay configured for decryption while secrets are
+// re-encrypted.
+//
+// With a KMS, the keyring is in envelope mode: each secret is encrypted with
+// a fresh data key, which is wrapped by the KMS and stored alongside it
+// ("envelope:<wrapped-key>:<ciphertext>"). The AES keys are then only used to
+// decrypt secrets written before envelope mode was enabled.
+type Keyring struct {
+	keys     map[string]*AESStore
+	activeID string
+	kms      KMS
+}
+
+// NewKeyring creates a Keyring from hex-encoded or base64-encoded 32-byte
+// keys by ID. activeID selects the encryption key and is required unless kms
+// is set.
+func NewKeyring(keys map[string]string, activeID string, kms KMS) (*Keyring, error) {
+	k := &Keyring{
+		keys:     make(map[string]*AESStore, len(keys)),
+		activeID: activeID,
+		kms:      kms,
+	}
+
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) || id == envelopePrefix {
+			return nil, fmt.Errorf("invalid key ID %q: use lowercase letters, digits, '-' and '_'", id)
+		}
+		store, err := NewAESStore(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.keys[id] = store
+	}
+
+	if kms == nil {
+		if activeID == "" {
+			return nil, errors.New("an active encryption key is required")
+		}
+		if _, ok := k.keys[activeID]; !ok {
+			return nil, fmt.Errorf("active key %q is not configured", activeID)
+		}
+	}
+
+	return k, nil
+}
+
+// Encrypt encrypts plaintext with the active key, or with a new data key in
+// envelope mode.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k.kms != nil {
+		return k.encryptEnvelope(plaintext)
+	}
+
+	encrypted, err := k.keys[k.activeID].Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return k.activeID + ":" + encrypted, nil
+}
+
+// Decrypt decrypts a ciphertext written by any configured key, by envelope
+// mode, or by a plain AESStore using the legacy key.
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	keyID, payload, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		// Unprefixed ciphertext from before key IDs
+		keyID, payload = LegacyKeyID, ciphertext
+	}
+
+	if keyID == envelopePrefix {
+		return k.decryptEnvelope(payload)
+	}
+
+	store, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return store.Decrypt(payload)
+}
+
+// NeedsRotation reports whether ciphertext was not written with the active
+// key (or, in envelope mode, is not an envelope).
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	keyID, _, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		return true
+	}
+	if k.kms != nil {
+		return keyID != envelopePrefix
+	}
+	return keyID != k.activeID
+}
+
+// Rotate re-encrypts ciphertext with the active key if it needs rotation.
+// It returns the new ciphertext and whether it changed.
+func (k *Keyring) Rotate(ciphertext string) (string, bool, error) {
+	if !k.NeedsRotation(ciphertext) {
+		return ciphertext, false, nil
+	}
+
+	plaintext, err := k.Decrypt(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+	rotated, err := k.Encrypt(plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return rotated, true, nil
+}
+
+func (k *Keyring) encryptEnvelope(plaintext string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+
+	wrapped, err := k.kms.WrapKey(ctx, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	sealed, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) decryptEnvelope(payload string) (string, error) {
+	if k.kms == nil {
+		return "", errors.New("envelope ciphertext requires secrets.mode: envelope")
+	}
+
+	wrappedB64, sealedB64, ok := strings.Cut(payload, ":")
+	if !ok {
+		return "", errors.New("malformed envelope ciphertext")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedB64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode wrapped data key: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(sealedB64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+
+	dataKey, err := k.kms.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
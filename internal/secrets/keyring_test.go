@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const otherKey = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+func TestNewKeyring_Validation(t *testing.T) {
+	if _, err := NewKeyring(map[string]string{"k1": testKey()}, "", nil); err == nil {
+		t.Error("expected error without an active key")
+	}
+	if _, err := NewKeyring(map[string]string{"k1": testKey()}, "k2", nil); err == nil {
+		t.Error("expected error for an active key that isn't configured")
+	}
+	if _, err := NewKeyring(map[string]string{"Bad:ID": testKey()}, "Bad:ID", nil); err == nil {
+		t.Error("expected error for an invalid key ID")
+	}
+	if _, err := NewKeyring(map[string]string{"envelope": testKey()}, "envelope", nil); err == nil {
+		t.Error("expected error for the reserved envelope key ID")
+	}
+	if _, err := NewKeyring(map[string]string{"k1": "too-short"}, "k1", nil); err == nil {
+		t.Error("expected error for an invalid key")
+	}
+}
+
+func TestKeyring_EncryptPrefixesActiveKey(t *testing.T) {
+	k, err := NewKeyring(map[string]string{"k1": testKey(), "k2": otherKey}, "k2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := k.Encrypt("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "k2:") {
+		t.Fatalf("ciphertext %q does not start with the active key ID", encrypted)
+	}
+
+	decrypted, err := k.Decrypt(encrypted)
+	if err != nil || decrypted != "sk-test" {
+		t.Fatalf("Decrypt = %q, %v", decrypted, err)
+	}
+}
+
+func TestKeyring_DecryptsOlderKeysAndLegacyCiphertexts(t *testing.T) {
+	legacy, _ := NewAESStore(testKey())
+	unprefixed, err := legacy.Encrypt("legacy-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, _ := NewKeyring(map[string]string{"k1": otherKey}, "k1", nil)
+	prefixed, _ := old.Encrypt("old-secret")
+
+	k, err := NewKeyring(map[string]string{LegacyKeyID: testKey(), "k1": otherKey, "k2": testKey()}, "k2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := k.Decrypt(unprefixed); err != nil || got != "legacy-secret" {
+		t.Errorf("legacy Decrypt = %q, %v", got, err)
+	}
+	if got, err := k.Decrypt(prefixed); err != nil || got != "old-secret" {
+		t.Errorf("k1 Decrypt = %q, %v", got, err)
+	}
+
+	withoutOld, _ := NewKeyring(map[string]string{"k2": testKey()}, "k2", nil)
+	if _, err := withoutOld.Decrypt(prefixed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with removed key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	old, _ := NewKeyring(map[string]string{"k1": testKey()}, "k1", nil)
+	encrypted, _ := old.Encrypt("sk-rotate")
+
+	k, _ := NewKeyring(map[string]string{"k1": testKey(), "k2": otherKey}, "k2", nil)
+
+	rotated, changed, err := k.Rotate(encrypted)
+	if err != nil || !changed {
+		t.Fatalf("Rotate = %v, %v", changed, err)
+	}
+	if !strings.HasPrefix(rotated, "k2:") {
+		t.Errorf("rotated ciphertext %q not under active key", rotated)
+	}
+	if got, _ := k.Decrypt(rotated); got != "sk-rotate" {
+		t.Errorf("rotated plaintext = %q", got)
+	}
+
+	again, changed, err := k.Rotate(rotated)
+	if err != nil || changed || again != rotated {
+		t.Errorf("second Rotate = %q, %v, %v; want unchanged", again, changed, err)
+	}
+}
+
+func writeKeyFile(t *testing.T, key string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kms.key")
+	if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeyring_Envelope(t *testing.T) {
+	kms, err := NewLocalKMS(writeKeyFile(t, otherKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	direct, _ := NewKeyring(map[string]string{"k1": testKey()}, "k1", nil)
+	directCiphertext, _ := direct.Encrypt("sk-direct")
+
+	k, err := NewKeyring(map[string]string{"k1": testKey()}, "", kms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := k.Encrypt("sk-envelope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "envelope:") {
+		t.Fatalf("ciphertext %q is not an envelope", encrypted)
+	}
+	if got, err := k.Decrypt(encrypted); err != nil || got != "sk-envelope" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+
+	// Direct ciphertexts still decrypt and are rotated into envelopes
+	if !k.NeedsRotation(directCiphertext) || k.NeedsRotation(encrypted) {
+		t.Error("NeedsRotation should only be true for the direct ciphertext")
+	}
+	rotated, changed, err := k.Rotate(directCiphertext)
+	if err != nil || !changed || !strings.HasPrefix(rotated, "envelope:") {
+		t.Fatalf("Rotate = %q, %v, %v", rotated, changed, err)
+	}
+
+	// A different KMS key can't unwrap the data key
+	otherKMS, _ := NewLocalKMS(writeKeyFile(t, testKey()))
+	other, _ := NewKeyring(nil, "", otherKMS)
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Error("expected error unwrapping with a different KMS key")
+	}
+
+	// Envelopes can't be read without a KMS
+	if _, err := direct.Decrypt(encrypted); err == nil {
+		t.Error("expected error decrypting an envelope without a KMS")
+	}
+}
+
+func TestNewLocalKMS_InvalidFile(t *testing.T) {
+	if _, err := NewLocalKMS(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for a missing key file")
+	}
+	if _, err := NewLocalKMS(writeKeyFile(t, "not-a-key")); err == nil {
+		t.Error("expected error for an invalid key file")
+	}
+}
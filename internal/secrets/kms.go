@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KMS wraps and unwraps data keys with a key encryption key that is held by
+// the KMS. In envelope mode each secret is encrypted with its own data key,
+// and only the wrapped data key is stored next to it.
+type KMS interface {
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// LocalKMS is a KMS backed by a key file on local disk. It is meant for
+// development and tests; the key file must be protected like any other
+// secret.
+type LocalKMS struct {
+	key []byte
+}
+
+// NewLocalKMS reads a hex-encoded or base64-encoded 32-byte key from path.
+func NewLocalKMS(path string) (*LocalKMS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KMS key file: %w", err)
+	}
+
+	key, err := parseKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMS key file %s: %w", path, err)
+	}
+
+	return &LocalKMS{key: key}, nil
+}
+
+// WrapKey encrypts a data key with AES-256-GCM.
+func (k *LocalKMS) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return seal(k.key, dataKey)
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey.
+func (k *LocalKMS) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return open(k.key, wrapped)
+}
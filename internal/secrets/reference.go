@@ -0,0 +1,240 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidReference is returned for values that aren't a supported secret reference.
+var ErrInvalidReference = errors.New("invalid secret reference (expected vault://<mount>/<path>#<field>, env://<NAME> or file:///<path>)")
+
+// ErrReferenceNotAllowed is returned for references outside the configured
+// allowlist. It is returned before anything is read, so it says nothing about
+// whether the secret exists.
+var ErrReferenceNotAllowed = errors.New("secret reference is not in the allowed environment variables, files or vault paths")
+
+// ReferencePolicy lists what references may point to. A reference is
+// allowed if it matches any entry for its scheme; a scheme with no entries
+// allows nothing.
+type ReferencePolicy struct {
+	EnvPrefixes []string // env:// variables whose names start with one of these
+	FileDirs    []string // file:// paths in one of these directories or below
+	VaultPaths  []string // vault:// secrets at or below one of these <mount>/<path> prefixes
+}
+
+// allowsEnv reports whether the environment variable name may be read
+func (p ReferencePolicy) allowsEnv(name string) bool {
+	for _, prefix := range p.EnvPrefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsFile reports whether the file at path may be read. Symlinks are
+// followed before checking, so a link can't lead out of an allowed directory.
+func (p ReferencePolicy) allowsFile(path string) bool {
+	if !p.inFileDirs(filepath.Clean(path)) {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// Let the read report the error; the path is in an allowed directory
+		return true
+	}
+	return p.inFileDirs(resolved)
+}
+
+func (p ReferencePolicy) inFileDirs(path string) bool {
+	for _, dir := range p.FileDirs {
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			if underDir(path, resolved) {
+				return true
+			}
+		}
+		if underDir(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func underDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../") && !filepath.IsAbs(rel)
+}
+
+// allowsVault reports whether the secret at mount/path may be read. Vault
+// doesn't see the path cleaned, so paths with empty, . or .. segments, which
+// could lead out of an allowed prefix, are never allowed.
+func (p ReferencePolicy) allowsVault(mount, path string) bool {
+	secret := strings.Split(mount+"/"+strings.Trim(path, "/"), "/")
+	for _, segment := range secret {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	for _, allowed := range p.VaultPaths {
+		prefix := strings.Split(strings.Trim(allowed, "/"), "/")
+		if prefix[0] == "" || len(prefix) > len(secret) {
+			continue
+		}
+		match := true
+		for i := range prefix {
+			if prefix[i] != secret[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+type cachedSecret struct {
+	value     string
+	expiresAt time.Time
+}
+
+// ReferenceStore is a SecretStore for deployments where provider keys must
+// not be stored in the gateway database, even encrypted. Provider mappings
+// hold a reference instead of a ciphertext, which is resolved when a request
+// needs it:
+//
+//	vault://kv/openai#api_key   field "api_key" of KV v2 secret "openai" in mount "kv"
+//	env://OPENAI_API_KEY        environment variable
+//	file:///run/secrets/openai  file contents, trimmed
+//
+// Only references allowed by the store's ReferencePolicy are resolved.
+// Resolved values are cached for the configured TTL.
+type ReferenceStore struct {
+	vault  *vaultClient // nil when vault:// references aren't configured
+	ttl    time.Duration
+	policy ReferencePolicy
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+// NewReferenceStore creates a ReferenceStore that resolves the references
+// policy allows. vault may be nil to disable vault:// references.
+func NewReferenceStore(vault *VaultConfig, cacheTTL time.Duration, policy ReferencePolicy) (*ReferenceStore, error) {
+	s := &ReferenceStore{
+		ttl:    cacheTTL,
+		policy: policy,
+		cache:  make(map[string]cachedSecret),
+	}
+	if vault != nil {
+		client, err := newVaultClient(*vault)
+		if err != nil {
+			return nil, err
+		}
+		s.vault = client
+	}
+	return s, nil
+}
+
+// Encrypt checks that reference resolves and returns it unchanged; the
+// reference itself is what gets stored.
+func (s *ReferenceStore) Encrypt(reference string) (string, error) {
+	if _, err := s.Decrypt(reference); err != nil {
+		return "", err
+	}
+	return reference, nil
+}
+
+// Decrypt resolves a reference to the secret it points to.
+func (s *ReferenceStore) Decrypt(reference string) (string, error) {
+	s.mu.Lock()
+	if cached, ok := s.cache[reference]; ok && time.Now().Before(cached.expiresAt) {
+		s.mu.Unlock()
+		return cached.value, nil
+	}
+	s.mu.Unlock()
+
+	value, err := s.resolve(reference)
+	if err != nil {
+		return "", err
+	}
+
+	if s.ttl > 0 {
+		s.mu.Lock()
+		s.cache[reference] = cachedSecret{value: value, expiresAt: time.Now().Add(s.ttl)}
+		s.mu.Unlock()
+	}
+	return value, nil
+}
+
+func (s *ReferenceStore) resolve(reference string) (string, error) {
+	u, err := url.Parse(reference)
+	if err != nil || u.Opaque != "" {
+		return "", ErrInvalidReference
+	}
+
+	var value string
+	switch u.Scheme {
+	case "env":
+		if u.Host == "" || u.Path != "" {
+			return "", ErrInvalidReference
+		}
+		if !s.policy.allowsEnv(u.Host) {
+			return "", ErrReferenceNotAllowed
+		}
+		value = os.Getenv(u.Host)
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", u.Host)
+		}
+
+	case "file":
+		if u.Host != "" || u.Path == "" {
+			return "", ErrInvalidReference
+		}
+		if !s.policy.allowsFile(u.Path) {
+			return "", ErrReferenceNotAllowed
+		}
+		data, err := os.ReadFile(u.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		value = strings.TrimSpace(string(data))
+
+	case "vault":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" || u.Fragment == "" {
+			return "", ErrInvalidReference
+		}
+		if !s.policy.allowsVault(u.Host, u.Path) {
+			return "", ErrReferenceNotAllowed
+		}
+		if s.vault == nil {
+			return "", errors.New("vault:// references require secrets.vault to be configured")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+		defer cancel()
+		value, err = s.vault.readKV(ctx, u.Host, u.Path, u.Fragment)
+		if err != nil {
+			return "", err
+		}
+
+	default:
+		return "", ErrInvalidReference
+	}
+
+	if value == "" {
+		return "", fmt.Errorf("secret reference %s resolved to an empty value", reference)
+	}
+	return value, nil
+}
@@ -1,7 +1,18 @@
 package secrets
 
+import "time"
+
+// backendTimeout bounds a single call to a KMS or external secret backend.
+const backendTimeout = 10 * time.Second
+
 // SecretStore provides encryption and decryption of sensitive values.
 type SecretStore interface {
 	Encrypt(plaintext string) (string, error)
 	Decrypt(ciphertext string) (string, error)
 }
+
+// Rotator is implemented by secret stores that can re-encrypt a stored value
+// under their current key. It returns the new value and whether it changed.
+type Rotator interface {
+	Rotate(ciphertext string) (string, bool, error)
+}
@@ -0,0 +1,201 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// VaultConfig holds connection settings for HashiCorp Vault.
+type VaultConfig struct {
+	Address   string
+	Token     string
+	Namespace string
+}
+
+// vaultClient is a minimal client for the Vault HTTP API.
+type vaultClient struct {
+	address   string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+func newVaultClient(cfg VaultConfig) (*vaultClient, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("vault token is required")
+	}
+	return &vaultClient{
+		address:   strings.TrimRight(cfg.Address, "/"),
+		token:     cfg.Token,
+		namespace: cfg.Namespace,
+		http:      &http.Client{Timeout: backendTimeout},
+	}, nil
+}
+
+// do sends a request to /v1/<path> and decodes the response's "data" field into out.
+func (c *vaultClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+"/v1/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return fmt.Errorf("vault %s %s returned %d: %s", method, path, resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+	}
+
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+// VaultTransit encrypts secrets with a Vault Transit key, so the key material
+// never leaves Vault. Ciphertexts are Vault's own "vault:v<N>:..." strings.
+// It can be used directly as a SecretStore or as the KMS in envelope mode.
+type VaultTransit struct {
+	client *vaultClient
+	mount  string
+	key    string
+}
+
+// NewVaultTransit creates a VaultTransit using the named key under a Transit
+// secrets engine mount (usually "transit").
+func NewVaultTransit(cfg VaultConfig, mount, key string) (*VaultTransit, error) {
+	client, err := newVaultClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if mount == "" || key == "" {
+		return nil, errors.New("vault transit mount and key are required")
+	}
+	return &VaultTransit{client: client, mount: strings.Trim(mount, "/"), key: key}, nil
+}
+
+// Encrypt encrypts plaintext with the latest version of the Transit key.
+func (v *VaultTransit) Encrypt(plaintext string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+	return v.encrypt(ctx, []byte(plaintext))
+}
+
+// Decrypt decrypts a Transit ciphertext.
+func (v *VaultTransit) Decrypt(ciphertext string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+	plaintext, err := v.decrypt(ctx, ciphertext)
+	return string(plaintext), err
+}
+
+// WrapKey encrypts a data key for envelope mode.
+func (v *VaultTransit) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	ciphertext, err := v.encrypt(ctx, dataKey)
+	return []byte(ciphertext), err
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey.
+func (v *VaultTransit) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return v.decrypt(ctx, string(wrapped))
+}
+
+// Rotate rewraps ciphertext with the latest version of the Transit key
+// without exposing the plaintext to the gateway.
+func (v *VaultTransit) Rotate(ciphertext string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := v.client.do(ctx, http.MethodPost, v.mount+"/rewrap/"+v.key, map[string]string{"ciphertext": ciphertext}, &out)
+	if err != nil {
+		return "", false, err
+	}
+	return out.Ciphertext, out.Ciphertext != ciphertext, nil
+}
+
+func (v *VaultTransit) encrypt(ctx context.Context, plaintext []byte) (string, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := v.client.do(ctx, http.MethodPost, v.mount+"/encrypt/"+v.key, map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	}, &out)
+	if err != nil {
+		return "", err
+	}
+	return out.Ciphertext, nil
+}
+
+func (v *VaultTransit) decrypt(ctx context.Context, ciphertext string) ([]byte, error) {
+	if !strings.HasPrefix(ciphertext, "vault:") {
+		return nil, errors.New("not a vault transit ciphertext")
+	}
+
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	err := v.client.do(ctx, http.MethodPost, v.mount+"/decrypt/"+v.key, map[string]string{"ciphertext": ciphertext}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+// readKV reads one field of a secret from a KV version 2 mount.
+func (c *vaultClient) readKV(ctx context.Context, mount, path, field string) (string, error) {
+	var out struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, strings.Trim(mount, "/")+"/data/"+strings.Trim(path, "/"), nil, &out); err != nil {
+		return "", err
+	}
+
+	value, ok := out.Data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in %s/%s", field, mount, path)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q in %s/%s is not a string", field, mount, path)
+	}
+	return s, nil
+}
@@ -0,0 +1,350 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fakeVaultToken = "test-token"
+
+// fakeVault is a stand-in for a Vault dev server with a Transit engine at
+// "transit" and a KV v2 engine at "kv". Transit "ciphertexts" are just the
+// base64 plaintext tagged with the key version.
+type fakeVault struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	keyVersion int
+	kv         map[string]map[string]interface{}
+	kvReads    int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	t.Helper()
+	v := &fakeVault{keyVersion: 1, kv: make(map[string]map[string]interface{})}
+	v.Server = httptest.NewServer(http.HandlerFunc(v.handle))
+	t.Cleanup(v.Close)
+	return v
+}
+
+func (v *fakeVault) config() VaultConfig {
+	return VaultConfig{Address: v.URL, Token: fakeVaultToken}
+}
+
+func (v *fakeVault) rotateKey() {
+	v.mu.Lock()
+	v.keyVersion++
+	v.mu.Unlock()
+}
+
+func (v *fakeVault) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != fakeVaultToken {
+		vaultError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var body map[string]string
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "transit/encrypt/majordomo":
+		vaultData(w, map[string]string{"ciphertext": fmt.Sprintf("vault:v%d:%s", v.keyVersion, body["plaintext"])})
+
+	case path == "transit/decrypt/majordomo" || path == "transit/rewrap/majordomo":
+		var version int
+		var payload string
+		if _, err := fmt.Sscanf(strings.Replace(body["ciphertext"], ":", " ", 2), "vault v%d %s", &version, &payload); err != nil || version > v.keyVersion {
+			vaultError(w, http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		if strings.HasPrefix(path, "transit/decrypt") {
+			vaultData(w, map[string]string{"plaintext": payload})
+		} else {
+			vaultData(w, map[string]string{"ciphertext": fmt.Sprintf("vault:v%d:%s", v.keyVersion, payload)})
+		}
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "kv/data/"):
+		v.kvReads++
+		secret, ok := v.kv[strings.TrimPrefix(path, "kv/data/")]
+		if !ok {
+			vaultError(w, http.StatusNotFound, "")
+			return
+		}
+		vaultData(w, map[string]interface{}{"data": secret, "metadata": map[string]int{"version": 1}})
+
+	default:
+		vaultError(w, http.StatusNotFound, "unsupported path "+path)
+	}
+}
+
+func vaultData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func vaultError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	errs := []string{}
+	if msg != "" {
+		errs = append(errs, msg)
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"errors": errs})
+}
+
+func TestVaultTransit_EncryptDecrypt(t *testing.T) {
+	vault := newFakeVault(t)
+	store, err := NewVaultTransit(vault.config(), "transit", "majordomo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := store.Encrypt("sk-vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "vault:v1:") {
+		t.Fatalf("ciphertext = %q", encrypted)
+	}
+	if got, err := store.Decrypt(encrypted); err != nil || got != "sk-vault" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+
+	if _, err := store.Decrypt("default:abc"); err == nil {
+		t.Error("expected error for a non-transit ciphertext")
+	}
+}
+
+func TestVaultTransit_Rotate(t *testing.T) {
+	vault := newFakeVault(t)
+	store, _ := NewVaultTransit(vault.config(), "transit", "majordomo")
+
+	encrypted, _ := store.Encrypt("sk-vault")
+	if _, changed, err := store.Rotate(encrypted); err != nil || changed {
+		t.Fatalf("Rotate before key rotation = %v, %v", changed, err)
+	}
+
+	vault.rotateKey()
+	rotated, changed, err := store.Rotate(encrypted)
+	if err != nil || !changed || !strings.HasPrefix(rotated, "vault:v2:") {
+		t.Fatalf("Rotate = %q, %v, %v", rotated, changed, err)
+	}
+	if got, _ := store.Decrypt(rotated); got != "sk-vault" {
+		t.Errorf("rotated plaintext = %q", got)
+	}
+}
+
+func TestVaultTransit_AsEnvelopeKMS(t *testing.T) {
+	vault := newFakeVault(t)
+	transit, _ := NewVaultTransit(vault.config(), "transit", "majordomo")
+
+	k, err := NewKeyring(nil, "", transit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := k.Encrypt("sk-envelope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Decrypt(encrypted); err != nil || got != "sk-envelope" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+}
+
+func TestVaultTransit_BadToken(t *testing.T) {
+	vault := newFakeVault(t)
+	cfg := vault.config()
+	cfg.Token = "wrong"
+	store, _ := NewVaultTransit(cfg, "transit", "majordomo")
+
+	_, err := store.Encrypt("sk-vault")
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("Encrypt with bad token = %v", err)
+	}
+}
+
+func TestNewVaultTransit_Validation(t *testing.T) {
+	if _, err := NewVaultTransit(VaultConfig{Token: "t"}, "transit", "k"); err == nil {
+		t.Error("expected error without an address")
+	}
+	if _, err := NewVaultTransit(VaultConfig{Address: "http://vault"}, "transit", "k"); err == nil {
+		t.Error("expected error without a token")
+	}
+	if _, err := NewVaultTransit(VaultConfig{Address: "http://vault", Token: "t"}, "transit", ""); err == nil {
+		t.Error("expected error without a key")
+	}
+}
+
+func TestReferenceStore_Vault(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.kv["openai"] = map[string]interface{}{"api_key": "sk-from-kv", "count": 3}
+	cfg := vault.config()
+
+	store, err := NewReferenceStore(&cfg, 0, ReferencePolicy{VaultPaths: []string{"kv"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := store.Decrypt("vault://kv/openai#api_key"); err != nil || got != "sk-from-kv" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+	for _, ref := range []string{"vault://kv/openai#missing", "vault://kv/openai#count", "vault://kv/other#api_key"} {
+		if _, err := store.Decrypt(ref); err == nil {
+			t.Errorf("expected error resolving %s", ref)
+		}
+	}
+
+	withoutVault, _ := NewReferenceStore(nil, 0, ReferencePolicy{VaultPaths: []string{"kv"}})
+	if _, err := withoutVault.Decrypt("vault://kv/openai#api_key"); err == nil {
+		t.Error("expected error for vault reference without vault config")
+	}
+}
+
+func TestReferenceStore_Caching(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.kv["openai"] = map[string]interface{}{"api_key": "sk-cached"}
+	cfg := vault.config()
+
+	store, _ := NewReferenceStore(&cfg, time.Hour, ReferencePolicy{VaultPaths: []string{"kv/openai"}})
+	for i := 0; i < 3; i++ {
+		if got, err := store.Decrypt("vault://kv/openai#api_key"); err != nil || got != "sk-cached" {
+			t.Fatalf("Decrypt = %q, %v", got, err)
+		}
+	}
+	if vault.kvReads != 1 {
+		t.Errorf("vault reads = %d, want 1", vault.kvReads)
+	}
+}
+
+func TestReferenceStore_EnvAndFile(t *testing.T) {
+	t.Setenv("MAJORDOMO_TEST_PROVIDER_KEY", "sk-from-env")
+	path := writeKeyFile(t, "sk-from-file")
+
+	store, _ := NewReferenceStore(nil, 0, ReferencePolicy{
+		EnvPrefixes: []string{"MAJORDOMO_TEST_"},
+		FileDirs:    []string{filepath.Dir(path)},
+	})
+
+	if got, err := store.Decrypt("env://MAJORDOMO_TEST_PROVIDER_KEY"); err != nil || got != "sk-from-env" {
+		t.Errorf("env Decrypt = %q, %v", got, err)
+	}
+	if got, err := store.Decrypt("file://" + path); err != nil || got != "sk-from-file" {
+		t.Errorf("file Decrypt = %q, %v", got, err)
+	}
+
+	// Encrypt stores the reference itself after checking it resolves
+	if got, err := store.Encrypt("env://MAJORDOMO_TEST_PROVIDER_KEY"); err != nil || got != "env://MAJORDOMO_TEST_PROVIDER_KEY" {
+		t.Errorf("Encrypt = %q, %v", got, err)
+	}
+	for _, ref := range []string{"sk-raw-key", "env://MAJORDOMO_TEST_UNSET", "file:///does/not/exist", "https://example.com"} {
+		if _, err := store.Encrypt(ref); err == nil {
+			t.Errorf("expected error for %q", ref)
+		}
+	}
+}
+
+func TestReferenceStore_Allowlist(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.kv["providers/openai"] = map[string]interface{}{"api_key": "sk-allowed"}
+	vault.kv["gateway/jwt"] = map[string]interface{}{"secret": "jwt-secret"}
+	cfg := vault.config()
+
+	t.Setenv("MAJORDOMO_PROVIDER_OPENAI", "sk-from-env")
+	t.Setenv("MAJORDOMO_JWT_SECRET", "jwt-secret")
+
+	dir := t.TempDir()
+	allowedDir := filepath.Join(dir, "providers")
+	if err := os.Mkdir(allowedDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	allowedFile := filepath.Join(allowedDir, "openai")
+	otherFile := filepath.Join(dir, "other")
+	for _, path := range []string{allowedFile, otherFile} {
+		if err := os.WriteFile(path, []byte("sk-from-file"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A link inside the allowed directory to a file outside it
+	link := filepath.Join(allowedDir, "link")
+	if err := os.Symlink(otherFile, link); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewReferenceStore(&cfg, 0, ReferencePolicy{
+		EnvPrefixes: []string{"MAJORDOMO_PROVIDER_"},
+		FileDirs:    []string{allowedDir},
+		VaultPaths:  []string{"kv/providers"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{
+		"env://MAJORDOMO_PROVIDER_OPENAI",
+		"file://" + allowedFile,
+		"vault://kv/providers/openai#api_key",
+	} {
+		if _, err := store.Encrypt(ref); err != nil {
+			t.Errorf("Encrypt(%q) = %v, want allowed", ref, err)
+		}
+	}
+
+	for _, ref := range []string{
+		"env://MAJORDOMO_JWT_SECRET",
+		"env://MAJORDOMO_PROVIDER", // shorter than the prefix
+		"env://UNSET_VARIABLE",
+		"file://" + otherFile,
+		"file://" + allowedDir + "/../other",
+		"file://" + link,
+		"file:///proc/self/environ",
+		"file:///does/not/exist",
+		"vault://kv/gateway/jwt#secret",
+		"vault://kv/providersx/openai#api_key",
+		"vault://secret/providers/openai#api_key",
+		"vault://kv/providers/../gateway/jwt#secret",
+		"vault://kv/providers/openai/../../gateway/jwt#secret",
+		"vault://kv/providers/./openai#api_key",
+		"vault://kv/providers//openai#api_key",
+	} {
+		if _, err := store.Encrypt(ref); !errors.Is(err, ErrReferenceNotAllowed) {
+			t.Errorf("Encrypt(%q) = %v, want ErrReferenceNotAllowed", ref, err)
+		}
+		if _, err := store.Decrypt(ref); !errors.Is(err, ErrReferenceNotAllowed) {
+			t.Errorf("Decrypt(%q) = %v, want ErrReferenceNotAllowed", ref, err)
+		}
+	}
+	if vault.kvReads != 1 {
+		t.Errorf("vault reads = %d, want 1 (only the allowed secret)", vault.kvReads)
+	}
+
+	// Without an allowlist, no references resolve
+	none, _ := NewReferenceStore(&cfg, 0, ReferencePolicy{})
+	if _, err := none.Decrypt("env://MAJORDOMO_PROVIDER_OPENAI"); !errors.Is(err, ErrReferenceNotAllowed) {
+		t.Errorf("Decrypt without allowlist = %v, want ErrReferenceNotAllowed", err)
+	}
+}
+
+func TestVaultClient_CancelledContext(t *testing.T) {
+	vault := newFakeVault(t)
+	client, _ := newVaultClient(vault.config())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.readKV(ctx, "kv", "openai", "api_key"); err == nil {
+		t.Error("expected error for cancelled context")
+	}
+}
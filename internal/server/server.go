@@ -12,7 +12,10 @@ import (
 	"github.com/superset-studio/majordomo-gateway/internal/api"
 	"github.com/superset-studio/majordomo-gateway/internal/auth"
 	"github.com/superset-studio/majordomo-gateway/internal/config"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
 	"github.com/superset-studio/majordomo-gateway/internal/proxy"
+	"github.com/superset-studio/majordomo-gateway/internal/storage"
+	"github.com/superset-studio/majordomo-gateway/internal/upstream"
 )
 
 // HealthChecker can verify that a backing resource is reachable.
@@ -20,23 +23,55 @@ type HealthChecker interface {
 	Ping(ctx context.Context) error
 }
 
+// WriterStatsReporter is implemented by storage backends that expose request
+// log writer counters. When the health checker implements it, /readyz includes
+// the counters in its response.
+type WriterStatsReporter interface {
+	Stats() storage.WriterStats
+}
+
+// SchemaVersionReporter is implemented by storage backends with versioned
+// migrations. When the health checker implements it, /readyz reports not
+// ready until the database schema is at the version this binary expects.
+type SchemaVersionReporter interface {
+	SchemaVersion(ctx context.Context) (current int, expected int, err error)
+}
+
+// UpstreamStatusReporter reports the health of each provider's endpoints.
+// /readyz includes it, but never fails because of it: every replica shares
+// the same upstreams, so taking one out of rotation wouldn't help.
+type UpstreamStatusReporter interface {
+	UpstreamStatus() map[string][]upstream.EndpointStatus
+}
+
 type Server struct {
 	httpServer    *http.Server
 	config        *config.ServerConfig
 	healthChecker HealthChecker
+	upstreams     UpstreamStatusReporter
 }
 
 type AdminConfig struct {
-	AdminHandler *api.AdminHandler
-	JWTService   *auth.JWTService
-	CORSOrigins  []string
+	AdminHandler   *api.AdminHandler
+	RoutesHandler  *api.RoutesHandler
+	PromptsHandler *api.PromptsHandler
+	Sessions       *auth.SessionManager
+	Users          storage.UserStorage
+	CORSOrigins    []string
+
+	// OIDCHandler enables single sign-on when set
+	OIDCHandler          *api.OIDCHandler
+	DisablePasswordLogin bool
 }
 
-func New(cfg *config.ServerConfig, proxyHandler *proxy.Handler, checker HealthChecker, apiHandler *api.Handler, resolver *auth.Resolver, adminCfg *AdminConfig) *Server {
+func New(cfg *config.ServerConfig, proxyHandler *proxy.Handler, checker HealthChecker, apiHandler *api.Handler, usageHandler *api.UsageHandler, resolver *auth.Resolver, adminCfg *AdminConfig) *Server {
 	s := &Server{
 		config:        cfg,
 		healthChecker: checker,
 	}
+	if proxyHandler != nil {
+		s.upstreams = proxyHandler
+	}
 
 	router := chi.NewRouter()
 
@@ -51,39 +86,118 @@ func New(cfg *config.ServerConfig, proxyHandler *proxy.Handler, checker HealthCh
 	router.Get("/health", healthHandler)
 	router.Get("/readyz", s.readyzHandler)
 
-	if adminCfg != nil && adminCfg.AdminHandler != nil && adminCfg.JWTService != nil {
+	if adminCfg != nil && adminCfg.AdminHandler != nil && adminCfg.Sessions != nil && adminCfg.Users != nil {
 		router.Route("/api/v1/admin", func(r chi.Router) {
-			r.Post("/login", adminCfg.AdminHandler.Login)
+			if adminCfg.DisablePasswordLogin {
+				r.Post("/login", api.PasswordLoginDisabled)
+			} else {
+				r.Post("/login", adminCfg.AdminHandler.Login)
+			}
+			r.Post("/refresh", adminCfg.AdminHandler.Refresh)
+			if adminCfg.OIDCHandler != nil {
+				r.Get("/oidc/login", adminCfg.OIDCHandler.Login)
+				r.Get("/oidc/callback", adminCfg.OIDCHandler.Callback)
+			}
 			r.Group(func(r chi.Router) {
-				r.Use(api.JWTAuthMiddleware(adminCfg.JWTService))
-				r.Get("/me", adminCfg.AdminHandler.Me)
-				r.Put("/me/password", adminCfg.AdminHandler.ChangePassword)
-				r.Get("/api-keys", adminCfg.AdminHandler.ListAPIKeys)
-				r.Post("/api-keys", adminCfg.AdminHandler.CreateAPIKey)
-				r.Get("/api-keys/{id}", adminCfg.AdminHandler.GetAPIKey)
-				r.Put("/api-keys/{id}", adminCfg.AdminHandler.UpdateAPIKey)
-				r.Delete("/api-keys/{id}", adminCfg.AdminHandler.RevokeAPIKey)
-				r.Get("/api-keys/{id}/proxy-keys", adminCfg.AdminHandler.ListProxyKeys)
-				r.Post("/api-keys/{id}/proxy-keys", adminCfg.AdminHandler.CreateProxyKey)
-				r.Get("/api-keys/{id}/proxy-keys/{pkId}", adminCfg.AdminHandler.GetProxyKey)
-				r.Delete("/api-keys/{id}/proxy-keys/{pkId}", adminCfg.AdminHandler.RevokeProxyKey)
-				r.Get("/api-keys/{id}/proxy-keys/{pkId}/providers", adminCfg.AdminHandler.ListProviderMappings)
-				r.Put("/api-keys/{id}/proxy-keys/{pkId}/providers/{provider}", adminCfg.AdminHandler.SetProviderMapping)
-				r.Delete("/api-keys/{id}/proxy-keys/{pkId}/providers/{provider}", adminCfg.AdminHandler.DeleteProviderMapping)
+				r.Use(api.JWTAuthMiddleware(adminCfg.Sessions, adminCfg.Users))
+				h := adminCfg.AdminHandler
+				can := api.RequirePermission
+
+				r.Post("/logout", h.Logout)
+				r.Get("/me", h.Me)
+				r.Put("/me/password", h.ChangePassword)
+				r.Get("/me/teams", h.MyTeams)
+
+				r.With(can(auth.PermAPIKeysRead)).Get("/api-keys", h.ListAPIKeys)
+				r.With(can(auth.PermAPIKeysWrite)).Post("/api-keys", h.CreateAPIKey)
+				r.With(can(auth.PermAPIKeysRead)).Get("/api-keys/{id}", h.GetAPIKey)
+				r.With(can(auth.PermAPIKeysWrite)).Put("/api-keys/{id}", h.UpdateAPIKey)
+				r.With(can(auth.PermAPIKeysWrite)).Delete("/api-keys/{id}", h.RevokeAPIKey)
+				r.With(can(auth.PermUsageRead)).Get("/api-keys/{id}/usage", h.GetAPIKeyUsage)
+				r.With(can(auth.PermAPIKeysWrite)).Put("/api-keys/{id}/team", h.SetAPIKeyTeam)
+				r.With(can(auth.PermProxyKeysRead)).Get("/api-keys/{id}/proxy-keys", h.ListProxyKeys)
+				r.With(can(auth.PermProxyKeysWrite)).Post("/api-keys/{id}/proxy-keys", h.CreateProxyKey)
+				r.With(can(auth.PermProxyKeysRead)).Get("/api-keys/{id}/proxy-keys/{pkId}", h.GetProxyKey)
+				r.With(can(auth.PermProxyKeysWrite)).Delete("/api-keys/{id}/proxy-keys/{pkId}", h.RevokeProxyKey)
+				r.With(can(auth.PermProxyKeysWrite)).Put("/api-keys/{id}/proxy-keys/{pkId}/single-header-auth", h.SetSingleHeaderAuth)
+				r.With(can(auth.PermProxyKeysRead)).Get("/api-keys/{id}/proxy-keys/{pkId}/providers", h.ListProviderMappings)
+				r.With(can(auth.PermProxyKeysWrite)).Put("/api-keys/{id}/proxy-keys/{pkId}/providers/{provider}", h.SetProviderMapping)
+				r.With(can(auth.PermProxyKeysWrite)).Delete("/api-keys/{id}/proxy-keys/{pkId}/providers/{provider}", h.DeleteProviderMapping)
+
+				r.With(can(auth.PermUsersRead)).Get("/users", h.ListUsers)
+				r.With(can(auth.PermUsersWrite)).Post("/users", h.CreateUser)
+				r.With(can(auth.PermUsersRead)).Get("/users/{userId}", h.GetUser)
+				r.With(can(auth.PermUsersWrite)).Put("/users/{userId}/role", h.SetUserRole)
+				r.With(can(auth.PermUsersWrite)).Put("/users/{userId}/password", h.ResetUserPassword)
+				r.With(can(auth.PermUsersWrite)).Post("/users/{userId}/deactivate", h.DeactivateUser)
+				r.With(can(auth.PermUsersWrite)).Post("/users/{userId}/activate", h.ActivateUser)
+
+				r.With(can(auth.PermTeamsRead)).Get("/organizations", h.ListOrganizations)
+				r.With(can(auth.PermTeamsWrite)).Post("/organizations", h.CreateOrganization)
+				r.With(can(auth.PermTeamsRead)).Get("/organizations/{orgId}/teams", h.ListTeams)
+				r.With(can(auth.PermTeamsWrite)).Post("/organizations/{orgId}/teams", h.CreateTeam)
+				r.With(can(auth.PermTeamsRead), can(auth.PermUsageRead)).Get("/organizations/{orgId}/usage", h.GetOrganizationUsage)
+
+				r.With(can(auth.PermUsageRead), can(auth.PermAllKeys)).Get("/usage/shadow", h.GetShadowUsage)
+
+				r.With(can(auth.PermAuditRead)).Get("/audit-events", h.ListAuditEvents)
+
+				if rh := adminCfg.RoutesHandler; rh != nil {
+					r.With(can(auth.PermRoutesRead)).Get("/routes", rh.ListRoutes)
+					r.With(can(auth.PermRoutesWrite)).Post("/routes", rh.CreateRoute)
+					r.With(can(auth.PermRoutesRead)).Get("/routes/{routeId}", rh.GetRoute)
+					r.With(can(auth.PermRoutesWrite)).Put("/routes/{routeId}", rh.UpdateRoute)
+					r.With(can(auth.PermRoutesWrite)).Delete("/routes/{routeId}", rh.DeleteRoute)
+
+					r.With(can(auth.PermRoutesRead)).Get("/experiments", rh.ListExperiments)
+					r.With(can(auth.PermRoutesWrite)).Post("/experiments", rh.CreateExperiment)
+					r.With(can(auth.PermRoutesRead)).Get("/experiments/{experimentId}", rh.GetExperiment)
+					r.With(can(auth.PermRoutesWrite)).Put("/experiments/{experimentId}", rh.UpdateExperiment)
+					r.With(can(auth.PermRoutesWrite)).Delete("/experiments/{experimentId}", rh.DeleteExperiment)
+					r.With(can(auth.PermRoutesRead), can(auth.PermUsageRead)).Get("/experiments/{experimentId}/results", rh.GetExperimentResults)
+				}
+
+				if ph := adminCfg.PromptsHandler; ph != nil {
+					r.With(can(auth.PermPromptsRead)).Get("/prompts", ph.ListPrompts)
+					r.With(can(auth.PermPromptsWrite)).Post("/prompts", ph.CreatePrompt)
+					r.With(can(auth.PermPromptsRead)).Get("/prompts/{name}", ph.GetPrompt)
+					r.With(can(auth.PermPromptsRead)).Get("/prompts/{name}/versions", ph.ListPromptVersions)
+					r.With(can(auth.PermPromptsRead)).Get("/prompts/{name}/versions/{version}", ph.GetPromptVersion)
+					r.With(can(auth.PermPromptsWrite)).Delete("/prompts/{name}/versions/{version}", ph.DeletePromptVersion)
+					r.With(can(auth.PermPromptsRead), can(auth.PermUsageRead), can(auth.PermAllKeys)).Get("/prompts/{name}/results", ph.GetPromptResults)
+				}
+
+				// Team routes check team membership in the handler, so team
+				// admins can manage their own team without a global role.
+				r.Get("/teams/{teamId}", h.GetTeam)
+				r.Get("/teams/{teamId}/api-keys", h.ListTeamAPIKeys)
+				r.Get("/teams/{teamId}/budget", h.GetTeamBudget)
+				r.Put("/teams/{teamId}/budget", h.SetTeamBudget)
+				r.Get("/teams/{teamId}/usage", h.GetTeamUsage)
+				r.Get("/teams/{teamId}/members", h.ListTeamMembers)
+				r.Put("/teams/{teamId}/members/{userId}", h.SetTeamMember)
+				r.Delete("/teams/{teamId}/members/{userId}", h.RemoveTeamMember)
 			})
 		})
 	}
 
-	if apiHandler != nil {
+	if apiHandler != nil || usageHandler != nil {
 		router.Route("/api/v1", func(r chi.Router) {
 			r.Use(api.AuthMiddleware(resolver))
-			r.Post("/proxy-keys", apiHandler.CreateProxyKey)
-			r.Get("/proxy-keys", apiHandler.ListProxyKeys)
-			r.Get("/proxy-keys/{id}", apiHandler.GetProxyKey)
-			r.Delete("/proxy-keys/{id}", apiHandler.RevokeProxyKey)
-			r.Put("/proxy-keys/{id}/providers/{provider}", apiHandler.SetProviderMapping)
-			r.Delete("/proxy-keys/{id}/providers/{provider}", apiHandler.DeleteProviderMapping)
-			r.Get("/proxy-keys/{id}/providers", apiHandler.ListProviderMappings)
+			scope := api.RequireScope
+			if usageHandler != nil {
+				r.With(scope(models.ScopeUsageRead)).Get("/usage", usageHandler.GetUsage)
+			}
+			if apiHandler != nil {
+				r.With(scope(models.ScopeProxyKeysWrite)).Post("/proxy-keys", apiHandler.CreateProxyKey)
+				r.With(scope(models.ScopeProxyKeysRead)).Get("/proxy-keys", apiHandler.ListProxyKeys)
+				r.With(scope(models.ScopeProxyKeysRead)).Get("/proxy-keys/{id}", apiHandler.GetProxyKey)
+				r.With(scope(models.ScopeProxyKeysWrite)).Delete("/proxy-keys/{id}", apiHandler.RevokeProxyKey)
+				r.With(scope(models.ScopeProxyKeysWrite)).Put("/proxy-keys/{id}/single-header-auth", apiHandler.SetSingleHeaderAuth)
+				r.With(scope(models.ScopeProxyKeysWrite)).Put("/proxy-keys/{id}/providers/{provider}", apiHandler.SetProviderMapping)
+				r.With(scope(models.ScopeProxyKeysWrite)).Delete("/proxy-keys/{id}/providers/{provider}", apiHandler.DeleteProviderMapping)
+				r.With(scope(models.ScopeProxyKeysRead)).Get("/proxy-keys/{id}/providers", apiHandler.ListProviderMappings)
+			}
 		})
 	}
 
@@ -126,13 +240,40 @@ func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if err := s.healthChecker.Ping(ctx); err != nil {
+	body := map[string]any{"status": "ok"}
+	if reporter, ok := s.healthChecker.(WriterStatsReporter); ok {
+		body["log_writer"] = reporter.Stats()
+	}
+	if s.upstreams != nil {
+		body["upstreams"] = s.upstreams.UpstreamStatus()
+	}
+
+	fail := func(err error) {
 		slog.Warn("readiness check failed", "error", err)
+		body["status"] = "error"
+		body["error"] = err.Error()
 		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{"status": "error", "error": err.Error()})
+		json.NewEncoder(w).Encode(body)
+	}
+
+	if err := s.healthChecker.Ping(ctx); err != nil {
+		fail(err)
 		return
 	}
 
+	if reporter, ok := s.healthChecker.(SchemaVersionReporter); ok {
+		version, latest, err := reporter.SchemaVersion(ctx)
+		if err != nil {
+			fail(err)
+			return
+		}
+		body["schema"] = map[string]int{"current": version, "expected": latest}
+		if version < latest {
+			fail(fmt.Errorf("database schema is at version %d, expected %d; run `majordomo migrate up`", version, latest))
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(body)
 }
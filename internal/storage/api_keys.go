@@ -16,14 +16,24 @@ var (
 )
 
 // CreateAPIKey creates a new API key in the database
-func (s *PostgresStorage) CreateAPIKey(ctx context.Context, keyHash string, input *models.CreateAPIKeyInput) (*models.APIKey, error) {
+func (s *sqlStore) CreateAPIKey(ctx context.Context, keyHash string, input *models.CreateAPIKeyInput) (*models.APIKey, error) {
 	query := `
-		INSERT INTO api_keys (key_hash, name, description, user_id)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, key_hash, name, description, user_id, is_active, created_at, revoked_at, last_used_at, request_count`
+		INSERT INTO api_keys (id, key_hash, name, description, user_id, team_id, organization_id, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count`
+
+	var teamID, orgID *uuid.UUID
+	if input.Team != nil {
+		teamID, orgID = &input.Team.ID, &input.Team.OrgID
+	}
+
+	scopes := input.Scopes
+	if scopes == nil {
+		scopes = models.AllScopes
+	}
 
 	var key models.APIKey
-	err := s.db.QueryRowxContext(ctx, query, keyHash, input.Name, input.Description, input.UserID).StructScan(&key)
+	err := s.db.QueryRowxContext(ctx, query, uuid.New(), keyHash, input.Name, input.Description, input.UserID, teamID, orgID, scopes).StructScan(&key)
 	if err != nil {
 		return nil, err
 	}
@@ -32,9 +42,9 @@ func (s *PostgresStorage) CreateAPIKey(ctx context.Context, keyHash string, inpu
 }
 
 // GetAPIKeyByHash retrieves an API key by its hash
-func (s *PostgresStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+func (s *sqlStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, user_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count
 		FROM api_keys
 		WHERE key_hash = $1`
 
@@ -51,9 +61,9 @@ func (s *PostgresStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (
 }
 
 // GetAPIKeyByID retrieves an API key by its UUID
-func (s *PostgresStorage) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+func (s *sqlStore) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, user_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count
 		FROM api_keys
 		WHERE id = $1`
 
@@ -70,9 +80,9 @@ func (s *PostgresStorage) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*mod
 }
 
 // ListAPIKeys retrieves all API keys
-func (s *PostgresStorage) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+func (s *sqlStore) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, user_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count
 		FROM api_keys
 		ORDER BY created_at DESC`
 
@@ -85,8 +95,8 @@ func (s *PostgresStorage) ListAPIKeys(ctx context.Context) ([]*models.APIKey, er
 	return keys, nil
 }
 
-// UpdateAPIKey updates an API key's name and/or description
-func (s *PostgresStorage) UpdateAPIKey(ctx context.Context, id uuid.UUID, input *models.UpdateAPIKeyInput) (*models.APIKey, error) {
+// UpdateAPIKey updates an API key's name, description and/or scopes
+func (s *sqlStore) UpdateAPIKey(ctx context.Context, id uuid.UUID, input *models.UpdateAPIKeyInput) (*models.APIKey, error) {
 	// Build dynamic update query
 	setClauses := []string{}
 	args := []interface{}{}
@@ -104,6 +114,12 @@ func (s *PostgresStorage) UpdateAPIKey(ctx context.Context, id uuid.UUID, input
 		argIdx++
 	}
 
+	if input.Scopes != nil {
+		setClauses = append(setClauses, fmt.Sprintf("scopes = $%d", argIdx))
+		args = append(args, input.Scopes)
+		argIdx++
+	}
+
 	if len(setClauses) == 0 {
 		// Nothing to update, just return current state
 		return s.GetAPIKeyByID(ctx, id)
@@ -118,7 +134,7 @@ func (s *PostgresStorage) UpdateAPIKey(ctx context.Context, id uuid.UUID, input
 		query += clause
 	}
 	query += fmt.Sprintf(" WHERE id = $%d", argIdx)
-	query += " RETURNING id, key_hash, name, description, user_id, is_active, created_at, revoked_at, last_used_at, request_count"
+	query += " RETURNING id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count"
 	args = append(args, id)
 
 	var key models.APIKey
@@ -134,7 +150,7 @@ func (s *PostgresStorage) UpdateAPIKey(ctx context.Context, id uuid.UUID, input
 }
 
 // RevokeAPIKey marks an API key as revoked
-func (s *PostgresStorage) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+func (s *sqlStore) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
 	query := `
 		UPDATE api_keys
 		SET is_active = false, revoked_at = $1
@@ -158,7 +174,7 @@ func (s *PostgresStorage) RevokeAPIKey(ctx context.Context, id uuid.UUID) error
 }
 
 // UpdateAPIKeyLastUsed updates the last_used_at timestamp and increments request_count
-func (s *PostgresStorage) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+func (s *sqlStore) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error {
 	query := `
 		UPDATE api_keys
 		SET last_used_at = $1, request_count = request_count + 1
@@ -169,9 +185,9 @@ func (s *PostgresStorage) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID
 }
 
 // ListAPIKeysByUserID retrieves all API keys owned by a specific user
-func (s *PostgresStorage) ListAPIKeysByUserID(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+func (s *sqlStore) ListAPIKeysByUserID(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, user_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count
 		FROM api_keys
 		WHERE user_id = $1
 		ORDER BY created_at DESC`
@@ -184,3 +200,50 @@ func (s *PostgresStorage) ListAPIKeysByUserID(ctx context.Context, userID uuid.U
 
 	return keys, nil
 }
+
+// ListAPIKeysByTeamID retrieves all API keys owned by a specific team
+func (s *sqlStore) ListAPIKeysByTeamID(ctx context.Context, teamID uuid.UUID) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, key_hash, name, description, user_id, team_id, organization_id, is_active, scopes, created_at, revoked_at, last_used_at, request_count
+		FROM api_keys
+		WHERE team_id = $1
+		ORDER BY created_at DESC`
+
+	var keys []*models.APIKey
+	err := s.db.SelectContext(ctx, &keys, query, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// SetAPIKeyTeam moves an API key to a team, or removes it from its team when
+// team is nil. Requests already made keep the team they were logged with.
+func (s *sqlStore) SetAPIKeyTeam(ctx context.Context, id uuid.UUID, team *models.Team) error {
+	var teamID, orgID *uuid.UUID
+	if team != nil {
+		teamID, orgID = &team.ID, &team.OrgID
+	}
+
+	query := `
+		UPDATE api_keys
+		SET team_id = $1, organization_id = $2
+		WHERE id = $3`
+
+	result, err := s.db.ExecContext(ctx, query, teamID, orgID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// DefaultAuditLimit and MaxAuditLimit bound the number of events ListAuditEvents returns.
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// WriteAuditEvent appends an event to the audit log. A zero ID or time is
+// filled in.
+func (s *sqlStore) WriteAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO audit_events (
+			id, occurred_at, actor_type, actor_id, actor_name, action,
+			target_type, target_id, before_state, after_state, source_ip
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err := s.db.ExecContext(ctx, query,
+		event.ID, event.OccurredAt.UTC(), event.ActorType, event.ActorID, event.ActorName, event.Action,
+		event.TargetType, event.TargetID, event.Before, event.After, event.SourceIP,
+	)
+	return err
+}
+
+// ListAuditEvents retrieves audit events matching q, newest first
+func (s *sqlStore) ListAuditEvents(ctx context.Context, q *models.AuditQuery) ([]*models.AuditEvent, error) {
+	var where []string
+	var args []interface{}
+	addFilter := func(column, op string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf("%s %s $%d", column, op, len(args)))
+	}
+
+	if !q.From.IsZero() {
+		addFilter("occurred_at", ">=", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		addFilter("occurred_at", "<", q.To.UTC())
+	}
+	if q.ActorType != "" {
+		addFilter("actor_type", "=", q.ActorType)
+	}
+	if q.ActorID != nil {
+		addFilter("actor_id", "=", *q.ActorID)
+	}
+	if q.Action != "" {
+		addFilter("action", "=", q.Action)
+	}
+	if q.TargetType != "" {
+		addFilter("target_type", "=", q.TargetType)
+	}
+	if q.TargetID != "" {
+		addFilter("target_id", "=", q.TargetID)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultAuditLimit
+	}
+	if limit > MaxAuditLimit {
+		limit = MaxAuditLimit
+	}
+
+	query := `
+		SELECT id, occurred_at, actor_type, actor_id, actor_name, action,
+			target_type, target_id, before_state, after_state, source_ip
+		FROM audit_events`
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY occurred_at DESC, id\n\t\tLIMIT %d", limit)
+
+	var events []*models.AuditEvent
+	if err := s.db.SelectContext(ctx, &events, query, args...); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
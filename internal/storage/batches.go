@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+const batchColumns = `id, provider, majordomo_api_key_id, user_id, team_id, organization_id, proxy_key_id,
+	provider_api_key_hash, provider_api_key_alias, request_id, endpoint, status, request_count,
+	output_file_id, error_file_id, metadata, created_at, updated_at, ended_at,
+	results_recorded_at, errors_recorded_at`
+
+// batchRecordedColumns maps a part of a batch's results to the column that
+// records when it was logged
+var batchRecordedColumns = map[string]string{
+	models.BatchPartResults: "results_recorded_at",
+	models.BatchPartErrors:  "errors_recorded_at",
+}
+
+type batchRow struct {
+	models.Batch
+	RawMetadata *string `db:"metadata"`
+}
+
+func (r *batchRow) batch() *models.Batch {
+	b := &r.Batch
+	b.Metadata = map[string]string{}
+	if r.RawMetadata != nil {
+		json.Unmarshal([]byte(*r.RawMetadata), &b.Metadata)
+	}
+	return b
+}
+
+// CreateBatch starts tracking a batch. The timestamps are filled in. A batch
+// that is already tracked is left as it is.
+func (s *sqlStore) CreateBatch(ctx context.Context, batch *models.Batch) error {
+	var metadata *string
+	if len(batch.Metadata) > 0 {
+		data, err := json.Marshal(batch.Metadata)
+		if err != nil {
+			return err
+		}
+		m := string(data)
+		metadata = &m
+	}
+
+	now := time.Now()
+	batch.CreatedAt = now
+	batch.UpdatedAt = now
+
+	query := `
+		INSERT INTO batches (` + batchColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, NULL, NULL)
+		ON CONFLICT (provider, id) DO NOTHING`
+
+	_, err := s.db.ExecContext(ctx, query,
+		batch.ID, batch.Provider, batch.MajordomoAPIKeyID, batch.UserID, batch.TeamID, batch.OrgID, batch.ProxyKeyID,
+		batch.ProviderAPIKeyHash, batch.ProviderAPIKeyAlias, batch.RequestID, batch.Endpoint, batch.Status, batch.RequestCount,
+		batch.OutputFileID, batch.ErrorFileID, metadata, now.UTC(), now.UTC(), utcOrNil(batch.EndedAt),
+	)
+	return err
+}
+
+// GetBatch retrieves a tracked batch, or nil if the batch isn't tracked
+func (s *sqlStore) GetBatch(ctx context.Context, provider, id string) (*models.Batch, error) {
+	query := `SELECT ` + batchColumns + ` FROM batches WHERE provider = $1 AND id = $2`
+	return s.getBatch(ctx, query, provider, id)
+}
+
+// GetBatchByFileID retrieves the tracked batch with the given output or error
+// file, or nil if there is none
+func (s *sqlStore) GetBatchByFileID(ctx context.Context, provider, fileID string) (*models.Batch, error) {
+	query := `
+		SELECT ` + batchColumns + `
+		FROM batches
+		WHERE provider = $1 AND (output_file_id = $2 OR error_file_id = $2)`
+	return s.getBatch(ctx, query, provider, fileID)
+}
+
+func (s *sqlStore) getBatch(ctx context.Context, query string, args ...any) (*models.Batch, error) {
+	var row batchRow
+	err := s.db.GetContext(ctx, &row, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.batch(), nil
+}
+
+// UpdateBatch stores a tracked batch's status, request count, files and end
+// time as the provider last reported them. Files and the end time are never
+// cleared. Batches that aren't tracked are ignored.
+func (s *sqlStore) UpdateBatch(ctx context.Context, batch *models.Batch) error {
+	batch.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE batches
+		SET status = $3, request_count = $4,
+			output_file_id = COALESCE($5, output_file_id),
+			error_file_id = COALESCE($6, error_file_id),
+			ended_at = COALESCE($7, ended_at),
+			updated_at = $8
+		WHERE provider = $1 AND id = $2`
+
+	_, err := s.db.ExecContext(ctx, query,
+		batch.Provider, batch.ID, batch.Status, batch.RequestCount,
+		batch.OutputFileID, batch.ErrorFileID, utcOrNil(batch.EndedAt), batch.UpdatedAt.UTC(),
+	)
+	return err
+}
+
+// ListPendingBatches returns the batches created since the given time that
+// were submitted with a proxy key, so the gateway can download their results,
+// and are still running or have results that weren't recorded. Oldest first.
+func (s *sqlStore) ListPendingBatches(ctx context.Context, since time.Time, limit int) ([]*models.Batch, error) {
+	query := fmt.Sprintf(`
+		SELECT `+batchColumns+`
+		FROM batches
+		WHERE proxy_key_id IS NOT NULL AND created_at >= $1
+			AND (ended_at IS NULL OR results_recorded_at IS NULL
+				OR (error_file_id IS NOT NULL AND errors_recorded_at IS NULL))
+		ORDER BY created_at
+		LIMIT %d`, limit)
+
+	var rows []batchRow
+	if err := s.db.SelectContext(ctx, &rows, query, since.UTC()); err != nil {
+		return nil, err
+	}
+
+	batches := make([]*models.Batch, len(rows))
+	for i := range rows {
+		batches[i] = rows[i].batch()
+	}
+	return batches, nil
+}
+
+// MarkBatchResultsRecorded marks a part of a batch's results as recorded and
+// reports whether this call did, so that when several gateways or requests
+// download the same results, only one logs them
+func (s *sqlStore) MarkBatchResultsRecorded(ctx context.Context, provider, id, part string) (bool, error) {
+	column, ok := batchRecordedColumns[part]
+	if !ok {
+		return false, fmt.Errorf("unknown batch results part %q", part)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE batches SET %[1]s = $3
+		WHERE provider = $1 AND id = $2 AND %[1]s IS NULL`, column)
+
+	result, err := s.db.ExecContext(ctx, query, provider, id, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
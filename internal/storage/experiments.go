@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var ErrExperimentNotFound = errors.New("experiment not found")
+
+const experimentColumns = `id, name, model, sticky_key, arms, is_active, created_at, updated_at`
+
+// CreateExperiment stores a new experiment. The ID and timestamps are filled
+// in.
+func (s *sqlStore) CreateExperiment(ctx context.Context, exp *models.Experiment) error {
+	exp.ID = uuid.New()
+	exp.CreatedAt = time.Now()
+	exp.UpdatedAt = exp.CreatedAt
+
+	query := `
+		INSERT INTO experiments (` + experimentColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := s.db.ExecContext(ctx, query,
+		exp.ID, exp.Name, exp.Model, exp.StickyKey, exp.Arms, exp.IsActive,
+		exp.CreatedAt.UTC(), exp.UpdatedAt.UTC(),
+	)
+	return err
+}
+
+// GetExperiment retrieves an experiment by its UUID
+func (s *sqlStore) GetExperiment(ctx context.Context, id uuid.UUID) (*models.Experiment, error) {
+	query := `
+		SELECT ` + experimentColumns + `
+		FROM experiments
+		WHERE id = $1`
+
+	var exp models.Experiment
+	err := s.db.GetContext(ctx, &exp, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExperimentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &exp, nil
+}
+
+// ListExperiments retrieves all experiments, oldest first
+func (s *sqlStore) ListExperiments(ctx context.Context) ([]*models.Experiment, error) {
+	query := `
+		SELECT ` + experimentColumns + `
+		FROM experiments
+		ORDER BY created_at, id`
+
+	var exps []*models.Experiment
+	if err := s.db.SelectContext(ctx, &exps, query); err != nil {
+		return nil, err
+	}
+
+	return exps, nil
+}
+
+// UpdateExperiment replaces the name, model, sticky key, arms and status of
+// an experiment and sets its UpdatedAt
+func (s *sqlStore) UpdateExperiment(ctx context.Context, exp *models.Experiment) error {
+	exp.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE experiments
+		SET name = $1, model = $2, sticky_key = $3, arms = $4, is_active = $5, updated_at = $6
+		WHERE id = $7`
+
+	result, err := s.db.ExecContext(ctx, query,
+		exp.Name, exp.Model, exp.StickyKey, exp.Arms, exp.IsActive, exp.UpdatedAt.UTC(), exp.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrExperimentNotFound
+	}
+
+	return nil
+}
+
+// DeleteExperiment deletes an experiment. Request logs keep its ID and arm
+// names.
+func (s *sqlStore) DeleteExperiment(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM experiments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrExperimentNotFound
+	}
+
+	return nil
+}
+
+// ExperimentResults compares the requests each arm of an experiment served
+// in [from, to). Arms without requests are left out.
+func (s *sqlStore) ExperimentResults(ctx context.Context, id uuid.UUID, from, to time.Time) ([]*models.ExperimentArmResult, error) {
+	query := `
+		SELECT experiment_arm,
+			COUNT(*) AS request_count,
+			SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) AS error_count,
+			SUM(input_tokens) AS input_tokens,
+			SUM(output_tokens) AS output_tokens,
+			CAST(SUM(total_cost) AS DOUBLE PRECISION) AS total_cost,
+			CAST(AVG(response_time_ms) AS DOUBLE PRECISION) AS avg_response_time_ms,
+			MAX(response_time_ms) AS max_response_time_ms
+		FROM llm_requests
+		WHERE experiment_id = $1 AND requested_at >= $2 AND requested_at < $3
+		GROUP BY experiment_arm
+		ORDER BY experiment_arm`
+
+	var results []*models.ExperimentArmResult
+	if err := s.db.SelectContext(ctx, &results, query, id, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		if r.RequestCount > 0 {
+			r.ErrorRate = float64(r.ErrorCount) / float64(r.RequestCount)
+			r.CostPerRequest = r.TotalCost / float64(r.RequestCount)
+		}
+	}
+	return results, nil
+}
@@ -162,9 +162,11 @@ func (m *HLLManager) Flush(ctx context.Context) error {
 		SET hll_state = $1,
 			approx_cardinality = $2,
 			request_count = request_count + $3,
-			last_seen_at = NOW(),
-			hll_updated_at = NOW()
-		WHERE majordomo_api_key_id = $4 AND key_name = $5`
+			last_seen_at = $4,
+			hll_updated_at = $4
+		WHERE majordomo_api_key_id = $5 AND key_name = $6`
+
+	now := time.Now().UTC()
 
 	flushed := 0
 	for key, entry := range toFlush {
@@ -176,7 +178,7 @@ func (m *HLLManager) Flush(ctx context.Context) error {
 		cardinality := entry.hll.Estimate()
 
 		result, err := m.db.ExecContext(ctx, query,
-			hllBytes, cardinality, entry.count,
+			hllBytes, cardinality, entry.count, now,
 			key.MajordomoAPIKeyID, key.KeyName)
 		if err != nil {
 			slog.Warn("failed to flush HLL", "error", err, "api_key_id", key.MajordomoAPIKeyID, "key", key.KeyName)
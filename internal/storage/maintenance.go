@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	requestLogTable        = "llm_requests"
+	requestLogDefaultTable = "llm_requests_default"
+)
+
+var partitionNamePattern = regexp.MustCompile(`^llm_requests_y(\d{4})m(\d{2})$`)
+
+// MaintenanceConfig controls partition management and data retention.
+type MaintenanceConfig struct {
+	PartitionsAhead int // Future monthly partitions to keep created
+	BodyRetention   int // Days to keep request/response bodies; 0 keeps them forever
+	RowRetention    int // Days to keep request rows (rollups are kept); 0 keeps them forever
+	BatchSize       int // Rows updated per statement when purging bodies
+}
+
+// MaintenanceReport summarizes what a maintenance run changed.
+type MaintenanceReport struct {
+	Partitioned        bool     `json:"partitioned"`
+	PartitionsCreated  []string `json:"partitions_created,omitempty"`
+	PartitionsDropped  []string `json:"partitions_dropped,omitempty"`
+	BodiesPurged       int64    `json:"bodies_purged"`
+	RowsExpired        int64    `json:"rows_expired"`
+	S3LifecycleApplied bool     `json:"s3_lifecycle_applied"`
+}
+
+// partitionName returns the monthly partition name covering t.
+func partitionName(t time.Time) string {
+	t = t.UTC()
+	return fmt.Sprintf("%s_y%04dm%02d", requestLogTable, t.Year(), int(t.Month()))
+}
+
+// monthStart returns the first instant of t's month in UTC.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// parsePartitionName returns the [start, end) range of a managed partition.
+// ok is false for tables that don't follow the monthly naming scheme.
+func parsePartitionName(name string) (start, end time.Time, ok bool) {
+	m := partitionNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	if month < 1 || month > 12 {
+		return time.Time{}, time.Time{}, false
+	}
+	start = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0), true
+}
+
+// IsRequestLogPartitioned reports whether llm_requests is a partitioned table.
+// Installations created before partitioning was introduced have a plain table.
+func (s *PostgresStorage) IsRequestLogPartitioned(ctx context.Context) (bool, error) {
+	var partitioned bool
+	err := s.db.GetContext(ctx, &partitioned, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'llm_requests'::regclass
+		)`)
+	return partitioned, err
+}
+
+// listRequestLogPartitions returns the names of all partitions of llm_requests.
+func (s *PostgresStorage) listRequestLogPartitions(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.db.SelectContext(ctx, &names, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'llm_requests'::regclass
+		ORDER BY c.relname`)
+	return names, err
+}
+
+// EnsurePartitions creates monthly partitions from the month containing now
+// through `ahead` months into the future. It returns the partitions created.
+func (s *PostgresStorage) EnsurePartitions(ctx context.Context, now time.Time, ahead int) ([]string, error) {
+	existing, err := s.listRequestLogPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		have[name] = true
+	}
+
+	var created []string
+	start := monthStart(now)
+	for i := 0; i <= ahead; i++ {
+		from := start.AddDate(0, i, 0)
+		name := partitionName(from)
+		if have[name] {
+			continue
+		}
+
+		query := fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+			pq.QuoteIdentifier(name), requestLogTable,
+			from.Format(time.RFC3339), from.AddDate(0, 1, 0).Format(time.RFC3339),
+		)
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return created, fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+		created = append(created, name)
+	}
+
+	return created, nil
+}
+
+// PurgeRequestBodies clears request_body, response_body and the client bodies
+// on rows requested before the cutoff, batchSize rows at a time. It returns the rows updated.
+func (s *PostgresStorage) PurgeRequestBodies(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+
+	query := `
+		WITH batch AS (
+			SELECT id, requested_at
+			FROM llm_requests
+			WHERE requested_at < $1
+			  AND (request_body IS NOT NULL OR response_body IS NOT NULL
+			       OR client_request_body IS NOT NULL OR client_response_body IS NOT NULL)
+			LIMIT $2
+		)
+		UPDATE llm_requests r
+		SET request_body = NULL, response_body = NULL, client_request_body = NULL, client_response_body = NULL
+		FROM batch
+		WHERE r.id = batch.id AND r.requested_at = batch.requested_at`
+
+	var total int64
+	for {
+		result, err := s.db.ExecContext(ctx, query, before, batchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// ExpireRequestRows removes rows requested before the cutoff. Their totals
+// are already held in the usage rollup tables, which are written in the same
+// transaction as the rows themselves (or, for rows stored before the tables
+// existed, backfilled when they were created). Monthly partitions that lie entirely
+// before the cutoff are dropped; remaining rows in the default partition (or
+// in an unpartitioned table) are deleted. It returns the dropped partitions
+// and the number of rows removed.
+func (s *PostgresStorage) ExpireRequestRows(ctx context.Context, before time.Time, partitioned bool) ([]string, int64, error) {
+	if !partitioned {
+		n, err := s.deleteExpiredRows(ctx, requestLogTable, before)
+		return nil, n, err
+	}
+
+	partitions, err := s.listRequestLogPartitions(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var dropped []string
+	var total int64
+	for _, name := range partitions {
+		if name == requestLogDefaultTable {
+			n, err := s.deleteExpiredRows(ctx, requestLogDefaultTable, before)
+			total += n
+			if err != nil {
+				return dropped, total, err
+			}
+			continue
+		}
+
+		_, end, ok := parsePartitionName(name)
+		if !ok || end.After(before) {
+			continue
+		}
+
+		n, err := s.dropPartition(ctx, name)
+		if err != nil {
+			return dropped, total, err
+		}
+		dropped = append(dropped, name)
+		total += n
+	}
+
+	return dropped, total, nil
+}
+
+// deleteExpiredRows deletes rows before the cutoff from the given table.
+func (s *PostgresStorage) deleteExpiredRows(ctx context.Context, table string, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE requested_at < $1`, pq.QuoteIdentifier(table)), before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired rows from %s: %w", table, err)
+	}
+	return result.RowsAffected()
+}
+
+// dropPartition drops a partition and returns the number of rows it held.
+func (s *PostgresStorage) dropPartition(ctx context.Context, partition string) (int64, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int64
+	if err := tx.GetContext(ctx, &count, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, pq.QuoteIdentifier(partition))); err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", partition, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s`, pq.QuoteIdentifier(partition))); err != nil {
+		return 0, fmt.Errorf("failed to drop %s: %w", partition, err)
+	}
+
+	return count, tx.Commit()
+}
+
+// Maintainer runs partition management and retention, either once (CLI) or
+// periodically in the background (serve).
+type Maintainer struct {
+	pg   *PostgresStorage
+	s3   *S3BodyStorage
+	cfg  MaintenanceConfig
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMaintainer creates a Maintainer. s3 may be nil when body storage is not S3.
+func NewMaintainer(pg *PostgresStorage, s3 *S3BodyStorage, cfg MaintenanceConfig) *Maintainer {
+	return &Maintainer{
+		pg:   pg,
+		s3:   s3,
+		cfg:  cfg,
+		done: make(chan struct{}),
+	}
+}
+
+// Run performs one maintenance pass. Steps are independent; the first error is
+// returned after all steps have been attempted.
+func (m *Maintainer) Run(ctx context.Context, now time.Time) (*MaintenanceReport, error) {
+	report := &MaintenanceReport{}
+	var firstErr error
+	fail := func(step string, err error) {
+		slog.Error("maintenance step failed", "step", step, "error", err)
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", step, err)
+		}
+	}
+
+	partitioned, err := m.pg.IsRequestLogPartitioned(ctx)
+	if err != nil {
+		fail("detect partitioning", err)
+	}
+	report.Partitioned = partitioned
+
+	if partitioned {
+		created, err := m.pg.EnsurePartitions(ctx, now, m.cfg.PartitionsAhead)
+		report.PartitionsCreated = created
+		if err != nil {
+			fail("create partitions", err)
+		}
+	} else if err == nil {
+		slog.Warn("llm_requests is not partitioned, skipping partition management; see docs/data-retention.md")
+	}
+
+	if m.cfg.BodyRetention > 0 {
+		cutoff := now.AddDate(0, 0, -m.cfg.BodyRetention)
+		n, err := m.pg.PurgeRequestBodies(ctx, cutoff, m.cfg.BatchSize)
+		report.BodiesPurged = n
+		if err != nil {
+			fail("purge bodies", err)
+		}
+
+		if m.s3 != nil {
+			if err := m.s3.ApplyBodyLifecycle(ctx, m.cfg.BodyRetention); err != nil {
+				fail("apply S3 lifecycle", err)
+			} else {
+				report.S3LifecycleApplied = true
+			}
+		}
+	}
+
+	if m.cfg.RowRetention > 0 {
+		cutoff := now.AddDate(0, 0, -m.cfg.RowRetention)
+		dropped, n, err := m.pg.ExpireRequestRows(ctx, cutoff, partitioned)
+		report.PartitionsDropped = dropped
+		report.RowsExpired = n
+		if err != nil {
+			fail("expire rows", err)
+		}
+	}
+
+	return report, firstErr
+}
+
+// Start runs maintenance immediately and then on every interval.
+func (m *Maintainer) Start(interval time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := m.Run(context.Background(), time.Now())
+			if err == nil {
+				slog.Info("maintenance completed",
+					"partitions_created", len(report.PartitionsCreated),
+					"partitions_dropped", len(report.PartitionsDropped),
+					"bodies_purged", report.BodiesPurged,
+					"rows_expired", report.RowsExpired,
+				)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the background loop to exit and waits for it.
+func (m *Maintainer) Stop() {
+	close(m.done)
+	m.wg.Wait()
+}
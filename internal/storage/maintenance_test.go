@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionName(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{"mid month", time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC), "llm_requests_y2026m03"},
+		{"first instant", time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), "llm_requests_y2026m12"},
+		{"non-UTC input uses UTC month", time.Date(2026, 1, 1, 1, 0, 0, 0, time.FixedZone("UTC+2", 2*3600)), "llm_requests_y2025m12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partitionName(tt.t); got != tt.want {
+				t.Errorf("partitionName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePartitionName(t *testing.T) {
+	start, end, ok := parsePartitionName("llm_requests_y2026m12")
+	if !ok {
+		t.Fatal("expected managed partition name to parse")
+	}
+	if !start.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("start = %v", start)
+	}
+	if !end.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("end = %v", end)
+	}
+
+	for _, name := range []string{"llm_requests_default", "llm_requests_y2026m13", "llm_requests_y2026m00", "other_y2026m01"} {
+		if _, _, ok := parsePartitionName(name); ok {
+			t.Errorf("expected %q not to parse", name)
+		}
+	}
+}
+
+func TestPartitionNameRoundTrip(t *testing.T) {
+	from := monthStart(time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC))
+	for i := 0; i < 24; i++ {
+		month := from.AddDate(0, i, 0)
+		start, end, ok := parsePartitionName(partitionName(month))
+		if !ok || !start.Equal(month) || !end.Equal(month.AddDate(0, 1, 0)) {
+			t.Fatalf("round trip failed for %v: start=%v end=%v ok=%v", month, start, end, ok)
+		}
+	}
+}
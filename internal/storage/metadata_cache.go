@@ -2,12 +2,14 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
 )
 
 type activeKeysEntry struct {
@@ -87,6 +89,36 @@ func (c *ActiveKeysCache) fetchActiveKeys(ctx context.Context, apiKeyID uuid.UUI
 	return keys, rows.Err()
 }
 
+// SplitMetadata marshals the raw metadata and the subset of it whose keys are
+// active for the log's Majordomo API key. The indexed subset is also returned
+// unmarshaled for the rollups.
+func (c *ActiveKeysCache) SplitMetadata(ctx context.Context, log *models.RequestLog) (string, string, map[string]string) {
+	// Get active keys from cache (only if we have a Majordomo API key)
+	indexedMetadata := make(map[string]string)
+	if log.MajordomoAPIKeyID != nil {
+		activeKeys, _ := c.GetActiveKeys(ctx, *log.MajordomoAPIKeyID)
+		for key, value := range log.RawMetadata {
+			if activeKeys[key] {
+				indexedMetadata[key] = value
+			}
+		}
+	}
+
+	rawMetadataJSON, err := json.Marshal(log.RawMetadata)
+	if err != nil {
+		slog.Error("failed to marshal raw metadata", "error", err)
+		rawMetadataJSON = []byte("{}")
+	}
+
+	indexedMetadataJSON, err := json.Marshal(indexedMetadata)
+	if err != nil {
+		slog.Error("failed to marshal indexed metadata", "error", err)
+		indexedMetadataJSON = []byte("{}")
+	}
+
+	return string(rawMetadataJSON), string(indexedMetadataJSON), indexedMetadata
+}
+
 // InvalidateAPIKey removes the cached entry for a Majordomo API key ID.
 // Call this when keys are activated/deactivated.
 func (c *ActiveKeysCache) InvalidateAPIKey(apiKeyID uuid.UUID) {
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// Storage drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// migrationLockID is the pg_advisory_lock key held while migrating, so that
+// several gateways starting at once don't run the same migration twice.
+const migrationLockID = 7_268_330_101
+
+var (
+	ErrNoMigrations  = errors.New("no migrations to roll back")
+	ErrUnknownSchema = errors.New("database schema is newer than this binary")
+	ErrUnknownDriver = errors.New("unknown storage driver")
+)
+
+// migrationDialect holds the driver-specific parts of the migrator.
+type migrationDialect struct {
+	dir         string
+	tableExists string
+	createTable string
+	lock        string // Empty when the database serializes schema changes itself
+	unlock      string
+}
+
+var migrationDialects = map[string]migrationDialect{
+	DriverPostgres: {
+		dir:         "migrations/postgres",
+		tableExists: `SELECT to_regclass('schema_migrations') IS NOT NULL`,
+		createTable: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version     INT PRIMARY KEY,
+				name        TEXT NOT NULL,
+				applied_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`,
+		lock:   `SELECT pg_advisory_lock($1)`,
+		unlock: `SELECT pg_advisory_unlock($1)`,
+	},
+	DriverSQLite: {
+		dir:         "migrations/sqlite",
+		tableExists: `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`,
+		createTable: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version     INTEGER PRIMARY KEY,
+				name        TEXT NOT NULL,
+				applied_at  DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+			)`,
+	},
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one embedded schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LoadMigrations parses the embedded migration files for a driver, ordered by version.
+func LoadMigrations(driver string) ([]Migration, error) {
+	dialect, ok := migrationDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+	}
+	return parseMigrations(migrationFiles, dialect.dir)
+}
+
+func parseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		m := migrationFilePattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+
+		data, err := fs.ReadFile(fsys, dir+"/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", mig.Version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the version of the newest embedded migration
+// for a driver.
+func LatestSchemaVersion(driver string) int {
+	migrations, err := LoadMigrations(driver)
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrator applies and rolls back the embedded migrations. Applied versions
+// are recorded in schema_migrations.
+type Migrator struct {
+	db         *sqlx.DB
+	dialect    migrationDialect
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the embedded migrations of a driver.
+func NewMigrator(db *sqlx.DB, driver string) (*Migrator, error) {
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: migrationDialects[driver], migrations: migrations}, nil
+}
+
+// schemaVersion returns the highest applied version, or 0 if none.
+func schemaVersion(ctx context.Context, q sqlx.QueryerContext, dialect migrationDialect) (int, error) {
+	var exists bool
+	if err := sqlx.GetContext(ctx, q, &exists, dialect.tableExists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err := sqlx.GetContext(ctx, q, &version, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	return version, err
+}
+
+// CurrentVersion returns the highest applied migration version.
+func (m *Migrator) CurrentVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, m.db, m.dialect)
+}
+
+// Status lists every embedded migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied := make(map[int]time.Time)
+
+	version, err := m.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > 0 {
+		var rows []struct {
+			Version   int       `db:"version"`
+			AppliedAt time.Time `db:"applied_at"`
+		}
+		if err := m.db.SelectContext(ctx, &rows, `SELECT version, applied_at FROM schema_migrations`); err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			applied[r.Version] = r.AppliedAt
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if t, ok := applied[mig.Version]; ok {
+			st.AppliedAt = &t
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations up to and including target (0 means latest)
+// and returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+	if target <= 0 {
+		target = len(m.migrations)
+	}
+
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+
+		current, err := schemaVersion(ctx, conn, m.dialect)
+		if err != nil {
+			return err
+		}
+		if current > len(m.migrations) {
+			return fmt.Errorf("%w (database at version %d, binary has %d)", ErrUnknownSchema, current, len(m.migrations))
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version <= current || mig.Version > target {
+				continue
+			}
+			slog.Info("applying migration", "version", mig.Version, "name", mig.Name)
+			if err := runMigration(ctx, conn, mig.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the migrations it rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		current, err := schemaVersion(ctx, conn, m.dialect)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return ErrNoMigrations
+		}
+		if current > len(m.migrations) {
+			return fmt.Errorf("%w (database at version %d, binary has %d)", ErrUnknownSchema, current, len(m.migrations))
+		}
+
+		for i := current - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			mig := m.migrations[i]
+			slog.Info("rolling back migration", "version", mig.Version, "name", mig.Name)
+			if err := runMigration(ctx, conn, mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+				return fmt.Errorf("rollback of %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			rolledBack = append(rolledBack, mig)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// runMigration executes a migration script and records it in one transaction.
+func runMigration(ctx context.Context, conn *sqlx.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock == "" {
+		return fn(conn)
+	}
+
+	if _, err := conn.ExecContext(ctx, m.dialect.lock, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled.
+		if _, err := conn.ExecContext(context.Background(), m.dialect.unlock, migrationLockID); err != nil && !errors.Is(err, sql.ErrConnDone) {
+			slog.Warn("failed to release migration lock", "error", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+// SchemaVersion returns the applied and expected schema versions.
+func (s *PostgresStorage) SchemaVersion(ctx context.Context) (int, int, error) {
+	current, err := schemaVersion(ctx, s.db, migrationDialects[DriverPostgres])
+	return current, LatestSchemaVersion(DriverPostgres), err
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, driver := range []string{DriverPostgres, DriverSQLite} {
+		t.Run(driver, func(t *testing.T) {
+			migrations, err := LoadMigrations(driver)
+			if err != nil {
+				t.Fatalf("LoadMigrations() error = %v", err)
+			}
+			if len(migrations) == 0 {
+				t.Fatal("expected embedded migrations")
+			}
+			if got := LatestSchemaVersion(driver); got != migrations[len(migrations)-1].Version {
+				t.Errorf("LatestSchemaVersion() = %d, want %d", got, migrations[len(migrations)-1].Version)
+			}
+			for _, m := range migrations {
+				if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+					t.Errorf("migration %d_%s has an empty script", m.Version, m.Name)
+				}
+			}
+		})
+	}
+
+	if _, err := LoadMigrations("mysql"); err == nil {
+		t.Error("expected error for unknown driver")
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+		want    []string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   file("B"),
+				"m/0002_second.down.sql": file("b"),
+				"m/0001_first.up.sql":    file("A"),
+				"m/0001_first.down.sql":  file("a"),
+			},
+			want: []string{"first", "second"},
+		},
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql": file("A"),
+			},
+			wantErr: "needs both up and down",
+		},
+		{
+			name: "gap in versions",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql":   file("A"),
+				"m/0001_first.down.sql": file("a"),
+				"m/0003_third.up.sql":   file("C"),
+				"m/0003_third.down.sql": file("c"),
+			},
+			wantErr: "contiguous",
+		},
+		{
+			name: "bad file name",
+			files: fstest.MapFS{
+				"m/first.sql": file("A"),
+			},
+			wantErr: "invalid migration file name",
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql":   file("A"),
+				"m/0001_other.down.sql": file("a"),
+			},
+			wantErr: "conflicting names",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := parseMigrations(tt.files, "m")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseMigrations() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMigrations() error = %v", err)
+			}
+			if len(migrations) != len(tt.want) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.want))
+			}
+			for i, name := range tt.want {
+				if migrations[i].Name != name || migrations[i].Version != i+1 {
+					t.Errorf("migration %d = %d_%s, want %d_%s", i, migrations[i].Version, migrations[i].Name, i+1, name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS llm_requests;
+DROP TABLE IF EXISTS llm_requests_metadata_keys;
+DROP TABLE IF EXISTS proxy_key_provider_mappings;
+DROP TABLE IF EXISTS proxy_keys;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS users;
@@ -1,3 +1,6 @@
+-- Baseline schema. Every statement is idempotent so databases created by hand
+-- from schema.sql before migrations existed are adopted unchanged.
+
 -- Majordomo API Keys
 CREATE TABLE IF NOT EXISTS api_keys (
     id                  UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -0,0 +1,24 @@
+-- Convert a partitioned llm_requests back into a plain table, keeping its rows.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'llm_requests'::regclass) THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE llm_requests RENAME TO llm_requests_partitioned;
+
+    CREATE TABLE llm_requests (LIKE llm_requests_partitioned INCLUDING DEFAULTS);
+    INSERT INTO llm_requests SELECT * FROM llm_requests_partitioned;
+    DROP TABLE llm_requests_partitioned;
+
+    ALTER TABLE llm_requests ADD PRIMARY KEY (id);
+    ALTER TABLE llm_requests ADD FOREIGN KEY (majordomo_api_key_id) REFERENCES api_keys(id);
+    ALTER TABLE llm_requests ADD FOREIGN KEY (proxy_key_id) REFERENCES proxy_keys(id);
+    ALTER TABLE llm_requests ADD FOREIGN KEY (user_id) REFERENCES users(id);
+
+    CREATE INDEX idx_llm_requests_majordomo_key_time ON llm_requests(majordomo_api_key_id, requested_at DESC);
+    CREATE INDEX idx_llm_requests_provider_key_time ON llm_requests(provider_api_key_hash, requested_at DESC);
+    CREATE INDEX idx_llm_requests_indexed_metadata_gin ON llm_requests USING GIN (indexed_metadata);
+    CREATE INDEX idx_llm_requests_user_id_time ON llm_requests(user_id, requested_at DESC) WHERE user_id IS NOT NULL;
+END
+$$;
@@ -0,0 +1,123 @@
+-- Range-partition llm_requests by month on requested_at. Partitions are
+-- created ahead of time by the gateway (see `majordomo maintenance run`).
+--
+-- A populated table is converted by copying its rows into a monthly partition
+-- per month they span, then dropping the old table. This rewrites the whole
+-- table; see docs/data-retention.md before upgrading a large installation.
+DO $$
+DECLARE
+    month_start TIMESTAMPTZ;
+    last_month  TIMESTAMPTZ;
+    part        TEXT;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'llm_requests'::regclass) THEN
+        RETURN;
+    END IF;
+
+    -- Keep the old table under another name until its rows are copied. Its
+    -- primary key and indexes are renamed or dropped so the new table can
+    -- take their names.
+    ALTER TABLE llm_requests RENAME TO llm_requests_unpartitioned;
+    ALTER TABLE llm_requests_unpartitioned RENAME CONSTRAINT llm_requests_pkey TO llm_requests_unpartitioned_pkey;
+    DROP INDEX IF EXISTS idx_llm_requests_majordomo_key_time;
+    DROP INDEX IF EXISTS idx_llm_requests_provider_key_time;
+    DROP INDEX IF EXISTS idx_llm_requests_indexed_metadata_gin;
+    DROP INDEX IF EXISTS idx_llm_requests_user_id_time;
+
+    CREATE TABLE llm_requests (
+        id                      UUID NOT NULL DEFAULT gen_random_uuid(),
+
+        -- Majordomo API key (for validation and tracking)
+        majordomo_api_key_id    UUID REFERENCES api_keys(id),
+
+        -- Provider API key (hashed, for usage tracking per provider key)
+        provider_api_key_hash   VARCHAR(64),
+        provider_api_key_alias  VARCHAR(255),
+
+        provider                VARCHAR(100) NOT NULL,
+        model                   VARCHAR(100) NOT NULL,
+        request_path            TEXT NOT NULL,
+        request_method          TEXT NOT NULL,
+
+        requested_at            TIMESTAMPTZ NOT NULL,
+        responded_at            TIMESTAMPTZ NOT NULL,
+        response_time_ms        INT NOT NULL,
+
+        input_tokens            INT NOT NULL,
+        output_tokens           INT NOT NULL,
+        cached_tokens           INT DEFAULT 0,
+        cache_creation_tokens   INT DEFAULT 0,
+
+        input_cost              NUMERIC(12, 8) NOT NULL,
+        output_cost             NUMERIC(12, 8) NOT NULL,
+        total_cost              NUMERIC(12, 8) NOT NULL,
+
+        status_code             INT NOT NULL,
+        error_message           TEXT,
+
+        -- All metadata (no index - for data retention)
+        raw_metadata            JSONB,
+        -- Only active keys (GIN indexed - for analytics queries)
+        indexed_metadata        JSONB DEFAULT '{}',
+
+        request_body            TEXT,
+        response_body           TEXT,
+
+        created_at              TIMESTAMPTZ DEFAULT now(),
+        body_s3_key             TEXT,
+        model_alias_found       BOOLEAN NOT NULL DEFAULT true,
+
+        proxy_key_id            UUID REFERENCES proxy_keys(id),
+        user_id                 UUID REFERENCES users(id),
+
+        PRIMARY KEY (id, requested_at)
+    ) PARTITION BY RANGE (requested_at);
+
+    -- Catches rows outside the managed monthly partitions; should normally stay empty
+    CREATE TABLE llm_requests_default PARTITION OF llm_requests DEFAULT;
+
+    CREATE INDEX idx_llm_requests_majordomo_key_time ON llm_requests(majordomo_api_key_id, requested_at DESC);
+    CREATE INDEX idx_llm_requests_provider_key_time ON llm_requests(provider_api_key_hash, requested_at DESC);
+    CREATE INDEX idx_llm_requests_indexed_metadata_gin ON llm_requests USING GIN (indexed_metadata);
+    CREATE INDEX idx_llm_requests_user_id_time ON llm_requests(user_id, requested_at DESC) WHERE user_id IS NOT NULL;
+
+    SELECT date_trunc('month', min(requested_at) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+           date_trunc('month', max(requested_at) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+    INTO month_start, last_month
+    FROM llm_requests_unpartitioned;
+
+    -- No rows leaves both NULL and skips the loop
+    WHILE month_start <= last_month LOOP
+        part := 'llm_requests_y' || to_char(month_start AT TIME ZONE 'UTC', 'YYYY')
+             || 'm' || to_char(month_start AT TIME ZONE 'UTC', 'MM');
+        EXECUTE format('CREATE TABLE %I PARTITION OF llm_requests FOR VALUES FROM (%L) TO (%L)',
+                       part, month_start, month_start + INTERVAL '1 month');
+
+        INSERT INTO llm_requests (
+            id, majordomo_api_key_id, provider_api_key_hash, provider_api_key_alias,
+            provider, model, request_path, request_method,
+            requested_at, responded_at, response_time_ms,
+            input_tokens, output_tokens, cached_tokens, cache_creation_tokens,
+            input_cost, output_cost, total_cost,
+            status_code, error_message, raw_metadata, indexed_metadata,
+            request_body, response_body, created_at, body_s3_key, model_alias_found,
+            proxy_key_id, user_id
+        )
+        SELECT
+            id, majordomo_api_key_id, provider_api_key_hash, provider_api_key_alias,
+            provider, model, request_path, request_method,
+            requested_at, responded_at, response_time_ms,
+            input_tokens, output_tokens, cached_tokens, cache_creation_tokens,
+            input_cost, output_cost, total_cost,
+            status_code, error_message, raw_metadata, indexed_metadata,
+            request_body, response_body, created_at, body_s3_key, model_alias_found,
+            proxy_key_id, user_id
+        FROM llm_requests_unpartitioned
+        WHERE requested_at >= month_start AND requested_at < month_start + INTERVAL '1 month';
+
+        month_start := month_start + INTERVAL '1 month';
+    END LOOP;
+
+    DROP TABLE llm_requests_unpartitioned;
+END
+$$;
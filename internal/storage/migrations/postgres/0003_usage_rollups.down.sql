@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS usage_rollups_daily;
+DROP TABLE IF EXISTS usage_rollups_hourly;
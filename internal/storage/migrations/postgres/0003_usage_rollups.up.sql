@@ -0,0 +1,119 @@
+-- Usage rollups, maintained by the gateway in the same transaction as the
+-- llm_requests rows they summarize. Buckets are UTC hours and UTC days.
+-- Rollups outlive row retention; rebuild with `majordomo rollups rebuild`.
+-- Rows already stored are backfilled below, so usage from before the rollups
+-- existed survives retention too.
+CREATE TABLE IF NOT EXISTS usage_rollups_hourly (
+    bucket                  TIMESTAMPTZ NOT NULL,
+    majordomo_api_key_id    UUID,
+    proxy_key_id            UUID,
+    user_id                 UUID,
+    provider                VARCHAR(100) NOT NULL,
+    model                   VARCHAR(100) NOT NULL,
+    -- '' for totals; otherwise one row per value of an active metadata key
+    metadata_key            VARCHAR(255) NOT NULL DEFAULT '',
+    metadata_value          TEXT NOT NULL DEFAULT '',
+
+    request_count           BIGINT NOT NULL DEFAULT 0,
+    error_count             BIGINT NOT NULL DEFAULT 0,
+    input_tokens            BIGINT NOT NULL DEFAULT 0,
+    output_tokens           BIGINT NOT NULL DEFAULT 0,
+    cached_tokens           BIGINT NOT NULL DEFAULT 0,
+    cache_creation_tokens   BIGINT NOT NULL DEFAULT 0,
+    input_cost              NUMERIC(18, 8) NOT NULL DEFAULT 0,
+    output_cost             NUMERIC(18, 8) NOT NULL DEFAULT 0,
+    total_cost              NUMERIC(18, 8) NOT NULL DEFAULT 0,
+    response_time_ms_sum    BIGINT NOT NULL DEFAULT 0,
+
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_usage_rollups_hourly_dims ON usage_rollups_hourly (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_hourly_majordomo_key_bucket ON usage_rollups_hourly(majordomo_api_key_id, metadata_key, bucket DESC);
+
+CREATE TABLE IF NOT EXISTS usage_rollups_daily (
+    bucket                  TIMESTAMPTZ NOT NULL,
+    majordomo_api_key_id    UUID,
+    proxy_key_id            UUID,
+    user_id                 UUID,
+    provider                VARCHAR(100) NOT NULL,
+    model                   VARCHAR(100) NOT NULL,
+    -- '' for totals; otherwise one row per value of an active metadata key
+    metadata_key            VARCHAR(255) NOT NULL DEFAULT '',
+    metadata_value          TEXT NOT NULL DEFAULT '',
+
+    request_count           BIGINT NOT NULL DEFAULT 0,
+    error_count             BIGINT NOT NULL DEFAULT 0,
+    input_tokens            BIGINT NOT NULL DEFAULT 0,
+    output_tokens           BIGINT NOT NULL DEFAULT 0,
+    cached_tokens           BIGINT NOT NULL DEFAULT 0,
+    cache_creation_tokens   BIGINT NOT NULL DEFAULT 0,
+    input_cost              NUMERIC(18, 8) NOT NULL DEFAULT 0,
+    output_cost             NUMERIC(18, 8) NOT NULL DEFAULT 0,
+    total_cost              NUMERIC(18, 8) NOT NULL DEFAULT 0,
+    response_time_ms_sum    BIGINT NOT NULL DEFAULT 0,
+
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_usage_rollups_daily_dims ON usage_rollups_daily (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_daily_majordomo_key_bucket ON usage_rollups_daily(majordomo_api_key_id, metadata_key, bucket DESC);
+
+-- Backfill from the requests already stored, grouped the way the gateway
+-- writes rollups: a totals row plus one row per indexed metadata key. Shadow
+-- requests, which rollups leave out, are only logged from migration 0013 on.
+INSERT INTO usage_rollups_hourly (
+    bucket, majordomo_api_key_id, proxy_key_id, user_id, provider, model, metadata_key, metadata_value,
+    request_count, error_count, input_tokens, output_tokens, cached_tokens, cache_creation_tokens,
+    input_cost, output_cost, total_cost, response_time_ms_sum
+)
+SELECT
+    date_trunc('hour', r.requested_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+    r.majordomo_api_key_id, r.proxy_key_id, r.user_id, r.provider, r.model, m.key, m.value,
+    COUNT(*), COUNT(*) FILTER (WHERE r.status_code >= 400),
+    SUM(r.input_tokens), SUM(r.output_tokens), SUM(COALESCE(r.cached_tokens, 0)), SUM(COALESCE(r.cache_creation_tokens, 0)),
+    SUM(r.input_cost), SUM(r.output_cost), SUM(r.total_cost), SUM(r.response_time_ms)
+FROM llm_requests r
+CROSS JOIN LATERAL (
+    SELECT ''::text AS key, ''::text AS value
+    UNION ALL
+    SELECT key, value FROM jsonb_each_text(COALESCE(r.indexed_metadata, '{}'::jsonb))
+) m
+GROUP BY 1, 2, 3, 4, 5, 6, 7, 8;
+
+INSERT INTO usage_rollups_daily (
+    bucket, majordomo_api_key_id, proxy_key_id, user_id, provider, model, metadata_key, metadata_value,
+    request_count, error_count, input_tokens, output_tokens, cached_tokens, cache_creation_tokens,
+    input_cost, output_cost, total_cost, response_time_ms_sum
+)
+SELECT
+    date_trunc('day', r.requested_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+    r.majordomo_api_key_id, r.proxy_key_id, r.user_id, r.provider, r.model, m.key, m.value,
+    COUNT(*), COUNT(*) FILTER (WHERE r.status_code >= 400),
+    SUM(r.input_tokens), SUM(r.output_tokens), SUM(COALESCE(r.cached_tokens, 0)), SUM(COALESCE(r.cache_creation_tokens, 0)),
+    SUM(r.input_cost), SUM(r.output_cost), SUM(r.total_cost), SUM(r.response_time_ms)
+FROM llm_requests r
+CROSS JOIN LATERAL (
+    SELECT ''::text AS key, ''::text AS value
+    UNION ALL
+    SELECT key, value FROM jsonb_each_text(COALESCE(r.indexed_metadata, '{}'::jsonb))
+) m
+GROUP BY 1, 2, 3, 4, 5, 6, 7, 8;
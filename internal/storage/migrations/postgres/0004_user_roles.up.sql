@@ -0,0 +1,4 @@
+-- Roles for admin UI users. Existing users become members, which keeps the
+-- access they had before roles existed: their own keys only.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member'
+    CHECK (role IN ('admin', 'member', 'viewer', 'billing'));
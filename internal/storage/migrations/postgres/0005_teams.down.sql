@@ -0,0 +1,67 @@
+-- Rows that differ only by team or organization are merged back together.
+CREATE TEMP TABLE rollups_hourly_merged AS
+SELECT bucket, majordomo_api_key_id, proxy_key_id, user_id, provider, model, metadata_key, metadata_value,
+    SUM(request_count) AS request_count, SUM(error_count) AS error_count,
+    SUM(input_tokens) AS input_tokens, SUM(output_tokens) AS output_tokens,
+    SUM(cached_tokens) AS cached_tokens, SUM(cache_creation_tokens) AS cache_creation_tokens,
+    SUM(input_cost) AS input_cost, SUM(output_cost) AS output_cost, SUM(total_cost) AS total_cost,
+    SUM(response_time_ms_sum) AS response_time_ms_sum, MAX(updated_at) AS updated_at
+FROM usage_rollups_hourly
+GROUP BY bucket, majordomo_api_key_id, proxy_key_id, user_id, provider, model, metadata_key, metadata_value;
+
+CREATE TEMP TABLE rollups_daily_merged AS
+SELECT bucket, majordomo_api_key_id, proxy_key_id, user_id, provider, model, metadata_key, metadata_value,
+    SUM(request_count) AS request_count, SUM(error_count) AS error_count,
+    SUM(input_tokens) AS input_tokens, SUM(output_tokens) AS output_tokens,
+    SUM(cached_tokens) AS cached_tokens, SUM(cache_creation_tokens) AS cache_creation_tokens,
+    SUM(input_cost) AS input_cost, SUM(output_cost) AS output_cost, SUM(total_cost) AS total_cost,
+    SUM(response_time_ms_sum) AS response_time_ms_sum, MAX(updated_at) AS updated_at
+FROM usage_rollups_daily
+GROUP BY bucket, majordomo_api_key_id, proxy_key_id, user_id, provider, model, metadata_key, metadata_value;
+
+DELETE FROM usage_rollups_hourly;
+DELETE FROM usage_rollups_daily;
+
+DROP INDEX IF EXISTS idx_usage_rollups_hourly_dims;
+DROP INDEX IF EXISTS idx_usage_rollups_daily_dims;
+DROP INDEX IF EXISTS idx_usage_rollups_hourly_team_bucket;
+DROP INDEX IF EXISTS idx_usage_rollups_daily_team_bucket;
+DROP INDEX IF EXISTS idx_usage_rollups_daily_org_bucket;
+ALTER TABLE usage_rollups_hourly DROP COLUMN IF EXISTS team_id, DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE usage_rollups_daily DROP COLUMN IF EXISTS team_id, DROP COLUMN IF EXISTS organization_id;
+
+CREATE UNIQUE INDEX idx_usage_rollups_hourly_dims ON usage_rollups_hourly (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE UNIQUE INDEX idx_usage_rollups_daily_dims ON usage_rollups_daily (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+
+INSERT INTO usage_rollups_hourly SELECT * FROM rollups_hourly_merged;
+INSERT INTO usage_rollups_daily SELECT * FROM rollups_daily_merged;
+DROP TABLE rollups_hourly_merged;
+DROP TABLE rollups_daily_merged;
+
+DROP INDEX IF EXISTS idx_llm_requests_team_id_time;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS team_id, DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_api_keys_team_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS team_id, DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS organizations;
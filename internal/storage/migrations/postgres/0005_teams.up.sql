@@ -0,0 +1,75 @@
+-- Organizations and teams. Teams own API keys (and through them, proxy keys)
+-- and an optional monthly budget; users hold a role in each team they belong to.
+CREATE TABLE IF NOT EXISTS organizations (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name            VARCHAR(255) NOT NULL UNIQUE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS teams (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id),
+    name            VARCHAR(255) NOT NULL,
+    monthly_budget  NUMERIC(18, 2),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id         UUID NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role            VARCHAR(20) NOT NULL DEFAULT 'member'
+        CHECK (role IN ('admin', 'member', 'viewer', 'billing')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_members_user_id ON team_members(user_id);
+
+-- organization_id is copied from the team so request logs and rollups can be
+-- grouped by organization without a join.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS team_id UUID REFERENCES teams(id);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_team_id ON api_keys(team_id) WHERE team_id IS NOT NULL;
+
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS team_id UUID;
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS organization_id UUID;
+CREATE INDEX IF NOT EXISTS idx_llm_requests_team_id_time ON llm_requests(team_id, requested_at DESC) WHERE team_id IS NOT NULL;
+
+-- Rollups gain team and organization dimensions. Existing rows keep NULL for
+-- both, so they don't count toward any team's usage.
+ALTER TABLE usage_rollups_hourly ADD COLUMN IF NOT EXISTS team_id UUID;
+ALTER TABLE usage_rollups_hourly ADD COLUMN IF NOT EXISTS organization_id UUID;
+ALTER TABLE usage_rollups_daily ADD COLUMN IF NOT EXISTS team_id UUID;
+ALTER TABLE usage_rollups_daily ADD COLUMN IF NOT EXISTS organization_id UUID;
+
+DROP INDEX IF EXISTS idx_usage_rollups_hourly_dims;
+CREATE UNIQUE INDEX idx_usage_rollups_hourly_dims ON usage_rollups_hourly (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(team_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(organization_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_hourly_team_bucket ON usage_rollups_hourly(team_id, metadata_key, bucket DESC) WHERE team_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_usage_rollups_daily_dims;
+CREATE UNIQUE INDEX idx_usage_rollups_daily_dims ON usage_rollups_daily (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(team_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(organization_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_daily_team_bucket ON usage_rollups_daily(team_id, metadata_key, bucket DESC) WHERE team_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_daily_org_bucket ON usage_rollups_daily(organization_id, metadata_key, bucket DESC) WHERE organization_id IS NOT NULL;
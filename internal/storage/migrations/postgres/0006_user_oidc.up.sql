@@ -0,0 +1,7 @@
+-- Links users to their identity at the configured OIDC provider. Users
+-- provisioned through SSO have an empty password_hash and can't use
+-- password login.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_issuer TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_identity ON users(oidc_issuer, oidc_subject);
@@ -0,0 +1,35 @@
+-- Append-only record of administrative actions. before_state and after_state
+-- hold the changed fields of the target, never secrets.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id              UUID PRIMARY KEY,
+    occurred_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor_type      VARCHAR(20) NOT NULL CHECK (actor_type IN ('user', 'api_key', 'cli')),
+    actor_id        UUID,
+    actor_name      TEXT NOT NULL DEFAULT '',
+    action          VARCHAR(100) NOT NULL,
+    target_type     VARCHAR(50) NOT NULL,
+    target_id       TEXT NOT NULL DEFAULT '',
+    before_state    JSONB,
+    after_state     JSONB,
+    source_ip       TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id, occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_update ON audit_events;
+CREATE TRIGGER audit_events_no_update
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
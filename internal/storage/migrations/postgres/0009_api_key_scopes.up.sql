@@ -0,0 +1,4 @@
+-- Scopes limit what a Majordomo API key may be used for, as a comma-separated
+-- list. Existing keys keep every scope so they work as before.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL
+    DEFAULT 'proxy,proxy-keys:read,proxy-keys:write,usage:read';
@@ -0,0 +1 @@
+ALTER TABLE proxy_keys DROP COLUMN IF EXISTS single_header_auth;
@@ -0,0 +1,3 @@
+-- Proxy keys with single-header auth authenticate requests on their own,
+-- without an X-Majordomo-Key header. Existing keys keep requiring both.
+ALTER TABLE proxy_keys ADD COLUMN IF NOT EXISTS single_header_auth BOOLEAN NOT NULL DEFAULT false;
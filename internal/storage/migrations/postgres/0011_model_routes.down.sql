@@ -0,0 +1,2 @@
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS requested_model;
+DROP TABLE IF EXISTS model_routes;
@@ -0,0 +1,20 @@
+-- Model routes send requests for a virtual model name, such as "fast", to a
+-- provider model. Routes may be limited to an API key, a proxy key or a
+-- metadata header value.
+CREATE TABLE IF NOT EXISTS model_routes (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name            VARCHAR(100) NOT NULL,
+    target_provider VARCHAR(50) NOT NULL DEFAULT '',
+    target_model    VARCHAR(100) NOT NULL,
+    api_key_id      UUID REFERENCES api_keys(id) ON DELETE CASCADE,
+    proxy_key_id    UUID REFERENCES proxy_keys(id) ON DELETE CASCADE,
+    metadata_key    VARCHAR(255),
+    metadata_value  TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_routes_name ON model_routes(name);
+
+-- The model the client asked for, when a route replaced it
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS requested_model VARCHAR(100);
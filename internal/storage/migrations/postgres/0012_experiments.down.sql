@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_llm_requests_experiment;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS experiment_arm;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS experiment_id;
+DROP TABLE IF EXISTS experiments;
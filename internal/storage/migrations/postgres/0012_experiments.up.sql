@@ -0,0 +1,22 @@
+-- Experiments split the traffic for a model name between weighted arms, each
+-- with its own target provider and model. At most one experiment per model
+-- name is active.
+CREATE TABLE IF NOT EXISTS experiments (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        VARCHAR(255) NOT NULL,
+    model       VARCHAR(100) NOT NULL,
+    sticky_key  VARCHAR(255),
+    arms        JSONB NOT NULL,
+    is_active   BOOLEAN NOT NULL DEFAULT true,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_experiments_active_model ON experiments(model) WHERE is_active;
+
+-- The experiment and arm that chose a request's model
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS experiment_id UUID;
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS experiment_arm VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_llm_requests_experiment ON llm_requests(experiment_id, requested_at)
+    WHERE experiment_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_llm_requests_shadow;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS shadow_rule;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS shadow_of;
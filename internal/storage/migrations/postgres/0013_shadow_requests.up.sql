@@ -0,0 +1,7 @@
+-- Shadow requests mirror a primary request to a candidate model. They are
+-- logged like any other request, linked to the primary by shadow_of.
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS shadow_of UUID;
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS shadow_rule VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_llm_requests_shadow ON llm_requests(requested_at, shadow_rule)
+    WHERE shadow_of IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS client_response_body;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS client_request_body;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS transforms;
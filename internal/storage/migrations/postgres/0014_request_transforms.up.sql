@@ -0,0 +1,6 @@
+-- Transforms rewrite request and response bodies. The names of the ones that
+-- applied are logged, and with body storage the bodies as the client sent and
+-- received them are kept next to those exchanged with the provider.
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS transforms TEXT;
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS client_request_body TEXT;
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS client_response_body TEXT;
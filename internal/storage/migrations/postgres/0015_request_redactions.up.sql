@@ -0,0 +1,3 @@
+-- Number of values redacted from a request and its stored bodies, such as
+-- emails, phone numbers and card numbers.
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS redactions INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_llm_requests_guardrail_action;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS guardrail_action;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS guardrails;
@@ -0,0 +1,7 @@
+-- Results of the guardrails run on a request and its response, and the most
+-- severe action among those that triggered ("block", "flag" or "log").
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS guardrails JSONB;
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS guardrail_action VARCHAR(16);
+
+CREATE INDEX IF NOT EXISTS idx_llm_requests_guardrail_action ON llm_requests(requested_at, guardrail_action)
+    WHERE guardrail_action IS NOT NULL;
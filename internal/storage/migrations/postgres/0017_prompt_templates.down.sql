@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_llm_requests_prompt;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS prompt_name;
+DROP TABLE IF EXISTS prompt_templates;
@@ -0,0 +1,20 @@
+-- Prompt templates are named, versioned lists of messages with {{variable}}
+-- placeholders. A request references one with the X-Majordomo-Prompt header
+-- and the gateway renders it before forwarding. Versions are never changed;
+-- editing a prompt adds the next version.
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        VARCHAR(100) NOT NULL,
+    version     INTEGER NOT NULL,
+    description TEXT,
+    messages    JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (name, version)
+);
+
+-- The prompt template and version a request was rendered from
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS prompt_name VARCHAR(100);
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS prompt_version INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_llm_requests_prompt ON llm_requests(prompt_name, requested_at)
+    WHERE prompt_name IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_llm_requests_batch;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS batch_custom_id;
+ALTER TABLE llm_requests DROP COLUMN IF EXISTS batch_id;
+DROP TABLE IF EXISTS batches;
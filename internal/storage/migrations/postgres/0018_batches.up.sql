@@ -0,0 +1,40 @@
+-- Batches submitted to the OpenAI and Anthropic batch APIs through the
+-- gateway, tracked against the key that submitted them. The requests in a
+-- batch are logged once their results are downloaded, and each part of the
+-- results is recorded at most once.
+CREATE TABLE IF NOT EXISTS batches (
+    id                     VARCHAR(255) NOT NULL,
+    provider               VARCHAR(50) NOT NULL,
+    majordomo_api_key_id   UUID NOT NULL,
+    user_id                UUID,
+    team_id                UUID,
+    organization_id        UUID,
+    proxy_key_id           UUID,
+    provider_api_key_hash  VARCHAR(64),
+    provider_api_key_alias VARCHAR(255),
+    request_id             UUID NOT NULL,
+    endpoint               VARCHAR(255) NOT NULL,
+    status                 VARCHAR(50) NOT NULL,
+    request_count          INTEGER NOT NULL DEFAULT 0,
+    output_file_id         VARCHAR(255),
+    error_file_id          VARCHAR(255),
+    metadata               JSONB,
+    created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at               TIMESTAMPTZ,
+    results_recorded_at    TIMESTAMPTZ,
+    errors_recorded_at     TIMESTAMPTZ,
+    PRIMARY KEY (provider, id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_batches_output_file ON batches(output_file_id) WHERE output_file_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_batches_error_file ON batches(error_file_id) WHERE error_file_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_batches_pending ON batches(created_at) WHERE results_recorded_at IS NULL;
+
+-- The batch a request submitted, retrieved or ran in, and the custom ID of
+-- requests that ran in one
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS batch_id VARCHAR(255);
+ALTER TABLE llm_requests ADD COLUMN IF NOT EXISTS batch_custom_id VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_llm_requests_batch ON llm_requests(batch_id)
+    WHERE batch_id IS NOT NULL;
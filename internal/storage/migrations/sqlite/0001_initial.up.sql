@@ -0,0 +1,194 @@
+-- SQLite schema for single-node deployments. Mirrors the Postgres schema:
+-- UUIDs are stored as text and generated by the gateway, timestamps as UTC
+-- text, and JSON metadata as text.
+
+CREATE TABLE users (
+    id              TEXT PRIMARY KEY,
+    username        TEXT NOT NULL UNIQUE,
+    password_hash   TEXT NOT NULL,
+    is_active       BOOLEAN NOT NULL DEFAULT true,
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE api_keys (
+    id              TEXT PRIMARY KEY,
+    key_hash        TEXT NOT NULL UNIQUE,
+    name            TEXT NOT NULL,
+    description     TEXT,
+    user_id         TEXT REFERENCES users(id),
+    is_active       BOOLEAN NOT NULL DEFAULT true,
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    revoked_at      DATETIME,
+    last_used_at    DATETIME,
+    request_count   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_api_keys_hash ON api_keys(key_hash) WHERE is_active = true;
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id) WHERE user_id IS NOT NULL;
+
+CREATE TABLE proxy_keys (
+    id                      TEXT PRIMARY KEY,
+    key_hash                TEXT NOT NULL UNIQUE,
+    name                    TEXT NOT NULL,
+    description             TEXT,
+    majordomo_api_key_id    TEXT NOT NULL REFERENCES api_keys(id),
+    is_active               BOOLEAN NOT NULL DEFAULT true,
+    created_at              DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    revoked_at              DATETIME,
+    last_used_at            DATETIME,
+    request_count           INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_proxy_keys_hash ON proxy_keys(key_hash) WHERE is_active = true;
+CREATE INDEX idx_proxy_keys_majordomo_key ON proxy_keys(majordomo_api_key_id);
+
+CREATE TABLE proxy_key_provider_mappings (
+    id              TEXT PRIMARY KEY,
+    proxy_key_id    TEXT NOT NULL REFERENCES proxy_keys(id) ON DELETE CASCADE,
+    provider        TEXT NOT NULL,
+    encrypted_key   TEXT NOT NULL,
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE(proxy_key_id, provider)
+);
+
+CREATE TABLE llm_requests (
+    id                      TEXT PRIMARY KEY,
+    majordomo_api_key_id    TEXT REFERENCES api_keys(id),
+    proxy_key_id            TEXT REFERENCES proxy_keys(id),
+    user_id                 TEXT REFERENCES users(id),
+    provider_api_key_hash   TEXT,
+    provider_api_key_alias  TEXT,
+
+    provider                TEXT NOT NULL,
+    model                   TEXT NOT NULL,
+    request_path            TEXT NOT NULL,
+    request_method          TEXT NOT NULL,
+
+    requested_at            DATETIME NOT NULL,
+    responded_at            DATETIME NOT NULL,
+    response_time_ms        INTEGER NOT NULL,
+
+    input_tokens            INTEGER NOT NULL,
+    output_tokens           INTEGER NOT NULL,
+    cached_tokens           INTEGER DEFAULT 0,
+    cache_creation_tokens   INTEGER DEFAULT 0,
+
+    input_cost              REAL NOT NULL,
+    output_cost             REAL NOT NULL,
+    total_cost              REAL NOT NULL,
+
+    status_code             INTEGER NOT NULL,
+    error_message           TEXT,
+
+    raw_metadata            TEXT,
+    indexed_metadata        TEXT DEFAULT '{}',
+
+    request_body            TEXT,
+    response_body           TEXT,
+
+    created_at              DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    body_s3_key             TEXT,
+    model_alias_found       BOOLEAN NOT NULL DEFAULT true
+);
+
+CREATE INDEX idx_llm_requests_majordomo_key_time ON llm_requests(majordomo_api_key_id, requested_at DESC);
+CREATE INDEX idx_llm_requests_provider_key_time ON llm_requests(provider_api_key_hash, requested_at DESC);
+CREATE INDEX idx_llm_requests_user_id_time ON llm_requests(user_id, requested_at DESC) WHERE user_id IS NOT NULL;
+
+CREATE TABLE llm_requests_metadata_keys (
+    majordomo_api_key_id    TEXT NOT NULL REFERENCES api_keys(id),
+    key_name                TEXT NOT NULL,
+    display_name            TEXT,
+    key_type                TEXT DEFAULT 'string',
+    is_required             BOOLEAN DEFAULT false,
+
+    is_active               BOOLEAN NOT NULL DEFAULT false,
+    activated_at            DATETIME,
+
+    request_count           INTEGER NOT NULL DEFAULT 0,
+    last_seen_at            DATETIME,
+
+    hll_state               BLOB,
+    approx_cardinality      INTEGER NOT NULL DEFAULT 0,
+    hll_updated_at          DATETIME,
+
+    created_at              DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (majordomo_api_key_id, key_name)
+);
+
+CREATE INDEX idx_llm_requests_metadata_keys_active ON llm_requests_metadata_keys(majordomo_api_key_id) WHERE is_active = true;
+
+-- Usage rollups; see the Postgres migration for details
+
+CREATE TABLE usage_rollups_hourly (
+    bucket                  DATETIME NOT NULL,
+    majordomo_api_key_id    TEXT,
+    proxy_key_id            TEXT,
+    user_id                 TEXT,
+    provider                TEXT NOT NULL,
+    model                   TEXT NOT NULL,
+    metadata_key            TEXT NOT NULL DEFAULT '',
+    metadata_value          TEXT NOT NULL DEFAULT '',
+
+    request_count           INTEGER NOT NULL DEFAULT 0,
+    error_count             INTEGER NOT NULL DEFAULT 0,
+    input_tokens            INTEGER NOT NULL DEFAULT 0,
+    output_tokens           INTEGER NOT NULL DEFAULT 0,
+    cached_tokens           INTEGER NOT NULL DEFAULT 0,
+    cache_creation_tokens   INTEGER NOT NULL DEFAULT 0,
+    input_cost              REAL NOT NULL DEFAULT 0,
+    output_cost             REAL NOT NULL DEFAULT 0,
+    total_cost              REAL NOT NULL DEFAULT 0,
+    response_time_ms_sum    INTEGER NOT NULL DEFAULT 0,
+
+    updated_at              DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE UNIQUE INDEX idx_usage_rollups_hourly_dims ON usage_rollups_hourly (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX idx_usage_rollups_hourly_majordomo_key_bucket ON usage_rollups_hourly(majordomo_api_key_id, metadata_key, bucket DESC);
+
+CREATE TABLE usage_rollups_daily (
+    bucket                  DATETIME NOT NULL,
+    majordomo_api_key_id    TEXT,
+    proxy_key_id            TEXT,
+    user_id                 TEXT,
+    provider                TEXT NOT NULL,
+    model                   TEXT NOT NULL,
+    metadata_key            TEXT NOT NULL DEFAULT '',
+    metadata_value          TEXT NOT NULL DEFAULT '',
+
+    request_count           INTEGER NOT NULL DEFAULT 0,
+    error_count             INTEGER NOT NULL DEFAULT 0,
+    input_tokens            INTEGER NOT NULL DEFAULT 0,
+    output_tokens           INTEGER NOT NULL DEFAULT 0,
+    cached_tokens           INTEGER NOT NULL DEFAULT 0,
+    cache_creation_tokens   INTEGER NOT NULL DEFAULT 0,
+    input_cost              REAL NOT NULL DEFAULT 0,
+    output_cost             REAL NOT NULL DEFAULT 0,
+    total_cost              REAL NOT NULL DEFAULT 0,
+    response_time_ms_sum    INTEGER NOT NULL DEFAULT 0,
+
+    updated_at              DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE UNIQUE INDEX idx_usage_rollups_daily_dims ON usage_rollups_daily (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX idx_usage_rollups_daily_majordomo_key_bucket ON usage_rollups_daily(majordomo_api_key_id, metadata_key, bucket DESC);
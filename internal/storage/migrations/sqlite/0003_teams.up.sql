@@ -0,0 +1,72 @@
+-- Organizations and teams; see the Postgres migration for details. Columns
+-- added to existing tables have no foreign keys so the down migration can
+-- drop them.
+CREATE TABLE organizations (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL UNIQUE,
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE teams (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organizations(id),
+    name            TEXT NOT NULL,
+    monthly_budget  REAL,
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE team_members (
+    team_id         TEXT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id         TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role            TEXT NOT NULL DEFAULT 'member'
+        CHECK (role IN ('admin', 'member', 'viewer', 'billing')),
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+
+ALTER TABLE api_keys ADD COLUMN team_id TEXT;
+ALTER TABLE api_keys ADD COLUMN organization_id TEXT;
+CREATE INDEX idx_api_keys_team_id ON api_keys(team_id) WHERE team_id IS NOT NULL;
+
+ALTER TABLE llm_requests ADD COLUMN team_id TEXT;
+ALTER TABLE llm_requests ADD COLUMN organization_id TEXT;
+CREATE INDEX idx_llm_requests_team_id_time ON llm_requests(team_id, requested_at DESC) WHERE team_id IS NOT NULL;
+
+ALTER TABLE usage_rollups_hourly ADD COLUMN team_id TEXT;
+ALTER TABLE usage_rollups_hourly ADD COLUMN organization_id TEXT;
+ALTER TABLE usage_rollups_daily ADD COLUMN team_id TEXT;
+ALTER TABLE usage_rollups_daily ADD COLUMN organization_id TEXT;
+
+DROP INDEX idx_usage_rollups_hourly_dims;
+CREATE UNIQUE INDEX idx_usage_rollups_hourly_dims ON usage_rollups_hourly (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(team_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(organization_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX idx_usage_rollups_hourly_team_bucket ON usage_rollups_hourly(team_id, metadata_key, bucket DESC) WHERE team_id IS NOT NULL;
+
+DROP INDEX idx_usage_rollups_daily_dims;
+CREATE UNIQUE INDEX idx_usage_rollups_daily_dims ON usage_rollups_daily (
+    bucket,
+    COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(team_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(organization_id, '00000000-0000-0000-0000-000000000000'),
+    provider,
+    model,
+    metadata_key,
+    metadata_value
+);
+CREATE INDEX idx_usage_rollups_daily_team_bucket ON usage_rollups_daily(team_id, metadata_key, bucket DESC) WHERE team_id IS NOT NULL;
+CREATE INDEX idx_usage_rollups_daily_org_bucket ON usage_rollups_daily(organization_id, metadata_key, bucket DESC) WHERE organization_id IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX idx_users_oidc_identity;
+
+ALTER TABLE users DROP COLUMN oidc_subject;
+ALTER TABLE users DROP COLUMN oidc_issuer;
@@ -0,0 +1,29 @@
+-- Append-only record of administrative actions. before_state and after_state
+-- hold the changed fields of the target, never secrets.
+CREATE TABLE audit_events (
+    id              TEXT PRIMARY KEY,
+    occurred_at     DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    actor_type      TEXT NOT NULL CHECK (actor_type IN ('user', 'api_key', 'cli')),
+    actor_id        TEXT,
+    actor_name      TEXT NOT NULL DEFAULT '',
+    action          TEXT NOT NULL,
+    target_type     TEXT NOT NULL,
+    target_id       TEXT NOT NULL DEFAULT '',
+    before_state    TEXT,
+    after_state     TEXT,
+    source_ip       TEXT
+);
+
+CREATE INDEX idx_audit_events_occurred_at ON audit_events(occurred_at);
+CREATE INDEX idx_audit_events_target ON audit_events(target_type, target_id, occurred_at);
+CREATE INDEX idx_audit_events_actor ON audit_events(actor_id, occurred_at);
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
@@ -0,0 +1,4 @@
+-- Scopes limit what a Majordomo API key may be used for; see the Postgres
+-- migration for details.
+ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL
+    DEFAULT 'proxy,proxy-keys:read,proxy-keys:write,usage:read';
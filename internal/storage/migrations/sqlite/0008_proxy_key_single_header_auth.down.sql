@@ -0,0 +1 @@
+ALTER TABLE proxy_keys DROP COLUMN single_header_auth;
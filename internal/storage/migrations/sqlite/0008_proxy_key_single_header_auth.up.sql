@@ -0,0 +1,3 @@
+-- Proxy keys with single-header auth authenticate requests on their own; see
+-- the Postgres migration for details.
+ALTER TABLE proxy_keys ADD COLUMN single_header_auth BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+ALTER TABLE llm_requests DROP COLUMN requested_model;
+DROP TABLE model_routes;
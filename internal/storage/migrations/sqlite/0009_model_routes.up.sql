@@ -0,0 +1,17 @@
+-- Model routes; see the Postgres migration for details.
+CREATE TABLE model_routes (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    target_provider TEXT NOT NULL DEFAULT '',
+    target_model    TEXT NOT NULL,
+    api_key_id      TEXT REFERENCES api_keys(id) ON DELETE CASCADE,
+    proxy_key_id    TEXT REFERENCES proxy_keys(id) ON DELETE CASCADE,
+    metadata_key    TEXT,
+    metadata_value  TEXT,
+    created_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at      DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_model_routes_name ON model_routes(name);
+
+ALTER TABLE llm_requests ADD COLUMN requested_model TEXT;
@@ -0,0 +1,4 @@
+DROP INDEX idx_llm_requests_experiment;
+ALTER TABLE llm_requests DROP COLUMN experiment_arm;
+ALTER TABLE llm_requests DROP COLUMN experiment_id;
+DROP TABLE experiments;
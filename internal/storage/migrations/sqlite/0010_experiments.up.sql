@@ -0,0 +1,19 @@
+-- Experiments; see the Postgres migration for details.
+CREATE TABLE experiments (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    model       TEXT NOT NULL,
+    sticky_key  TEXT,
+    arms        TEXT NOT NULL,
+    is_active   BOOLEAN NOT NULL DEFAULT true,
+    created_at  DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at  DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE UNIQUE INDEX idx_experiments_active_model ON experiments(model) WHERE is_active;
+
+ALTER TABLE llm_requests ADD COLUMN experiment_id TEXT;
+ALTER TABLE llm_requests ADD COLUMN experiment_arm TEXT;
+
+CREATE INDEX idx_llm_requests_experiment ON llm_requests(experiment_id, requested_at)
+    WHERE experiment_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX idx_llm_requests_shadow;
+ALTER TABLE llm_requests DROP COLUMN shadow_rule;
+ALTER TABLE llm_requests DROP COLUMN shadow_of;
@@ -0,0 +1,6 @@
+-- Shadow requests; see the Postgres migration for details.
+ALTER TABLE llm_requests ADD COLUMN shadow_of TEXT;
+ALTER TABLE llm_requests ADD COLUMN shadow_rule TEXT;
+
+CREATE INDEX idx_llm_requests_shadow ON llm_requests(requested_at, shadow_rule)
+    WHERE shadow_of IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE llm_requests DROP COLUMN client_response_body;
+ALTER TABLE llm_requests DROP COLUMN client_request_body;
+ALTER TABLE llm_requests DROP COLUMN transforms;
@@ -0,0 +1,4 @@
+-- Request transforms; see the Postgres migration for details.
+ALTER TABLE llm_requests ADD COLUMN transforms TEXT;
+ALTER TABLE llm_requests ADD COLUMN client_request_body TEXT;
+ALTER TABLE llm_requests ADD COLUMN client_response_body TEXT;
@@ -0,0 +1 @@
+ALTER TABLE llm_requests DROP COLUMN redactions;
@@ -0,0 +1,2 @@
+-- Request redactions; see the Postgres migration for details.
+ALTER TABLE llm_requests ADD COLUMN redactions INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX idx_llm_requests_guardrail_action;
+ALTER TABLE llm_requests DROP COLUMN guardrail_action;
+ALTER TABLE llm_requests DROP COLUMN guardrails;
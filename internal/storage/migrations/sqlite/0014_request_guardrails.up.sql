@@ -0,0 +1,6 @@
+-- Request guardrails; see the Postgres migration for details.
+ALTER TABLE llm_requests ADD COLUMN guardrails TEXT;
+ALTER TABLE llm_requests ADD COLUMN guardrail_action TEXT;
+
+CREATE INDEX idx_llm_requests_guardrail_action ON llm_requests(requested_at, guardrail_action)
+    WHERE guardrail_action IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX idx_llm_requests_prompt;
+ALTER TABLE llm_requests DROP COLUMN prompt_version;
+ALTER TABLE llm_requests DROP COLUMN prompt_name;
+DROP TABLE prompt_templates;
@@ -0,0 +1,16 @@
+-- Prompt templates; see the Postgres migration for details.
+CREATE TABLE prompt_templates (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    version     INTEGER NOT NULL,
+    description TEXT,
+    messages    TEXT NOT NULL,
+    created_at  DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE (name, version)
+);
+
+ALTER TABLE llm_requests ADD COLUMN prompt_name TEXT;
+ALTER TABLE llm_requests ADD COLUMN prompt_version INTEGER;
+
+CREATE INDEX idx_llm_requests_prompt ON llm_requests(prompt_name, requested_at)
+    WHERE prompt_name IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX idx_llm_requests_batch;
+ALTER TABLE llm_requests DROP COLUMN batch_custom_id;
+ALTER TABLE llm_requests DROP COLUMN batch_id;
+DROP TABLE batches;
@@ -0,0 +1,35 @@
+-- Batches; see the Postgres migration for details.
+CREATE TABLE batches (
+    id                     TEXT NOT NULL,
+    provider               TEXT NOT NULL,
+    majordomo_api_key_id   TEXT NOT NULL,
+    user_id                TEXT,
+    team_id                TEXT,
+    organization_id        TEXT,
+    proxy_key_id           TEXT,
+    provider_api_key_hash  TEXT,
+    provider_api_key_alias TEXT,
+    request_id             TEXT NOT NULL,
+    endpoint               TEXT NOT NULL,
+    status                 TEXT NOT NULL,
+    request_count          INTEGER NOT NULL DEFAULT 0,
+    output_file_id         TEXT,
+    error_file_id          TEXT,
+    metadata               TEXT,
+    created_at             DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at             DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    ended_at               DATETIME,
+    results_recorded_at    DATETIME,
+    errors_recorded_at     DATETIME,
+    PRIMARY KEY (provider, id)
+);
+
+CREATE INDEX idx_batches_output_file ON batches(output_file_id) WHERE output_file_id IS NOT NULL;
+CREATE INDEX idx_batches_error_file ON batches(error_file_id) WHERE error_file_id IS NOT NULL;
+CREATE INDEX idx_batches_pending ON batches(created_at) WHERE results_recorded_at IS NULL;
+
+ALTER TABLE llm_requests ADD COLUMN batch_id TEXT;
+ALTER TABLE llm_requests ADD COLUMN batch_custom_id TEXT;
+
+CREATE INDEX idx_llm_requests_batch ON llm_requests(batch_id)
+    WHERE batch_id IS NOT NULL;
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var ErrModelRouteNotFound = errors.New("model route not found")
+
+const modelRouteColumns = `id, name, target_provider, target_model, api_key_id, proxy_key_id,
+			metadata_key, metadata_value, created_at, updated_at`
+
+// CreateModelRoute stores a new model route. The ID and timestamps are
+// filled in.
+func (s *sqlStore) CreateModelRoute(ctx context.Context, route *models.ModelRoute) error {
+	route.ID = uuid.New()
+	route.CreatedAt = time.Now()
+	route.UpdatedAt = route.CreatedAt
+
+	query := `
+		INSERT INTO model_routes (` + modelRouteColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err := s.db.ExecContext(ctx, query,
+		route.ID, route.Name, route.TargetProvider, route.TargetModel, route.APIKeyID, route.ProxyKeyID,
+		route.MetadataKey, route.MetadataValue, route.CreatedAt.UTC(), route.UpdatedAt.UTC(),
+	)
+	return err
+}
+
+// GetModelRoute retrieves a model route by its UUID
+func (s *sqlStore) GetModelRoute(ctx context.Context, id uuid.UUID) (*models.ModelRoute, error) {
+	query := `
+		SELECT ` + modelRouteColumns + `
+		FROM model_routes
+		WHERE id = $1`
+
+	var route models.ModelRoute
+	err := s.db.GetContext(ctx, &route, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrModelRouteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &route, nil
+}
+
+// ListModelRoutes retrieves all model routes, oldest first
+func (s *sqlStore) ListModelRoutes(ctx context.Context) ([]*models.ModelRoute, error) {
+	query := `
+		SELECT ` + modelRouteColumns + `
+		FROM model_routes
+		ORDER BY created_at, id`
+
+	var routes []*models.ModelRoute
+	if err := s.db.SelectContext(ctx, &routes, query); err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
+
+// UpdateModelRoute replaces the name, target and conditions of a model route
+// and sets its UpdatedAt
+func (s *sqlStore) UpdateModelRoute(ctx context.Context, route *models.ModelRoute) error {
+	route.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE model_routes
+		SET name = $1, target_provider = $2, target_model = $3, api_key_id = $4, proxy_key_id = $5,
+			metadata_key = $6, metadata_value = $7, updated_at = $8
+		WHERE id = $9`
+
+	result, err := s.db.ExecContext(ctx, query,
+		route.Name, route.TargetProvider, route.TargetModel, route.APIKeyID, route.ProxyKeyID,
+		route.MetadataKey, route.MetadataValue, route.UpdatedAt.UTC(), route.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrModelRouteNotFound
+	}
+
+	return nil
+}
+
+// DeleteModelRoute deletes a model route
+func (s *sqlStore) DeleteModelRoute(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM model_routes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrModelRouteNotFound
+	}
+
+	return nil
+}
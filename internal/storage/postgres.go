@@ -2,31 +2,73 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
 )
 
 type PostgresStorage struct {
-	db             *sqlx.DB
+	sqlStore
 	logChan        chan *models.RequestLog
 	done           chan struct{}
+	wg             sync.WaitGroup
 	activeKeyCache *ActiveKeysCache
 	hllManager     *HLLManager
+	spill          *SpillFile
+
+	batchSize      int
+	flushInterval  time.Duration
+	replayInterval time.Duration
+
+	written  atomic.Uint64
+	dropped  atomic.Uint64
+	spilled  atomic.Uint64
+	replayed atomic.Uint64
 }
 
 // PostgresStorageConfig holds configuration for the storage layer.
 type PostgresStorageConfig struct {
 	HLLFlushInterval   time.Duration
 	ActiveKeysCacheTTL time.Duration
+
+	// Request log writer settings
+	BufferSize     int           // Capacity of the in-memory log queue
+	BatchSize      int           // Max logs per COPY batch
+	FlushInterval  time.Duration // Max time a log waits in a partial batch
+	SpillDir       string        // Directory for the spill file; empty disables spilling
+	SpillMaxBytes  int64         // Upper bound on spill file size; 0 means unbounded
+	ReplayInterval time.Duration // How often to try replaying spilled logs
 }
 
-func NewPostgresStorage(ctx context.Context, dsn string, maxConns int, cfg *PostgresStorageConfig) (*PostgresStorage, error) {
+// WriterStats reports counters for the request log writer.
+type WriterStats struct {
+	Written    uint64 `json:"written"`
+	Dropped    uint64 `json:"dropped"`
+	Spilled    uint64 `json:"spilled"`
+	Replayed   uint64 `json:"replayed"`
+	SpillBytes int64  `json:"spill_bytes"`
+}
+
+// requestLogColumns is the column order used for COPY into llm_requests.
+var requestLogColumns = []string{
+	"id", "user_id", "team_id", "organization_id", "majordomo_api_key_id", "proxy_key_id", "provider_api_key_hash", "provider_api_key_alias",
+	"provider", "model", "requested_model", "experiment_id", "experiment_arm", "shadow_of", "shadow_rule", "transforms", "redactions", "guardrails", "guardrail_action", "prompt_name", "prompt_version", "batch_id", "batch_custom_id", "request_path", "request_method",
+	"requested_at", "responded_at", "response_time_ms",
+	"input_tokens", "output_tokens", "cached_tokens", "cache_creation_tokens",
+	"input_cost", "output_cost", "total_cost",
+	"status_code", "error_message", "raw_metadata", "indexed_metadata",
+	"request_body", "response_body", "client_request_body", "client_response_body", "body_s3_key", "model_alias_found",
+}
+
+// OpenPostgres connects to Postgres and verifies the connection.
+func OpenPostgres(ctx context.Context, dsn string, maxConns int) (*sqlx.DB, error) {
 	db, err := sqlx.ConnectContext(ctx, "postgres", dsn)
 	if err != nil {
 		return nil, err
@@ -39,6 +81,15 @@ func NewPostgresStorage(ctx context.Context, dsn string, maxConns int, cfg *Post
 		return nil, err
 	}
 
+	return db, nil
+}
+
+func NewPostgresStorage(ctx context.Context, dsn string, maxConns int, cfg *PostgresStorageConfig) (*PostgresStorage, error) {
+	db, err := OpenPostgres(ctx, dsn, maxConns)
+	if err != nil {
+		return nil, err
+	}
+
 	// Use defaults if config not provided
 	if cfg == nil {
 		cfg = &PostgresStorageConfig{
@@ -46,13 +97,40 @@ func NewPostgresStorage(ctx context.Context, dsn string, maxConns int, cfg *Post
 			ActiveKeysCacheTTL: 5 * time.Minute,
 		}
 	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.ReplayInterval <= 0 {
+		cfg.ReplayInterval = 30 * time.Second
+	}
 
 	s := &PostgresStorage{
-		db:             db,
-		logChan:        make(chan *models.RequestLog, 1000),
+		sqlStore:       sqlStore{db: db},
+		logChan:        make(chan *models.RequestLog, cfg.BufferSize),
 		done:           make(chan struct{}),
 		activeKeyCache: NewActiveKeysCache(db, cfg.ActiveKeysCacheTTL),
 		hllManager:     NewHLLManager(db, cfg.HLLFlushInterval),
+		batchSize:      cfg.BatchSize,
+		flushInterval:  cfg.FlushInterval,
+		replayInterval: cfg.ReplayInterval,
+	}
+
+	if cfg.SpillDir != "" {
+		spill, err := NewSpillFile(cfg.SpillDir, cfg.SpillMaxBytes)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		s.spill = spill
+		if size := spill.Size(); size > 0 {
+			slog.Info("found spilled request logs from a previous run", "bytes", size, "dir", cfg.SpillDir)
+		}
 	}
 
 	// Load persisted HLLs on startup
@@ -61,111 +139,279 @@ func NewPostgresStorage(ctx context.Context, dsn string, maxConns int, cfg *Post
 	}
 
 	s.hllManager.Start()
+
+	s.wg.Add(1)
 	go s.writeLoop()
+	if s.spill != nil {
+		s.wg.Add(1)
+		go s.replayLoop()
+	}
 
 	return s, nil
 }
 
 func (s *PostgresStorage) writeLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.RequestLog, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.persistBatch(batch)
+		batch = make([]*models.RequestLog, 0, s.batchSize)
+	}
+
 	for {
 		select {
 		case log := <-s.logChan:
-			s.writeLog(log)
+			batch = append(batch, log)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
 		case <-s.done:
 			for len(s.logChan) > 0 {
-				s.writeLog(<-s.logChan)
+				batch = append(batch, <-s.logChan)
+				if len(batch) >= s.batchSize {
+					flush()
+				}
 			}
+			flush()
 			return
 		}
 	}
 }
 
-func (s *PostgresStorage) writeLog(log *models.RequestLog) {
-	ctx := context.Background()
+// persistBatch writes a batch to Postgres, spilling the rows not yet written
+// to disk if the database is unreachable.
+func (s *PostgresStorage) persistBatch(batch []*models.RequestLog) {
+	written, rejected, err := s.writeRows(context.Background(), batch)
+	if err != nil {
+		rest := batch[written+rejected:]
+		slog.Warn("database unavailable, spilling request logs", "error", err, "count", len(rest))
+		s.spillLogs(rest)
+	}
+}
 
-	// Get active keys from cache (only if we have a Majordomo API key)
-	var indexedMetadata map[string]string
-	if log.MajordomoAPIKeyID != nil {
-		activeKeys, _ := s.activeKeyCache.GetActiveKeys(ctx, *log.MajordomoAPIKeyID)
+// writeRows writes a batch to Postgres with writeOrRetryRows and counts the
+// rows written and dropped.
+func (s *PostgresStorage) writeRows(ctx context.Context, batch []*models.RequestLog) (written, rejected int, err error) {
+	written, rejected, err = writeOrRetryRows(batch,
+		func(batch []*models.RequestLog) error { return s.writeBatch(ctx, batch) },
+		func() error { return s.db.PingContext(ctx) },
+	)
+	s.written.Add(uint64(written))
+	s.dropped.Add(uint64(rejected))
+	return written, rejected, err
+}
 
-		// Split metadata into raw and indexed
-		indexedMetadata = make(map[string]string)
-		for key, value := range log.RawMetadata {
-			if activeKeys[key] {
-				indexedMetadata[key] = value
+// writeOrRetryRows writes a batch with write. If the batch is rejected while
+// the database is up, rows are retried one at a time so a single bad row
+// cannot block the rest, and the rows rejected again are dropped. A row is
+// only dropped if ping still succeeds after it failed; otherwise the write
+// error is returned, and the rows from batch[written+rejected:] on have not
+// been written.
+func writeOrRetryRows(batch []*models.RequestLog, write func([]*models.RequestLog) error, ping func() error) (written, rejected int, err error) {
+	err = write(batch)
+	if err == nil {
+		return len(batch), 0, nil
+	}
+
+	if pingErr := ping(); pingErr != nil {
+		return 0, 0, err
+	}
+
+	slog.Warn("batch write failed, retrying rows individually", "error", err, "count", len(batch))
+	for _, log := range batch {
+		if err := write([]*models.RequestLog{log}); err != nil {
+			if pingErr := ping(); pingErr != nil {
+				return written, rejected, err
 			}
+			slog.Error("failed to write request log, dropping it", "error", err, "request_id", log.ID)
+			rejected++
+			continue
 		}
-	} else {
-		indexedMetadata = make(map[string]string)
+		written++
 	}
+	return written, rejected, nil
+}
 
-	// Marshal both metadata columns
-	rawMetadataJSON, err := json.Marshal(log.RawMetadata)
+// writeBatch inserts the batch with a single COPY, adds it to the usage rollups
+// in the same transaction, and then records metadata keys and HLL values for
+// the rows that were written.
+func (s *PostgresStorage) writeBatch(ctx context.Context, batch []*models.RequestLog) error {
+	txn, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		slog.Error("failed to marshal raw metadata", "error", err)
-		rawMetadataJSON = []byte("{}")
+		return err
 	}
+	defer txn.Rollback()
 
-	indexedMetadataJSON, err := json.Marshal(indexedMetadata)
+	stmt, err := txn.PrepareContext(ctx, pq.CopyIn("llm_requests", requestLogColumns...))
 	if err != nil {
-		slog.Error("failed to marshal indexed metadata", "error", err)
-		indexedMetadataJSON = []byte("{}")
+		return err
 	}
 
-	query := `
-		INSERT INTO llm_requests (
-			id, user_id, majordomo_api_key_id, proxy_key_id, provider_api_key_hash, provider_api_key_alias,
-			provider, model, request_path, request_method,
-			requested_at, responded_at, response_time_ms,
-			input_tokens, output_tokens, cached_tokens, cache_creation_tokens,
-			input_cost, output_cost, total_cost,
-			status_code, error_message, raw_metadata, indexed_metadata,
-			request_body, response_body, body_s3_key, model_alias_found
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28
-		)`
-
-	_, err = s.db.ExecContext(ctx, query,
-		log.ID, log.UserID, log.MajordomoAPIKeyID, log.ProxyKeyID, log.ProviderAPIKeyHash, log.ProviderAPIKeyAlias,
-		log.Provider, log.Model, log.RequestPath, log.RequestMethod,
-		log.RequestedAt, log.RespondedAt, log.ResponseTimeMs,
-		log.InputTokens, log.OutputTokens, log.CachedTokens, log.CacheCreationTokens,
-		log.InputCost, log.OutputCost, log.TotalCost,
-		log.StatusCode, log.ErrorMessage, rawMetadataJSON, indexedMetadataJSON,
-		log.RequestBody, log.ResponseBody, log.BodyS3Key, log.ModelAliasFound,
-	)
-	if err != nil {
-		slog.Error("failed to write request log", "error", err, "request_id", log.ID)
-		return
+	indexed := make([]map[string]string, len(batch))
+	for i, log := range batch {
+		rawMetadataJSON, indexedMetadataJSON, indexedMetadata := s.activeKeyCache.SplitMetadata(ctx, log)
+		indexed[i] = indexedMetadata
+
+		_, err = stmt.ExecContext(ctx,
+			log.ID, log.UserID, log.TeamID, log.OrgID, log.MajordomoAPIKeyID, log.ProxyKeyID, log.ProviderAPIKeyHash, log.ProviderAPIKeyAlias,
+			log.Provider, log.Model, log.RequestedModel, log.ExperimentID, log.ExperimentArm, log.ShadowOf, log.ShadowRule, log.Transforms, log.Redactions, log.Guardrails, log.GuardrailAction, log.PromptName, log.PromptVersion, log.BatchID, log.BatchCustomID, log.RequestPath, log.RequestMethod,
+			log.RequestedAt, log.RespondedAt, log.ResponseTimeMs,
+			log.InputTokens, log.OutputTokens, log.CachedTokens, log.CacheCreationTokens,
+			log.InputCost, log.OutputCost, log.TotalCost,
+			log.StatusCode, log.ErrorMessage, rawMetadataJSON, indexedMetadataJSON,
+			log.RequestBody, log.ResponseBody, log.ClientRequestBody, log.ClientResponseBody, log.BodyS3Key, log.ModelAliasFound,
+		)
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// Flush buffered COPY data
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
 	}
 
-	// Update HLLs and register metadata keys (only if we have a Majordomo API key)
-	if log.MajordomoAPIKeyID != nil {
+	if err := upsertRollups(ctx, txn, batch, indexed); err != nil {
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	s.recordMetadata(ctx, batch)
+	return nil
+}
+
+// recordMetadata registers metadata keys and updates HLLs for written logs
+// (only for logs with a Majordomo API key).
+func (s *PostgresStorage) recordMetadata(ctx context.Context, batch []*models.RequestLog) {
+	keys := make(map[hllKey]struct{})
+	for _, log := range batch {
+		if log.MajordomoAPIKeyID == nil {
+			continue
+		}
 		for key, value := range log.RawMetadata {
+			keys[hllKey{MajordomoAPIKeyID: *log.MajordomoAPIKeyID, KeyName: key}] = struct{}{}
 			s.hllManager.AddValue(*log.MajordomoAPIKeyID, key, value)
 		}
-		s.registerMetadataKeys(ctx, *log.MajordomoAPIKeyID, log.RawMetadata)
 	}
+
+	s.registerMetadataKeys(ctx, keys)
 }
 
-func (s *PostgresStorage) registerMetadataKeys(ctx context.Context, apiKeyID uuid.UUID, metadata map[string]string) {
-	if len(metadata) == 0 {
+func (s *PostgresStorage) registerMetadataKeys(ctx context.Context, keys map[hllKey]struct{}) {
+	if len(keys) == 0 {
 		return
 	}
 
+	apiKeyIDs := make([]string, 0, len(keys))
+	keyNames := make([]string, 0, len(keys))
+	for k := range keys {
+		apiKeyIDs = append(apiKeyIDs, k.MajordomoAPIKeyID.String())
+		keyNames = append(keyNames, k.KeyName)
+	}
+
 	query := `
 		INSERT INTO llm_requests_metadata_keys (majordomo_api_key_id, key_name)
-		VALUES ($1, $2)
+		SELECT * FROM unnest($1::uuid[], $2::text[])
 		ON CONFLICT (majordomo_api_key_id, key_name) DO NOTHING`
 
-	for key := range metadata {
-		_, err := s.db.ExecContext(ctx, query, apiKeyID, key)
-		if err != nil {
-			slog.Warn("failed to register metadata key", "error", err, "key", key)
+	if _, err := s.db.ExecContext(ctx, query, pq.Array(apiKeyIDs), pq.Array(keyNames)); err != nil {
+		slog.Warn("failed to register metadata keys", "error", err, "count", len(keys))
+	}
+}
+
+func (s *PostgresStorage) spillLogs(batch []*models.RequestLog) {
+	if s.spill == nil {
+		slog.Error("dropping request logs, spill to disk is not configured", "count", len(batch))
+		s.dropped.Add(uint64(len(batch)))
+		return
+	}
+
+	if err := s.spill.Append(batch); err != nil {
+		slog.Error("failed to spill request logs, dropping", "error", err, "count", len(batch))
+		s.dropped.Add(uint64(len(batch)))
+		return
+	}
+	s.spilled.Add(uint64(len(batch)))
+}
+
+func (s *PostgresStorage) replayLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.replaySpill()
+		case <-s.done:
+			return
 		}
 	}
 }
 
+// replaySpill writes spilled logs back to Postgres once it is reachable again.
+func (s *PostgresStorage) replaySpill() {
+	if s.spill.Size() == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.db.PingContext(ctx); err != nil {
+		slog.Debug("database still unavailable, deferring spill replay", "error", err)
+		return
+	}
+
+	// Rows the database rejects are dropped, as they are on first write, so
+	// that they can't hold up the rest of the spill. If the database goes away
+	// partway through a batch, the whole batch is kept, and the rows already
+	// written are rejected as duplicates when it is replayed again.
+	n := 0
+	_, err := s.spill.Drain(s.batchSize, func(batch []*models.RequestLog) error {
+		written, _, err := s.writeRows(ctx, batch)
+		n += written
+		return err
+	})
+	if n > 0 {
+		s.replayed.Add(uint64(n))
+		slog.Info("replayed spilled request logs", "count", n)
+	}
+	if err != nil {
+		slog.Warn("spill replay interrupted", "error", err)
+	}
+}
+
+// Stats returns a snapshot of the request log writer counters.
+func (s *PostgresStorage) Stats() WriterStats {
+	stats := WriterStats{
+		Written:  s.written.Load(),
+		Dropped:  s.dropped.Load(),
+		Spilled:  s.spilled.Load(),
+		Replayed: s.replayed.Load(),
+	}
+	if s.spill != nil {
+		stats.SpillBytes = s.spill.Size()
+	}
+	return stats
+}
+
 func (s *PostgresStorage) Ping(ctx context.Context) error {
 	return s.db.PingContext(ctx)
 }
@@ -174,15 +420,56 @@ func (s *PostgresStorage) WriteRequestLog(ctx context.Context, log *models.Reque
 	select {
 	case s.logChan <- log:
 	default:
-		slog.Warn("request log channel full, dropping log", "request_id", log.ID)
+		slog.Warn("request log channel full, spilling log", "request_id", log.ID)
+		s.spillLogs([]*models.RequestLog{log})
+	}
+}
+
+// WriteRequestLogs writes logs right away, batchSize at a time, instead of
+// queueing them, so that many logs written at once can't overflow the queue.
+// If the database becomes unreachable, the logs not yet written are spilled.
+func (s *PostgresStorage) WriteRequestLogs(ctx context.Context, logs []*models.RequestLog) error {
+	for start := 0; start < len(logs); start += s.batchSize {
+		batch := logs[start:min(start+s.batchSize, len(logs))]
+		if written, rejected, err := s.writeRows(ctx, batch); err != nil {
+			rest := logs[start+written+rejected:]
+			if s.spill == nil {
+				return err
+			}
+			if spillErr := s.spill.Append(rest); spillErr != nil {
+				return fmt.Errorf("%w; spilling failed: %v", err, spillErr)
+			}
+			slog.Warn("database unavailable, spilling request logs", "error", err, "count", len(rest))
+			s.spilled.Add(uint64(len(rest)))
+			return nil
+		}
 	}
+	return nil
 }
 
 func (s *PostgresStorage) Close() error {
 	close(s.done)
+	s.wg.Wait()
+
 	// Stop HLL manager (triggers final flush)
 	if s.hllManager != nil {
 		s.hllManager.Stop()
 	}
-	return s.db.Close()
+
+	var errs []error
+	if s.spill != nil {
+		errs = append(errs, s.spill.Close())
+	}
+
+	stats := s.Stats()
+	slog.Info("request log writer stopped",
+		"written", stats.Written,
+		"dropped", stats.Dropped,
+		"spilled", stats.Spilled,
+		"replayed", stats.Replayed,
+		"spill_bytes", stats.SpillBytes,
+	)
+
+	errs = append(errs, s.db.Close())
+	return errors.Join(errs...)
 }
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var ErrPromptNotFound = errors.New("prompt template not found")
+
+const promptColumns = `id, name, version, description, messages, created_at`
+
+// CreatePromptVersion stores a new version of the named prompt template. The
+// ID, version and timestamp are filled in; the version is one more than the
+// latest stored version, or 1 for a new name.
+func (s *sqlStore) CreatePromptVersion(ctx context.Context, prompt *models.PromptTemplate) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var latest int
+	if err := tx.GetContext(ctx, &latest, `SELECT COALESCE(MAX(version), 0) FROM prompt_templates WHERE name = $1`, prompt.Name); err != nil {
+		return err
+	}
+
+	prompt.ID = uuid.New()
+	prompt.Version = latest + 1
+	prompt.CreatedAt = time.Now()
+
+	// Two versions created at once for the same name conflict on the unique
+	// (name, version) constraint, and the second fails
+	query := `
+		INSERT INTO prompt_templates (` + promptColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	if _, err := tx.ExecContext(ctx, query,
+		prompt.ID, prompt.Name, prompt.Version, prompt.Description, prompt.Messages, prompt.CreatedAt.UTC(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPromptVersion retrieves a version of the named prompt template, or the
+// latest version if version is 0
+func (s *sqlStore) GetPromptVersion(ctx context.Context, name string, version int) (*models.PromptTemplate, error) {
+	query := `
+		SELECT ` + promptColumns + `
+		FROM prompt_templates
+		WHERE name = $1 AND version = $2`
+	args := []any{name, version}
+	if version == 0 {
+		query = `
+			SELECT ` + promptColumns + `
+			FROM prompt_templates
+			WHERE name = $1
+			ORDER BY version DESC
+			LIMIT 1`
+		args = args[:1]
+	}
+
+	var prompt models.PromptTemplate
+	err := s.db.GetContext(ctx, &prompt, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromptNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &prompt, nil
+}
+
+// ListPrompts retrieves the latest version of every prompt template, by name
+func (s *sqlStore) ListPrompts(ctx context.Context) ([]*models.PromptTemplate, error) {
+	query := `
+		SELECT ` + promptColumns + `
+		FROM prompt_templates p
+		WHERE version = (SELECT MAX(version) FROM prompt_templates WHERE name = p.name)
+		ORDER BY name`
+
+	var prompts []*models.PromptTemplate
+	if err := s.db.SelectContext(ctx, &prompts, query); err != nil {
+		return nil, err
+	}
+
+	return prompts, nil
+}
+
+// ListPromptVersions retrieves every version of the named prompt template,
+// newest first
+func (s *sqlStore) ListPromptVersions(ctx context.Context, name string) ([]*models.PromptTemplate, error) {
+	query := `
+		SELECT ` + promptColumns + `
+		FROM prompt_templates
+		WHERE name = $1
+		ORDER BY version DESC`
+
+	var prompts []*models.PromptTemplate
+	if err := s.db.SelectContext(ctx, &prompts, query, name); err != nil {
+		return nil, err
+	}
+
+	return prompts, nil
+}
+
+// DeletePromptVersion deletes a version of the named prompt template.
+// Requests that reference it fail from then on; later versions keep their
+// numbers.
+func (s *sqlStore) DeletePromptVersion(ctx context.Context, name string, version int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM prompt_templates WHERE name = $1 AND version = $2`, name, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPromptNotFound
+	}
+
+	return nil
+}
+
+// PromptResults compares the requests rendered from each version of the
+// named prompt template between from and to
+func (s *sqlStore) PromptResults(ctx context.Context, name string, from, to time.Time) ([]*models.PromptVersionResult, error) {
+	query := `
+		SELECT prompt_version,
+			COUNT(*) AS request_count,
+			SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) AS error_count,
+			SUM(input_tokens) AS input_tokens,
+			SUM(output_tokens) AS output_tokens,
+			CAST(SUM(total_cost) AS DOUBLE PRECISION) AS total_cost,
+			CAST(AVG(response_time_ms) AS DOUBLE PRECISION) AS avg_response_time_ms,
+			MAX(response_time_ms) AS max_response_time_ms
+		FROM llm_requests
+		WHERE prompt_name = $1 AND requested_at >= $2 AND requested_at < $3
+		GROUP BY prompt_version
+		ORDER BY prompt_version`
+
+	var results []*models.PromptVersionResult
+	if err := s.db.SelectContext(ctx, &results, query, name, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		if r.RequestCount > 0 {
+			r.ErrorRate = float64(r.ErrorCount) / float64(r.RequestCount)
+			r.CostPerRequest = r.TotalCost / float64(r.RequestCount)
+		}
+	}
+	return results, nil
+}
@@ -16,14 +16,14 @@ var (
 )
 
 // CreateProxyKey creates a new proxy key in the database
-func (s *PostgresStorage) CreateProxyKey(ctx context.Context, keyHash string, majordomoKeyID uuid.UUID, input *models.CreateProxyKeyInput) (*models.ProxyKey, error) {
+func (s *sqlStore) CreateProxyKey(ctx context.Context, keyHash string, majordomoKeyID uuid.UUID, input *models.CreateProxyKeyInput) (*models.ProxyKey, error) {
 	query := `
-		INSERT INTO proxy_keys (key_hash, name, description, majordomo_api_key_id)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, key_hash, name, description, majordomo_api_key_id, is_active, created_at, revoked_at, last_used_at, request_count`
+		INSERT INTO proxy_keys (id, key_hash, name, description, majordomo_api_key_id, single_header_auth)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, key_hash, name, description, majordomo_api_key_id, single_header_auth, is_active, created_at, revoked_at, last_used_at, request_count`
 
 	var key models.ProxyKey
-	err := s.db.QueryRowxContext(ctx, query, keyHash, input.Name, input.Description, majordomoKeyID).StructScan(&key)
+	err := s.db.QueryRowxContext(ctx, query, uuid.New(), keyHash, input.Name, input.Description, majordomoKeyID, input.SingleHeaderAuth).StructScan(&key)
 	if err != nil {
 		return nil, err
 	}
@@ -32,9 +32,9 @@ func (s *PostgresStorage) CreateProxyKey(ctx context.Context, keyHash string, ma
 }
 
 // GetProxyKeyByHash retrieves a proxy key by its hash
-func (s *PostgresStorage) GetProxyKeyByHash(ctx context.Context, keyHash string) (*models.ProxyKey, error) {
+func (s *sqlStore) GetProxyKeyByHash(ctx context.Context, keyHash string) (*models.ProxyKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, majordomo_api_key_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, majordomo_api_key_id, single_header_auth, is_active, created_at, revoked_at, last_used_at, request_count
 		FROM proxy_keys
 		WHERE key_hash = $1`
 
@@ -51,9 +51,9 @@ func (s *PostgresStorage) GetProxyKeyByHash(ctx context.Context, keyHash string)
 }
 
 // GetProxyKeyByID retrieves a proxy key by its UUID
-func (s *PostgresStorage) GetProxyKeyByID(ctx context.Context, id uuid.UUID) (*models.ProxyKey, error) {
+func (s *sqlStore) GetProxyKeyByID(ctx context.Context, id uuid.UUID) (*models.ProxyKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, majordomo_api_key_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, majordomo_api_key_id, single_header_auth, is_active, created_at, revoked_at, last_used_at, request_count
 		FROM proxy_keys
 		WHERE id = $1`
 
@@ -70,9 +70,9 @@ func (s *PostgresStorage) GetProxyKeyByID(ctx context.Context, id uuid.UUID) (*m
 }
 
 // ListProxyKeys retrieves all proxy keys for a given Majordomo API key
-func (s *PostgresStorage) ListProxyKeys(ctx context.Context, majordomoKeyID uuid.UUID) ([]*models.ProxyKey, error) {
+func (s *sqlStore) ListProxyKeys(ctx context.Context, majordomoKeyID uuid.UUID) ([]*models.ProxyKey, error) {
 	query := `
-		SELECT id, key_hash, name, description, majordomo_api_key_id, is_active, created_at, revoked_at, last_used_at, request_count
+		SELECT id, key_hash, name, description, majordomo_api_key_id, single_header_auth, is_active, created_at, revoked_at, last_used_at, request_count
 		FROM proxy_keys
 		WHERE majordomo_api_key_id = $1
 		ORDER BY created_at DESC`
@@ -87,7 +87,7 @@ func (s *PostgresStorage) ListProxyKeys(ctx context.Context, majordomoKeyID uuid
 }
 
 // RevokeProxyKey marks a proxy key as revoked
-func (s *PostgresStorage) RevokeProxyKey(ctx context.Context, id uuid.UUID) error {
+func (s *sqlStore) RevokeProxyKey(ctx context.Context, id uuid.UUID) error {
 	query := `
 		UPDATE proxy_keys
 		SET is_active = false, revoked_at = $1
@@ -110,8 +110,33 @@ func (s *PostgresStorage) RevokeProxyKey(ctx context.Context, id uuid.UUID) erro
 	return nil
 }
 
+// SetProxyKeySingleHeaderAuth turns single-header auth on or off for an
+// active proxy key
+func (s *sqlStore) SetProxyKeySingleHeaderAuth(ctx context.Context, id uuid.UUID, enabled bool) error {
+	query := `
+		UPDATE proxy_keys
+		SET single_header_auth = $1
+		WHERE id = $2 AND is_active = true`
+
+	result, err := s.db.ExecContext(ctx, query, enabled, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrProxyKeyNotFound
+	}
+
+	return nil
+}
+
 // UpdateProxyKeyLastUsed updates the last_used_at timestamp and increments request_count
-func (s *PostgresStorage) UpdateProxyKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+func (s *sqlStore) UpdateProxyKeyLastUsed(ctx context.Context, id uuid.UUID) error {
 	query := `
 		UPDATE proxy_keys
 		SET last_used_at = $1, request_count = request_count + 1
@@ -122,19 +147,19 @@ func (s *PostgresStorage) UpdateProxyKeyLastUsed(ctx context.Context, id uuid.UU
 }
 
 // SetProviderMapping creates or updates a provider mapping for a proxy key
-func (s *PostgresStorage) SetProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string, encryptedKey string) error {
+func (s *sqlStore) SetProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string, encryptedKey string) error {
 	query := `
-		INSERT INTO proxy_key_provider_mappings (proxy_key_id, provider, encrypted_key)
-		VALUES ($1, $2, $3)
+		INSERT INTO proxy_key_provider_mappings (id, proxy_key_id, provider, encrypted_key)
+		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (proxy_key_id, provider) DO UPDATE
-		SET encrypted_key = EXCLUDED.encrypted_key, updated_at = now()`
+		SET encrypted_key = EXCLUDED.encrypted_key, updated_at = CURRENT_TIMESTAMP`
 
-	_, err := s.db.ExecContext(ctx, query, proxyKeyID, provider, encryptedKey)
+	_, err := s.db.ExecContext(ctx, query, uuid.New(), proxyKeyID, provider, encryptedKey)
 	return err
 }
 
 // GetProviderMapping retrieves a provider mapping for a proxy key and provider
-func (s *PostgresStorage) GetProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string) (*models.ProviderMapping, error) {
+func (s *sqlStore) GetProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string) (*models.ProviderMapping, error) {
 	query := `
 		SELECT id, proxy_key_id, provider, encrypted_key, created_at, updated_at
 		FROM proxy_key_provider_mappings
@@ -153,7 +178,7 @@ func (s *PostgresStorage) GetProviderMapping(ctx context.Context, proxyKeyID uui
 }
 
 // ListProviderMappings retrieves all provider mappings for a proxy key
-func (s *PostgresStorage) ListProviderMappings(ctx context.Context, proxyKeyID uuid.UUID) ([]*models.ProviderMapping, error) {
+func (s *sqlStore) ListProviderMappings(ctx context.Context, proxyKeyID uuid.UUID) ([]*models.ProviderMapping, error) {
 	query := `
 		SELECT id, proxy_key_id, provider, encrypted_key, created_at, updated_at
 		FROM proxy_key_provider_mappings
@@ -170,7 +195,7 @@ func (s *PostgresStorage) ListProviderMappings(ctx context.Context, proxyKeyID u
 }
 
 // DeleteProviderMapping removes a provider mapping for a proxy key
-func (s *PostgresStorage) DeleteProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string) error {
+func (s *sqlStore) DeleteProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string) error {
 	query := `
 		DELETE FROM proxy_key_provider_mappings
 		WHERE proxy_key_id = $1 AND provider = $2`
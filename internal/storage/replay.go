@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// DefaultReplayLimit and MaxReplayLimit bound the number of requests
+// ListReplayRequests returns.
+const (
+	DefaultReplayLimit = 100
+	MaxReplayLimit     = 10000
+)
+
+// ListReplayRequests returns the logged requests matching the query whose
+// body was stored in the database or S3, oldest first. Requests that replayed
+// another and batch API calls are left out.
+func (s *sqlStore) ListReplayRequests(ctx context.Context, q *models.ReplayQuery) ([]*models.LoggedRequest, error) {
+	where := []string{"shadow_of IS NULL", "batch_id IS NULL", "(request_body IS NOT NULL OR body_s3_key IS NOT NULL)"}
+	args := []interface{}{models.ReplayOfMetadataKey}
+	where = append(where, "raw_metadata ->> CAST($1 AS TEXT) IS NULL")
+	addFilter := func(column, op string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf("%s %s $%d", column, op, len(args)))
+	}
+
+	if !q.From.IsZero() {
+		addFilter("requested_at", ">=", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		addFilter("requested_at", "<", q.To.UTC())
+	}
+	if q.MajordomoAPIKeyID != nil {
+		addFilter("majordomo_api_key_id", "=", *q.MajordomoAPIKeyID)
+	}
+	if q.Provider != "" {
+		addFilter("provider", "=", q.Provider)
+	}
+	if q.Model != "" {
+		addFilter("model", "=", q.Model)
+	}
+
+	// raw_metadata holds every metadata key, indexed or not
+	keys := make([]string, 0, len(q.Metadata))
+	for key := range q.Metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		args = append(args, key, q.Metadata[key])
+		where = append(where, fmt.Sprintf("raw_metadata ->> CAST($%d AS TEXT) = $%d", len(args)-1, len(args)))
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultReplayLimit
+	}
+	if limit > MaxReplayLimit {
+		limit = MaxReplayLimit
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, provider, model, request_path, request_method, prompt_name, prompt_version,
+			requested_at, response_time_ms, input_tokens, output_tokens,
+			CAST(total_cost AS DOUBLE PRECISION) AS total_cost, status_code, raw_metadata,
+			request_body, response_body, client_request_body, client_response_body, body_s3_key
+		FROM llm_requests
+		WHERE %s
+		ORDER BY requested_at, id
+		LIMIT %d`, strings.Join(where, " AND "), limit)
+
+	var rows []struct {
+		models.LoggedRequest
+		RawMetadata *string `db:"raw_metadata"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	requests := make([]*models.LoggedRequest, len(rows))
+	for i := range rows {
+		r := &rows[i].LoggedRequest
+		if raw := rows[i].RawMetadata; raw != nil {
+			json.Unmarshal([]byte(*raw), &r.Metadata)
+		}
+		requests[i] = r
+	}
+	return requests, nil
+}
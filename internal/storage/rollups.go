@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var (
+	ErrInvalidGranularity = fmt.Errorf("granularity must be %q or %q", models.GranularityHour, models.GranularityDay)
+	ErrRebuildBeforeData  = fmt.Errorf("rebuild range starts before the oldest retained request")
+)
+
+// rollupTables maps a granularity to its rollup table.
+var rollupTables = map[string]string{
+	models.GranularityHour: "usage_rollups_hourly",
+	models.GranularityDay:  "usage_rollups_daily",
+}
+
+// rollupColumns is the column order used when upserting rollup rows.
+var rollupColumns = []string{
+	"bucket", "majordomo_api_key_id", "proxy_key_id", "user_id", "team_id", "organization_id", "provider", "model", "metadata_key", "metadata_value",
+	"request_count", "error_count", "input_tokens", "output_tokens", "cached_tokens", "cache_creation_tokens",
+	"input_cost", "output_cost", "total_cost", "response_time_ms_sum",
+}
+
+// rollupConflictTarget matches the unique index on both rollup tables.
+const rollupConflictTarget = `(
+	bucket,
+	COALESCE(majordomo_api_key_id, '00000000-0000-0000-0000-000000000000'),
+	COALESCE(proxy_key_id, '00000000-0000-0000-0000-000000000000'),
+	COALESCE(user_id, '00000000-0000-0000-0000-000000000000'),
+	COALESCE(team_id, '00000000-0000-0000-0000-000000000000'),
+	COALESCE(organization_id, '00000000-0000-0000-0000-000000000000'),
+	provider, model, metadata_key, metadata_value
+)`
+
+// rollupMaxRowsPerStatement keeps upserts well below Postgres' parameter limit.
+const rollupMaxRowsPerStatement = 500
+
+type rollupKey struct {
+	Bucket        time.Time
+	APIKeyID      uuid.NullUUID
+	ProxyKeyID    uuid.NullUUID
+	UserID        uuid.NullUUID
+	TeamID        uuid.NullUUID
+	OrgID         uuid.NullUUID
+	Provider      string
+	Model         string
+	MetadataKey   string
+	MetadataValue string
+}
+
+type rollupTotals struct {
+	Requests            int64
+	Errors              int64
+	InputTokens         int64
+	OutputTokens        int64
+	CachedTokens        int64
+	CacheCreationTokens int64
+	InputCost           float64
+	OutputCost          float64
+	TotalCost           float64
+	ResponseTimeMs      int64
+}
+
+// truncateBucket returns the start of the UTC hour or day containing t.
+func truncateBucket(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	if granularity == models.GranularityDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+func nullUUID(id *uuid.UUID) uuid.NullUUID {
+	if id == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *id, Valid: true}
+}
+
+// aggregateRollups sums logs into rollup rows for one granularity. Each log
+// contributes to a totals row (empty metadata key) and to one row per indexed
+// metadata key. indexed[i] holds the indexed metadata for logs[i]. Shadow
+// requests are left out, so they count towards neither usage nor budgets.
+func aggregateRollups(logs []*models.RequestLog, indexed []map[string]string, granularity string) map[rollupKey]*rollupTotals {
+	rows := make(map[rollupKey]*rollupTotals)
+
+	add := func(key rollupKey, log *models.RequestLog) {
+		t, ok := rows[key]
+		if !ok {
+			t = &rollupTotals{}
+			rows[key] = t
+		}
+		t.Requests++
+		if log.StatusCode >= 400 {
+			t.Errors++
+		}
+		t.InputTokens += int64(log.InputTokens)
+		t.OutputTokens += int64(log.OutputTokens)
+		t.CachedTokens += int64(log.CachedTokens)
+		t.CacheCreationTokens += int64(log.CacheCreationTokens)
+		t.InputCost += log.InputCost
+		t.OutputCost += log.OutputCost
+		t.TotalCost += log.TotalCost
+		t.ResponseTimeMs += log.ResponseTimeMs
+	}
+
+	for i, log := range logs {
+		if log.ShadowOf != nil {
+			continue
+		}
+		key := rollupKey{
+			Bucket:     truncateBucket(log.RequestedAt, granularity),
+			APIKeyID:   nullUUID(log.MajordomoAPIKeyID),
+			ProxyKeyID: nullUUID(log.ProxyKeyID),
+			UserID:     nullUUID(log.UserID),
+			TeamID:     nullUUID(log.TeamID),
+			OrgID:      nullUUID(log.OrgID),
+			Provider:   log.Provider,
+			Model:      log.Model,
+		}
+		add(key, log)
+
+		if i < len(indexed) {
+			for k, v := range indexed[i] {
+				mk := key
+				mk.MetadataKey = k
+				mk.MetadataValue = v
+				add(mk, log)
+			}
+		}
+	}
+
+	return rows
+}
+
+// sortedRollupKeys orders keys deterministically so concurrent writers lock
+// rollup rows in the same order.
+func sortedRollupKeys(rows map[rollupKey]*rollupTotals) []rollupKey {
+	keys := make([]rollupKey, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.Before(b.Bucket)
+		}
+		if a.APIKeyID.UUID != b.APIKeyID.UUID {
+			return a.APIKeyID.UUID.String() < b.APIKeyID.UUID.String()
+		}
+		if a.ProxyKeyID.UUID != b.ProxyKeyID.UUID {
+			return a.ProxyKeyID.UUID.String() < b.ProxyKeyID.UUID.String()
+		}
+		if a.UserID.UUID != b.UserID.UUID {
+			return a.UserID.UUID.String() < b.UserID.UUID.String()
+		}
+		if a.TeamID.UUID != b.TeamID.UUID {
+			return a.TeamID.UUID.String() < b.TeamID.UUID.String()
+		}
+		if a.OrgID.UUID != b.OrgID.UUID {
+			return a.OrgID.UUID.String() < b.OrgID.UUID.String()
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		if a.MetadataKey != b.MetadataKey {
+			return a.MetadataKey < b.MetadataKey
+		}
+		return a.MetadataValue < b.MetadataValue
+	})
+	return keys
+}
+
+// upsertRollups adds the batch's totals to the hourly and daily rollup tables
+// inside the caller's transaction.
+func upsertRollups(ctx context.Context, tx *sql.Tx, logs []*models.RequestLog, indexed []map[string]string) error {
+	for _, granularity := range []string{models.GranularityHour, models.GranularityDay} {
+		rows := aggregateRollups(logs, indexed, granularity)
+		keys := sortedRollupKeys(rows)
+
+		for start := 0; start < len(keys); start += rollupMaxRowsPerStatement {
+			end := min(start+rollupMaxRowsPerStatement, len(keys))
+			query, args := buildRollupUpsert(rollupTables[granularity], keys[start:end], rows)
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return fmt.Errorf("failed to update %s: %w", rollupTables[granularity], err)
+			}
+		}
+	}
+	return nil
+}
+
+func buildRollupUpsert(table string, keys []rollupKey, rows map[rollupKey]*rollupTotals) (string, []interface{}) {
+	var b strings.Builder
+	args := make([]interface{}, 0, len(keys)*len(rollupColumns))
+
+	fmt.Fprintf(&b, "INSERT INTO %s AS u (%s) VALUES ", table, strings.Join(rollupColumns, ", "))
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range rollupColumns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", len(args)+j+1)
+		}
+		b.WriteString(")")
+
+		t := rows[k]
+		args = append(args,
+			k.Bucket, k.APIKeyID, k.ProxyKeyID, k.UserID, k.TeamID, k.OrgID, k.Provider, k.Model, k.MetadataKey, k.MetadataValue,
+			t.Requests, t.Errors, t.InputTokens, t.OutputTokens, t.CachedTokens, t.CacheCreationTokens,
+			t.InputCost, t.OutputCost, t.TotalCost, t.ResponseTimeMs,
+		)
+	}
+
+	fmt.Fprintf(&b, ` ON CONFLICT %s DO UPDATE SET
+		request_count = u.request_count + EXCLUDED.request_count,
+		error_count = u.error_count + EXCLUDED.error_count,
+		input_tokens = u.input_tokens + EXCLUDED.input_tokens,
+		output_tokens = u.output_tokens + EXCLUDED.output_tokens,
+		cached_tokens = u.cached_tokens + EXCLUDED.cached_tokens,
+		cache_creation_tokens = u.cache_creation_tokens + EXCLUDED.cache_creation_tokens,
+		input_cost = u.input_cost + EXCLUDED.input_cost,
+		output_cost = u.output_cost + EXCLUDED.output_cost,
+		total_cost = u.total_cost + EXCLUDED.total_cost,
+		response_time_ms_sum = u.response_time_ms_sum + EXCLUDED.response_time_ms_sum,
+		updated_at = CURRENT_TIMESTAMP`, rollupConflictTarget)
+
+	return b.String(), args
+}
+
+// RebuildRollups recomputes hourly and daily rollups for [from, to) from
+// llm_requests. The range is widened to whole UTC days so daily buckets are
+// rebuilt completely. Rebuilding is idempotent; it refuses ranges that start
+// before the oldest retained request, since rollups are the only record of
+// expired rows. It returns the number of request rows scanned.
+func (s *PostgresStorage) RebuildRollups(ctx context.Context, from, to time.Time) (int64, error) {
+	from = truncateBucket(from, models.GranularityDay)
+	if dayStart := truncateBucket(to, models.GranularityDay); !dayStart.Equal(to.UTC()) {
+		to = dayStart.AddDate(0, 0, 1)
+	}
+
+	var oldest sql.NullTime
+	if err := s.db.GetContext(ctx, &oldest, `SELECT MIN(requested_at) FROM llm_requests`); err != nil {
+		return 0, err
+	}
+	if !oldest.Valid || from.Before(truncateBucket(oldest.Time, models.GranularityDay)) {
+		return 0, ErrRebuildBeforeData
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Block concurrent rollup writers so rows committed during the rebuild are
+	// neither lost nor counted twice.
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE usage_rollups_hourly, usage_rollups_daily IN EXCLUSIVE MODE`); err != nil {
+		return 0, err
+	}
+
+	var scanned int64
+	if err := tx.GetContext(ctx, &scanned, `SELECT COUNT(*) FROM llm_requests WHERE requested_at >= $1 AND requested_at < $2`, from, to); err != nil {
+		return 0, err
+	}
+
+	for _, granularity := range []string{models.GranularityHour, models.GranularityDay} {
+		if err := rebuildRollupTable(ctx, tx, granularity, from, to); err != nil {
+			return 0, err
+		}
+	}
+
+	return scanned, tx.Commit()
+}
+
+func rebuildRollupTable(ctx context.Context, tx *sqlx.Tx, granularity string, from, to time.Time) error {
+	table := rollupTables[granularity]
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE bucket >= $1 AND bucket < $2`, table), from, to); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", table, err)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (%s)
+		SELECT
+			date_trunc('%s', r.requested_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+			r.majordomo_api_key_id, r.proxy_key_id, r.user_id, r.team_id, r.organization_id, r.provider, r.model, m.key, m.value,
+			COUNT(*), COUNT(*) FILTER (WHERE r.status_code >= 400),
+			SUM(r.input_tokens), SUM(r.output_tokens), SUM(COALESCE(r.cached_tokens, 0)), SUM(COALESCE(r.cache_creation_tokens, 0)),
+			SUM(r.input_cost), SUM(r.output_cost), SUM(r.total_cost), SUM(r.response_time_ms)
+		FROM llm_requests r
+		CROSS JOIN LATERAL (
+			SELECT ''::text AS key, ''::text AS value
+			UNION ALL
+			SELECT key, value FROM jsonb_each_text(COALESCE(r.indexed_metadata, '{}'::jsonb))
+		) m
+		WHERE r.requested_at >= $1 AND r.requested_at < $2 AND r.shadow_of IS NULL
+		GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10`,
+		table, strings.Join(rollupColumns, ", "), granularity)
+
+	if _, err := tx.ExecContext(ctx, query, from, to); err != nil {
+		return fmt.Errorf("failed to rebuild %s: %w", table, err)
+	}
+	return nil
+}
+
+// QueryUsage returns rollup rows matching the query, grouped by bucket,
+// provider and model (and metadata value when a metadata key is given).
+func (s *sqlStore) QueryUsage(ctx context.Context, q *models.UsageQuery) ([]*models.UsageRollup, error) {
+	table, ok := rollupTables[q.Granularity]
+	if !ok {
+		return nil, ErrInvalidGranularity
+	}
+
+	where := []string{"bucket >= $1", "bucket < $2", "metadata_key = $3"}
+	args := []interface{}{q.From.UTC(), q.To.UTC(), q.MetadataKey}
+	addFilter := func(column string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if q.MajordomoAPIKeyID != nil {
+		addFilter("majordomo_api_key_id", *q.MajordomoAPIKeyID)
+	}
+	if q.ProxyKeyID != nil {
+		addFilter("proxy_key_id", *q.ProxyKeyID)
+	}
+	if q.UserID != nil {
+		addFilter("user_id", *q.UserID)
+	}
+	if q.TeamID != nil {
+		addFilter("team_id", *q.TeamID)
+	}
+	if q.OrgID != nil {
+		addFilter("organization_id", *q.OrgID)
+	}
+	if q.Provider != "" {
+		addFilter("provider", q.Provider)
+	}
+	if q.Model != "" {
+		addFilter("model", q.Model)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT bucket, provider, model, metadata_value,
+			SUM(request_count) AS request_count,
+			SUM(error_count) AS error_count,
+			SUM(input_tokens) AS input_tokens,
+			SUM(output_tokens) AS output_tokens,
+			SUM(cached_tokens) AS cached_tokens,
+			SUM(cache_creation_tokens) AS cache_creation_tokens,
+			CAST(SUM(input_cost) AS DOUBLE PRECISION) AS input_cost,
+			CAST(SUM(output_cost) AS DOUBLE PRECISION) AS output_cost,
+			CAST(SUM(total_cost) AS DOUBLE PRECISION) AS total_cost,
+			SUM(response_time_ms_sum) AS response_time_ms_sum
+		FROM %s
+		WHERE %s
+		GROUP BY bucket, provider, model, metadata_value
+		ORDER BY bucket, provider, model, metadata_value`,
+		table, strings.Join(where, " AND "))
+
+	var rows []*models.UsageRollup
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// TeamCostSince returns a team's total cost from the daily rollups, starting
+// with the UTC day containing since.
+func (s *sqlStore) TeamCostSince(ctx context.Context, teamID uuid.UUID, since time.Time) (float64, error) {
+	query := `
+		SELECT CAST(COALESCE(SUM(total_cost), 0) AS DOUBLE PRECISION)
+		FROM usage_rollups_daily
+		WHERE team_id = $1 AND metadata_key = '' AND bucket >= $2`
+
+	var cost float64
+	if err := s.db.GetContext(ctx, &cost, query, teamID, truncateBucket(since, models.GranularityDay)); err != nil {
+		return 0, err
+	}
+	return cost, nil
+}
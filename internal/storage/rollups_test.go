@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+func TestTruncateBucket(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 1, 45, 30, 0, time.FixedZone("UTC+2", 2*3600))
+
+	if got := truncateBucket(ts, models.GranularityHour); !got.Equal(time.Date(2026, 2, 28, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("hour bucket = %v", got)
+	}
+	if got := truncateBucket(ts, models.GranularityDay); !got.Equal(time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("day bucket = %v", got)
+	}
+}
+
+func TestAggregateRollups(t *testing.T) {
+	apiKey := uuid.New()
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	logs := []*models.RequestLog{
+		{MajordomoAPIKeyID: &apiKey, Provider: "openai", Model: "gpt-4o", RequestedAt: base.Add(5 * time.Minute), InputTokens: 10, OutputTokens: 5, TotalCost: 0.5, StatusCode: 200, ResponseTimeMs: 100},
+		{MajordomoAPIKeyID: &apiKey, Provider: "openai", Model: "gpt-4o", RequestedAt: base.Add(50 * time.Minute), InputTokens: 20, OutputTokens: 7, TotalCost: 0.25, StatusCode: 500, ResponseTimeMs: 300},
+		{MajordomoAPIKeyID: &apiKey, Provider: "openai", Model: "gpt-4o", RequestedAt: base.Add(90 * time.Minute), InputTokens: 1, StatusCode: 200},
+	}
+	indexed := []map[string]string{
+		{"team": "search"},
+		{"team": "ads"},
+		nil,
+	}
+
+	t.Run("hourly", func(t *testing.T) {
+		rows := aggregateRollups(logs, indexed, models.GranularityHour)
+
+		// Two totals rows (10:00, 11:00) and two metadata rows at 10:00.
+		if len(rows) != 4 {
+			t.Fatalf("got %d rows, want 4", len(rows))
+		}
+
+		totals := rows[rollupKey{Bucket: base, APIKeyID: nullUUID(&apiKey), Provider: "openai", Model: "gpt-4o"}]
+		if totals == nil {
+			t.Fatal("missing 10:00 totals row")
+		}
+		if totals.Requests != 2 || totals.Errors != 1 || totals.InputTokens != 30 || totals.OutputTokens != 12 || totals.ResponseTimeMs != 400 {
+			t.Errorf("unexpected totals: %+v", totals)
+		}
+		if totals.TotalCost != 0.75 {
+			t.Errorf("total cost = %v, want 0.75", totals.TotalCost)
+		}
+
+		search := rows[rollupKey{Bucket: base, APIKeyID: nullUUID(&apiKey), Provider: "openai", Model: "gpt-4o", MetadataKey: "team", MetadataValue: "search"}]
+		if search == nil || search.Requests != 1 || search.InputTokens != 10 {
+			t.Errorf("unexpected team=search row: %+v", search)
+		}
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		rows := aggregateRollups(logs, indexed, models.GranularityDay)
+		day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+		totals := rows[rollupKey{Bucket: day, APIKeyID: nullUUID(&apiKey), Provider: "openai", Model: "gpt-4o"}]
+		if totals == nil || totals.Requests != 3 || totals.InputTokens != 31 {
+			t.Errorf("unexpected daily totals: %+v", totals)
+		}
+		if len(rows) != 3 {
+			t.Errorf("got %d rows, want 3", len(rows))
+		}
+	})
+}
+
+func TestAggregateRollupsNilIDs(t *testing.T) {
+	logs := []*models.RequestLog{{Provider: "anthropic", Model: "claude", RequestedAt: time.Now()}}
+	rows := aggregateRollups(logs, nil, models.GranularityHour)
+
+	for k := range rows {
+		if k.APIKeyID.Valid || k.ProxyKeyID.Valid || k.UserID.Valid || k.TeamID.Valid || k.OrgID.Valid {
+			t.Errorf("expected NULL ids, got %+v", k)
+		}
+	}
+}
+
+func TestBuildRollupUpsert(t *testing.T) {
+	apiKey := uuid.New()
+	logs := []*models.RequestLog{
+		{MajordomoAPIKeyID: &apiKey, Provider: "openai", Model: "b", RequestedAt: time.Now()},
+		{MajordomoAPIKeyID: &apiKey, Provider: "openai", Model: "a", RequestedAt: time.Now()},
+	}
+	rows := aggregateRollups(logs, nil, models.GranularityDay)
+	keys := sortedRollupKeys(rows)
+
+	if keys[0].Model != "a" || keys[1].Model != "b" {
+		t.Errorf("keys not sorted: %+v", keys)
+	}
+
+	query, args := buildRollupUpsert("usage_rollups_daily", keys, rows)
+	if len(args) != 2*len(rollupColumns) {
+		t.Errorf("got %d args, want %d", len(args), 2*len(rollupColumns))
+	}
+	if !strings.Contains(query, "$40)") {
+		t.Errorf("expected placeholders up to $40, query: %s", query)
+	}
+	if !strings.Contains(query, "ON CONFLICT (") {
+		t.Error("expected ON CONFLICT clause")
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"time"
@@ -14,9 +16,21 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
 )
 
+const (
+	// BodyObjectTagKey/BodyObjectTagValue tag every object written by Upload so
+	// that the retention lifecycle rule only matches request/response bodies.
+	BodyObjectTagKey   = "majordomo-data-class"
+	BodyObjectTagValue = "body"
+
+	// BodyLifecycleRuleID identifies the lifecycle rule managed by the gateway.
+	BodyLifecycleRuleID = "majordomo-body-retention"
+)
+
 type S3BodyStorage struct {
 	client     *s3.Client
 	bucket     string
@@ -35,6 +49,10 @@ type BodyUpload struct {
 	ResponseStatus  int
 	ResponseHeaders map[string]string
 	ResponseBody    []byte
+
+	// Set when transforms changed what the client sent or received
+	ClientRequestBody  []byte
+	ClientResponseBody []byte
 }
 
 type S3BodyContent struct {
@@ -49,12 +67,17 @@ type S3RequestContent struct {
 	Path    string            `json:"path"`
 	Headers map[string]string `json:"headers,omitempty"`
 	Body    json.RawMessage   `json:"body,omitempty"`
+	// ClientBody is the body as the client sent it, if transforms changed it
+	ClientBody json.RawMessage `json:"client_body,omitempty"`
 }
 
 type S3ResponseContent struct {
 	StatusCode int               `json:"status_code"`
 	Headers    map[string]string `json:"headers,omitempty"`
 	Body       json.RawMessage   `json:"body,omitempty"`
+	// ClientBody is the body as the client received it, if transforms
+	// changed it
+	ClientBody json.RawMessage `json:"client_body,omitempty"`
 }
 
 type S3Config struct {
@@ -127,11 +150,15 @@ func (s *S3BodyStorage) doUpload(upload *BodyUpload) {
 			Path:    upload.RequestPath,
 			Headers: upload.RequestHeaders,
 			Body:    toJSONRawMessage(upload.RequestBody),
+
+			ClientBody: toJSONRawMessage(upload.ClientRequestBody),
 		},
 		Response: S3ResponseContent{
 			StatusCode: upload.ResponseStatus,
 			Headers:    upload.ResponseHeaders,
 			Body:       toJSONRawMessage(upload.ResponseBody),
+
+			ClientBody: toJSONRawMessage(upload.ClientResponseBody),
 		},
 	}
 
@@ -158,6 +185,7 @@ func (s *S3BodyStorage) doUpload(upload *BodyUpload) {
 		Body:            bytes.NewReader(buf.Bytes()),
 		ContentType:     aws.String("application/json"),
 		ContentEncoding: aws.String("gzip"),
+		Tagging:         aws.String(BodyObjectTagKey + "=" + BodyObjectTagValue),
 	})
 	if err != nil {
 		slog.Error("failed to upload to S3", "error", err, "request_id", upload.RequestID, "key", upload.Key)
@@ -186,6 +214,40 @@ func (s *S3BodyStorage) Upload(upload *BodyUpload) {
 	}
 }
 
+// Download reads the bodies stored under key by Upload
+func (s *S3BodyStorage) Download(ctx context.Context, key string) (*S3BodyContent, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+
+	// Objects are gzipped, but some HTTP clients decompress them on the way
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gzReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+		if data, err = io.ReadAll(gzReader); err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+	}
+
+	var content S3BodyContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return &content, nil
+}
+
 // GenerateKey creates an S3 key for storing request/response bodies.
 // The keyPrefix is typically the Majordomo API key ID (first 16 chars used).
 func (s *S3BodyStorage) GenerateKey(keyPrefix string, requestID uuid.UUID, timestamp time.Time) string {
@@ -198,6 +260,53 @@ func (s *S3BodyStorage) GenerateKey(keyPrefix string, requestID uuid.UUID, times
 	return fmt.Sprintf("%s/%s/%s.json.gz", prefix, date, requestID.String())
 }
 
+// ApplyBodyLifecycle installs (or updates) a bucket lifecycle rule that expires
+// body objects after the given number of days. Rules not managed by the gateway
+// are preserved.
+func (s *S3BodyStorage) ApplyBodyLifecycle(ctx context.Context, days int) error {
+	var rules []types.LifecycleRule
+
+	existing, err := s.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("failed to read bucket lifecycle: %w", err)
+		}
+	} else {
+		for _, rule := range existing.Rules {
+			if aws.ToString(rule.ID) == BodyLifecycleRuleID {
+				if rule.Expiration != nil && aws.ToInt32(rule.Expiration.Days) == int32(days) {
+					return nil // Already up to date
+				}
+				continue
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	rules = append(rules, types.LifecycleRule{
+		ID:     aws.String(BodyLifecycleRuleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{
+			Tag: &types.Tag{Key: aws.String(BodyObjectTagKey), Value: aws.String(BodyObjectTagValue)},
+		},
+		Expiration: &types.LifecycleExpiration{Days: aws.Int32(int32(days))},
+	})
+
+	_, err = s.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s.bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update bucket lifecycle: %w", err)
+	}
+
+	slog.Info("applied S3 body lifecycle rule", "bucket", s.bucket, "days", days)
+	return nil
+}
+
 func (s *S3BodyStorage) Close() error {
 	close(s.done)
 	return nil
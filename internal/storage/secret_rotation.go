@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// ReencryptFunc re-encrypts a provider secret. It returns the new ciphertext
+// and whether it differs from the old one.
+type ReencryptFunc func(ciphertext string) (string, bool, error)
+
+// RotationReport summarizes a re-encryption pass over provider mappings.
+type RotationReport struct {
+	Scanned   int
+	Rotated   int
+	Unchanged int
+	Conflicts int         // Rows updated by someone else during the pass
+	FailedIDs []uuid.UUID // Rows that could not be decrypted or re-encrypted
+}
+
+// ReencryptProviderMappings walks every provider mapping in batches and
+// replaces its encrypted key with the result of reencrypt. Each batch is
+// written in one transaction, and a row is only updated if its ciphertext is
+// still the one that was read, so concurrent changes are never overwritten.
+// Rows that fail to re-encrypt are reported and skipped.
+func (s *sqlStore) ReencryptProviderMappings(ctx context.Context, batchSize int, reencrypt ReencryptFunc) (*RotationReport, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	report := &RotationReport{}
+	after := uuid.Nil
+	for {
+		var rows []struct {
+			ID           uuid.UUID `db:"id"`
+			EncryptedKey string    `db:"encrypted_key"`
+		}
+		err := s.db.SelectContext(ctx, &rows, `
+			SELECT id, encrypted_key
+			FROM proxy_key_provider_mappings
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2`, after, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(rows) == 0 {
+			return report, nil
+		}
+		after = rows[len(rows)-1].ID
+
+		tx, err := s.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return report, err
+		}
+
+		rotatedInBatch := 0
+		for _, row := range rows {
+			report.Scanned++
+
+			rotated, changed, err := reencrypt(row.EncryptedKey)
+			if err != nil {
+				slog.Warn("failed to re-encrypt provider mapping", "id", row.ID, "error", err)
+				report.FailedIDs = append(report.FailedIDs, row.ID)
+				continue
+			}
+			if !changed {
+				report.Unchanged++
+				continue
+			}
+
+			result, err := tx.ExecContext(ctx, `
+				UPDATE proxy_key_provider_mappings
+				SET encrypted_key = $1, updated_at = CURRENT_TIMESTAMP
+				WHERE id = $2 AND encrypted_key = $3`,
+				rotated, row.ID, row.EncryptedKey)
+			if err != nil {
+				tx.Rollback()
+				return report, err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				report.Conflicts++
+			} else {
+				rotatedInBatch++
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return report, err
+		}
+		report.Rotated += rotatedInBatch
+	}
+}
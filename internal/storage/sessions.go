@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession stores a new session and removes the user's expired ones. A
+// zero ID is filled in.
+func (s *sqlStore) CreateSession(ctx context.Context, session *models.Session) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	now := time.Now()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	if session.LastUsedAt.IsZero() {
+		session.LastUsedAt = session.CreatedAt
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 AND expires_at < $2`,
+		session.UserID, now.UTC(),
+	); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO sessions (
+			id, user_id, refresh_token_hash, user_agent, source_ip,
+			created_at, last_used_at, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := s.db.ExecContext(ctx, query,
+		session.ID, session.UserID, session.RefreshTokenHash, session.UserAgent, session.SourceIP,
+		session.CreatedAt.UTC(), session.LastUsedAt.UTC(), session.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// GetSession retrieves a session by its UUID
+func (s *sqlStore) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, refresh_token_hash, previous_token_hash, user_agent, source_ip,
+			created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE id = $1`
+
+	var session models.Session
+	err := s.db.GetContext(ctx, &session, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetSessionByTokenHash retrieves the session whose current or previous
+// refresh token has the given hash
+func (s *sqlStore) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, refresh_token_hash, previous_token_hash, user_agent, source_ip,
+			created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE refresh_token_hash = $1 OR previous_token_hash = $2`
+
+	var session models.Session
+	err := s.db.GetContext(ctx, &session, query, tokenHash, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RotateSessionToken replaces the session's refresh token and extends its
+// expiry. It only succeeds if oldHash is still the current token and the
+// session is not revoked, so that two concurrent refreshes with the same
+// token can't both succeed; otherwise it returns ErrSessionNotFound.
+func (s *sqlStore) RotateSessionToken(ctx context.Context, id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET refresh_token_hash = $1, previous_token_hash = $2, last_used_at = $3, expires_at = $4
+		WHERE id = $5 AND refresh_token_hash = $6 AND revoked_at IS NULL`
+
+	result, err := s.db.ExecContext(ctx, query,
+		newHash, oldHash, time.Now().UTC(), expiresAt.UTC(), id, oldHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeSession revokes a session. Revoking a session that is already
+// revoked is not an error.
+func (s *sqlStore) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL`
+
+	_, err := s.db.ExecContext(ctx, query, time.Now().UTC(), id)
+	return err
+}
+
+// RevokeUserSessions revokes every active session of a user
+func (s *sqlStore) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL`
+
+	_, err := s.db.ExecContext(ctx, query, time.Now().UTC(), userID)
+	return err
+}
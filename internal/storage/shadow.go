@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+// ShadowResults compares the shadow requests sent in [from, to) with the
+// primary requests they mirrored, per rule and shadow model. Shadow requests
+// whose primary has not been written yet are counted without it.
+func (s *sqlStore) ShadowResults(ctx context.Context, from, to time.Time) ([]*models.ShadowResult, error) {
+	query := `
+		SELECT s.shadow_rule, s.model,
+			COUNT(*) AS request_count,
+			SUM(CASE WHEN s.status_code >= 400 THEN 1 ELSE 0 END) AS error_count,
+			SUM(s.input_tokens) AS input_tokens,
+			SUM(s.output_tokens) AS output_tokens,
+			CAST(SUM(s.total_cost) AS DOUBLE PRECISION) AS total_cost,
+			CAST(AVG(s.response_time_ms) AS DOUBLE PRECISION) AS avg_response_time_ms,
+			SUM(CASE WHEN p.status_code >= 400 THEN 1 ELSE 0 END) AS primary_error_count,
+			CAST(COALESCE(SUM(p.total_cost), 0) AS DOUBLE PRECISION) AS primary_total_cost,
+			CAST(COALESCE(AVG(p.response_time_ms), 0) AS DOUBLE PRECISION) AS primary_avg_response_time_ms
+		FROM llm_requests s
+		LEFT JOIN llm_requests p ON p.id = s.shadow_of
+		WHERE s.shadow_of IS NOT NULL AND s.requested_at >= $1 AND s.requested_at < $2
+		GROUP BY s.shadow_rule, s.model
+		ORDER BY s.shadow_rule, s.model`
+
+	var results []*models.ShadowResult
+	if err := s.db.SelectContext(ctx, &results, query, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var (
+	ErrSpillFull     = errors.New("spill file size limit reached")
+	ErrSpillDisabled = errors.New("spill to disk is not configured")
+)
+
+const (
+	spillFilePrefix = "requests-"
+	spillFileSuffix = ".spill"
+)
+
+// SpillFile is a bounded, append-only store on local disk for request logs that
+// could not be written to the database. Logs are stored as JSON lines across
+// segment files so that replay can make progress one segment at a time.
+type SpillFile struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+	current  *os.File
+	writer   *bufio.Writer
+}
+
+// NewSpillFile opens (or creates) a spill directory. Existing segments left over
+// from a previous run are kept and will be picked up by Drain.
+func NewSpillFile(dir string, maxBytes int64) (*SpillFile, error) {
+	if dir == "" {
+		return nil, ErrSpillDisabled
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	s := &SpillFile{dir: dir, maxBytes: maxBytes}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range segments {
+		if fi, err := os.Stat(path); err == nil {
+			s.size += fi.Size()
+		}
+	}
+
+	return s, nil
+}
+
+// Append writes logs to the current segment. It returns ErrSpillFull without
+// writing anything if the logs would push the spill past its size limit.
+func (s *SpillFile) Append(logs []*models.RequestLog) error {
+	var buf []byte
+	for _, log := range logs {
+		line, err := json.Marshal(log)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request log: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxBytes > 0 && s.size+int64(len(buf)) > s.maxBytes {
+		return ErrSpillFull
+	}
+
+	if s.current == nil {
+		name := fmt.Sprintf("%s%020d%s", spillFilePrefix, time.Now().UnixNano(), spillFileSuffix)
+		f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open spill segment: %w", err)
+		}
+		s.current = f
+		s.writer = bufio.NewWriter(f)
+	}
+
+	if _, err := s.writer.Write(buf); err != nil {
+		return fmt.Errorf("failed to write spill segment: %w", err)
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush spill segment: %w", err)
+	}
+	if err := s.current.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spill segment: %w", err)
+	}
+
+	s.size += int64(len(buf))
+	return nil
+}
+
+// Size returns the number of bytes currently held on disk.
+func (s *SpillFile) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Drain replays spilled logs in batches of at most batchSize through fn, oldest
+// segment first. A segment is removed once every batch in it has been accepted.
+// If fn fails, the unprocessed remainder of the segment is kept for the next
+// attempt and the error is returned. Drain returns the number of logs replayed.
+func (s *SpillFile) Drain(batchSize int, fn func([]*models.RequestLog) error) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	// Rotate so new appends land in a fresh segment while we replay.
+	s.mu.Lock()
+	if err := s.closeCurrent(); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	segments, err := s.segments()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, path := range segments {
+		n, err := s.drainSegment(path, batchSize, fn)
+		replayed += n
+		if err != nil {
+			return replayed, err
+		}
+	}
+
+	return replayed, nil
+}
+
+func (s *SpillFile) drainSegment(path string, batchSize int, fn func([]*models.RequestLog) error) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spill segment: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	replayed := 0
+	for start := 0; start < len(lines); start += batchSize {
+		end := min(start+batchSize, len(lines))
+
+		batch := make([]*models.RequestLog, 0, end-start)
+		for _, line := range lines[start:end] {
+			if line == "" {
+				continue
+			}
+			var log models.RequestLog
+			if err := json.Unmarshal([]byte(line), &log); err != nil {
+				slog.Warn("skipping corrupt spill record", "error", err, "segment", filepath.Base(path))
+				continue
+			}
+			batch = append(batch, &log)
+		}
+
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				if rewriteErr := s.rewriteSegment(path, lines[start:]); rewriteErr != nil {
+					slog.Error("failed to rewrite spill segment", "error", rewriteErr, "segment", filepath.Base(path))
+				}
+				return replayed, err
+			}
+		}
+		replayed += len(batch)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil {
+		return replayed, fmt.Errorf("failed to remove spill segment: %w", err)
+	}
+	s.size -= int64(len(data))
+	return replayed, nil
+}
+
+// rewriteSegment atomically replaces a segment with the given remaining lines.
+func (s *SpillFile) rewriteSegment(path string, remaining []string) error {
+	content := strings.Join(remaining, "\n") + "\n"
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, _ := os.Stat(path)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if before != nil {
+		s.size -= before.Size() - int64(len(content))
+	}
+	return nil
+}
+
+// segments returns all segment paths in the spill directory, oldest first.
+func (s *SpillFile) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spill directory: %w", err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, spillFilePrefix) || !strings.HasSuffix(name, spillFileSuffix) {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.dir, name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (s *SpillFile) closeCurrent() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	s.writer = nil
+	return err
+}
+
+// Close closes the current segment. Spilled data stays on disk.
+func (s *SpillFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeCurrent()
+}
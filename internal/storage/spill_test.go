@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+func testLogs(n int) []*models.RequestLog {
+	logs := make([]*models.RequestLog, n)
+	for i := range logs {
+		logs[i] = &models.RequestLog{
+			ID:          uuid.New(),
+			Provider:    "openai",
+			Model:       "gpt-4o",
+			RawMetadata: map[string]string{"user-id": "u1"},
+		}
+	}
+	return logs
+}
+
+func TestSpillFile_AppendAndDrain(t *testing.T) {
+	spill, err := NewSpillFile(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer spill.Close()
+
+	logs := testLogs(5)
+	if err := spill.Append(logs[:3]); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := spill.Append(logs[3:]); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if spill.Size() == 0 {
+		t.Fatal("expected non-zero spill size")
+	}
+
+	var got []*models.RequestLog
+	var batches int
+	n, err := spill.Drain(2, func(batch []*models.RequestLog) error {
+		batches++
+		got = append(got, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	if n != 5 || len(got) != 5 {
+		t.Fatalf("expected 5 replayed logs, got n=%d len=%d", n, len(got))
+	}
+	if batches != 3 {
+		t.Fatalf("expected 3 batches, got %d", batches)
+	}
+	for i := range logs {
+		if got[i].ID != logs[i].ID {
+			t.Fatalf("log %d: got ID %s, want %s", i, got[i].ID, logs[i].ID)
+		}
+		if got[i].RawMetadata["user-id"] != "u1" {
+			t.Fatalf("log %d: metadata not preserved", i)
+		}
+	}
+	if spill.Size() != 0 {
+		t.Fatalf("expected empty spill after drain, got %d bytes", spill.Size())
+	}
+}
+
+func TestSpillFile_DrainFailureKeepsRemainder(t *testing.T) {
+	spill, err := NewSpillFile(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer spill.Close()
+
+	logs := testLogs(4)
+	if err := spill.Append(logs); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	calls := 0
+	n, err := spill.Drain(2, func(batch []*models.RequestLog) error {
+		calls++
+		if calls == 2 {
+			return errors.New("db down")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected drain error")
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 replayed logs before failure, got %d", n)
+	}
+
+	var got []*models.RequestLog
+	n, err = spill.Drain(10, func(batch []*models.RequestLog) error {
+		got = append(got, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("second drain failed: %v", err)
+	}
+	if n != 2 || got[0].ID != logs[2].ID || got[1].ID != logs[3].ID {
+		t.Fatalf("expected remaining logs to be replayed in order, got %d", n)
+	}
+}
+
+func TestSpillFile_MaxBytes(t *testing.T) {
+	spill, err := NewSpillFile(t.TempDir(), 200)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer spill.Close()
+
+	if err := spill.Append(testLogs(10)); !errors.Is(err, ErrSpillFull) {
+		t.Fatalf("expected ErrSpillFull, got %v", err)
+	}
+	if spill.Size() != 0 {
+		t.Fatalf("expected nothing written, got %d bytes", spill.Size())
+	}
+}
+
+func TestSpillFile_ReopenPicksUpExistingSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	spill, err := NewSpillFile(dir, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := spill.Append(testLogs(3)); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	size := spill.Size()
+	spill.Close()
+
+	reopened, err := NewSpillFile(dir, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.Size() != size {
+		t.Fatalf("expected size %d after reopen, got %d", size, reopened.Size())
+	}
+
+	n, err := reopened.Drain(10, func([]*models.RequestLog) error { return nil })
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 replayed logs, got n=%d err=%v", n, err)
+	}
+}
+
+func TestNewSpillFile_EmptyDir(t *testing.T) {
+	if _, err := NewSpillFile("", 0); !errors.Is(err, ErrSpillDisabled) {
+		t.Fatalf("expected ErrSpillDisabled, got %v", err)
+	}
+}
+
+func TestSpillFile_DrainDropsPoisonRow(t *testing.T) {
+	spill, err := NewSpillFile(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer spill.Close()
+
+	logs := testLogs(5)
+	poison := logs[1].ID
+	if err := spill.Append(logs); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	// The database is up but rejects any batch containing the poison row
+	var stored []*models.RequestLog
+	write := func(batch []*models.RequestLog) error {
+		for _, log := range batch {
+			if log.ID == poison {
+				return errors.New("invalid byte sequence for encoding UTF8")
+			}
+		}
+		stored = append(stored, batch...)
+		return nil
+	}
+	ping := func() error { return nil }
+
+	var written, rejected int
+	_, err = spill.Drain(2, func(batch []*models.RequestLog) error {
+		w, r, err := writeOrRetryRows(batch, write, ping)
+		written += w
+		rejected += r
+		return err
+	})
+	if err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	if written != 4 || rejected != 1 || len(stored) != 4 {
+		t.Fatalf("written=%d rejected=%d stored=%d, want 4, 1, 4", written, rejected, len(stored))
+	}
+	for _, log := range stored {
+		if log.ID == poison {
+			t.Fatal("poison row was stored")
+		}
+	}
+	if spill.Size() != 0 {
+		t.Fatalf("expected empty spill after drain, got %d bytes", spill.Size())
+	}
+}
+
+func TestWriteOrRetryRows_DatabaseDown(t *testing.T) {
+	logs := testLogs(3)
+	down := errors.New("connection refused")
+	calls := 0
+	written, rejected, err := writeOrRetryRows(logs,
+		func([]*models.RequestLog) error { calls++; return down },
+		func() error { return down },
+	)
+	if !errors.Is(err, down) || written != 0 || rejected != 0 {
+		t.Fatalf("got written=%d rejected=%d err=%v, want the write error and nothing counted", written, rejected, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no row retries while the database is down, got %d writes", calls)
+	}
+}
+
+func TestWriteOrRetryRows_DatabaseGoesDownDuringRetry(t *testing.T) {
+	logs := testLogs(4)
+	poison := logs[0].ID
+	down := errors.New("connection refused")
+
+	// The first row is rejected while the database is up, the second is
+	// written, and the database goes away before the third
+	var stored []*models.RequestLog
+	up := true
+	write := func(batch []*models.RequestLog) error {
+		if len(batch) > 1 {
+			return errors.New("invalid byte sequence for encoding UTF8")
+		}
+		if batch[0].ID == poison {
+			return errors.New("invalid byte sequence for encoding UTF8")
+		}
+		if !up {
+			return down
+		}
+		stored = append(stored, batch...)
+		if len(stored) == 1 {
+			up = false
+		}
+		return nil
+	}
+	ping := func() error {
+		if !up {
+			return down
+		}
+		return nil
+	}
+
+	written, rejected, err := writeOrRetryRows(logs, write, ping)
+	if !errors.Is(err, down) {
+		t.Fatalf("expected the write error once the database is down, got %v", err)
+	}
+	if written != 1 || rejected != 1 || len(stored) != 1 {
+		t.Fatalf("written=%d rejected=%d stored=%d, want 1, 1, 1", written, rejected, len(stored))
+	}
+	if rest := logs[written+rejected:]; len(rest) != 2 || rest[0].ID != logs[2].ID {
+		t.Fatalf("expected the last 2 rows to be left unwritten, got %d", len(rest))
+	}
+}
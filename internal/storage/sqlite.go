@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStorage stores everything in a single SQLite file. It is meant for
+// local development and small single-node deployments; partition management,
+// retention and rollup rebuilds are Postgres-only.
+type SQLiteStorage struct {
+	sqlStore
+	logChan        chan *models.RequestLog
+	done           chan struct{}
+	wg             sync.WaitGroup
+	activeKeyCache *ActiveKeysCache
+	hllManager     *HLLManager
+
+	batchSize     int
+	flushInterval time.Duration
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// SQLiteStorageConfig holds configuration for the SQLite backend.
+type SQLiteStorageConfig struct {
+	Path               string
+	HLLFlushInterval   time.Duration
+	ActiveKeysCacheTTL time.Duration
+	BufferSize         int
+	BatchSize          int
+	FlushInterval      time.Duration
+}
+
+// OpenSQLite opens (or creates) a SQLite database file. Connections enforce
+// foreign keys, use WAL so readers don't block the writer, start write
+// transactions immediately to avoid lock upgrades, and store times as text
+// that sorts chronologically.
+func OpenSQLite(ctx context.Context, path string) (*sqlx.DB, error) {
+	if path == "" {
+		return nil, errors.New("sqlite path is required")
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	db, err := sqlx.ConnectContext(ctx, DriverSQLite, fmt.Sprintf("file:%s?%s", path, params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewSQLiteStorage opens the database, applies pending migrations and starts
+// the request log writer.
+func NewSQLiteStorage(ctx context.Context, cfg *SQLiteStorageConfig) (*SQLiteStorage, error) {
+	db, err := OpenSQLite(ctx, cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db, DriverSQLite)
+	if err == nil {
+		_, err = migrator.Up(ctx, 0)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite database: %w", err)
+	}
+
+	if cfg.HLLFlushInterval <= 0 {
+		cfg.HLLFlushInterval = 60 * time.Second
+	}
+	if cfg.ActiveKeysCacheTTL <= 0 {
+		cfg.ActiveKeysCacheTTL = 5 * time.Minute
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	s := &SQLiteStorage{
+		sqlStore:       sqlStore{db: db},
+		logChan:        make(chan *models.RequestLog, cfg.BufferSize),
+		done:           make(chan struct{}),
+		activeKeyCache: NewActiveKeysCache(db, cfg.ActiveKeysCacheTTL),
+		hllManager:     NewHLLManager(db, cfg.HLLFlushInterval),
+		batchSize:      cfg.BatchSize,
+		flushInterval:  cfg.FlushInterval,
+	}
+
+	if err := s.hllManager.LoadFromDB(ctx); err != nil {
+		slog.Warn("failed to load HLL state from DB", "error", err)
+	}
+	s.hllManager.Start()
+
+	s.wg.Add(1)
+	go s.writeLoop()
+
+	return s, nil
+}
+
+func (s *SQLiteStorage) writeLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.RequestLog, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if written, rejected, err := s.writeRows(context.Background(), batch); err != nil {
+			rest := batch[written+rejected:]
+			slog.Error("failed to write request logs", "error", err, "count", len(rest))
+			s.dropped.Add(uint64(len(rest)))
+		}
+		batch = make([]*models.RequestLog, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case log := <-s.logChan:
+			batch = append(batch, log)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.done:
+			for len(s.logChan) > 0 {
+				batch = append(batch, <-s.logChan)
+				if len(batch) >= s.batchSize {
+					flush()
+				}
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// writeRows writes a batch with writeOrRetryRows and counts the rows written
+// and dropped.
+func (s *SQLiteStorage) writeRows(ctx context.Context, batch []*models.RequestLog) (written, rejected int, err error) {
+	written, rejected, err = writeOrRetryRows(batch,
+		func(batch []*models.RequestLog) error { return s.writeBatch(ctx, batch) },
+		func() error { return s.db.PingContext(ctx) },
+	)
+	s.written.Add(uint64(written))
+	s.dropped.Add(uint64(rejected))
+	return written, rejected, err
+}
+
+// writeBatch inserts the batch and updates the usage rollups in one
+// transaction, then records metadata keys and HLL values.
+func (s *SQLiteStorage) writeBatch(ctx context.Context, batch []*models.RequestLog) error {
+	// Resolve metadata before taking the write lock
+	raw := make([]string, len(batch))
+	indexedJSON := make([]string, len(batch))
+	indexed := make([]map[string]string, len(batch))
+	for i, log := range batch {
+		raw[i], indexedJSON[i], indexed[i] = s.activeKeyCache.SplitMetadata(ctx, log)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := make([]string, len(requestLogColumns))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO llm_requests (%s) VALUES (%s)",
+		strings.Join(requestLogColumns, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, log := range batch {
+		_, err := stmt.ExecContext(ctx,
+			log.ID, log.UserID, log.TeamID, log.OrgID, log.MajordomoAPIKeyID, log.ProxyKeyID, log.ProviderAPIKeyHash, log.ProviderAPIKeyAlias,
+			log.Provider, log.Model, log.RequestedModel, log.ExperimentID, log.ExperimentArm, log.ShadowOf, log.ShadowRule, log.Transforms, log.Redactions, log.Guardrails, log.GuardrailAction, log.PromptName, log.PromptVersion, log.BatchID, log.BatchCustomID, log.RequestPath, log.RequestMethod,
+			log.RequestedAt.UTC(), log.RespondedAt.UTC(), log.ResponseTimeMs,
+			log.InputTokens, log.OutputTokens, log.CachedTokens, log.CacheCreationTokens,
+			log.InputCost, log.OutputCost, log.TotalCost,
+			log.StatusCode, log.ErrorMessage, raw[i], indexedJSON[i],
+			log.RequestBody, log.ResponseBody, log.ClientRequestBody, log.ClientResponseBody, log.BodyS3Key, log.ModelAliasFound,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := upsertRollups(ctx, tx, batch, indexed); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.recordMetadata(ctx, batch)
+	return nil
+}
+
+// recordMetadata registers metadata keys and updates HLLs for written logs
+// (only for logs with a Majordomo API key).
+func (s *SQLiteStorage) recordMetadata(ctx context.Context, batch []*models.RequestLog) {
+	keys := make(map[hllKey]struct{})
+	for _, log := range batch {
+		if log.MajordomoAPIKeyID == nil {
+			continue
+		}
+		for key, value := range log.RawMetadata {
+			keys[hllKey{MajordomoAPIKeyID: *log.MajordomoAPIKeyID, KeyName: key}] = struct{}{}
+			s.hllManager.AddValue(*log.MajordomoAPIKeyID, key, value)
+		}
+	}
+
+	for k := range keys {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO llm_requests_metadata_keys (majordomo_api_key_id, key_name)
+			VALUES ($1, $2)
+			ON CONFLICT (majordomo_api_key_id, key_name) DO NOTHING`,
+			k.MajordomoAPIKeyID, k.KeyName)
+		if err != nil {
+			slog.Warn("failed to register metadata key", "error", err, "key", k.KeyName)
+		}
+	}
+}
+
+// Stats returns a snapshot of the request log writer counters.
+func (s *SQLiteStorage) Stats() WriterStats {
+	return WriterStats{
+		Written: s.written.Load(),
+		Dropped: s.dropped.Load(),
+	}
+}
+
+// SchemaVersion returns the applied and expected schema versions.
+func (s *SQLiteStorage) SchemaVersion(ctx context.Context) (int, int, error) {
+	current, err := schemaVersion(ctx, s.db, migrationDialects[DriverSQLite])
+	return current, LatestSchemaVersion(DriverSQLite), err
+}
+
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStorage) WriteRequestLog(ctx context.Context, log *models.RequestLog) {
+	select {
+	case s.logChan <- log:
+	default:
+		slog.Warn("request log channel full, dropping log", "request_id", log.ID)
+		s.dropped.Add(1)
+	}
+}
+
+// WriteRequestLogs writes logs right away, batchSize at a time, instead of
+// queueing them, so that many logs written at once can't overflow the queue.
+func (s *SQLiteStorage) WriteRequestLogs(ctx context.Context, logs []*models.RequestLog) error {
+	for start := 0; start < len(logs); start += s.batchSize {
+		batch := logs[start:min(start+s.batchSize, len(logs))]
+		if _, _, err := s.writeRows(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	s.hllManager.Stop()
+
+	stats := s.Stats()
+	slog.Info("request log writer stopped", "written", stats.Written, "dropped", stats.Dropped)
+
+	return s.db.Close()
+}
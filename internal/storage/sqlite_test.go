@@ -0,0 +1,1048 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+func newTestSQLiteStorage(t *testing.T, path string) *SQLiteStorage {
+	t.Helper()
+	s, err := NewSQLiteStorage(context.Background(), &SQLiteStorageConfig{
+		Path:          path,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	return s
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "majordomo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := NewMigrator(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if v, _ := m.CurrentVersion(ctx); v != LatestSchemaVersion(DriverSQLite) {
+		t.Errorf("version after Up = %d, want %d", v, LatestSchemaVersion(DriverSQLite))
+	}
+
+	steps := LatestSchemaVersion(DriverSQLite)
+	if rolledBack, err := m.Down(ctx, steps); err != nil || len(rolledBack) != steps {
+		t.Fatalf("Down rolled back %d, err %v", len(rolledBack), err)
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("Down on empty schema = %v, want ErrNoMigrations", err)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
+
+func TestSQLiteKeysAndUsers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	user, err := s.CreateUser(ctx, &models.CreateUserInput{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if got, err := s.GetUserByUsername(ctx, "alice"); err != nil || got.ID != user.ID {
+		t.Fatalf("GetUserByUsername = %v, %v", got, err)
+	}
+	if user.Role != models.RoleMember {
+		t.Errorf("default role = %q, want member", user.Role)
+	}
+	if err := s.UpdateUserRole(ctx, user.ID, models.RoleViewer); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+	if err := s.UpdateUserRole(ctx, user.ID, models.Role("root")); err != ErrInvalidRole {
+		t.Errorf("UpdateUserRole(root) = %v, want ErrInvalidRole", err)
+	}
+	if err := s.SetUserActive(ctx, user.ID, false); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	if got, err := s.GetUserByID(ctx, user.ID); err != nil || got.Role != models.RoleViewer || got.IsActive {
+		t.Fatalf("updated user = %+v, %v", got, err)
+	}
+	if err := s.SetUserActive(ctx, uuid.New(), true); err != ErrUserNotFound {
+		t.Errorf("SetUserActive(unknown) = %v, want ErrUserNotFound", err)
+	}
+
+	ssoUser, err := s.CreateOIDCUser(ctx, "bob@example.com", "https://idp.example.com", "sub-1", models.RoleViewer)
+	if err != nil {
+		t.Fatalf("CreateOIDCUser: %v", err)
+	}
+	if got, err := s.GetUserByOIDCSubject(ctx, "https://idp.example.com", "sub-1"); err != nil || got.ID != ssoUser.ID || got.PasswordHash != "" {
+		t.Fatalf("GetUserByOIDCSubject = %+v, %v", got, err)
+	}
+	if got, err := s.GetUserByOIDCSubject(ctx, "https://other.example.com", "sub-1"); got != nil || err != nil {
+		t.Errorf("GetUserByOIDCSubject(other issuer) = %+v, %v", got, err)
+	}
+	if err := s.LinkUserOIDC(ctx, user.ID, "https://idp.example.com", "sub-2"); err != nil {
+		t.Fatalf("LinkUserOIDC: %v", err)
+	}
+	if got, err := s.GetUserByOIDCSubject(ctx, "https://idp.example.com", "sub-2"); err != nil || got.ID != user.ID {
+		t.Fatalf("GetUserByOIDCSubject after link = %+v, %v", got, err)
+	}
+
+	key, err := s.CreateAPIKey(ctx, "hash-1", &models.CreateAPIKeyInput{Name: "test", UserID: &user.ID})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if got, err := s.GetAPIKeyByHash(ctx, "hash-1"); err != nil || got.ID != key.ID {
+		t.Fatalf("GetAPIKeyByHash = %v, %v", got, err)
+	}
+	if keys, err := s.ListAPIKeysByUserID(ctx, user.ID); err != nil || len(keys) != 1 {
+		t.Fatalf("ListAPIKeysByUserID = %d keys, %v", len(keys), err)
+	}
+	if err := s.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if got, err := s.GetAPIKeyByID(ctx, key.ID); err != nil || got.IsActive {
+		t.Fatalf("revoked key = %+v, %v", got, err)
+	}
+
+	pk, err := s.CreateProxyKey(ctx, "proxy-hash", key.ID, &models.CreateProxyKeyInput{Name: "proxy"})
+	if err != nil {
+		t.Fatalf("CreateProxyKey: %v", err)
+	}
+	if err := s.SetProviderMapping(ctx, pk.ID, "openai", "enc-1"); err != nil {
+		t.Fatalf("SetProviderMapping: %v", err)
+	}
+	if err := s.SetProviderMapping(ctx, pk.ID, "openai", "enc-2"); err != nil {
+		t.Fatalf("SetProviderMapping (update): %v", err)
+	}
+	mapping, err := s.GetProviderMapping(ctx, pk.ID, "openai")
+	if err != nil || mapping.EncryptedKey != "enc-2" {
+		t.Fatalf("GetProviderMapping = %+v, %v", mapping, err)
+	}
+	if err := s.DeleteProviderMapping(ctx, pk.ID, "openai"); err != nil {
+		t.Fatalf("DeleteProviderMapping: %v", err)
+	}
+	if mapping, err := s.GetProviderMapping(ctx, pk.ID, "openai"); mapping != nil || err != nil {
+		t.Errorf("GetProviderMapping after delete = %+v, %v", mapping, err)
+	}
+}
+
+func TestSQLiteRequestLogsAndUsage(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	key, err := s.CreateAPIKey(ctx, "hash-1", &models.CreateAPIKeyInput{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO llm_requests_metadata_keys (majordomo_api_key_id, key_name, is_active) VALUES ($1, 'team', true)`, key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, team := range []string{"search", "search", "ads"} {
+		s.WriteRequestLog(ctx, &models.RequestLog{
+			ID:                uuid.New(),
+			MajordomoAPIKeyID: &key.ID,
+			Provider:          "openai",
+			Model:             "gpt-4o",
+			RequestedAt:       base.Add(time.Duration(i) * time.Minute).In(time.FixedZone("UTC+2", 2*3600)),
+			RespondedAt:       base.Add(time.Duration(i)*time.Minute + time.Second),
+			InputTokens:       10,
+			TotalCost:         0.5,
+			StatusCode:        200,
+			RawMetadata:       map[string]string{"team": team, "user": "u1"},
+		})
+	}
+
+	// Close drains the writer and flushes HLL state
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	if stats := s.Stats(); stats.Dropped != 0 {
+		t.Errorf("dropped = %d", stats.Dropped)
+	}
+
+	var count int
+	if err := s.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM llm_requests WHERE requested_at >= $1`, base.UTC()); err != nil || count != 3 {
+		t.Fatalf("llm_requests count = %d, %v", count, err)
+	}
+
+	var keyNames []string
+	if err := s.db.SelectContext(ctx, &keyNames, `SELECT key_name FROM llm_requests_metadata_keys WHERE majordomo_api_key_id = $1 AND hll_state IS NOT NULL ORDER BY key_name`, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(keyNames) != 2 || keyNames[0] != "team" || keyNames[1] != "user" {
+		t.Errorf("metadata keys with HLL state = %v", keyNames)
+	}
+
+	rows, err := s.QueryUsage(ctx, &models.UsageQuery{
+		Granularity:       models.GranularityHour,
+		From:              base,
+		To:                base.Add(time.Hour),
+		MajordomoAPIKeyID: &key.ID,
+	})
+	if err != nil {
+		t.Fatalf("QueryUsage: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 3 || rows[0].InputTokens != 30 || !rows[0].Bucket.Equal(base) {
+		t.Fatalf("hourly usage = %+v", rows)
+	}
+
+	rows, err = s.QueryUsage(ctx, &models.UsageQuery{
+		Granularity:       models.GranularityDay,
+		From:              base.Truncate(24 * time.Hour),
+		To:                base.Add(24 * time.Hour),
+		MajordomoAPIKeyID: &key.ID,
+		MetadataKey:       "team",
+	})
+	if err != nil {
+		t.Fatalf("QueryUsage by metadata key: %v", err)
+	}
+	byTeam := make(map[string]int64)
+	for _, r := range rows {
+		byTeam[r.MetadataValue] = r.RequestCount
+	}
+	if byTeam["search"] != 2 || byTeam["ads"] != 1 {
+		t.Errorf("daily usage by team = %v", byTeam)
+	}
+}
+
+func TestSQLiteWriteLoopDropsOnlyRejectedRows(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	logs := make([]*models.RequestLog, 3)
+	for i := range logs {
+		logs[i] = &models.RequestLog{
+			ID:          uuid.New(),
+			Provider:    "openai",
+			Model:       "gpt-4o",
+			RequestedAt: base.Add(time.Duration(i) * time.Minute),
+			RespondedAt: base.Add(time.Duration(i)*time.Minute + time.Second),
+			StatusCode:  200,
+		}
+	}
+	if err := s.WriteRequestLogs(ctx, logs[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first log is already stored, so only it is rejected from the batch
+	for _, log := range logs {
+		s.WriteRequestLog(ctx, log)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.Stats(); stats.Written != 3 || stats.Dropped != 1 {
+		t.Errorf("written = %d, dropped = %d, want 3, 1", stats.Written, stats.Dropped)
+	}
+
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	var count int
+	if err := s.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM llm_requests`); err != nil || count != 3 {
+		t.Fatalf("llm_requests count = %d, %v", count, err)
+	}
+}
+
+func TestSQLiteTeams(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	org, err := s.CreateOrganization(ctx, "acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	budget := 10.0
+	team, err := s.CreateTeam(ctx, org.ID, "search", &budget)
+	if err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	if got, err := s.GetTeamByName(ctx, org.ID, "search"); err != nil || got.ID != team.ID || *got.MonthlyBudget != budget {
+		t.Fatalf("GetTeamByName = %+v, %v", got, err)
+	}
+	if _, err := s.GetTeam(ctx, uuid.New()); err != ErrTeamNotFound {
+		t.Errorf("GetTeam(unknown) = %v, want ErrTeamNotFound", err)
+	}
+
+	user, err := s.CreateUser(ctx, &models.CreateUserInput{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTeamMember(ctx, team.ID, user.ID, models.RoleMember); err != nil {
+		t.Fatalf("SetTeamMember: %v", err)
+	}
+	if err := s.SetTeamMember(ctx, team.ID, user.ID, models.RoleAdmin); err != nil {
+		t.Fatalf("SetTeamMember (update): %v", err)
+	}
+	if role, err := s.GetTeamMemberRole(ctx, team.ID, user.ID); err != nil || role != models.RoleAdmin {
+		t.Errorf("GetTeamMemberRole = %q, %v", role, err)
+	}
+	if members, err := s.ListTeamMembers(ctx, team.ID); err != nil || len(members) != 1 || members[0].Username != "alice" {
+		t.Errorf("ListTeamMembers = %+v, %v", members, err)
+	}
+	if teams, err := s.ListTeamsByUserID(ctx, user.ID); err != nil || len(teams) != 1 {
+		t.Errorf("ListTeamsByUserID = %d teams, %v", len(teams), err)
+	}
+
+	key, err := s.CreateAPIKey(ctx, "hash-1", &models.CreateAPIKeyInput{Name: "test", Team: team})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if key.TeamID == nil || *key.TeamID != team.ID || key.OrgID == nil || *key.OrgID != org.ID {
+		t.Fatalf("team key = %+v", key)
+	}
+	if keys, err := s.ListAPIKeysByTeamID(ctx, team.ID); err != nil || len(keys) != 1 {
+		t.Fatalf("ListAPIKeysByTeamID = %d keys, %v", len(keys), err)
+	}
+
+	now := time.Now().UTC()
+	for i := 0; i < 2; i++ {
+		s.WriteRequestLog(ctx, &models.RequestLog{
+			ID:                uuid.New(),
+			MajordomoAPIKeyID: &key.ID,
+			TeamID:            &team.ID,
+			OrgID:             &org.ID,
+			Provider:          "openai",
+			Model:             "gpt-4o",
+			RequestedAt:       now,
+			RespondedAt:       now,
+			TotalCost:         1.5,
+			StatusCode:        200,
+		})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	cost, err := s.TeamCostSince(ctx, team.ID, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || cost != 3.0 {
+		t.Errorf("TeamCostSince = %v, %v; want 3", cost, err)
+	}
+	rows, err := s.QueryUsage(ctx, &models.UsageQuery{
+		Granularity: models.GranularityDay,
+		From:        now.Add(-24 * time.Hour),
+		To:          now.Add(24 * time.Hour),
+		OrgID:       &org.ID,
+	})
+	if err != nil || len(rows) != 1 || rows[0].RequestCount != 2 {
+		t.Errorf("org usage = %+v, %v", rows, err)
+	}
+
+	if err := s.SetAPIKeyTeam(ctx, key.ID, nil); err != nil {
+		t.Fatalf("SetAPIKeyTeam: %v", err)
+	}
+	if got, err := s.GetAPIKeyByID(ctx, key.ID); err != nil || got.TeamID != nil || got.OrgID != nil {
+		t.Errorf("key after leaving team = %+v, %v", got, err)
+	}
+	if err := s.RemoveTeamMember(ctx, team.ID, user.ID); err != nil {
+		t.Fatalf("RemoveTeamMember: %v", err)
+	}
+	if err := s.RemoveTeamMember(ctx, team.ID, user.ID); err != ErrTeamMemberNotFound {
+		t.Errorf("RemoveTeamMember twice = %v, want ErrTeamMemberNotFound", err)
+	}
+}
+
+func TestSQLiteAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	userID := uuid.New()
+	ip := "10.0.0.1"
+	base := time.Now().Add(-time.Hour)
+	events := []*models.AuditEvent{
+		{
+			OccurredAt: base, ActorType: models.AuditActorCLI, ActorName: "root",
+			Action: "user.create", TargetType: "user", TargetID: userID.String(),
+			After: models.AuditState(`{"username":"alice","role":"member"}`),
+		},
+		{
+			OccurredAt: base.Add(time.Minute), ActorType: models.AuditActorUser, ActorID: &userID, ActorName: "alice",
+			Action: "user.role_change", TargetType: "user", TargetID: userID.String(),
+			Before: models.AuditState(`{"role":"member"}`), After: models.AuditState(`{"role":"admin"}`), SourceIP: &ip,
+		},
+		{
+			OccurredAt: base.Add(2 * time.Minute), ActorType: models.AuditActorUser, ActorID: &userID, ActorName: "alice",
+			Action: "api_key.revoke", TargetType: "api_key", TargetID: uuid.NewString(),
+		},
+	}
+	for _, e := range events {
+		if err := s.WriteAuditEvent(ctx, e); err != nil {
+			t.Fatalf("WriteAuditEvent: %v", err)
+		}
+	}
+
+	all, err := s.ListAuditEvents(ctx, &models.AuditQuery{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("ListAuditEvents = %d events, %v", len(all), err)
+	}
+	if all[0].Action != "api_key.revoke" || all[2].Action != "user.create" {
+		t.Errorf("events not newest first: %s, %s", all[0].Action, all[2].Action)
+	}
+
+	got, err := s.ListAuditEvents(ctx, &models.AuditQuery{TargetType: "user", TargetID: userID.String(), ActorID: &userID})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("filtered ListAuditEvents = %d events, %v", len(got), err)
+	}
+	if e := got[0]; string(e.Before) != `{"role":"member"}` || string(e.After) != `{"role":"admin"}` || e.SourceIP == nil || *e.SourceIP != ip {
+		t.Errorf("event = %+v", e)
+	}
+
+	if got, err := s.ListAuditEvents(ctx, &models.AuditQuery{From: base.Add(30 * time.Second), Limit: 1}); err != nil || len(got) != 1 || got[0].Action != "api_key.revoke" {
+		t.Errorf("ListAuditEvents(from, limit) = %+v, %v", got, err)
+	}
+	if got, err := s.ListAuditEvents(ctx, &models.AuditQuery{ActorType: models.AuditActorCLI}); err != nil || len(got) != 1 || got[0].Before != nil || got[0].SourceIP != nil {
+		t.Errorf("ListAuditEvents(cli) = %+v, %v", got, err)
+	}
+
+	// The log is append-only
+	if _, err := s.db.ExecContext(ctx, "UPDATE audit_events SET action = 'x'"); err == nil {
+		t.Error("UPDATE on audit_events succeeded")
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM audit_events"); err == nil {
+		t.Error("DELETE on audit_events succeeded")
+	}
+}
+
+func TestReencryptProviderMappings(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	key, err := s.CreateAPIKey(ctx, "hash-1", &models.CreateAPIKeyInput{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts := map[string]string{"openai": "old:a", "anthropic": "new:b", "gemini": "old:broken"}
+	for i := 0; i < 3; i++ {
+		pk, err := s.CreateProxyKey(ctx, uuid.NewString(), key.ID, &models.CreateProxyKeyInput{Name: "proxy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for provider, ciphertext := range ciphertexts {
+			if err := s.SetProviderMapping(ctx, pk.ID, provider, ciphertext); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	report, err := s.ReencryptProviderMappings(ctx, 2, func(ciphertext string) (string, bool, error) {
+		switch ciphertext {
+		case "old:broken":
+			return "", false, errors.New("unknown key")
+		case "old:a":
+			return "new:a", true, nil
+		}
+		return ciphertext, false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 9 || report.Rotated != 3 || report.Unchanged != 3 || len(report.FailedIDs) != 3 {
+		t.Errorf("report = %+v", report)
+	}
+
+	var remaining int
+	if err := s.db.GetContext(ctx, &remaining, `SELECT COUNT(*) FROM proxy_key_provider_mappings WHERE encrypted_key = 'old:a'`); err != nil || remaining != 0 {
+		t.Errorf("unrotated rows = %d, %v", remaining, err)
+	}
+}
+
+func TestSQLiteSessions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	user, err := s.CreateUser(ctx, &models.CreateUserInput{Username: "alice", Password: "password1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := &models.Session{UserID: user.ID, RefreshTokenHash: "expired", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := s.CreateSession(ctx, expired); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	session := &models.Session{UserID: user.ID, RefreshTokenHash: "first", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := s.GetSession(ctx, expired.ID); err != ErrSessionNotFound {
+		t.Errorf("expired session = %v, want it removed", err)
+	}
+
+	if err := s.RotateSessionToken(ctx, session.ID, "first", "second", time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("RotateSessionToken: %v", err)
+	}
+	if err := s.RotateSessionToken(ctx, session.ID, "first", "third", time.Now().Add(2*time.Hour)); err != ErrSessionNotFound {
+		t.Errorf("RotateSessionToken(stale) = %v, want ErrSessionNotFound", err)
+	}
+
+	for _, hash := range []string{"first", "second"} {
+		got, err := s.GetSessionByTokenHash(ctx, hash)
+		if err != nil {
+			t.Fatalf("GetSessionByTokenHash(%s): %v", hash, err)
+		}
+		if got.ID != session.ID || got.RefreshTokenHash != "second" || got.PreviousTokenHash == nil || *got.PreviousTokenHash != "first" {
+			t.Errorf("GetSessionByTokenHash(%s) = %+v", hash, got)
+		}
+	}
+	if _, err := s.GetSessionByTokenHash(ctx, "unknown"); err != ErrSessionNotFound {
+		t.Errorf("GetSessionByTokenHash(unknown) = %v, want ErrSessionNotFound", err)
+	}
+
+	other := &models.Session{UserID: user.ID, RefreshTokenHash: "other", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreateSession(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeSession(ctx, session.ID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if err := s.RotateSessionToken(ctx, session.ID, "second", "third", time.Now().Add(time.Hour)); err != ErrSessionNotFound {
+		t.Errorf("RotateSessionToken(revoked) = %v, want ErrSessionNotFound", err)
+	}
+	got, err := s.GetSession(ctx, other.ID)
+	if err != nil || got.RevokedAt != nil {
+		t.Fatalf("other session = %+v, %v, want it active", got, err)
+	}
+
+	if err := s.RevokeUserSessions(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+	got, err = s.GetSession(ctx, other.ID)
+	if err != nil || got.RevokedAt == nil {
+		t.Errorf("other session = %+v, %v, want it revoked", got, err)
+	}
+}
+
+func TestSQLiteAPIKeyScopes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	all, err := s.CreateAPIKey(ctx, "hash-all", &models.CreateAPIKeyInput{Name: "all"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if all.Scopes.String() != models.AllScopes.String() {
+		t.Errorf("default scopes = %q, want %q", all.Scopes, models.AllScopes)
+	}
+
+	key, err := s.CreateAPIKey(ctx, "hash-ci", &models.CreateAPIKeyInput{Name: "ci", Scopes: models.Scopes{models.ScopeProxy}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	got, err := s.GetAPIKeyByHash(ctx, "hash-ci")
+	if err != nil || !got.Scopes.Has(models.ScopeProxy) || got.Scopes.Has(models.ScopeProxyKeysWrite) {
+		t.Fatalf("GetAPIKeyByHash = %+v, %v, want only the proxy scope", got, err)
+	}
+
+	updated, err := s.UpdateAPIKey(ctx, key.ID, &models.UpdateAPIKeyInput{Scopes: models.Scopes{models.ScopeUsageRead}})
+	if err != nil {
+		t.Fatalf("UpdateAPIKey: %v", err)
+	}
+	if updated.Scopes.String() != "usage:read" || updated.Name != "ci" {
+		t.Errorf("updated key = %+v, want only usage:read", updated)
+	}
+}
+
+func TestSQLiteProxyKeySingleHeaderAuth(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	key, err := s.CreateAPIKey(ctx, "hash", &models.CreateAPIKeyInput{Name: "key"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	pk, err := s.CreateProxyKey(ctx, "proxy-hash", key.ID, &models.CreateProxyKeyInput{Name: "proxy", SingleHeaderAuth: true})
+	if err != nil {
+		t.Fatalf("CreateProxyKey: %v", err)
+	}
+	if !pk.SingleHeaderAuth {
+		t.Errorf("created proxy key = %+v, want single-header auth", pk)
+	}
+
+	if err := s.SetProxyKeySingleHeaderAuth(ctx, pk.ID, false); err != nil {
+		t.Fatalf("SetProxyKeySingleHeaderAuth: %v", err)
+	}
+	got, err := s.GetProxyKeyByHash(ctx, "proxy-hash")
+	if err != nil || got.SingleHeaderAuth {
+		t.Fatalf("GetProxyKeyByHash = %+v, %v, want single-header auth off", got, err)
+	}
+
+	if err := s.RevokeProxyKey(ctx, pk.ID); err != nil {
+		t.Fatalf("RevokeProxyKey: %v", err)
+	}
+	if err := s.SetProxyKeySingleHeaderAuth(ctx, pk.ID, true); !errors.Is(err, ErrProxyKeyNotFound) {
+		t.Errorf("SetProxyKeySingleHeaderAuth on revoked key = %v, want ErrProxyKeyNotFound", err)
+	}
+}
+
+func TestSQLiteModelRoutes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	key, err := s.CreateAPIKey(ctx, "hash", &models.CreateAPIKeyInput{Name: "key"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	fallback := &models.ModelRoute{Name: "fast", TargetModel: "gpt-4o-mini"}
+	if err := s.CreateModelRoute(ctx, fallback); err != nil {
+		t.Fatalf("CreateModelRoute: %v", err)
+	}
+	route := &models.ModelRoute{Name: "fast", TargetProvider: "anthropic", TargetModel: "claude-3-5-haiku-latest", APIKeyID: &key.ID}
+	if err := s.CreateModelRoute(ctx, route); err != nil {
+		t.Fatalf("CreateModelRoute: %v", err)
+	}
+
+	routes, err := s.ListModelRoutes(ctx)
+	if err != nil || len(routes) != 2 || routes[0].ID != fallback.ID {
+		t.Fatalf("ListModelRoutes = %+v, %v, want both routes, oldest first", routes, err)
+	}
+	if routes[1].APIKeyID == nil || *routes[1].APIKeyID != key.ID || routes[1].TargetProvider != "anthropic" {
+		t.Errorf("listed route = %+v, want the API key condition and target provider", routes[1])
+	}
+
+	metadataKey, metadataValue := "region", "eu"
+	route.APIKeyID = nil
+	route.MetadataKey = &metadataKey
+	route.MetadataValue = &metadataValue
+	if err := s.UpdateModelRoute(ctx, route); err != nil {
+		t.Fatalf("UpdateModelRoute: %v", err)
+	}
+	got, err := s.GetModelRoute(ctx, route.ID)
+	if err != nil {
+		t.Fatalf("GetModelRoute: %v", err)
+	}
+	if got.APIKeyID != nil || got.MetadataValue == nil || *got.MetadataValue != "eu" || got.Conditions() != 1 {
+		t.Errorf("updated route = %+v, want only the metadata condition", got)
+	}
+
+	if err := s.DeleteModelRoute(ctx, route.ID); err != nil {
+		t.Fatalf("DeleteModelRoute: %v", err)
+	}
+	if _, err := s.GetModelRoute(ctx, route.ID); !errors.Is(err, ErrModelRouteNotFound) {
+		t.Errorf("GetModelRoute after delete = %v, want ErrModelRouteNotFound", err)
+	}
+	if err := s.DeleteModelRoute(ctx, route.ID); !errors.Is(err, ErrModelRouteNotFound) {
+		t.Errorf("DeleteModelRoute twice = %v, want ErrModelRouteNotFound", err)
+	}
+}
+
+func TestSQLitePrompts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	messages := models.PromptMessages{{Role: "system", Content: "Triage tickets for {{product}}."}}
+	for i := 1; i <= 2; i++ {
+		p := &models.PromptTemplate{Name: "support-triage", Messages: messages}
+		if err := s.CreatePromptVersion(ctx, p); err != nil {
+			t.Fatalf("CreatePromptVersion: %v", err)
+		}
+		if p.Version != i {
+			t.Errorf("version = %d, want %d", p.Version, i)
+		}
+	}
+	description := "summaries"
+	if err := s.CreatePromptVersion(ctx, &models.PromptTemplate{Name: "summarize", Description: &description, Messages: messages}); err != nil {
+		t.Fatalf("CreatePromptVersion: %v", err)
+	}
+
+	latest, err := s.GetPromptVersion(ctx, "support-triage", 0)
+	if err != nil || latest.Version != 2 || len(latest.Messages) != 1 || latest.Messages[0].Content != messages[0].Content {
+		t.Fatalf("GetPromptVersion(latest) = %+v, %v, want version 2", latest, err)
+	}
+	if _, err := s.GetPromptVersion(ctx, "support-triage", 3); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("GetPromptVersion(3) = %v, want ErrPromptNotFound", err)
+	}
+
+	prompts, err := s.ListPrompts(ctx)
+	if err != nil || len(prompts) != 2 || prompts[0].Name != "summarize" || prompts[1].Version != 2 {
+		t.Fatalf("ListPrompts = %+v, %v, want the latest version of each, by name", prompts, err)
+	}
+	if *prompts[0].Description != "summaries" {
+		t.Errorf("description = %q", *prompts[0].Description)
+	}
+
+	now := time.Now().UTC()
+	name := "support-triage"
+	for i, version := range []int{1, 2, 2} {
+		s.WriteRequestLog(ctx, &models.RequestLog{
+			ID:             uuid.New(),
+			Provider:       "openai",
+			Model:          "gpt-4o",
+			PromptName:     &name,
+			PromptVersion:  &version,
+			RequestedAt:    now,
+			RespondedAt:    now,
+			ResponseTimeMs: int64(100 * (i + 1)),
+			TotalCost:      0.25,
+			StatusCode:     200,
+		})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	results, err := s.PromptResults(ctx, name, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("PromptResults: %v", err)
+	}
+	if len(results) != 2 || results[0].Version != 1 || results[1].RequestCount != 2 ||
+		results[1].AvgResponseTimeMs != 250 || results[1].CostPerRequest != 0.25 {
+		t.Errorf("PromptResults = %+v, %+v", results[0], results[len(results)-1])
+	}
+
+	if err := s.DeletePromptVersion(ctx, name, 1); err != nil {
+		t.Fatalf("DeletePromptVersion: %v", err)
+	}
+	if err := s.DeletePromptVersion(ctx, name, 1); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("DeletePromptVersion twice = %v, want ErrPromptNotFound", err)
+	}
+	versions, err := s.ListPromptVersions(ctx, name)
+	if err != nil || len(versions) != 1 || versions[0].Version != 2 {
+		t.Errorf("ListPromptVersions after delete = %+v, %v, want only version 2", versions, err)
+	}
+}
+
+func TestSQLiteExperiments(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	stickyKey := "user-id"
+	exp := &models.Experiment{
+		Name:      "gpt-4.1 rollout",
+		Model:     "default",
+		StickyKey: &stickyKey,
+		Arms: models.ExperimentArms{
+			{Name: "control", TargetModel: "gpt-4o", Weight: 90},
+			{Name: "candidate", TargetModel: "gpt-4.1", Weight: 10},
+		},
+		IsActive: true,
+	}
+	if err := s.CreateExperiment(ctx, exp); err != nil {
+		t.Fatalf("CreateExperiment: %v", err)
+	}
+	if err := s.CreateExperiment(ctx, &models.Experiment{Name: "second", Model: "default", Arms: exp.Arms, IsActive: true}); err == nil {
+		t.Error("CreateExperiment allowed two active experiments for one model")
+	}
+
+	got, err := s.GetExperiment(ctx, exp.ID)
+	if err != nil {
+		t.Fatalf("GetExperiment: %v", err)
+	}
+	if len(got.Arms) != 2 || got.Arms[1].Name != "candidate" || got.Arms[1].Weight != 10 || *got.StickyKey != "user-id" {
+		t.Errorf("GetExperiment = %+v", got)
+	}
+
+	now := time.Now().UTC()
+	for i, arm := range []string{"control", "control", "candidate"} {
+		s.WriteRequestLog(ctx, &models.RequestLog{
+			ID:             uuid.New(),
+			Provider:       "openai",
+			Model:          "gpt-4o",
+			ExperimentID:   &exp.ID,
+			ExperimentArm:  &arm,
+			RequestedAt:    now,
+			RespondedAt:    now,
+			ResponseTimeMs: int64(100 * (i + 1)),
+			TotalCost:      0.5,
+			StatusCode:     200 + 300*(i%2),
+		})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	results, err := s.ExperimentResults(ctx, exp.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ExperimentResults: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("ExperimentResults = %d arms, want 2", len(results))
+	}
+	candidate, control := results[0], results[1]
+	if control.Arm != "control" || control.RequestCount != 2 || control.ErrorCount != 1 || control.ErrorRate != 0.5 ||
+		control.AvgResponseTimeMs != 150 || control.MaxResponseTimeMs != 200 || control.CostPerRequest != 0.5 {
+		t.Errorf("control = %+v", control)
+	}
+	if candidate.Arm != "candidate" || candidate.RequestCount != 1 || candidate.TotalCost != 0.5 {
+		t.Errorf("candidate = %+v", candidate)
+	}
+
+	exp.IsActive = false
+	if err := s.UpdateExperiment(ctx, exp); err != nil {
+		t.Fatalf("UpdateExperiment: %v", err)
+	}
+	if err := s.CreateExperiment(ctx, &models.Experiment{Name: "next", Model: "default", Arms: exp.Arms, IsActive: true}); err != nil {
+		t.Errorf("CreateExperiment after stopping the first: %v", err)
+	}
+	if err := s.DeleteExperiment(ctx, exp.ID); err != nil {
+		t.Fatalf("DeleteExperiment: %v", err)
+	}
+	if _, err := s.GetExperiment(ctx, exp.ID); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("GetExperiment after delete = %v, want ErrExperimentNotFound", err)
+	}
+}
+
+func TestSQLiteShadowRequests(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	rule := "gpt-4.1 candidate"
+	for i := 0; i < 2; i++ {
+		primary := &models.RequestLog{
+			ID:             uuid.New(),
+			Provider:       "openai",
+			Model:          "gpt-4o",
+			RequestedAt:    base,
+			RespondedAt:    base,
+			ResponseTimeMs: 400,
+			TotalCost:      1,
+			StatusCode:     200,
+		}
+		s.WriteRequestLog(ctx, primary)
+		s.WriteRequestLog(ctx, &models.RequestLog{
+			ID:             uuid.New(),
+			Provider:       "openai",
+			Model:          "gpt-4.1",
+			ShadowOf:       &primary.ID,
+			ShadowRule:     &rule,
+			RequestedAt:    base,
+			RespondedAt:    base,
+			ResponseTimeMs: int64(100 * (i + 1)),
+			TotalCost:      0.25,
+			StatusCode:     200 + 300*i,
+		})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	// Shadow requests stay out of the rollups
+	rows, err := s.QueryUsage(ctx, &models.UsageQuery{Granularity: models.GranularityHour, From: base, To: base.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("QueryUsage: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Model != "gpt-4o" || rows[0].RequestCount != 2 {
+		t.Errorf("usage = %+v, want only the primary requests", rows)
+	}
+
+	results, err := s.ShadowResults(ctx, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ShadowResults: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("ShadowResults = %d rows, want 1", len(results))
+	}
+	r := results[0]
+	if r.Rule != rule || r.Model != "gpt-4.1" || r.RequestCount != 2 || r.ErrorCount != 1 || r.TotalCost != 0.5 ||
+		r.AvgResponseTimeMs != 150 || r.PrimaryTotalCost != 2 || r.PrimaryAvgResponseTimeMs != 400 || r.PrimaryErrorCount != 0 {
+		t.Errorf("ShadowResults = %+v", r)
+	}
+}
+
+func TestSQLiteListReplayRequests(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "majordomo.db")
+	s := newTestSQLiteStorage(t, path)
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	s3Key := "key/2026-03-01/request.json.gz"
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	primary := uuid.New()
+	logs := []*models.RequestLog{
+		{Model: "gpt-4o", RequestBody: &body, RawMetadata: map[string]string{"feature": "search"}},
+		{Model: "gpt-4o", BodyS3Key: &s3Key, RawMetadata: map[string]string{"feature": "chat"}},
+		{Model: "gpt-4o-mini", RequestBody: &body, RawMetadata: map[string]string{"feature": "search"}},
+		{Model: "gpt-4o", RawMetadata: map[string]string{"feature": "search"}}, // No body
+		{Model: "gpt-4o", RequestBody: &body, ShadowOf: &primary},
+		{Model: "gpt-4o", RequestBody: &body, RawMetadata: map[string]string{models.ReplayOfMetadataKey: primary.String()}},
+	}
+	for i, log := range logs {
+		log.ID = uuid.New()
+		log.Provider = "openai"
+		log.RequestPath = "/v1/chat/completions"
+		log.RequestMethod = "POST"
+		log.RequestedAt = base.Add(time.Duration(i) * time.Minute)
+		log.RespondedAt = log.RequestedAt.Add(time.Second)
+		log.StatusCode = 200
+		s.WriteRequestLog(ctx, log)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSQLiteStorage(t, path)
+	defer s.Close()
+
+	all, err := s.ListReplayRequests(ctx, &models.ReplayQuery{From: base, To: base.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("ListReplayRequests: %v", err)
+	}
+	if len(all) != 3 || all[0].ID != logs[0].ID || all[1].ID != logs[1].ID || all[2].ID != logs[2].ID {
+		t.Fatalf("ListReplayRequests = %d requests, want the 3 with a stored body that are not shadows or replays, in order", len(all))
+	}
+	if all[0].RequestBody == nil || *all[0].RequestBody != body || all[0].Metadata["feature"] != "search" {
+		t.Errorf("first request = %+v", all[0])
+	}
+	if all[1].BodyS3Key == nil || *all[1].BodyS3Key != s3Key || all[1].RequestBody != nil {
+		t.Errorf("S3 request = %+v", all[1])
+	}
+
+	matched, err := s.ListReplayRequests(ctx, &models.ReplayQuery{Model: "gpt-4o", Metadata: map[string]string{"feature": "search"}})
+	if err != nil {
+		t.Fatalf("ListReplayRequests: %v", err)
+	}
+	if len(matched) != 1 || matched[0].ID != logs[0].ID {
+		t.Errorf("ListReplayRequests(model, metadata) = %d requests, want the first", len(matched))
+	}
+
+	limited, err := s.ListReplayRequests(ctx, &models.ReplayQuery{Limit: 2})
+	if err != nil || len(limited) != 2 {
+		t.Errorf("ListReplayRequests(limit 2) = %d requests, %v", len(limited), err)
+	}
+}
+
+func TestSQLiteBatches(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "majordomo.db"))
+	defer s.Close()
+
+	proxyKeyID := uuid.New()
+	batch := &models.Batch{
+		ID:                "batch_abc",
+		Provider:          "openai",
+		MajordomoAPIKeyID: uuid.New(),
+		ProxyKeyID:        &proxyKeyID,
+		RequestID:         uuid.New(),
+		Endpoint:          "/v1/chat/completions",
+		Status:            "validating",
+		RequestCount:      250,
+		Metadata:          map[string]string{"feature": "nightly-eval"},
+	}
+	if err := s.CreateBatch(ctx, batch); err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+	// Tracking the same batch again keeps the first
+	if err := s.CreateBatch(ctx, &models.Batch{ID: "batch_abc", Provider: "openai", MajordomoAPIKeyID: uuid.New(), RequestID: uuid.New(), Endpoint: "/v1/embeddings", Status: "validating"}); err != nil {
+		t.Fatalf("CreateBatch again: %v", err)
+	}
+
+	got, err := s.GetBatch(ctx, "openai", "batch_abc")
+	if err != nil || got == nil {
+		t.Fatalf("GetBatch = %v, %v", got, err)
+	}
+	if got.MajordomoAPIKeyID != batch.MajordomoAPIKeyID || got.Endpoint != "/v1/chat/completions" || got.Metadata["feature"] != "nightly-eval" || got.EndedAt != nil {
+		t.Errorf("GetBatch = %+v", got)
+	}
+	if missing, err := s.GetBatch(ctx, "anthropic", "batch_abc"); missing != nil || err != nil {
+		t.Errorf("GetBatch(other provider) = %v, %v, want nil", missing, err)
+	}
+
+	since := time.Now().Add(-time.Hour)
+	pending, err := s.ListPendingBatches(ctx, since, 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("ListPendingBatches = %d batches, %v, want the running batch", len(pending), err)
+	}
+
+	outputFile, errorFile := "file-out", "file-err"
+	endedAt := time.Now()
+	if err := s.UpdateBatch(ctx, &models.Batch{Provider: "openai", ID: "batch_abc", Status: "completed", RequestCount: 250, OutputFileID: &outputFile, ErrorFileID: &errorFile, EndedAt: &endedAt}); err != nil {
+		t.Fatalf("UpdateBatch: %v", err)
+	}
+	for _, fileID := range []string{outputFile, errorFile} {
+		got, err := s.GetBatchByFileID(ctx, "openai", fileID)
+		if err != nil || got == nil || got.ID != "batch_abc" || got.Status != "completed" || got.EndedAt == nil {
+			t.Errorf("GetBatchByFileID(%s) = %+v, %v", fileID, got, err)
+		}
+	}
+
+	for _, part := range []string{models.BatchPartResults, models.BatchPartErrors} {
+		if marked, err := s.MarkBatchResultsRecorded(ctx, "openai", "batch_abc", part); err != nil || !marked {
+			t.Fatalf("MarkBatchResultsRecorded(%s) = %v, %v", part, marked, err)
+		}
+	}
+	if pending, err := s.ListPendingBatches(ctx, since, 10); err != nil || len(pending) != 0 {
+		t.Errorf("ListPendingBatches = %d batches, %v, want none once every part is recorded", len(pending), err)
+	}
+	if marked, _ := s.MarkBatchResultsRecorded(ctx, "openai", "batch_abc", models.BatchPartResults); marked {
+		t.Error("MarkBatchResultsRecorded marked results that were already recorded")
+	}
+	if _, err := s.MarkBatchResultsRecorded(ctx, "openai", "batch_abc", "other"); err == nil {
+		t.Error("MarkBatchResultsRecorded(unknown part): want error")
+	}
+
+	batchID := batch.ID
+	body := `{"model":"gpt-4o"}`
+	logs := make([]*models.RequestLog, 250)
+	for i := range logs {
+		customID := fmt.Sprintf("request-%d", i)
+		logs[i] = &models.RequestLog{
+			ID: uuid.New(), Provider: "openai", Model: "gpt-4o", RequestPath: "/v1/chat/completions", RequestMethod: "POST",
+			BatchID: &batchID, BatchCustomID: &customID, RequestBody: &body,
+			RequestedAt: batch.CreatedAt, RespondedAt: endedAt, StatusCode: 200, InputTokens: 10, TotalCost: 0.001,
+		}
+	}
+	if err := s.WriteRequestLogs(ctx, logs); err != nil {
+		t.Fatalf("WriteRequestLogs: %v", err)
+	}
+	var count int
+	if err := s.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM llm_requests WHERE batch_id = $1`, batchID); err != nil || count != 250 {
+		t.Errorf("logged %d batch requests, %v, want 250", count, err)
+	}
+	if replays, err := s.ListReplayRequests(ctx, &models.ReplayQuery{}); err != nil || len(replays) != 0 {
+		t.Errorf("ListReplayRequests = %d requests, %v, want batch requests left out", len(replays), err)
+	}
+
+	// Writing the same logs again, as a retry does, stores and counts them once
+	if err := s.WriteRequestLogs(ctx, append(logs[:10:10], logs[0])); err != nil {
+		t.Fatalf("WriteRequestLogs again: %v", err)
+	}
+	if err := s.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM llm_requests WHERE batch_id = $1`, batchID); err != nil || count != 250 {
+		t.Errorf("logged %d batch requests after a retry, %v, want 250", count, err)
+	}
+	var requests int
+	if err := s.db.GetContext(ctx, &requests, `SELECT COALESCE(SUM(request_count), 0) FROM usage_rollups_daily WHERE metadata_key = ''`); err != nil || requests != 250 {
+		t.Errorf("daily rollups count %d requests, %v, want 250", requests, err)
+	}
+}
@@ -2,14 +2,50 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/superset-studio/majordomo-gateway/internal/models"
 )
 
+// Backend is implemented by each storage driver and covers every storage
+// interface the gateway needs.
+type Backend interface {
+	Storage
+	APIKeyStorage
+	UserStorage
+	SessionStorage
+	TeamStorage
+	ProxyKeyStorage
+	UsageStorage
+	AuditStorage
+	SecretRotationStorage
+	ModelRouteStorage
+	ExperimentStorage
+	PromptStorage
+	ReplayStorage
+	BatchStorage
+
+	// SchemaVersion returns the applied and expected schema versions.
+	SchemaVersion(ctx context.Context) (current int, expected int, err error)
+}
+
+// sqlStore implements the key, user, session, team, proxy key, model route, experiment, prompt, replay, batch, usage and audit queries shared by
+// the Postgres and SQLite backends. Its queries only use SQL both accept.
+type sqlStore struct {
+	db *sqlx.DB
+}
+
 // Storage defines the interface for request log storage
 type Storage interface {
 	WriteRequestLog(ctx context.Context, log *models.RequestLog)
+	// WriteRequestLogs writes many logs at once and returns when they are
+	// written, or spilled to disk if the database is unreachable. Logs the
+	// database rejects, such as ones whose ID is already stored, are dropped,
+	// so writing the same logs again stores them once. It returns an error
+	// if the logs could be neither written nor spilled.
+	WriteRequestLogs(ctx context.Context, logs []*models.RequestLog) error
 	Ping(ctx context.Context) error
 	Close() error
 }
@@ -24,6 +60,8 @@ type APIKeyStorage interface {
 	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
 	UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error
 	ListAPIKeysByUserID(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error)
+	ListAPIKeysByTeamID(ctx context.Context, teamID uuid.UUID) ([]*models.APIKey, error)
+	SetAPIKeyTeam(ctx context.Context, id uuid.UUID, team *models.Team) error
 }
 
 // UserStorage defines the interface for user CRUD operations
@@ -33,6 +71,42 @@ type UserStorage interface {
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	ListUsers(ctx context.Context) ([]*models.User, error)
 	UpdateUserPassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	UpdateUserRole(ctx context.Context, id uuid.UUID, role models.Role) error
+	SetUserActive(ctx context.Context, id uuid.UUID, active bool) error
+	GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error)
+	CreateOIDCUser(ctx context.Context, username, issuer, subject string, role models.Role) (*models.User, error)
+	LinkUserOIDC(ctx context.Context, id uuid.UUID, issuer, subject string) error
+}
+
+// SessionStorage defines the interface for admin login sessions
+type SessionStorage interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	RotateSessionToken(ctx context.Context, id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// TeamStorage defines the interface for organization, team and team membership operations
+type TeamStorage interface {
+	CreateOrganization(ctx context.Context, name string) (*models.Organization, error)
+	GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error)
+	GetOrganizationByName(ctx context.Context, name string) (*models.Organization, error)
+	ListOrganizations(ctx context.Context) ([]*models.Organization, error)
+
+	CreateTeam(ctx context.Context, orgID uuid.UUID, name string, monthlyBudget *float64) (*models.Team, error)
+	GetTeam(ctx context.Context, id uuid.UUID) (*models.Team, error)
+	GetTeamByName(ctx context.Context, orgID uuid.UUID, name string) (*models.Team, error)
+	ListTeams(ctx context.Context, orgID uuid.UUID) ([]*models.Team, error)
+	ListTeamsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Team, error)
+	UpdateTeamBudget(ctx context.Context, id uuid.UUID, monthlyBudget *float64) error
+
+	SetTeamMember(ctx context.Context, teamID, userID uuid.UUID, role models.Role) error
+	RemoveTeamMember(ctx context.Context, teamID, userID uuid.UUID) error
+	ListTeamMembers(ctx context.Context, teamID uuid.UUID) ([]*models.TeamMember, error)
+	// GetTeamMemberRole returns "" if the user is not a member of the team
+	GetTeamMemberRole(ctx context.Context, teamID, userID uuid.UUID) (models.Role, error)
 }
 
 // ProxyKeyStorage defines the interface for proxy key CRUD operations
@@ -42,6 +116,7 @@ type ProxyKeyStorage interface {
 	GetProxyKeyByID(ctx context.Context, id uuid.UUID) (*models.ProxyKey, error)
 	ListProxyKeys(ctx context.Context, majordomoKeyID uuid.UUID) ([]*models.ProxyKey, error)
 	RevokeProxyKey(ctx context.Context, id uuid.UUID) error
+	SetProxyKeySingleHeaderAuth(ctx context.Context, id uuid.UUID, enabled bool) error
 	UpdateProxyKeyLastUsed(ctx context.Context, id uuid.UUID) error
 
 	SetProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string, encryptedKey string) error
@@ -49,3 +124,71 @@ type ProxyKeyStorage interface {
 	ListProviderMappings(ctx context.Context, proxyKeyID uuid.UUID) ([]*models.ProviderMapping, error)
 	DeleteProviderMapping(ctx context.Context, proxyKeyID uuid.UUID, provider string) error
 }
+
+// SecretRotationStorage re-encrypts stored provider secrets
+type SecretRotationStorage interface {
+	ReencryptProviderMappings(ctx context.Context, batchSize int, reencrypt ReencryptFunc) (*RotationReport, error)
+}
+
+// UsageStorage defines the interface for reading aggregated usage
+type UsageStorage interface {
+	QueryUsage(ctx context.Context, q *models.UsageQuery) ([]*models.UsageRollup, error)
+	TeamCostSince(ctx context.Context, teamID uuid.UUID, since time.Time) (float64, error)
+	ShadowResults(ctx context.Context, from, to time.Time) ([]*models.ShadowResult, error)
+}
+
+// ModelRouteStorage defines the interface for model route CRUD operations
+type ModelRouteStorage interface {
+	CreateModelRoute(ctx context.Context, route *models.ModelRoute) error
+	GetModelRoute(ctx context.Context, id uuid.UUID) (*models.ModelRoute, error)
+	ListModelRoutes(ctx context.Context) ([]*models.ModelRoute, error)
+	UpdateModelRoute(ctx context.Context, route *models.ModelRoute) error
+	DeleteModelRoute(ctx context.Context, id uuid.UUID) error
+}
+
+// ExperimentStorage defines the interface for experiment CRUD operations and
+// results
+type ExperimentStorage interface {
+	CreateExperiment(ctx context.Context, exp *models.Experiment) error
+	GetExperiment(ctx context.Context, id uuid.UUID) (*models.Experiment, error)
+	ListExperiments(ctx context.Context) ([]*models.Experiment, error)
+	UpdateExperiment(ctx context.Context, exp *models.Experiment) error
+	DeleteExperiment(ctx context.Context, id uuid.UUID) error
+	ExperimentResults(ctx context.Context, id uuid.UUID, from, to time.Time) ([]*models.ExperimentArmResult, error)
+}
+
+// PromptStorage defines the interface for versioned prompt templates and
+// their results. A version of 0 means the latest version.
+type PromptStorage interface {
+	CreatePromptVersion(ctx context.Context, prompt *models.PromptTemplate) error
+	GetPromptVersion(ctx context.Context, name string, version int) (*models.PromptTemplate, error)
+	ListPrompts(ctx context.Context) ([]*models.PromptTemplate, error)
+	ListPromptVersions(ctx context.Context, name string) ([]*models.PromptTemplate, error)
+	DeletePromptVersion(ctx context.Context, name string, version int) error
+	PromptResults(ctx context.Context, name string, from, to time.Time) ([]*models.PromptVersionResult, error)
+}
+
+// ReplayStorage defines the interface for selecting logged requests to
+// replay
+type ReplayStorage interface {
+	ListReplayRequests(ctx context.Context, q *models.ReplayQuery) ([]*models.LoggedRequest, error)
+}
+
+// BatchStorage defines the interface for tracking provider batches submitted
+// through the gateway
+type BatchStorage interface {
+	CreateBatch(ctx context.Context, batch *models.Batch) error
+	GetBatch(ctx context.Context, provider, id string) (*models.Batch, error)
+	GetBatchByFileID(ctx context.Context, provider, fileID string) (*models.Batch, error)
+	UpdateBatch(ctx context.Context, batch *models.Batch) error
+	ListPendingBatches(ctx context.Context, since time.Time, limit int) ([]*models.Batch, error)
+	// MarkBatchResultsRecorded marks a part of a batch's results as recorded
+	// and reports whether it wasn't already, so that each part is recorded once
+	MarkBatchResultsRecorded(ctx context.Context, provider, id, part string) (bool, error)
+}
+
+// AuditStorage defines the interface for the append-only audit log
+type AuditStorage interface {
+	WriteAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, q *models.AuditQuery) ([]*models.AuditEvent, error)
+}
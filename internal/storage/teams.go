@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/superset-studio/majordomo-gateway/internal/models"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrTeamNotFound         = errors.New("team not found")
+	ErrTeamMemberNotFound   = errors.New("team member not found")
+)
+
+// CreateOrganization creates a new organization
+func (s *sqlStore) CreateOrganization(ctx context.Context, name string) (*models.Organization, error) {
+	query := `
+		INSERT INTO organizations (id, name)
+		VALUES ($1, $2)
+		RETURNING id, name, created_at`
+
+	var org models.Organization
+	if err := s.db.QueryRowxContext(ctx, query, uuid.New(), name).StructScan(&org); err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// GetOrganization retrieves an organization by its UUID
+func (s *sqlStore) GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	query := `
+		SELECT id, name, created_at
+		FROM organizations
+		WHERE id = $1`
+
+	var org models.Organization
+	err := s.db.GetContext(ctx, &org, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// GetOrganizationByName retrieves an organization by its name
+func (s *sqlStore) GetOrganizationByName(ctx context.Context, name string) (*models.Organization, error) {
+	query := `
+		SELECT id, name, created_at
+		FROM organizations
+		WHERE name = $1`
+
+	var org models.Organization
+	err := s.db.GetContext(ctx, &org, query, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// ListOrganizations retrieves all organizations
+func (s *sqlStore) ListOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	query := `
+		SELECT id, name, created_at
+		FROM organizations
+		ORDER BY name`
+
+	var orgs []*models.Organization
+	if err := s.db.SelectContext(ctx, &orgs, query); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// CreateTeam creates a new team in an organization
+func (s *sqlStore) CreateTeam(ctx context.Context, orgID uuid.UUID, name string, monthlyBudget *float64) (*models.Team, error) {
+	query := `
+		INSERT INTO teams (id, organization_id, name, monthly_budget)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, organization_id, name, monthly_budget, created_at`
+
+	var team models.Team
+	if err := s.db.QueryRowxContext(ctx, query, uuid.New(), orgID, name, monthlyBudget).StructScan(&team); err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// GetTeam retrieves a team by its UUID
+func (s *sqlStore) GetTeam(ctx context.Context, id uuid.UUID) (*models.Team, error) {
+	query := `
+		SELECT id, organization_id, name, monthly_budget, created_at
+		FROM teams
+		WHERE id = $1`
+
+	var team models.Team
+	err := s.db.GetContext(ctx, &team, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// GetTeamByName retrieves a team by its name within an organization
+func (s *sqlStore) GetTeamByName(ctx context.Context, orgID uuid.UUID, name string) (*models.Team, error) {
+	query := `
+		SELECT id, organization_id, name, monthly_budget, created_at
+		FROM teams
+		WHERE organization_id = $1 AND name = $2`
+
+	var team models.Team
+	err := s.db.GetContext(ctx, &team, query, orgID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// ListTeams retrieves all teams in an organization
+func (s *sqlStore) ListTeams(ctx context.Context, orgID uuid.UUID) ([]*models.Team, error) {
+	query := `
+		SELECT id, organization_id, name, monthly_budget, created_at
+		FROM teams
+		WHERE organization_id = $1
+		ORDER BY name`
+
+	var teams []*models.Team
+	if err := s.db.SelectContext(ctx, &teams, query, orgID); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// ListTeamsByUserID retrieves all teams a user is a member of
+func (s *sqlStore) ListTeamsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Team, error) {
+	query := `
+		SELECT t.id, t.organization_id, t.name, t.monthly_budget, t.created_at
+		FROM teams t
+		JOIN team_members m ON m.team_id = t.id
+		WHERE m.user_id = $1
+		ORDER BY t.name`
+
+	var teams []*models.Team
+	if err := s.db.SelectContext(ctx, &teams, query, userID); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// UpdateTeamBudget sets a team's monthly budget; nil removes it
+func (s *sqlStore) UpdateTeamBudget(ctx context.Context, id uuid.UUID, monthlyBudget *float64) error {
+	query := `
+		UPDATE teams
+		SET monthly_budget = $1
+		WHERE id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, monthlyBudget, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTeamNotFound
+	}
+
+	return nil
+}
+
+// SetTeamMember adds a user to a team, or changes their role if they are
+// already a member
+func (s *sqlStore) SetTeamMember(ctx context.Context, teamID, userID uuid.UUID, role models.Role) error {
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+
+	query := `
+		INSERT INTO team_members (team_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (team_id, user_id)
+		DO UPDATE SET role = EXCLUDED.role`
+
+	_, err := s.db.ExecContext(ctx, query, teamID, userID, role)
+	return err
+}
+
+// RemoveTeamMember removes a user from a team
+func (s *sqlStore) RemoveTeamMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	query := `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, teamID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTeamMemberNotFound
+	}
+
+	return nil
+}
+
+// ListTeamMembers retrieves the members of a team
+func (s *sqlStore) ListTeamMembers(ctx context.Context, teamID uuid.UUID) ([]*models.TeamMember, error) {
+	query := `
+		SELECT m.team_id, m.user_id, u.username, m.role, m.created_at
+		FROM team_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.team_id = $1
+		ORDER BY u.username`
+
+	var members []*models.TeamMember
+	if err := s.db.SelectContext(ctx, &members, query, teamID); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetTeamMemberRole returns a user's role in a team, or "" if the user is
+// not a member
+func (s *sqlStore) GetTeamMemberRole(ctx context.Context, teamID, userID uuid.UUID) (models.Role, error) {
+	query := `SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2`
+
+	var role models.Role
+	err := s.db.GetContext(ctx, &role, query, teamID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
@@ -12,22 +12,31 @@ import (
 
 var (
 	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidRole  = errors.New("invalid role")
 )
 
 // CreateUser creates a new user with a bcrypt-hashed password
-func (s *PostgresStorage) CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
+func (s *sqlStore) CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
 	if err != nil {
 		return nil, err
 	}
 
 	query := `
-		INSERT INTO users (username, password_hash)
-		VALUES ($1, $2)
-		RETURNING id, username, password_hash, is_active, created_at`
+		INSERT INTO users (id, username, password_hash, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, username, password_hash, role, is_active, oidc_issuer, oidc_subject, created_at`
+
+	role := input.Role
+	if role == "" {
+		role = models.RoleMember
+	}
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
 
 	var user models.User
-	err = s.db.QueryRowxContext(ctx, query, input.Username, string(hash)).StructScan(&user)
+	err = s.db.QueryRowxContext(ctx, query, uuid.New(), input.Username, string(hash), role).StructScan(&user)
 	if err != nil {
 		return nil, err
 	}
@@ -36,9 +45,9 @@ func (s *PostgresStorage) CreateUser(ctx context.Context, input *models.CreateUs
 }
 
 // GetUserByID retrieves a user by their UUID
-func (s *PostgresStorage) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+func (s *sqlStore) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_active, created_at
+		SELECT id, username, password_hash, role, is_active, oidc_issuer, oidc_subject, created_at
 		FROM users
 		WHERE id = $1`
 
@@ -55,9 +64,9 @@ func (s *PostgresStorage) GetUserByID(ctx context.Context, id uuid.UUID) (*model
 }
 
 // GetUserByUsername retrieves a user by their username
-func (s *PostgresStorage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+func (s *sqlStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_active, created_at
+		SELECT id, username, password_hash, role, is_active, oidc_issuer, oidc_subject, created_at
 		FROM users
 		WHERE username = $1`
 
@@ -73,10 +82,74 @@ func (s *PostgresStorage) GetUserByUsername(ctx context.Context, username string
 	return &user, nil
 }
 
+// GetUserByOIDCSubject retrieves the user linked to an OIDC identity
+func (s *sqlStore) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	query := `
+		SELECT id, username, password_hash, role, is_active, oidc_issuer, oidc_subject, created_at
+		FROM users
+		WHERE oidc_issuer = $1 AND oidc_subject = $2`
+
+	var user models.User
+	err := s.db.GetContext(ctx, &user, query, issuer, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateOIDCUser creates a user linked to an OIDC identity. The user has no
+// password, so they can only log in through the OIDC provider.
+func (s *sqlStore) CreateOIDCUser(ctx context.Context, username, issuer, subject string, role models.Role) (*models.User, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	query := `
+		INSERT INTO users (id, username, password_hash, role, oidc_issuer, oidc_subject)
+		VALUES ($1, $2, '', $3, $4, $5)
+		RETURNING id, username, password_hash, role, is_active, oidc_issuer, oidc_subject, created_at`
+
+	var user models.User
+	err := s.db.QueryRowxContext(ctx, query, uuid.New(), username, role, issuer, subject).StructScan(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// LinkUserOIDC links an existing user to an OIDC identity
+func (s *sqlStore) LinkUserOIDC(ctx context.Context, id uuid.UUID, issuer, subject string) error {
+	query := `
+		UPDATE users
+		SET oidc_issuer = $1, oidc_subject = $2
+		WHERE id = $3`
+
+	result, err := s.db.ExecContext(ctx, query, issuer, subject, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 // ListUsers retrieves all users
-func (s *PostgresStorage) ListUsers(ctx context.Context) ([]*models.User, error) {
+func (s *sqlStore) ListUsers(ctx context.Context) ([]*models.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_active, created_at
+		SELECT id, username, password_hash, role, is_active, oidc_issuer, oidc_subject, created_at
 		FROM users
 		ORDER BY created_at DESC`
 
@@ -90,7 +163,7 @@ func (s *PostgresStorage) ListUsers(ctx context.Context) ([]*models.User, error)
 }
 
 // UpdateUserPassword updates a user's password hash
-func (s *PostgresStorage) UpdateUserPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+func (s *sqlStore) UpdateUserPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
 	query := `
 		UPDATE users
 		SET password_hash = $1
@@ -112,3 +185,45 @@ func (s *PostgresStorage) UpdateUserPassword(ctx context.Context, id uuid.UUID,
 
 	return nil
 }
+
+// UpdateUserRole changes a user's role
+func (s *sqlStore) UpdateUserRole(ctx context.Context, id uuid.UUID, role models.Role) error {
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+
+	query := `
+		UPDATE users
+		SET role = $1
+		WHERE id = $2`
+
+	return s.updateUser(ctx, query, role, id)
+}
+
+// SetUserActive activates or deactivates a user. Inactive users can't log in.
+func (s *sqlStore) SetUserActive(ctx context.Context, id uuid.UUID, active bool) error {
+	query := `
+		UPDATE users
+		SET is_active = $1
+		WHERE id = $2`
+
+	return s.updateUser(ctx, query, active, id)
+}
+
+func (s *sqlStore) updateUser(ctx context.Context, query string, value interface{}, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, query, value, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
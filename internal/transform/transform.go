@@ -0,0 +1,361 @@
+// Package transform rewrites request and response bodies with declarative,
+// JSON Patch style rules.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Phase is the body a rule applies to
+type Phase string
+
+const (
+	// PhaseRequest rules change the request before it is sent upstream
+	PhaseRequest Phase = "request"
+	// PhaseResponse rules change the response before it is returned
+	PhaseResponse Phase = "response"
+)
+
+// Operation is one change to a JSON body. Path is a JSON Pointer (RFC 6901).
+type Operation struct {
+	// Op is one of:
+	//   add     sets an object member or inserts into an array ("-" appends)
+	//   replace sets an existing value; a missing path is left alone
+	//   remove  deletes a value; a missing path is left alone
+	//   default sets an object member only if it isn't already set
+	Op    string
+	Path  string
+	Value json.RawMessage // Unused by remove
+}
+
+// Rule is a list of operations applied to the bodies it matches. Empty
+// scope lists match everything.
+type Rule struct {
+	Name       string
+	Phase      Phase
+	APIKeyIDs  []uuid.UUID
+	Models     []string // Matches the model the client asked for or the one routing chose
+	Paths      []string // Request paths; a trailing * matches any suffix
+	Operations []Operation
+}
+
+// Scope describes the request a body belongs to
+type Scope struct {
+	APIKeyID       uuid.UUID
+	RequestedModel string
+	Model          string
+	Path           string
+}
+
+func (r *Rule) matches(scope Scope) bool {
+	if len(r.APIKeyIDs) > 0 && !slices.Contains(r.APIKeyIDs, scope.APIKeyID) {
+		return false
+	}
+	if len(r.Models) > 0 && !slices.Contains(r.Models, scope.RequestedModel) && !slices.Contains(r.Models, scope.Model) {
+		return false
+	}
+	if len(r.Paths) > 0 && !slices.ContainsFunc(r.Paths, func(p string) bool { return matchPath(p, scope.Path) }) {
+		return false
+	}
+	return true
+}
+
+func matchPath(pattern, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return pattern == path
+}
+
+// Transformer applies rules to bodies, in the order the rules are given
+type Transformer struct {
+	request  []Rule
+	response []Rule
+}
+
+// NewTransformer creates a Transformer from validated rules
+func NewTransformer(rules []Rule) *Transformer {
+	t := &Transformer{}
+	for _, rule := range rules {
+		if rule.Phase == PhaseResponse {
+			t.response = append(t.response, rule)
+		} else {
+			t.request = append(t.request, rule)
+		}
+	}
+	return t
+}
+
+// Failure is a rule that matched a body but couldn't be applied to it
+type Failure struct {
+	Rule string
+	Err  error
+}
+
+// Result is the outcome of transforming a body
+type Result struct {
+	Body     []byte
+	Applied  []string // Names of the rules that changed the body
+	Failures []Failure
+}
+
+// Request applies the request rules matching scope to body
+func (t *Transformer) Request(scope Scope, body []byte) Result {
+	return apply(t.request, scope, body)
+}
+
+// Response applies the response rules matching scope to body
+func (t *Transformer) Response(scope Scope, body []byte) Result {
+	return apply(t.response, scope, body)
+}
+
+// HasResponseRules reports whether any response rule could apply
+func (t *Transformer) HasResponseRules() bool {
+	return len(t.response) > 0
+}
+
+// apply runs each matching rule against body. A rule that fails leaves the
+// body as the previous rule left it.
+func apply(rules []Rule, scope Scope, body []byte) Result {
+	result := Result{Body: body}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matches(scope) {
+			continue
+		}
+		out, err := applyRule(rule, result.Body)
+		if err != nil {
+			result.Failures = append(result.Failures, Failure{Rule: rule.Name, Err: err})
+			continue
+		}
+		if !bytes.Equal(out, result.Body) {
+			result.Body = out
+			result.Applied = append(result.Applied, rule.Name)
+		}
+	}
+	return result
+}
+
+func applyRule(rule *Rule, body []byte) ([]byte, error) {
+	doc, err := decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("body is not JSON: %w", err)
+	}
+	changed := false
+	for _, op := range rule.Operations {
+		var opChanged bool
+		doc, opChanged, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.Op, op.Path, err)
+		}
+		changed = changed || opChanged
+	}
+	if !changed {
+		return body, nil
+	}
+
+	// Leave <, > and & in prompts as they were sent
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// decode parses JSON keeping numbers as they were written
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// applyOperation applies op to doc and returns the new document and whether
+// anything changed
+func applyOperation(doc any, op Operation) (any, bool, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	var value any
+	if op.Op != "remove" {
+		if value, err = decode(op.Value); err != nil {
+			return nil, false, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+	if len(tokens) == 0 {
+		if op.Op == "add" || op.Op == "replace" {
+			return value, true, nil
+		}
+		return nil, false, errors.New("cannot " + op.Op + " the whole document")
+	}
+
+	parent, ok := lookup(doc, tokens[:len(tokens)-1])
+	if !ok {
+		if op.Op == "remove" || op.Op == "replace" {
+			return doc, false, nil
+		}
+		return nil, false, errors.New("parent does not exist")
+	}
+	last := tokens[len(tokens)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		_, exists := container[last]
+		switch op.Op {
+		case "add":
+			container[last] = value
+		case "replace":
+			if !exists {
+				return doc, false, nil
+			}
+			container[last] = value
+		case "remove":
+			if !exists {
+				return doc, false, nil
+			}
+			delete(container, last)
+		case "default":
+			if exists {
+				return doc, false, nil
+			}
+			container[last] = value
+		}
+		return doc, true, nil
+
+	case []any:
+		if op.Op == "default" {
+			return nil, false, errors.New("default only applies to object members")
+		}
+		if op.Op == "add" && last == "-" {
+			return setAt(doc, tokens[:len(tokens)-1], append(container, value)), true, nil
+		}
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 {
+			return nil, false, fmt.Errorf("invalid array index %q", last)
+		}
+		switch op.Op {
+		case "add":
+			if i > len(container) {
+				return nil, false, fmt.Errorf("array index %d out of range", i)
+			}
+			return setAt(doc, tokens[:len(tokens)-1], slices.Insert(container, i, value)), true, nil
+		case "replace":
+			if i >= len(container) {
+				return doc, false, nil
+			}
+			container[i] = value
+			return doc, true, nil
+		case "remove":
+			if i >= len(container) {
+				return doc, false, nil
+			}
+			return setAt(doc, tokens[:len(tokens)-1], slices.Delete(container, i, i+1)), true, nil
+		}
+	}
+	return nil, false, errors.New("parent is not an object or array")
+}
+
+// lookup returns the value at tokens in doc
+func lookup(doc any, tokens []string) (any, bool) {
+	for _, token := range tokens {
+		switch v := doc.(type) {
+		case map[string]any:
+			next, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// setAt replaces the value at tokens, which must exist, and returns the new
+// document. Arrays change length in place, so their parent needs the new
+// slice.
+func setAt(doc any, tokens []string, value any) any {
+	if len(tokens) == 0 {
+		return value
+	}
+	parent, _ := lookup(doc, tokens[:len(tokens)-1])
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]any:
+		container[last] = value
+	case []any:
+		i, _ := strconv.Atoi(last)
+		container[i] = value
+	}
+	return doc
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// ValidateRule checks that a rule can be used
+func ValidateRule(rule *Rule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	if rule.Phase != PhaseRequest && rule.Phase != PhaseResponse {
+		return fmt.Errorf("phase must be request or response, got %q", rule.Phase)
+	}
+	if len(rule.Operations) == 0 {
+		return errors.New("at least one operation is required")
+	}
+	for i, op := range rule.Operations {
+		switch op.Op {
+		case "add", "replace", "default":
+			if _, err := decode(op.Value); err != nil {
+				return fmt.Errorf("operation %d: value is required and must be JSON", i)
+			}
+		case "remove":
+		default:
+			return fmt.Errorf("operation %d: op must be add, replace, remove or default, got %q", i, op.Op)
+		}
+		if _, err := parsePointer(op.Path); err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+		if op.Path == "" && (op.Op == "remove" || op.Op == "default") {
+			return fmt.Errorf("operation %d: %s needs a path", i, op.Op)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRequestOperations(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []Operation
+		body string
+		want string
+	}{
+		{
+			"insert system prompt",
+			[]Operation{{Op: "add", Path: "/messages/0", Value: json.RawMessage(`{"role":"system","content":"Be brief"}`)}},
+			`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`,
+			`{"messages":[{"content":"Be brief","role":"system"},{"content":"hi","role":"user"}],"model":"gpt-4o"}`,
+		},
+		{
+			"append",
+			[]Operation{{Op: "add", Path: "/stop/-", Value: json.RawMessage(`"END"`)}},
+			`{"stop":["\n"]}`,
+			`{"stop":["\n","END"]}`,
+		},
+		{
+			"remove user",
+			[]Operation{{Op: "remove", Path: "/user"}},
+			`{"model":"gpt-4o","user":"alice@example.com"}`,
+			`{"model":"gpt-4o"}`,
+		},
+		{
+			"remove missing member is a no-op",
+			[]Operation{{Op: "remove", Path: "/user"}},
+			`{"model":"gpt-4o"}`,
+			`{"model":"gpt-4o"}`,
+		},
+		{
+			"default when unset",
+			[]Operation{{Op: "default", Path: "/temperature", Value: json.RawMessage(`0.2`)}},
+			`{"model":"gpt-4o"}`,
+			`{"model":"gpt-4o","temperature":0.2}`,
+		},
+		{
+			"default keeps the client's value",
+			[]Operation{{Op: "default", Path: "/temperature", Value: json.RawMessage(`0.2`)}},
+			`{"temperature":1.0}`,
+			`{"temperature":1.0}`,
+		},
+		{
+			"replace nested",
+			[]Operation{{Op: "replace", Path: "/a~1b/0", Value: json.RawMessage(`"<x & y>"`)}},
+			`{"a/b":["old"],"n":12345678901234567890}`,
+			`{"a/b":["<x & y>"],"n":12345678901234567890}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTransformer([]Rule{{Name: "r", Phase: PhaseRequest, Operations: tt.ops}})
+			result := tr.Request(Scope{}, []byte(tt.body))
+			if len(result.Failures) > 0 {
+				t.Fatalf("unexpected failures: %v", result.Failures)
+			}
+			if string(result.Body) != tt.want {
+				t.Errorf("body = %s, want %s", result.Body, tt.want)
+			}
+			if changed := tt.body != tt.want; changed != (len(result.Applied) == 1) {
+				t.Errorf("applied = %v, changed = %v", result.Applied, changed)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	key := uuid.New()
+	tr := NewTransformer([]Rule{
+		{Name: "key", Phase: PhaseRequest, APIKeyIDs: []uuid.UUID{key}, Operations: []Operation{{Op: "add", Path: "/key", Value: json.RawMessage(`true`)}}},
+		{Name: "model", Phase: PhaseRequest, Models: []string{"fast"}, Operations: []Operation{{Op: "add", Path: "/model_rule", Value: json.RawMessage(`true`)}}},
+		{Name: "path", Phase: PhaseRequest, Paths: []string{"/v1/chat/*"}, Operations: []Operation{{Op: "add", Path: "/path", Value: json.RawMessage(`true`)}}},
+		{Name: "response", Phase: PhaseResponse, Operations: []Operation{{Op: "remove", Path: "/id"}}},
+	})
+
+	result := tr.Request(Scope{APIKeyID: key, RequestedModel: "fast", Model: "gpt-4o-mini", Path: "/v1/chat/completions"}, []byte(`{}`))
+	if want := `{"key":true,"model_rule":true,"path":true}`; string(result.Body) != want {
+		t.Errorf("body = %s, want %s", result.Body, want)
+	}
+
+	result = tr.Request(Scope{APIKeyID: uuid.New(), Model: "gpt-4o", Path: "/v1/embeddings"}, []byte(`{}`))
+	if string(result.Body) != `{}` || len(result.Applied) != 0 {
+		t.Errorf("body = %s, applied = %v, want no changes", result.Body, result.Applied)
+	}
+
+	result = tr.Response(Scope{}, []byte(`{"id":"x","object":"chat.completion"}`))
+	if want := `{"object":"chat.completion"}`; string(result.Body) != want {
+		t.Errorf("response body = %s, want %s", result.Body, want)
+	}
+}
+
+func TestFailedRuleLeavesBody(t *testing.T) {
+	tr := NewTransformer([]Rule{
+		{Name: "broken", Phase: PhaseRequest, Operations: []Operation{
+			{Op: "remove", Path: "/user"},
+			{Op: "add", Path: "/missing/parent", Value: json.RawMessage(`1`)},
+		}},
+		{Name: "ok", Phase: PhaseRequest, Operations: []Operation{{Op: "add", Path: "/seed", Value: json.RawMessage(`1`)}}},
+	})
+
+	result := tr.Request(Scope{}, []byte(`{"user":"u"}`))
+	if want := `{"seed":1,"user":"u"}`; string(result.Body) != want {
+		t.Errorf("body = %s, want %s", result.Body, want)
+	}
+	if len(result.Failures) != 1 || result.Failures[0].Rule != "broken" {
+		t.Errorf("failures = %v, want broken", result.Failures)
+	}
+
+	result = tr.Request(Scope{}, []byte(`not json`))
+	if string(result.Body) != `not json` || len(result.Failures) != 2 {
+		t.Errorf("non-JSON body = %s with %d failures, want it unchanged with 2", result.Body, len(result.Failures))
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	add := Operation{Op: "add", Path: "/x", Value: json.RawMessage(`1`)}
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"valid", Rule{Name: "r", Phase: PhaseRequest, Operations: []Operation{add}}, false},
+		{"valid remove", Rule{Name: "r", Phase: PhaseResponse, Operations: []Operation{{Op: "remove", Path: "/x"}}}, false},
+		{"missing name", Rule{Phase: PhaseRequest, Operations: []Operation{add}}, true},
+		{"bad phase", Rule{Name: "r", Phase: "both", Operations: []Operation{add}}, true},
+		{"no operations", Rule{Name: "r", Phase: PhaseRequest}, true},
+		{"unknown op", Rule{Name: "r", Phase: PhaseRequest, Operations: []Operation{{Op: "move", Path: "/x"}}}, true},
+		{"missing value", Rule{Name: "r", Phase: PhaseRequest, Operations: []Operation{{Op: "add", Path: "/x"}}}, true},
+		{"relative path", Rule{Name: "r", Phase: PhaseRequest, Operations: []Operation{{Op: "remove", Path: "x"}}}, true},
+		{"remove document", Rule{Name: "r", Phase: PhaseRequest, Operations: []Operation{{Op: "remove", Path: ""}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRule(&tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
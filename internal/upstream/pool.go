@@ -0,0 +1,300 @@
+// Package upstream tracks the health of provider endpoints and chooses which
+// endpoint each request is sent to.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Strategy decides which available endpoint of a pool gets a request
+type Strategy string
+
+const (
+	// StrategyLatency picks the endpoint with the lowest p95 latency,
+	// trying endpoints without enough samples first
+	StrategyLatency Strategy = "latency"
+	// StrategyRoundRobin spreads requests evenly over the endpoints
+	StrategyRoundRobin Strategy = "round_robin"
+	// StrategyFailover sends every request to the first endpoint, moving on
+	// only while its circuit breaker is open
+	StrategyFailover Strategy = "failover"
+)
+
+// ParseStrategy returns the strategy named s
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case StrategyLatency, StrategyRoundRobin, StrategyFailover:
+		return Strategy(s), nil
+	}
+	return "", fmt.Errorf("unknown upstream strategy %q: must be latency, round_robin or failover", s)
+}
+
+// minLatencySamples is the number of successful requests an endpoint needs
+// before the latency strategy trusts its p95
+const minLatencySamples = 5
+
+// Config controls health tracking and circuit breaking. A threshold of 0
+// disables that check.
+type Config struct {
+	Strategy Strategy
+	// Window is the number of recent requests per endpoint that the error
+	// rate and p95 latency are computed over
+	Window int
+	// ConsecutiveFailures opens the breaker after this many failures in a row
+	ConsecutiveFailures int
+	// ErrorRate opens the breaker when this fraction of the window failed,
+	// once the window holds at least MinRequests requests
+	ErrorRate   float64
+	MinRequests int
+	// OpenDuration is how long a breaker stays open before a trial request
+	// is let through
+	OpenDuration time.Duration
+}
+
+// State is the state of an endpoint's circuit breaker
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// Endpoint is one base URL of a pool
+type Endpoint struct {
+	URL string
+
+	// Guarded by the pool's mutex
+	state       State
+	openedAt    time.Time
+	trial       bool // A half-open trial request is in flight
+	results     []result
+	next        int // Index in results of the next result to overwrite
+	consecutive int
+	p95         time.Duration
+	successes   int
+}
+
+type result struct {
+	latency time.Duration
+	failed  bool
+}
+
+// EndpointStatus is a snapshot of an endpoint's health
+type EndpointStatus struct {
+	URL                 string     `json:"url"`
+	State               State      `json:"state"`
+	Requests            int        `json:"requests"` // Requests in the window
+	ErrorRate           float64    `json:"error_rate"`
+	P95LatencyMs        int64      `json:"p95_latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+}
+
+// Pool is the set of endpoints serving one provider. It is safe for
+// concurrent use.
+type Pool struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	endpoints []*Endpoint
+	rr        int
+}
+
+// NewPool creates a pool of the given base URLs, all starting closed
+func NewPool(baseURLs []string, cfg Config) *Pool {
+	if cfg.Window <= 0 {
+		cfg.Window = 1
+	}
+	p := &Pool{cfg: cfg, now: time.Now}
+	for _, url := range baseURLs {
+		p.endpoints = append(p.endpoints, &Endpoint{URL: url, state: StateClosed})
+	}
+	return p
+}
+
+// Pick chooses the endpoint for a request, which must be reported with Done.
+// Endpoints whose breaker is open are skipped; if every breaker is open, the
+// endpoint that has been open longest gets the request rather than failing
+// it.
+func (p *Pool) Pick() *Endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var available []*Endpoint
+	for _, e := range p.endpoints {
+		if e.state == StateOpen && now.Sub(e.openedAt) >= p.cfg.OpenDuration {
+			e.state = StateHalfOpen
+		}
+		if e.state == StateClosed || (e.state == StateHalfOpen && !e.trial) {
+			available = append(available, e)
+		}
+	}
+
+	if len(available) == 0 {
+		oldest := p.endpoints[0]
+		for _, e := range p.endpoints[1:] {
+			if e.openedAt.Before(oldest.openedAt) {
+				oldest = e
+			}
+		}
+		return oldest
+	}
+
+	var picked *Endpoint
+	switch p.cfg.Strategy {
+	case StrategyRoundRobin:
+		picked = available[p.rr%len(available)]
+		p.rr++
+	case StrategyFailover:
+		picked = available[0]
+	default:
+		for _, e := range available {
+			if picked == nil || e.latencyScore() < picked.latencyScore() {
+				picked = e
+			}
+		}
+	}
+
+	if picked.state == StateHalfOpen {
+		picked.trial = true
+	}
+	return picked
+}
+
+func (e *Endpoint) latencyScore() time.Duration {
+	if e.successes < minLatencySamples {
+		return 0
+	}
+	return e.p95
+}
+
+// Done reports the outcome of a request sent to e. Transport errors and 5xx
+// responses count as failures; a request canceled by the client counts as
+// nothing.
+func (p *Pool) Done(e *Endpoint, latency time.Duration, statusCode int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		e.trial = false
+		return
+	}
+	failed := err != nil || statusCode >= 500
+	e.trial = false
+
+	// A trial request, or one sent while every breaker was open, decides
+	// the breaker on its own. A success starts the endpoint afresh.
+	if e.state != StateClosed {
+		if failed {
+			e.state = StateOpen
+			e.openedAt = p.now()
+		} else {
+			e.state = StateClosed
+			e.results = e.results[:0]
+			e.next = 0
+		}
+		e.record(result{latency: latency, failed: failed}, p.cfg.Window)
+		return
+	}
+
+	e.record(result{latency: latency, failed: failed}, p.cfg.Window)
+	if p.shouldOpen(e) {
+		e.state = StateOpen
+		e.openedAt = p.now()
+	}
+}
+
+func (p *Pool) shouldOpen(e *Endpoint) bool {
+	if p.cfg.ConsecutiveFailures > 0 && e.consecutive >= p.cfg.ConsecutiveFailures {
+		return true
+	}
+	if p.cfg.ErrorRate > 0 && len(e.results) >= max(p.cfg.MinRequests, 1) {
+		return e.errorRate() >= p.cfg.ErrorRate
+	}
+	return false
+}
+
+// record adds r to the window and updates the derived statistics
+func (e *Endpoint) record(r result, window int) {
+	if len(e.results) < window {
+		e.results = append(e.results, r)
+	} else {
+		e.results[e.next] = r
+	}
+	e.next = (e.next + 1) % window
+
+	if r.failed {
+		e.consecutive++
+	} else {
+		e.consecutive = 0
+	}
+
+	latencies := make([]time.Duration, 0, len(e.results))
+	for _, r := range e.results {
+		if !r.failed {
+			latencies = append(latencies, r.latency)
+		}
+	}
+	e.successes = len(latencies)
+	e.p95 = 0
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		e.p95 = latencies[(len(latencies)*95+99)/100-1]
+	}
+}
+
+func (e *Endpoint) errorRate() float64 {
+	if len(e.results) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, r := range e.results {
+		if r.failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(e.results))
+}
+
+// Status returns the health of every endpoint, in configuration order
+func (p *Pool) Status() []EndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]EndpointStatus, len(p.endpoints))
+	for i, e := range p.endpoints {
+		statuses[i] = EndpointStatus{
+			URL:                 e.URL,
+			State:               e.state,
+			Requests:            len(e.results),
+			ErrorRate:           e.errorRate(),
+			P95LatencyMs:        e.p95.Milliseconds(),
+			ConsecutiveFailures: e.consecutive,
+		}
+		if e.state == StateOpen {
+			until := e.openedAt.Add(p.cfg.OpenDuration)
+			statuses[i].OpenUntil = &until
+		}
+	}
+	return statuses
+}
+
+// Pools holds the endpoint pool of each provider, by provider name
+type Pools map[string]*Pool
+
+// Status returns the health of every pool's endpoints, by provider name
+func (p Pools) Status() map[string][]EndpointStatus {
+	statuses := make(map[string][]EndpointStatus, len(p))
+	for name, pool := range p {
+		statuses[name] = pool.Status()
+	}
+	return statuses
+}
@@ -0,0 +1,165 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errConnRefused = errors.New("connection refused")
+
+func newTestPool(strategy Strategy, urls ...string) (*Pool, *time.Time) {
+	p := NewPool(urls, Config{
+		Strategy:            strategy,
+		Window:              10,
+		ConsecutiveFailures: 3,
+		ErrorRate:           0.5,
+		MinRequests:         6,
+		OpenDuration:        30 * time.Second,
+	})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	return p, &now
+}
+
+func TestConsecutiveFailuresOpenBreaker(t *testing.T) {
+	p, now := newTestPool(StrategyFailover, "http://a", "http://b")
+
+	for i := 0; i < 3; i++ {
+		e := p.Pick()
+		if e.URL != "http://a" {
+			t.Fatalf("pick %d = %s before the breaker opened, want http://a", i, e.URL)
+		}
+		p.Done(e, time.Second, 0, errConnRefused)
+	}
+	if got := p.Status()[0].State; got != StateOpen {
+		t.Fatalf("state after 3 failures = %s, want open", got)
+	}
+	if e := p.Pick(); e.URL != "http://b" {
+		t.Errorf("pick while a is open = %s, want http://b", e.URL)
+	}
+
+	// After the open duration one trial request is let through
+	*now = now.Add(31 * time.Second)
+	trial := p.Pick()
+	if trial.URL != "http://a" {
+		t.Fatalf("pick after open duration = %s, want the http://a trial", trial.URL)
+	}
+	if e := p.Pick(); e.URL != "http://b" {
+		t.Errorf("pick during the trial = %s, want http://b", e.URL)
+	}
+	p.Done(trial, time.Second, 503, nil)
+	if got := p.Status()[0].State; got != StateOpen {
+		t.Fatalf("state after a failed trial = %s, want open", got)
+	}
+
+	*now = now.Add(31 * time.Second)
+	trial = p.Pick()
+	p.Done(trial, time.Second, 200, nil)
+	status := p.Status()[0]
+	if status.State != StateClosed || status.Requests != 1 || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after a successful trial = %+v, want closed with a fresh window", status)
+	}
+}
+
+func TestErrorRateOpensBreaker(t *testing.T) {
+	p, _ := newTestPool(StrategyFailover, "http://a")
+	e := p.Pick()
+
+	// Alternating failures never reach 3 in a row, but half the window fails
+	for i := 0; i < 5; i++ {
+		p.Done(e, time.Second, 200+300*(i%2), nil)
+	}
+	if got := p.Status()[0].State; got != StateClosed {
+		t.Fatalf("state below MinRequests = %s, want closed", got)
+	}
+	p.Done(e, time.Second, 500, nil)
+	if got := p.Status()[0]; got.State != StateOpen || got.ErrorRate != 0.5 {
+		t.Errorf("status = %+v, want open at error rate 0.5", got)
+	}
+
+	// 4xx responses are the caller's problem, not the endpoint's
+	p2, _ := newTestPool(StrategyFailover, "http://a")
+	for i := 0; i < 10; i++ {
+		p2.Done(p2.Pick(), time.Second, 429, nil)
+	}
+	if got := p2.Status()[0]; got.State != StateClosed || got.ErrorRate != 0 {
+		t.Errorf("status after 4xx = %+v, want closed", got)
+	}
+}
+
+func TestAllOpenUsesOldest(t *testing.T) {
+	p, now := newTestPool(StrategyFailover, "http://a", "http://b")
+	for _, url := range []string{"http://a", "http://b"} {
+		for i := 0; i < 3; i++ {
+			e := p.Pick()
+			if e.URL != url {
+				t.Fatalf("pick = %s, want %s", e.URL, url)
+			}
+			p.Done(e, time.Second, 502, nil)
+		}
+		*now = now.Add(time.Second)
+	}
+	if e := p.Pick(); e.URL != "http://a" {
+		t.Errorf("pick with every breaker open = %s, want http://a, open longest", e.URL)
+	}
+	if got := p.Status()[1].OpenUntil; got == nil || !got.Equal(now.Add(29*time.Second)) {
+		t.Errorf("http://b open until %v, want %v", got, now.Add(29*time.Second))
+	}
+}
+
+func TestLatencyStrategy(t *testing.T) {
+	p, _ := newTestPool(StrategyLatency, "http://slow", "http://fast")
+	for _, ep := range p.endpoints {
+		latency := 100 * time.Millisecond
+		if ep.URL == "http://slow" {
+			latency = time.Second
+		}
+		for i := 0; i < minLatencySamples; i++ {
+			p.Done(ep, latency, 200, nil)
+		}
+	}
+	if e := p.Pick(); e.URL != "http://fast" {
+		t.Errorf("pick = %s, want http://fast", e.URL)
+	}
+	if got := p.Status()[0].P95LatencyMs; got != 1000 {
+		t.Errorf("slow p95 = %dms, want 1000", got)
+	}
+
+	// Endpoints without enough samples are tried first
+	p2, _ := newTestPool(StrategyLatency, "http://a", "http://b")
+	for i := 0; i < minLatencySamples; i++ {
+		p2.Done(p2.endpoints[0], time.Millisecond, 200, nil)
+	}
+	if e := p2.Pick(); e.URL != "http://b" {
+		t.Errorf("pick = %s, want the unsampled http://b", e.URL)
+	}
+}
+
+func TestRoundRobinAndCancel(t *testing.T) {
+	p, _ := newTestPool(StrategyRoundRobin, "http://a", "http://b")
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[p.Pick().URL]++
+	}
+	if seen["http://a"] != 2 || seen["http://b"] != 2 {
+		t.Errorf("round robin picks = %v", seen)
+	}
+
+	// Canceled requests aren't counted
+	e := p.Pick()
+	p.Done(e, time.Second, 0, context.Canceled)
+	if got := p.Status()[0].Requests + p.Status()[1].Requests; got != 0 {
+		t.Errorf("requests after a cancel = %d, want 0", got)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	if s, err := ParseStrategy("round_robin"); err != nil || s != StrategyRoundRobin {
+		t.Errorf("ParseStrategy(round_robin) = %q, %v", s, err)
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Error("ParseStrategy(random) should fail")
+	}
+}